@@ -13,6 +13,13 @@ type Config struct {
 	Redis    RedisConfig    `yaml:"redis"`
 	Dify     DifyConfig     `yaml:"dify"`
 	MemOS    MemOSConfig    `yaml:"memos"`
+	LLM      LLMConfig      `yaml:"llm"`
+	OpenAI   OpenAIConfig   `yaml:"openai"`
+	Cassette CassetteConfig `yaml:"cassette"`
+	// 记忆检索（按任务输入语义重排）
+	Retrieval RetrievalConfig `yaml:"retrieval"`
+	// 自定义实验组（在内置 A–F 之外新增 G/H 等变体）
+	Groups []GroupConfig `yaml:"groups"`
 }
 
 type ServerConfig struct {
@@ -20,6 +27,10 @@ type ServerConfig struct {
 }
 
 type DatabaseConfig struct {
+	// mysql（默认）/sqlite（纯 Go 嵌入式，单文件，无需安装数据库）/memory（进程内存，不落盘）
+	Driver string `yaml:"driver"`
+	// sqlite 数据文件路径（默认 mem_test.db；":memory:" 为内存库）
+	Path     string `yaml:"path"`
 	Host     string `yaml:"host"`
 	Port     int    `yaml:"port"`
 	User     string `yaml:"user"`
@@ -40,13 +51,21 @@ type DifyConfig struct {
 	APIKey  string `yaml:"api_key"`
 	// 应用类型：workflow/chat/completion（本项目主要支持 workflow）
 	AppType string `yaml:"app_type"`
-	// response_mode: blocking/streaming（后端为简化处理建议 blocking）
+	// response_mode: blocking/streaming（streaming 会解析 SSE 并记录首 token 延迟，适合长 workflow）
 	ResponseMode string `yaml:"response_mode"`
 	// workflow 必填 inputs：system + query（字段名可配置，默认 system/query）
 	WorkflowSystemKey string `yaml:"workflow_system_key"`
 	WorkflowQueryKey  string `yaml:"workflow_query_key"`
 	// Workflow 输出字段名（从 outputs 中取该 key 作为 answer；为空则自动猜测）
 	WorkflowOutputKey string `yaml:"workflow_output_key"`
+	// mock_mode: true 时不调用真实 Dify，改用内置离线模拟模型（确定性、可复现，适合 CI）
+	MockMode bool `yaml:"mock_mode"`
+	// 模拟模型基础出错率（0~1，默认 0）
+	MockErrorRate float64 `yaml:"mock_error_rate"`
+	// 模拟模型遵循注入记忆的概率（0~1，不配置时默认 0.9；显式 0 表示从不遵循）
+	MockObeyMemoryRate *float64 `yaml:"mock_obey_memory_rate"`
+	// 模拟模型随机种子（同一 seed + 同一 prompt => 同一答案）
+	MockSeed int64 `yaml:"mock_seed"`
 }
 
 type MemOSConfig struct {
@@ -58,6 +77,78 @@ type MemOSConfig struct {
 	TopK int `yaml:"top_k"`
 }
 
+// LLMConfig 按服务选择大模型后端：dify/openai/mock（为空默认 dify）
+type LLMConfig struct {
+	AgentProvider      string `yaml:"agent_provider"`
+	ReflectionProvider string `yaml:"reflection_provider"`
+}
+
+// OpenAIConfig OpenAI 兼容协议（/v1/chat/completions）的本地/远程推理服务
+type OpenAIConfig struct {
+	// 例如 http://localhost:8000/v1（不含 /chat/completions）
+	BaseURL string `yaml:"base_url"`
+	// 选填：本地服务通常不校验
+	APIKey string `yaml:"api_key"`
+	Model  string `yaml:"model"`
+	// 选填：作为 system 消息发送
+	SystemPrompt   string  `yaml:"system_prompt"`
+	Temperature    float64 `yaml:"temperature"`
+	MaxTokens      int     `yaml:"max_tokens"`
+	TimeoutSeconds int     `yaml:"timeout_seconds"`
+}
+
+// CassetteConfig 大模型调用录制/回放（用于复现历史 run、重算统计）
+type CassetteConfig struct {
+	// off/record/replay（为空默认 off）
+	Mode string `yaml:"mode"`
+	// record 模式输出目录（默认 outputs），文件名 llm_cassette_run_<run_id>.jsonl
+	Dir string `yaml:"dir"`
+	// replay 模式读取的 cassette 文件
+	ReplayPath string `yaml:"replay_path"`
+	// replay 模式下 prompt 与录制不一致时按 (group, round, 调用序号) 宽松回放；默认 false，不一致即报未命中
+	AllowLoose bool `yaml:"allow_loose"`
+}
+
+// RetrievalConfig 记忆检索：在仓库排序（最近验证 > 版本 > 置信度 > 使用次数）的基础上按任务输入选取记忆
+type RetrievalConfig struct {
+	// recency（默认，与基线 run 一致）：只用仓库排序，不看输入；semantic：相似度 + 仓库排序名次 + 置信度混合重排；
+	// bm25：trigger/lesson 关键词倒排索引打分，命中不足时按仓库排序补齐
+	Mode string `yaml:"mode"`
+	// 向量化方式：hash（默认，本地特征哈希，无需网络）
+	Embedder string `yaml:"embedder"`
+	// hash 向量维度（默认 256）
+	Dim int `yaml:"dim"`
+	// 参与重排的候选数（默认 max(4×memory_limit, 20)）
+	Candidates int `yaml:"candidates"`
+	// 混合权重（全为 0 时使用默认 0.5/0.4/0.1）
+	SimilarityWeight float64 `yaml:"similarity_weight"`
+	RecencyWeight    float64 `yaml:"recency_weight"`
+	ConfidenceWeight float64 `yaml:"confidence_weight"`
+	// BM25 参数（mode=bm25；默认 k1=1.2、b=0.75）
+	BM25K1 float64 `yaml:"bm25_k1"`
+	BM25B  float64 `yaml:"bm25_b"`
+}
+
+// GroupConfig 自定义实验组；base 指定继承的已有组，其余字段只覆盖显式填写的部分
+type GroupConfig struct {
+	Name        string `yaml:"name"`
+	Base        string `yaml:"base"`
+	Description string `yaml:"description"`
+	// none/logs/memory
+	Retrieval string `yaml:"retrieval"`
+	// run/run_global
+	Scope string `yaml:"scope"`
+	// none/run/global/validated
+	Reflection      string `yaml:"reflection"`
+	MemoryLimit     *int   `yaml:"memory_limit"`
+	STMLimit        *int   `yaml:"stm_limit"`
+	Rerank          *bool  `yaml:"rerank"`
+	SelfCheck       *bool  `yaml:"self_check"`
+	MemOS           *bool  `yaml:"memos"`
+	Bandit          *bool  `yaml:"bandit"`
+	ChangeDetection *bool  `yaml:"change_detection"`
+}
+
 func LoadConfig(path string) (*Config, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
@@ -2,44 +2,89 @@ package db
 
 import (
 	"fmt"
-	"log"
+	"strings"
 
 	"mem-test/internal/config"
 	"mem-test/internal/model"
+	"mem-test/internal/repository"
 
+	"github.com/glebarez/sqlite"
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
 )
 
-var DB *gorm.DB
+// database.driver 取值
+const (
+	DriverMySQL  = "mysql"
+	DriverSQLite = "sqlite"
+	DriverMemory = "memory"
+)
+
+// defaultSQLitePath database.driver=sqlite 且未配置 path 时的数据文件
+const defaultSQLitePath = "mem_test.db"
 
-func InitDB(cfg *config.Config) error {
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=%s&parseTime=True&loc=Local",
-		cfg.Database.User,
-		cfg.Database.Password,
-		cfg.Database.Host,
-		cfg.Database.Port,
-		cfg.Database.DBName,
-		cfg.Database.Charset,
-	)
+// Open 按 database.driver 打开数据库、自动迁移并构建仓库；返回的 Store 由调用方注入各服务
+func Open(cfg config.DatabaseConfig) (*repository.Store, error) {
+	var dialector gorm.Dialector
+	switch driver := DriverName(cfg); driver {
+	case DriverMySQL:
+		dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=%s&parseTime=True&loc=Local",
+			cfg.User,
+			cfg.Password,
+			cfg.Host,
+			cfg.Port,
+			cfg.DBName,
+			cfg.Charset,
+		)
+		dialector = mysql.Open(dsn)
+	case DriverSQLite:
+		path := strings.TrimSpace(cfg.Path)
+		if path == "" {
+			path = defaultSQLitePath
+		}
+		dialector = sqlite.Open(path)
+	case DriverMemory:
+		return repository.NewMemoryStore(), nil
+	default:
+		return nil, fmt.Errorf("不支持的数据库驱动: %q（可选 mysql/sqlite/memory）", driver)
+	}
 
-	var err error
-	DB, err = gorm.Open(mysql.Open(dsn), &gorm.Config{})
+	gdb, err := gorm.Open(dialector, &gorm.Config{})
 	if err != nil {
-		return fmt.Errorf("连接数据库失败: %w", err)
+		return nil, fmt.Errorf("连接数据库失败: %w", err)
+	}
+	if dialector.Name() == DriverSQLite {
+		// SQLite 同一时刻只允许一个写者：单连接串行化，避免后台实验与 HTTP 请求并发写时报 database is locked；
+		// 同时保证 ":memory:" 库在所有查询间共享
+		sqlDB, err := gdb.DB()
+		if err != nil {
+			return nil, fmt.Errorf("连接数据库失败: %w", err)
+		}
+		sqlDB.SetMaxOpenConns(1)
 	}
 
 	// 自动迁移
-	if err := DB.AutoMigrate(
+	if err := gdb.AutoMigrate(
 		&model.ExperimentRun{},
+		&model.ExperimentSweep{},
 		&model.Memory{},
 		&model.Task{},
 		&model.Feedback{},
 		&model.TaskLog{},
+		&model.GlobalPoolSnapshot{},
+		&model.GlobalPoolSnapshotItem{},
 	); err != nil {
-		return fmt.Errorf("数据库迁移失败: %w", err)
+		return nil, fmt.Errorf("数据库迁移失败: %w", err)
 	}
 
-	log.Println("数据库初始化成功")
-	return nil
+	return repository.NewGormStore(gdb)
+}
+
+// DriverName 规范化后的 database.driver（未配置时为 mysql）
+func DriverName(cfg config.DatabaseConfig) string {
+	driver := strings.ToLower(strings.TrimSpace(cfg.Driver))
+	if driver == "" {
+		return DriverMySQL
+	}
+	return driver
 }
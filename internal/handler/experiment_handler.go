@@ -1,38 +1,75 @@
 package handler
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
-	"mem-test/internal/db"
 	"mem-test/internal/model"
+	"mem-test/internal/repository"
 	"mem-test/internal/service"
 
 	"github.com/gin-gonic/gin"
-	"gorm.io/gorm"
 )
 
 type ExperimentHandler struct {
+	store  *repository.Store
 	runner *service.ExperimentRunner
 }
 
-func NewExperimentHandler(runner *service.ExperimentRunner) *ExperimentHandler {
-	return &ExperimentHandler{runner: runner}
+func NewExperimentHandler(store *repository.Store, runner *service.ExperimentRunner) *ExperimentHandler {
+	return &ExperimentHandler{store: store, runner: runner}
 }
 
-// GetExperimentStats 获取实验统计数据
-func (h *ExperimentHandler) GetExperimentStats(c *gin.Context) {
-	groupType := c.Query("group_type") // A/B/C/D/E/F
+// groups 组注册表（未初始化 runner 时只有内置 A–F）
+func (h *ExperimentHandler) groups() *service.GroupRegistry {
+	if h.runner == nil {
+		return service.NewGroupRegistry()
+	}
+	return h.runner.Groups()
+}
 
-	var tasks []model.Task
-	query := db.DB.Model(&model.Task{})
+// groupNames 已注册的全部组（内置 A–F + 配置中的自定义组）
+func (h *ExperimentHandler) groupNames() []string {
+	return h.groups().Names()
+}
 
-	if groupType != "" {
-		query = query.Where("group_type = ?", groupType)
+// recoveryK 恢复指标的连对阈值（query: recovery_k，默认 3）
+func recoveryK(c *gin.Context) int {
+	if k, err := strconv.Atoi(strings.TrimSpace(c.Query("recovery_k"))); err == nil && k > 0 {
+		return k
 	}
+	return service.DefaultRecoveryK
+}
 
-	if err := query.Find(&tasks).Error; err != nil {
+// runGroups 某次 run 实际参与的组（旧数据没有 groups_json 时退回全部已注册组）
+func (h *ExperimentHandler) runGroups(run *model.ExperimentRun) []string {
+	var groups []string
+	if err := json.Unmarshal([]byte(run.GroupsJSON), &groups); err != nil || len(groups) == 0 {
+		return h.groupNames()
+	}
+	return groups
+}
+
+// ListGroups 列出已注册的实验组及其策略（检索范围/记忆条数/重排/自检/短期记忆/bandit/反思策略）
+func (h *ExperimentHandler) ListGroups(c *gin.Context) {
+	registry := service.NewGroupRegistry()
+	if h.runner != nil {
+		registry = h.runner.Groups()
+	}
+	c.JSON(http.StatusOK, gin.H{"groups": registry.List()})
+}
+
+// GetExperimentStats 获取实验统计数据
+func (h *ExperimentHandler) GetExperimentStats(c *gin.Context) {
+	groupType := c.Query("group_type") // A/B/C/D/E/F
+
+	tasks, err := h.store.Tasks.Find(c.Request.Context(), repository.TaskFilter{GroupType: groupType})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -47,14 +84,14 @@ func (h *ExperimentHandler) GetExperimentStats(c *gin.Context) {
 	})
 }
 
-// CompareGroups 对比A/B/C组
+// CompareGroups 对比所有已注册的组
 func (h *ExperimentHandler) CompareGroups(c *gin.Context) {
-	groups := []string{"A", "B", "C", "D", "E", "F"}
+	groups := h.groupNames()
 	comparison := make(map[string]interface{})
 
 	for _, group := range groups {
-		var tasks []model.Task
-		if err := db.DB.Where("group_type = ?", group).Find(&tasks).Error; err != nil {
+		tasks, err := h.store.Tasks.Find(c.Request.Context(), repository.TaskFilter{GroupType: group})
+		if err != nil {
 			continue
 		}
 		comparison[group] = h.calculateStats(tasks)
@@ -77,16 +114,15 @@ func (h *ExperimentHandler) GetErrorTrend(c *gin.Context) {
 		taskType = "lottery"
 	}
 	runIDStr := strings.TrimSpace(c.Query("run_id"))
-	var run model.ExperimentRun
-	q := db.DB.Model(&model.ExperimentRun{})
+	var run *model.ExperimentRun
+	var err error
 	if runIDStr != "" {
-		if rid, err := strconv.ParseUint(runIDStr, 10, 64); err == nil && rid > 0 {
-			q = q.Where("id = ?", uint(rid))
-		}
+		rid, _ := strconv.ParseUint(runIDStr, 10, 64)
+		run, err = h.store.Runs.Get(c.Request.Context(), uint(rid))
 	} else {
-		q = q.Where("rule_mode = ? AND task_type = ?", mode, taskType).Order("id DESC")
+		run, err = h.store.Runs.Latest(c.Request.Context(), taskType, mode)
 	}
-	if err := q.First(&run).Error; err != nil {
+	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "未找到对应实验 run"})
 		return
 	}
@@ -96,31 +132,44 @@ func (h *ExperimentHandler) GetErrorTrend(c *gin.Context) {
 		rounds = 0
 	}
 
-	groups := []string{"A", "B", "C", "D", "E", "F"}
+	groups := h.runGroups(run)
 	curves := map[string]service.Curves{}
-	var thresholds []int
+	flagsByGroup := map[string][]int{}
+	var thresholds, ruleVersions []int
 
 	for _, g := range groups {
-		var tasks []model.Task
-		if err := db.DB.Where("run_id = ? AND group_type = ?", run.ID, g).Find(&tasks).Error; err != nil {
+		tasks, err := h.store.Tasks.Find(c.Request.Context(), repository.TaskFilter{RunID: run.ID, GroupType: g, ExcludePhase: model.TaskPhaseEval})
+		if err != nil {
 			continue
 		}
-		flags, ths, _ := service.ExtractRoundFlags(tasks, rounds)
+		flags, ths, vers := service.ExtractRoundFlags(tasks, rounds)
 		if len(thresholds) == 0 {
-			thresholds = ths
+			thresholds, ruleVersions = ths, vers
 		}
 		curves[g] = service.BuildCumulativeCurves(flags, rounds)
+		flagsByGroup[g] = flags
 	}
+	recovery, comparison := service.BuildRecovery(groups, ruleVersions, flagsByGroup, recoveryK(c))
 
 	c.JSON(http.StatusOK, gin.H{
-		"run_id":     run.ID,
-		"rule_mode":  run.RuleMode,
-		"rounds":     rounds,
-		"thresholds": thresholds,
-		"curves":     curves,
+		"run_id":              run.ID,
+		"rule_mode":           run.RuleMode,
+		"rounds":              rounds,
+		"thresholds":          thresholds,
+		"curves":              curves,
+		"recovery":            recovery,
+		"recovery_comparison": comparison,
 	})
 }
 
+// isInvalidRunRequest 实验请求参数错误（返回 400）
+func isInvalidRunRequest(err error) bool {
+	return errors.Is(err, service.ErrUnknownGroup) ||
+		errors.Is(err, service.ErrInvalidAblation) ||
+		errors.Is(err, service.ErrInvalidEvalConfig) ||
+		errors.Is(err, service.ErrInvalidGlobalPool)
+}
+
 // RunExperiment 自动跑一批实验：生成样本 -> 执行 A/B/C -> 自动判题 -> C组自动反思写记忆
 func (h *ExperimentHandler) RunExperiment(c *gin.Context) {
 	if h.runner == nil {
@@ -134,19 +183,212 @@ func (h *ExperimentHandler) RunExperiment(c *gin.Context) {
 		return
 	}
 
-	result, err := h.runner.Run(c.Request.Context(), req)
+	// wait=true：兼容旧行为，同样经后台任务队列执行，请求阻塞到实验结束（请求断开时取消该 run）
+	if c.Query("wait") == "true" {
+		result, err := h.runner.Run(c.Request.Context(), req)
+		if err != nil {
+			if isInvalidRunRequest(err) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"result":          result,
+			"result_path":     result.ResultPath,
+			"conclusion_path": result.ConclusionPath,
+		})
+		return
+	}
+
+	run, err := h.runner.Submit(c.Request.Context(), req)
 	if err != nil {
+		if isInvalidRunRequest(err) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{
+		"run_id":     run.ID,
+		"status":     run.Status,
+		"status_url": fmt.Sprintf("/api/experiments/runs/%d/status", run.ID),
+	})
+}
+
+// GetRunStatus 查询后台实验进度（状态/当前轮次/错误数；结束后附带结果文件路径）
+func (h *ExperimentHandler) GetRunStatus(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的ID"})
+		return
+	}
+
+	run, err := h.store.Runs.Get(c.Request.Context(), uint(id))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "run不存在"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
+	// 总轮次包含评估阶段
+	progress := 0.0
+	if total := run.RunsPerGroup + run.EvalRounds; total > 0 {
+		progress = float64(run.CompletedRounds) / float64(total)
+	}
 	c.JSON(http.StatusOK, gin.H{
-		"result":          result,
-		"result_path":     result.ResultPath,
-		"conclusion_path": result.ConclusionPath,
+		"run_id":           run.ID,
+		"status":           run.Status,
+		"terminal":         run.IsTerminal(),
+		"current_round":    run.CurrentRound,
+		"completed_rounds": run.CompletedRounds,
+		"runs_per_group":   run.RunsPerGroup,
+		"eval_rounds":      run.EvalRounds,
+		"global_pool":      run.GlobalPool,
+		"base_snapshot_id": run.BaseSnapshotID,
+		"end_snapshot_id":  run.EndSnapshotID,
+		"progress":         progress,
+		"error_count":      run.ErrorCount,
+		"error_message":    run.ErrorMessage,
+		"started_at":       run.StartedAt,
+		"finished_at":      run.FinishedAt,
+		"result_path":      run.ResultPath,
+		"conclusion_path":  run.ConclusionPath,
 	})
 }
 
+// StreamRunEvents 以 SSE 推送实验进度：先回放已发生的事件，再实时推送
+// （round：组/轮次/判题结果/注入记忆/反思结果；epoch：F 组切换 epoch；status：状态变化）
+// run 不在本进程执行时只推送一次当前状态后结束；客户端消费过慢时推送 dropped 后断开，重连即可回放。
+func (h *ExperimentHandler) StreamRunEvents(c *gin.Context) {
+	if h.runner == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "experiment runner not initialized"})
+		return
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的ID"})
+		return
+	}
+
+	history, events, unsubscribe, live := h.runner.SubscribeProgress(uint(id))
+	defer unsubscribe()
+
+	if !live {
+		run, err := h.store.Runs.Get(c.Request.Context(), uint(id))
+		if err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "run不存在"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		history = []service.ExperimentEvent{{
+			Type:            service.ExperimentEventStatus,
+			RunID:           run.ID,
+			Status:          run.Status,
+			CompletedRounds: run.CompletedRounds,
+			Time:            run.UpdatedAt,
+		}}
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	// 关闭 nginx 等反向代理的缓冲
+	c.Header("X-Accel-Buffering", "no")
+
+	for _, ev := range history {
+		c.SSEvent(ev.Type, ev)
+	}
+	c.Writer.Flush()
+	if !live {
+		return
+	}
+
+	heartbeat := time.NewTicker(15 * time.Second)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case ev, ok := <-events:
+			if !ok {
+				return
+			}
+			c.SSEvent(ev.Type, ev)
+			c.Writer.Flush()
+		case <-heartbeat.C:
+			_, _ = fmt.Fprint(c.Writer, ": ping\n\n")
+			c.Writer.Flush()
+		}
+	}
+}
+
+// ResumeRun 从中断处续跑（服务崩溃/取消/失败后），后台执行，立即返回
+func (h *ExperimentHandler) ResumeRun(c *gin.Context) {
+	if h.runner == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "experiment runner not initialized"})
+		return
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的ID"})
+		return
+	}
+
+	run, err := h.runner.Resume(c.Request.Context(), uint(id))
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "run不存在"})
+		case errors.Is(err, service.ErrRunActive), errors.Is(err, service.ErrRunAlreadyDone):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{
+		"run_id":     run.ID,
+		"status":     run.Status,
+		"status_url": fmt.Sprintf("/api/experiments/runs/%d/status", run.ID),
+	})
+}
+
+// CancelRun 取消排队中/执行中的实验
+func (h *ExperimentHandler) CancelRun(c *gin.Context) {
+	if h.runner == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "experiment runner not initialized"})
+		return
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的ID"})
+		return
+	}
+
+	if err := h.runner.Cancel(c.Request.Context(), uint(id)); err != nil {
+		switch {
+		case errors.Is(err, repository.ErrNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "run不存在"})
+		case errors.Is(err, service.ErrRunNotCancellable):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "已请求取消", "run_id": id})
+}
+
 // CompareGroupsByModes 区分高频/低频规则变更两种模式，输出组间对比 + 正确率变化曲线 + 试错次数
 func (h *ExperimentHandler) CompareGroupsByModes(c *gin.Context) {
 	modes := []string{"low", "high"}
@@ -155,53 +397,58 @@ func (h *ExperimentHandler) CompareGroupsByModes(c *gin.Context) {
 		taskType = "lottery"
 	}
 	resp := map[string]interface{}{}
+	k := recoveryK(c)
 
 	for _, mode := range modes {
-		var run model.ExperimentRun
-		if err := db.DB.Where("rule_mode = ? AND task_type = ?", mode, taskType).Order("id DESC").First(&run).Error; err != nil {
+		run, err := h.store.Runs.Latest(c.Request.Context(), taskType, mode)
+		if err != nil {
 			continue
 		}
 		rounds := run.RunsPerGroup
-		groups := []string{"A", "B", "C", "D", "E", "F"}
+		groups := h.runGroups(run)
 
 		modeCurve := service.ModeCurve{
-			RunID:                  run.ID,
-			RuleMode:               mode,
-			Rounds:                 rounds,
-			Groups:                 groups,
-			Overall:                map[string]service.GroupStats{},
-			Curves:                 map[string]service.Curves{},
-			FirstErrorRound:        map[string]int{},
-			MemoryChangeStartRound: -1,
+			RunID:                    run.ID,
+			RuleMode:                 mode,
+			Rounds:                   rounds,
+			Groups:                   groups,
+			Overall:                  map[string]service.GroupStats{},
+			Curves:                   map[string]service.Curves{},
+			FirstErrorRound:          map[string]int{},
+			MemoryChangeStartRound:   -1,
+			MemoryChangesByGroup:     map[string][]int{},
+			MemoryChangeStartByGroup: map[string]int{},
 		}
 
 		// overall stats（只统计本 run）
 		for _, g := range groups {
-			var tasks []model.Task
-			_ = db.DB.Where("run_id = ? AND group_type = ?", run.ID, g).Find(&tasks).Error
+			tasks, _ := h.store.Tasks.Find(c.Request.Context(), repository.TaskFilter{RunID: run.ID, GroupType: g, ExcludePhase: model.TaskPhaseEval})
 			modeCurve.Overall[g] = calcStatsFromTasks(tasks)
 		}
 
 		// curves + thresholds/ruleVersions（取 A 组作为基准提取规则序列）
-		var aTasks []model.Task
-		_ = db.DB.Where("run_id = ? AND group_type = ?", run.ID, "A").Find(&aTasks).Error
+		aTasks, _ := h.store.Tasks.Find(c.Request.Context(), repository.TaskFilter{RunID: run.ID, GroupType: "A"})
 		_, ths, vers := service.ExtractRoundFlags(aTasks, rounds)
 		modeCurve.Threshold = ths
 
-		var cTasks []model.Task
-		_ = db.DB.Where("run_id = ? AND group_type = ?", run.ID, "C").Find(&cTasks).Error
+		cTasks, _ := h.store.Tasks.Find(c.Request.Context(), repository.TaskFilter{RunID: run.ID, GroupType: "C"})
 		cFlags, _, _ := service.ExtractRoundFlags(cTasks, rounds)
 		modeCurve.TrialAndError = service.ComputeTrialAndErrorC(vers, cFlags)
 		modeCurve.MemoryChangesPerRound = append([]int(nil), cFlags...)
 		modeCurve.MemoryChangeStartRound = service.FirstErrorRound(cFlags)
 
+		flagsByGroup := map[string][]int{}
 		for _, g := range groups {
-			var tasks []model.Task
-			_ = db.DB.Where("run_id = ? AND group_type = ?", run.ID, g).Find(&tasks).Error
+			tasks, _ := h.store.Tasks.Find(c.Request.Context(), repository.TaskFilter{RunID: run.ID, GroupType: g, ExcludePhase: model.TaskPhaseEval})
 			flags, _, _ := service.ExtractRoundFlags(tasks, rounds)
 			modeCurve.Curves[g] = service.BuildCumulativeCurves(flags, rounds)
 			modeCurve.FirstErrorRound[g] = service.FirstErrorRound(flags)
+			changes := service.MemoryChangeFlags(h.groups().Resolve(g), flags)
+			modeCurve.MemoryChangesByGroup[g] = changes
+			modeCurve.MemoryChangeStartByGroup[g] = service.FirstErrorRound(changes)
+			flagsByGroup[g] = flags
 		}
+		modeCurve.Recovery, modeCurve.RecoveryComparison = service.BuildRecovery(groups, vers, flagsByGroup, k)
 
 		resp[mode] = modeCurve
 	}
@@ -232,25 +479,7 @@ func calcStatsFromTasks(tasks []model.Task) service.GroupStats {
 
 // ResetAll 重置实验数据（清空 tasks/feedbacks/memories/task_logs/experiment_runs）
 func (h *ExperimentHandler) ResetAll(c *gin.Context) {
-	err := db.DB.Transaction(func(tx *gorm.DB) error {
-		if err := tx.Session(&gorm.Session{AllowGlobalUpdate: true}).Unscoped().Delete(&model.TaskLog{}).Error; err != nil {
-			return err
-		}
-		if err := tx.Session(&gorm.Session{AllowGlobalUpdate: true}).Unscoped().Delete(&model.Feedback{}).Error; err != nil {
-			return err
-		}
-		if err := tx.Session(&gorm.Session{AllowGlobalUpdate: true}).Unscoped().Delete(&model.Task{}).Error; err != nil {
-			return err
-		}
-		if err := tx.Session(&gorm.Session{AllowGlobalUpdate: true}).Unscoped().Delete(&model.Memory{}).Error; err != nil {
-			return err
-		}
-		if err := tx.Session(&gorm.Session{AllowGlobalUpdate: true}).Unscoped().Delete(&model.ExperimentRun{}).Error; err != nil {
-			return err
-		}
-		return nil
-	})
-	if err != nil {
+	if err := h.store.Reset(c.Request.Context()); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -266,6 +495,10 @@ func (h *ExperimentHandler) calculateStats(tasks []model.Task) map[string]interf
 		"total_tokens": 0,
 		"avg_tokens":   0,
 		"error_rate":   0.0,
+		// prompt/completion 拆分；estimated_tokens 为本地估算补全的任务数
+		"prompt_tokens":     0,
+		"completion_tokens": 0,
+		"estimated_tokens":  0,
 	}
 
 	if len(tasks) == 0 {
@@ -274,6 +507,11 @@ func (h *ExperimentHandler) calculateStats(tasks []model.Task) map[string]interf
 
 	for _, task := range tasks {
 		stats["total_tokens"] = stats["total_tokens"].(int) + task.TokenCount
+		stats["prompt_tokens"] = stats["prompt_tokens"].(int) + task.PromptTokens
+		stats["completion_tokens"] = stats["completion_tokens"].(int) + task.CompletionTokens
+		if task.TokenEstimated {
+			stats["estimated_tokens"] = stats["estimated_tokens"].(int) + 1
+		}
 
 		if task.IsCorrect == nil {
 			stats["unknown"] = stats["unknown"].(int) + 1
@@ -302,3 +540,250 @@ func (h *ExperimentHandler) calculateStats(tasks []model.Task) map[string]interf
 
 	return stats
 }
+
+// RunSweep 提交矩阵实验（task_types × rule_modes × seeds），后台逐个执行，立即返回 sweep 与各格子的 run_id
+func (h *ExperimentHandler) RunSweep(c *gin.Context) {
+	if h.runner == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "experiment runner not initialized"})
+		return
+	}
+
+	var req service.ExperimentSweepRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	sweep, runIDs, err := h.runner.SubmitSweep(c.Request.Context(), req)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidSweepRequest) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{
+		"sweep_id":   sweep.ID,
+		"status":     sweep.Status,
+		"total_runs": sweep.TotalRuns,
+		"run_ids":    runIDs,
+		"status_url": fmt.Sprintf("/api/experiments/sweeps/%d", sweep.ID),
+		"report_url": fmt.Sprintf("/api/experiments/sweeps/%d/report", sweep.ID),
+	})
+}
+
+// GetSweep 查询矩阵实验进度及各格子 run 的状态
+func (h *ExperimentHandler) GetSweep(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的ID"})
+		return
+	}
+
+	sweep, err := h.store.Sweeps.Get(c.Request.Context(), uint(id))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "sweep不存在"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	runs, err := h.store.Runs.ListBySweep(c.Request.Context(), sweep.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	items := make([]gin.H, 0, len(runs))
+	for _, run := range runs {
+		items = append(items, gin.H{
+			"run_id":           run.ID,
+			"task_type":        run.TaskType,
+			"rule_mode":        run.RuleMode,
+			"seed":             run.Seed,
+			"status":           run.Status,
+			"completed_rounds": run.CompletedRounds,
+			"error_count":      run.ErrorCount,
+			"result_path":      run.ResultPath,
+		})
+	}
+	progress := 0.0
+	if sweep.TotalRuns > 0 {
+		progress = float64(sweep.CompletedRuns) / float64(sweep.TotalRuns)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"sweep":    sweep,
+		"terminal": sweep.IsTerminal(),
+		"progress": progress,
+		"runs":     items,
+	})
+}
+
+// GetSweepReport 按当前已完成的 run 重新生成汇总报告（sweep 未结束时为部分结果）
+func (h *ExperimentHandler) GetSweepReport(c *gin.Context) {
+	if h.runner == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "experiment runner not initialized"})
+		return
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的ID"})
+		return
+	}
+
+	report, err := h.runner.BuildSweepReport(c.Request.Context(), uint(id))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "sweep不存在"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if c.Query("format") == "markdown" {
+		c.Data(http.StatusOK, "text/markdown; charset=utf-8", []byte(service.RenderSweepMarkdown(report)))
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// GetMetaAnalysis 跨 run 汇总：按 task_type / rule_mode / 创建日期筛选已完成的 run，
+// 对各组错误率与组间对比做固定/随机效应 meta 分析（format=markdown 返回森林图风格的表）
+func (h *ExperimentHandler) GetMetaAnalysis(c *gin.Context) {
+	if h.runner == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "experiment runner not initialized"})
+		return
+	}
+	req := service.MetaAnalysisRequest{
+		TaskType: strings.TrimSpace(c.Query("task_type")),
+		RuleMode: strings.TrimSpace(c.Query("rule_mode")),
+	}
+	if req.TaskType == "" {
+		req.TaskType = "lottery"
+	}
+	var err error
+	if req.From, err = parseMetaTime(c.Query("from"), false); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.To, err = parseMetaTime(c.Query("to"), true); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	for _, s := range strings.Split(c.Query("contrasts"), ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			req.Contrasts = append(req.Contrasts, s)
+		}
+	}
+
+	report, err := h.runner.BuildMetaAnalysis(c.Request.Context(), req)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidMetaQuery) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if c.Query("format") == "markdown" {
+		c.Data(http.StatusOK, "text/markdown; charset=utf-8", []byte(service.RenderMetaAnalysisMarkdown(report)))
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// parseMetaTime 解析 2006-01-02 或 RFC3339；只给日期的 to 视为包含当天
+func parseMetaTime(s string, end bool) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", s, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: 日期 %q 应为 2006-01-02 或 RFC3339", service.ErrInvalidMetaQuery, s)
+	}
+	if end {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+// CancelSweep 取消矩阵实验中所有未结束的 run
+func (h *ExperimentHandler) CancelSweep(c *gin.Context) {
+	if h.runner == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "experiment runner not initialized"})
+		return
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的ID"})
+		return
+	}
+
+	if err := h.runner.CancelSweep(c.Request.Context(), uint(id)); err != nil {
+		switch {
+		case errors.Is(err, repository.ErrNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "sweep不存在"})
+		case errors.Is(err, service.ErrSweepNotCancellable):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "已请求取消", "sweep_id": id})
+}
+
+// ListPoolSnapshots 列出全局记忆池快照（?limit=，默认 50）
+func (h *ExperimentHandler) ListPoolSnapshots(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	snaps, err := service.ListGlobalPoolSnapshots(c.Request.Context(), h.store, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"snapshots": snaps})
+}
+
+// GetPoolSnapshot 快照详情（含全部记忆条目）
+func (h *ExperimentHandler) GetPoolSnapshot(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的ID"})
+		return
+	}
+	snap, items, err := service.GetGlobalPoolSnapshot(c.Request.Context(), h.store, uint(id))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "快照不存在"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"snapshot": snap, "memories": items})
+}
+
+// CreatePoolSnapshot 手动对共享全局池打快照（如在一组 run 开始前固定“先验经验”）
+func (h *ExperimentHandler) CreatePoolSnapshot(c *gin.Context) {
+	var req struct {
+		Note string `json:"note"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	snap, err := service.CreateGlobalPoolSnapshot(c.Request.Context(), h.store, 0, 0, 0, req.Note)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"snapshot": snap})
+}
@@ -1,34 +1,35 @@
 package handler
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
+	"mem-test/internal/repository"
+	"mem-test/internal/service"
+
 	"github.com/gin-gonic/gin"
-	"mem-test/internal/db"
-	"mem-test/internal/model"
 )
 
 type MemoryHandler struct {
+	store *repository.Store
 }
 
-func NewMemoryHandler() *MemoryHandler {
-	return &MemoryHandler{}
+func NewMemoryHandler(store *repository.Store) *MemoryHandler {
+	return &MemoryHandler{store: store}
 }
 
 // ListMemories 列出所有记忆
 func (h *MemoryHandler) ListMemories(c *gin.Context) {
-	var memories []model.Memory
-	
-	query := db.DB.Order("created_at DESC")
-	
-	if limit := c.Query("limit"); limit != "" {
-		if l, err := strconv.Atoi(limit); err == nil {
-			query = query.Limit(l)
+	limit := 0
+	if v := c.Query("limit"); v != "" {
+		if l, err := strconv.Atoi(v); err == nil {
+			limit = l
 		}
 	}
 
-	if err := query.Find(&memories).Error; err != nil {
+	memories, err := h.store.Memories.List(c.Request.Context(), limit)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -40,10 +41,14 @@ func (h *MemoryHandler) ListMemories(c *gin.Context) {
 
 // GetMemory 获取单个记忆
 func (h *MemoryHandler) GetMemory(c *gin.Context) {
-	id := c.Param("id")
-	
-	var memory model.Memory
-	if err := db.DB.First(&memory, id).Error; err != nil {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的ID"})
+		return
+	}
+
+	memory, err := h.store.Memories.Get(c.Request.Context(), uint(id))
+	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "记忆不存在"})
 		return
 	}
@@ -53,11 +58,36 @@ func (h *MemoryHandler) GetMemory(c *gin.Context) {
 	})
 }
 
+// GetMemoryHistory 记忆的完整演化链（从首个版本到最新版本）及相邻版本 trigger/lesson 的差异
+func (h *MemoryHandler) GetMemoryHistory(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的ID"})
+		return
+	}
+
+	history, err := service.GetMemoryHistory(c.Request.Context(), h.store, uint(id))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "记忆不存在"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, history)
+}
+
 // DeleteMemory 删除记忆
 func (h *MemoryHandler) DeleteMemory(c *gin.Context) {
-	id := c.Param("id")
-	
-	if err := db.DB.Delete(&model.Memory{}, id).Error; err != nil {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的ID"})
+		return
+	}
+
+	if err := h.store.Memories.Delete(c.Request.Context(), uint(id)); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
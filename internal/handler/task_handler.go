@@ -5,21 +5,21 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"mem-test/internal/db"
 	"mem-test/internal/model"
+	"mem-test/internal/repository"
 	"mem-test/internal/service"
-
-	"gorm.io/gorm"
 )
 
 type TaskHandler struct {
+	store             *repository.Store
 	agentService      *service.AgentService
 	coachService      *service.CoachService
 	reflectionService *service.ReflectionService
 }
 
-func NewTaskHandler(agentService *service.AgentService, coachService *service.CoachService, reflectionService *service.ReflectionService) *TaskHandler {
+func NewTaskHandler(store *repository.Store, agentService *service.AgentService, coachService *service.CoachService, reflectionService *service.ReflectionService) *TaskHandler {
 	return &TaskHandler{
+		store:             store,
 		agentService:      agentService,
 		coachService:      coachService,
 		reflectionService: reflectionService,
@@ -91,20 +91,19 @@ func (h *TaskHandler) AutoJudgeAndReflect(c *gin.Context) {
 	}
 
 	// 获取任务
-	var task model.Task
-	if err := db.DB.First(&task, req.TaskID).Error; err != nil {
+	task, err := h.store.Tasks.Get(c.Request.Context(), req.TaskID)
+	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "任务不存在"})
 		return
 	}
 
 	// 自动判断（规则引擎）
 	var feedback *model.Feedback
-	var err error
 	switch task.TaskType {
 	case "lottery_v2":
-		feedback, err = h.coachService.JudgeLotteryV2Task(c.Request.Context(), &task)
+		feedback, err = h.coachService.JudgeLotteryV2Task(c.Request.Context(), task)
 	default:
-		feedback, err = h.coachService.JudgeLotteryTask(c.Request.Context(), &task)
+		feedback, err = h.coachService.JudgeLotteryTask(c.Request.Context(), task)
 	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -129,14 +128,7 @@ func (h *TaskHandler) AutoJudgeAndReflect(c *gin.Context) {
 	if feedback.Type == "correct" && task.MemoryIDs != "" {
 		ids := service.ParseMemoryIDs(task.MemoryIDs)
 		if len(ids) > 0 {
-			now := time.Now()
-			_ = db.DB.WithContext(c.Request.Context()).
-				Model(&model.Memory{}).
-				Where("id IN ?", ids).
-				Updates(map[string]interface{}{
-					"last_verified_at": now,
-					"confidence":       gorm.Expr("LEAST(confidence + ?, 1)", 0.01),
-				}).Error
+			_ = h.store.Memories.MarkVerified(c.Request.Context(), ids, time.Now(), 0.01)
 		}
 	}
 
@@ -159,13 +151,13 @@ func (h *TaskHandler) ReflectAndSave(c *gin.Context) {
 	}
 
 	// 获取反馈
-	var feedback model.Feedback
-	if err := db.DB.First(&feedback, req.FeedbackID).Error; err != nil {
+	feedback, err := h.store.Feedbacks.Get(c.Request.Context(), req.FeedbackID)
+	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "反馈不存在"})
 		return
 	}
 
-	memory, err := h.reflectionService.ReflectAndSaveMemory(c.Request.Context(), req.TaskID, &feedback)
+	memory, err := h.reflectionService.ReflectAndSaveMemory(c.Request.Context(), req.TaskID, feedback)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
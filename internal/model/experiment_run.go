@@ -19,7 +19,57 @@ type ExperimentRun struct {
 	GroupsJSON   string `gorm:"type:text" json:"groups_json"`
 	// 规则变更模式：none/low/high
 	RuleMode string `gorm:"type:varchar(20);index" json:"rule_mode"`
+	// 任务 action（与 seed 一起决定输入序列，resume 时用于重建）
+	Action string `gorm:"type:varchar(50)" json:"action"`
+	// 消融开关（group -> 组件开关 JSON；为空表示各组按默认策略）
+	AblationsJSON string `gorm:"type:text" json:"ablations_json"`
+	// 评估阶段：训练 runs_per_group 轮后冻结记忆，再跑 eval_rounds 轮留出集（0 表示不评估）
+	EvalRounds int   `json:"eval_rounds"`
+	EvalSeed   int64 `json:"eval_seed"`
+	// 留出集分布：same（同分布、不同 seed）/boundary（集中在规则门槛附近）
+	EvalDistribution string `gorm:"type:varchar(20)" json:"eval_distribution"`
+	// 全局池来源：live（共享全局池）/snapshot（从快照导入隔离池）/empty（空隔离池冷启动）
+	GlobalPool string `gorm:"type:varchar(20)" json:"global_pool"`
+	// global_pool=snapshot 时的起始快照
+	BaseSnapshotID uint `gorm:"index" json:"base_snapshot_id"`
+	// run 结束时为其所用全局池生成的快照（0 表示未生成）
+	EndSnapshotID uint `json:"end_snapshot_id"`
+	// 记忆检索方式：recency / bm25 / semantic:<embedder>（创建 run 时的服务配置；空表示该字段上线前的 run，即 recency）
+	Retrieval string `gorm:"type:varchar(50)" json:"retrieval"`
+	// cassette replay 中 prompt 不一致、按位置宽松回放的调用次数（cassette.allow_loose；非 0 表示不是逐位复现）
+	CassetteLooseHits int `json:"cassette_loose_hits"`
+	// 所属矩阵实验（0 表示单独提交的 run）
+	SweepID uint `gorm:"index" json:"sweep_id"`
+	// 运行状态：queued/running/done/failed/cancelled
+	Status string `gorm:"type:varchar(20);index" json:"status"`
+	// 当前执行到的轮次（从 0 开始）
+	CurrentRound int `json:"current_round"`
+	// 已完成轮次（取消时为部分结果的轮数）
+	CompletedRounds int `json:"completed_rounds"`
+	// 执行/判题/反思失败次数（对应结果中的 errors）
+	ErrorCount int `json:"error_count"`
+	// failed 时的错误信息
+	ErrorMessage string     `gorm:"type:text" json:"error_message"`
+	StartedAt    *time.Time `json:"started_at"`
+	FinishedAt   *time.Time `json:"finished_at"`
 	// 备注/结论文件路径
 	ResultPath     string `gorm:"type:varchar(500)" json:"result_path"`
 	ConclusionPath string `gorm:"type:varchar(500)" json:"conclusion_path"`
 }
+
+const (
+	ExperimentRunStatusQueued    = "queued"
+	ExperimentRunStatusRunning   = "running"
+	ExperimentRunStatusDone      = "done"
+	ExperimentRunStatusFailed    = "failed"
+	ExperimentRunStatusCancelled = "cancelled"
+)
+
+// IsTerminal 是否为终态（done/failed/cancelled）
+func (r *ExperimentRun) IsTerminal() bool {
+	switch r.Status {
+	case ExperimentRunStatusDone, ExperimentRunStatusFailed, ExperimentRunStatusCancelled:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,43 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ExperimentSweep 一次 task_type × rule_mode × seed 矩阵实验；每个格子对应一个 ExperimentRun（通过 sweep_id 关联）
+type ExperimentSweep struct {
+	ID        uint           `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+
+	TaskTypesJSON string `gorm:"type:text" json:"task_types_json"`
+	RuleModesJSON string `gorm:"type:text" json:"rule_modes_json"`
+	SeedsJSON     string `gorm:"type:text" json:"seeds_json"`
+	GroupsJSON    string `gorm:"type:text" json:"groups_json"`
+	RunsPerGroup  int    `json:"runs_per_group"`
+	Action        string `gorm:"type:varchar(50)" json:"action"`
+	// 各 run 的全局池来源（snapshot/empty）；未指定时为提交时对共享全局池生成的快照
+	GlobalPool           string `gorm:"type:varchar(20)" json:"global_pool"`
+	GlobalPoolSnapshotID uint   `json:"global_pool_snapshot_id"`
+	// 运行状态：queued/running/done/failed/cancelled（与 ExperimentRun 共用取值）
+	Status        string     `gorm:"type:varchar(20);index" json:"status"`
+	TotalRuns     int        `json:"total_runs"`
+	CompletedRuns int        `json:"completed_runs"`
+	StartedAt     *time.Time `json:"started_at"`
+	FinishedAt    *time.Time `json:"finished_at"`
+	// 汇总报告文件路径
+	ReportPath         string `gorm:"type:varchar(500)" json:"report_path"`
+	ReportMarkdownPath string `gorm:"type:varchar(500)" json:"report_markdown_path"`
+}
+
+// IsTerminal 是否为终态（done/failed/cancelled）
+func (s *ExperimentSweep) IsTerminal() bool {
+	switch s.Status {
+	case ExperimentRunStatusDone, ExperimentRunStatusFailed, ExperimentRunStatusCancelled:
+		return true
+	}
+	return false
+}
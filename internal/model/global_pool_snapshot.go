@@ -0,0 +1,44 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// GlobalPoolSnapshot 全局记忆池快照（跨 run 迁移实验：新 run 可从指定快照起步，保证“先验经验”可控）
+type GlobalPoolSnapshot struct {
+	ID        uint           `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+
+	// 生成快照的 run（0 表示手动对共享全局池打快照）
+	SourceRunID uint `gorm:"index" json:"source_run_id"`
+	// 快照来源池：0 为共享全局池，>0 为该 run 的隔离全局池
+	PoolRunID uint `json:"pool_run_id"`
+	// 快照来源 run 自身的起始快照（形成迁移链）
+	ParentSnapshotID uint   `gorm:"index" json:"parent_snapshot_id"`
+	MemoryCount      int    `json:"memory_count"`
+	Note             string `gorm:"type:varchar(500)" json:"note"`
+}
+
+// GlobalPoolSnapshotItem 快照中的一条全局记忆（拷贝生成快照时的字段值）
+type GlobalPoolSnapshotItem struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+
+	SnapshotID     uint       `gorm:"not null;index" json:"snapshot_id"`
+	SourceMemoryID uint       `json:"source_memory_id"`
+	Trigger        string     `gorm:"column:trigger;type:varchar(500);not null" json:"trigger"`
+	TriggerKey     string     `gorm:"type:varchar(200);not null;default:''" json:"trigger_key"`
+	Lesson         string     `gorm:"type:text;not null" json:"lesson"`
+	DerivedFrom    string     `gorm:"type:varchar(200)" json:"derived_from"`
+	ApplyTo        string     `gorm:"type:varchar(200)" json:"apply_to"`
+	Confidence     float64    `gorm:"type:decimal(3,2);default:0.5" json:"confidence"`
+	Version        int        `gorm:"default:1" json:"version"`
+	UseCount       int        `gorm:"default:0" json:"use_count"`
+	FailureCount   int        `gorm:"default:0" json:"failure_count"`
+	LastVerifiedAt *time.Time `json:"last_verified_at"`
+	Deprecated     bool       `gorm:"default:false" json:"deprecated"`
+}
@@ -31,6 +31,19 @@ type Memory struct {
 	// 来源（从哪个反馈中得出）
 	DerivedFrom string `gorm:"type:varchar(200)" json:"derived_from"`
 
+	// 演化谱系（0 表示无）：
+	// ParentID 同一 trigger_key 的上一版本（run 内演化 / 全局池内演化 / 快照导入后按版本重新链接）
+	ParentID uint `gorm:"index;default:0" json:"parent_id"`
+	// SourceMemoryID 全局记录由哪条 run 内记忆固化而来；快照导入的记录指向快照中的原记录
+	SourceMemoryID uint `gorm:"index;default:0" json:"source_memory_id"`
+	// SourceTaskID / SourceFeedbackID 触发这次反思的任务与反馈
+	SourceTaskID     uint `gorm:"index;default:0" json:"source_task_id"`
+	SourceFeedbackID uint `gorm:"default:0" json:"source_feedback_id"`
+
+	// 全局池归属（仅 run_id=0 且 derived_from=global|... 的记录有意义）：
+	// 0 为共享全局池；>0 为该 run 的隔离全局池（从快照导入或空池冷启动后固化所得）
+	PoolRunID uint `gorm:"index;default:0" json:"pool_run_id"`
+
 	// 适用范围
 	ApplyTo string `gorm:"type:varchar(200)" json:"apply_to"`
 
@@ -60,6 +73,12 @@ type Memory struct {
 
 	// DeprecatedAt：标记废弃的时间
 	DeprecatedAt *time.Time `gorm:"index" json:"deprecated_at"`
+
+	// Embedding trigger+lesson 的向量（检索时与任务输入做余弦相似度；首次被检索时按当前 embedder 补齐）
+	Embedding Vector `gorm:"type:text" json:"-"`
+
+	// EmbeddingModel 生成 Embedding 的 embedder 标识（如 hash-256）；与当前 embedder 不一致时重算
+	EmbeddingModel string `gorm:"type:varchar(50)" json:"embedding_model"`
 }
 
 // Task 任务历史表
@@ -89,6 +108,11 @@ type Task struct {
 
 	// Token消耗
 	TokenCount int `json:"token_count"`
+	// prompt/completion 拆分（workflow 模式服务端只给 total 时按本地估算拆分）
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	// token 是否（部分）由本地估算得出
+	TokenEstimated bool `gorm:"default:false" json:"token_estimated"`
 
 	// 实验组（A/B/C）
 	GroupType string `gorm:"type:varchar(10);index" json:"group_type"`
@@ -104,8 +128,16 @@ type Task struct {
 
 	// 当前轮次使用的规则门槛（仅 lottery 场景用；非实验任务默认为 0）
 	RuleThreshold int `gorm:"index" json:"rule_threshold"`
+
+	// 实验阶段：train（默认，可写记忆）/eval（冻结记忆后的留出集评估）
+	Phase string `gorm:"type:varchar(10);index;default:train" json:"phase"`
 }
 
+const (
+	TaskPhaseTrain = "train"
+	TaskPhaseEval  = "eval"
+)
+
 // Feedback 反馈记录表
 type Feedback struct {
 	ID        uint           `gorm:"primarykey" json:"id"`
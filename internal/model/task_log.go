@@ -22,4 +22,14 @@ type TaskLog struct {
 	SystemPrompt string `gorm:"type:longtext" json:"system_prompt"`
 	QueryInput   string `gorm:"type:longtext" json:"query_input"`
 	MemoryIDs    string `gorm:"type:varchar(500)" json:"memory_ids"`
+
+	// 首 token 延迟（毫秒；仅 streaming 模式可得，blocking 为 0）
+	TimeToFirstTokenMs int64 `json:"time_to_first_token_ms"`
+
+	// token 拆分与 workflow 执行统计（E/F 两阶段为两次调用之和）
+	PromptTokens        int     `json:"prompt_tokens"`
+	CompletionTokens    int     `json:"completion_tokens"`
+	TokenEstimated      bool    `gorm:"default:false" json:"token_estimated"`
+	WorkflowSteps       int     `json:"workflow_steps"`
+	WorkflowElapsedTime float64 `json:"workflow_elapsed_time"`
 }
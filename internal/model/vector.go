@@ -0,0 +1,48 @@
+package model
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// Vector 定长向量，以 JSON 数组存入 text 列（MySQL / SQLite 通用）
+type Vector []float32
+
+// Value 实现 driver.Valuer；空向量存 NULL
+func (v Vector) Value() (driver.Value, error) {
+	if len(v) == 0 {
+		return nil, nil
+	}
+	b, err := json.Marshal([]float32(v))
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// Scan 实现 sql.Scanner
+func (v *Vector) Scan(src interface{}) error {
+	var raw []byte
+	switch s := src.(type) {
+	case nil:
+		*v = nil
+		return nil
+	case []byte:
+		raw = s
+	case string:
+		raw = []byte(s)
+	default:
+		return fmt.Errorf("无法解析向量列: %T", src)
+	}
+	if len(raw) == 0 {
+		*v = nil
+		return nil
+	}
+	var out []float32
+	if err := json.Unmarshal(raw, &out); err != nil {
+		return fmt.Errorf("解析向量失败: %w", err)
+	}
+	*v = out
+	return nil
+}
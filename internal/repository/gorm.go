@@ -0,0 +1,603 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"mem-test/internal/model"
+
+	"gorm.io/gorm"
+)
+
+// dialect 各数据库在标量取小/取大上的差异（MySQL: LEAST/GREATEST；SQLite: 多参数 MIN/MAX）
+type dialect struct {
+	least    string
+	greatest string
+}
+
+var (
+	mysqlDialect  = dialect{least: "LEAST", greatest: "GREATEST"}
+	sqliteDialect = dialect{least: "MIN", greatest: "MAX"}
+)
+
+func dialectOf(db *gorm.DB) (dialect, error) {
+	switch name := db.Dialector.Name(); name {
+	case "mysql":
+		return mysqlDialect, nil
+	case "sqlite":
+		return sqliteDialect, nil
+	default:
+		return dialect{}, fmt.Errorf("不支持的数据库方言: %s", name)
+	}
+}
+
+// NewGormStore 基于已打开的 gorm 连接构建仓库（MySQL / SQLite，按连接的方言生成 SQL）
+func NewGormStore(db *gorm.DB) (*Store, error) {
+	d, err := dialectOf(db)
+	if err != nil {
+		return nil, err
+	}
+	return &Store{
+		Memories:  &gormMemories{db: db, d: d},
+		Tasks:     &gormTasks{db: db},
+		Feedbacks: &gormFeedbacks{db: db},
+		TaskLogs:  &gormTaskLogs{db: db},
+		Runs:      &gormRuns{db: db},
+		Sweeps:    &gormSweeps{db: db},
+		Snapshots: &gormSnapshots{db: db},
+		reset: func(ctx context.Context) error {
+			return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+				for _, m := range []interface{}{&model.TaskLog{}, &model.Feedback{}, &model.Task{}, &model.Memory{}, &model.ExperimentRun{}} {
+					if err := tx.Session(&gorm.Session{AllowGlobalUpdate: true}).Unscoped().Delete(m).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+		},
+	}, nil
+}
+
+// first 单条查询：把 gorm.ErrRecordNotFound 统一为 ErrNotFound
+func first(q *gorm.DB, dest interface{}) error {
+	err := q.First(dest).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrNotFound
+	}
+	return err
+}
+
+type gormMemories struct {
+	db *gorm.DB
+	d  dialect
+}
+
+func (r *gormMemories) model(ctx context.Context) *gorm.DB {
+	return r.db.WithContext(ctx).Model(&model.Memory{})
+}
+
+// pool 全局池记录：run_id=0 且 derived_from 带 global 前缀
+func (r *gormMemories) pool(ctx context.Context, poolRunID uint) *gorm.DB {
+	return r.model(ctx).Where("run_id = 0 AND derived_from LIKE ? AND pool_run_id = ?", GlobalPoolPrefix+"%", poolRunID)
+}
+
+func (r *gormMemories) Create(ctx context.Context, m *model.Memory) error {
+	return r.db.WithContext(ctx).Create(m).Error
+}
+
+func (r *gormMemories) CreateBatch(ctx context.Context, ms []model.Memory) error {
+	if len(ms) == 0 {
+		return nil
+	}
+	return r.db.WithContext(ctx).Create(&ms).Error
+}
+
+func (r *gormMemories) Get(ctx context.Context, id uint) (*model.Memory, error) {
+	var m model.Memory
+	if err := first(r.db.WithContext(ctx).Where("id = ?", id), &m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+func (r *gormMemories) List(ctx context.Context, limit int) ([]model.Memory, error) {
+	q := r.db.WithContext(ctx).Order("created_at DESC")
+	if limit > 0 {
+		q = q.Limit(limit)
+	}
+	var out []model.Memory
+	if err := q.Find(&out).Error; err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (r *gormMemories) Delete(ctx context.Context, id uint) error {
+	return r.db.WithContext(ctx).Delete(&model.Memory{}, id).Error
+}
+
+func (r *gormMemories) FindByIDs(ctx context.Context, ids []uint) ([]model.Memory, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	var out []model.Memory
+	if err := r.db.WithContext(ctx).Unscoped().Where("id IN ?", ids).Find(&out).Error; err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (r *gormMemories) Retrieve(ctx context.Context, rq RetrieveQuery) ([]model.Memory, error) {
+	q := r.model(ctx).Where("deprecated = ?", false)
+	if rq.RunID > 0 {
+		if rq.IncludeGlobal {
+			q = q.Where("(run_id = ? OR (run_id = 0 AND derived_from LIKE ? AND pool_run_id = ?))", rq.RunID, GlobalPoolPrefix+"%", rq.PoolRunID)
+		} else {
+			q = q.Where("run_id = ?", rq.RunID)
+		}
+	}
+	var out []model.Memory
+	err := q.
+		Where("(apply_to = ? OR apply_to = ?)", rq.TaskType, ApplyToAny).
+		Order("last_verified_at DESC, version DESC, confidence DESC, use_count DESC, updated_at DESC").
+		Limit(rq.Limit).
+		Find(&out).Error
+	return out, err
+}
+
+func (r *gormMemories) LatestByTrigger(ctx context.Context, runID uint, triggerKey, applyTo string) (*model.Memory, error) {
+	q := r.model(ctx).Where("trigger_key = ? AND apply_to = ?", triggerKey, applyTo)
+	if runID > 0 {
+		q = q.Where("run_id = ?", runID)
+	}
+	var m model.Memory
+	if err := first(q.Order("version DESC"), &m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+func (r *gormMemories) LatestInPool(ctx context.Context, poolRunID uint, triggerKey, applyTo string) (*model.Memory, error) {
+	var m model.Memory
+	q := r.pool(ctx, poolRunID).Where("apply_to = ? AND trigger_key = ?", applyTo, triggerKey).Order("version DESC")
+	if err := first(q, &m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+func (r *gormMemories) ListPool(ctx context.Context, poolRunID uint) ([]model.Memory, error) {
+	var out []model.Memory
+	if err := r.pool(ctx, poolRunID).Order("id ASC").Find(&out).Error; err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (r *gormMemories) CountPool(ctx context.Context, poolRunID uint) (int64, error) {
+	var n int64
+	if err := r.pool(ctx, poolRunID).Count(&n).Error; err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+func (r *gormMemories) MarkUsed(ctx context.Context, ids []uint, at time.Time) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return r.model(ctx).Where("id IN ?", ids).Updates(map[string]interface{}{
+		"use_count":    gorm.Expr("use_count + 1"),
+		"last_used_at": at,
+	}).Error
+}
+
+func (r *gormMemories) MarkVerified(ctx context.Context, ids []uint, at time.Time, delta float64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return r.model(ctx).Where("id IN ?", ids).Updates(map[string]interface{}{
+		"last_verified_at": at,
+		"confidence":       gorm.Expr(r.d.least+"(confidence + ?, 1)", delta),
+	}).Error
+}
+
+func (r *gormMemories) Penalize(ctx context.Context, ids []uint, at time.Time, delta float64, failureThreshold int) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	// 原子更新 failure_count，避免并发丢更新；deprecated_at 只在首次废弃时写入
+	return r.model(ctx).Where("id IN ?", ids).Updates(map[string]interface{}{
+		"failure_count":  gorm.Expr("failure_count + 1"),
+		"last_failed_at": at,
+		"confidence":     gorm.Expr(r.d.greatest+"(confidence - ?, 0)", delta),
+		"deprecated": gorm.Expr(
+			"CASE WHEN failure_count + 1 >= ? THEN ? ELSE deprecated END",
+			failureThreshold, true,
+		),
+		"deprecated_at": gorm.Expr(
+			"CASE WHEN failure_count + 1 >= ? AND (deprecated = ? OR deprecated IS NULL) THEN ? ELSE deprecated_at END",
+			failureThreshold, false, at,
+		),
+	}).Error
+}
+
+func (r *gormMemories) Reinforce(ctx context.Context, id uint, at time.Time, delta float64) error {
+	return r.model(ctx).Where("id = ?", id).Updates(map[string]interface{}{
+		"confidence": gorm.Expr(r.d.least+"(confidence + ?, 1)", delta),
+		"updated_at": at,
+	}).Error
+}
+
+func (r *gormMemories) SetEmbedding(ctx context.Context, id uint, vec model.Vector, embedModel string) error {
+	return r.model(ctx).Where("id = ?", id).UpdateColumns(map[string]interface{}{
+		"embedding":       vec,
+		"embedding_model": embedModel,
+	}).Error
+}
+
+func (r *gormMemories) SetParent(ctx context.Context, id, parentID uint) error {
+	return r.model(ctx).Where("id = ?", id).UpdateColumn("parent_id", parentID).Error
+}
+
+func (r *gormMemories) Children(ctx context.Context, id uint) ([]model.Memory, error) {
+	if id == 0 {
+		return nil, nil
+	}
+	var out []model.Memory
+	if err := r.db.WithContext(ctx).Unscoped().Where("parent_id = ?", id).Order("id asc").Find(&out).Error; err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (r *gormMemories) FindBySourceTasks(ctx context.Context, taskIDs []uint) ([]model.Memory, error) {
+	if len(taskIDs) == 0 {
+		return nil, nil
+	}
+	var out []model.Memory
+	if err := r.db.WithContext(ctx).Unscoped().Where("source_task_id IN ?", taskIDs).Order("id asc").Find(&out).Error; err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+type gormTasks struct {
+	db *gorm.DB
+}
+
+func (r *gormTasks) Create(ctx context.Context, t *model.Task) error {
+	return r.db.WithContext(ctx).Create(t).Error
+}
+
+func (r *gormTasks) Get(ctx context.Context, id uint) (*model.Task, error) {
+	var t model.Task
+	if err := first(r.db.WithContext(ctx).Where("id = ?", id), &t); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (r *gormTasks) Find(ctx context.Context, f TaskFilter) ([]model.Task, error) {
+	q := r.db.WithContext(ctx).Model(&model.Task{})
+	if f.RunID > 0 {
+		q = q.Where("run_id = ?", f.RunID)
+	}
+	if f.TaskType != "" {
+		q = q.Where("task_type = ?", f.TaskType)
+	}
+	if f.GroupType != "" {
+		q = q.Where("group_type = ?", f.GroupType)
+	}
+	if f.Phase != "" {
+		q = q.Where("phase = ?", f.Phase)
+	}
+	if f.ExcludePhase != "" {
+		q = q.Where("phase <> ?", f.ExcludePhase)
+	}
+	switch {
+	case f.CorrectOnly:
+		q = q.Where("is_correct = ?", true)
+	case f.JudgedOnly:
+		q = q.Where("is_correct IS NOT NULL")
+	case f.PendingOnly:
+		q = q.Where("is_correct IS NULL")
+	}
+	if f.WithThreshold {
+		q = q.Where("rule_threshold > 0")
+	}
+	switch f.Order {
+	case TaskOrderIDDesc:
+		q = q.Order("id DESC")
+	case TaskOrderRound:
+		q = q.Order("round ASC, id ASC")
+	case TaskOrderNewest:
+		q = q.Order("created_at DESC")
+	default:
+		q = q.Order("id ASC")
+	}
+	if f.Limit > 0 {
+		q = q.Limit(f.Limit)
+	}
+	var out []model.Task
+	if err := q.Find(&out).Error; err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (r *gormTasks) SetCorrect(ctx context.Context, id uint, correct bool) error {
+	return r.db.WithContext(ctx).Model(&model.Task{}).Where("id = ?", id).Update("is_correct", correct).Error
+}
+
+func (r *gormTasks) SetRoundInfo(ctx context.Context, t *model.Task) error {
+	return r.db.WithContext(ctx).Model(&model.Task{}).Where("id = ?", t.ID).Updates(map[string]interface{}{
+		"round":          t.Round,
+		"rule_mode":      t.RuleMode,
+		"rule_version":   t.RuleVersion,
+		"rule_threshold": t.RuleThreshold,
+	}).Error
+}
+
+func (r *gormTasks) DeleteByIDs(ctx context.Context, ids []uint) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return r.db.WithContext(ctx).Where("id IN ?", ids).Delete(&model.Task{}).Error
+}
+
+type gormFeedbacks struct {
+	db *gorm.DB
+}
+
+func (r *gormFeedbacks) Create(ctx context.Context, f *model.Feedback) error {
+	return r.db.WithContext(ctx).Create(f).Error
+}
+
+func (r *gormFeedbacks) Get(ctx context.Context, id uint) (*model.Feedback, error) {
+	var f model.Feedback
+	if err := first(r.db.WithContext(ctx).Where("id = ?", id), &f); err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+func (r *gormFeedbacks) Save(ctx context.Context, f *model.Feedback) error {
+	return r.db.WithContext(ctx).Save(f).Error
+}
+
+func (r *gormFeedbacks) LatestByTask(ctx context.Context, taskID uint) (*model.Feedback, error) {
+	var f model.Feedback
+	if err := first(r.db.WithContext(ctx).Where("task_id = ?", taskID).Order("id desc"), &f); err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+func (r *gormFeedbacks) RecentIncorrect(ctx context.Context, runID uint, taskType string, limit int) ([]model.Feedback, error) {
+	var out []model.Feedback
+	err := r.db.WithContext(ctx).
+		Model(&model.Feedback{}).
+		Joins("JOIN tasks ON tasks.id = feedbacks.task_id").
+		Where("feedbacks.run_id = ? AND tasks.task_type = ? AND feedbacks.type = ?", runID, taskType, "incorrect").
+		Where("tasks.phase <> ?", model.TaskPhaseEval).
+		Order("feedbacks.id DESC").
+		Limit(limit).
+		Find(&out).Error
+	return out, err
+}
+
+type gormTaskLogs struct {
+	db *gorm.DB
+}
+
+func (r *gormTaskLogs) Create(ctx context.Context, l *model.TaskLog) error {
+	return r.db.WithContext(ctx).Create(l).Error
+}
+
+func (r *gormTaskLogs) DeleteByTaskIDs(ctx context.Context, taskIDs []uint) error {
+	if len(taskIDs) == 0 {
+		return nil
+	}
+	return r.db.WithContext(ctx).Where("task_id IN ?", taskIDs).Delete(&model.TaskLog{}).Error
+}
+
+type gormRuns struct {
+	db *gorm.DB
+}
+
+func (r *gormRuns) update(ctx context.Context, id uint, fields map[string]interface{}) error {
+	return r.db.WithContext(ctx).Model(&model.ExperimentRun{}).Where("id = ?", id).Updates(fields).Error
+}
+
+func (r *gormRuns) Create(ctx context.Context, run *model.ExperimentRun) error {
+	return r.db.WithContext(ctx).Create(run).Error
+}
+
+func (r *gormRuns) Get(ctx context.Context, id uint) (*model.ExperimentRun, error) {
+	var run model.ExperimentRun
+	if err := first(r.db.WithContext(ctx).Where("id = ?", id), &run); err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
+
+func (r *gormRuns) Save(ctx context.Context, run *model.ExperimentRun) error {
+	return r.db.WithContext(ctx).Save(run).Error
+}
+
+func (r *gormRuns) Latest(ctx context.Context, taskType, ruleMode string) (*model.ExperimentRun, error) {
+	var run model.ExperimentRun
+	q := r.db.WithContext(ctx).Where("rule_mode = ? AND task_type = ?", ruleMode, taskType).Order("id DESC")
+	if err := first(q, &run); err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
+
+func (r *gormRuns) Find(ctx context.Context, f RunFilter) ([]model.ExperimentRun, error) {
+	q := r.db.WithContext(ctx).Model(&model.ExperimentRun{})
+	if f.TaskType != "" {
+		q = q.Where("task_type = ?", f.TaskType)
+	}
+	if f.RuleMode != "" {
+		q = q.Where("rule_mode = ?", f.RuleMode)
+	}
+	if f.Status != "" {
+		q = q.Where("status = ?", f.Status)
+	}
+	if !f.From.IsZero() {
+		q = q.Where("created_at >= ?", f.From)
+	}
+	if !f.To.IsZero() {
+		q = q.Where("created_at < ?", f.To)
+	}
+	var out []model.ExperimentRun
+	if err := q.Order("id ASC").Find(&out).Error; err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (r *gormRuns) ListBySweep(ctx context.Context, sweepID uint) ([]model.ExperimentRun, error) {
+	var out []model.ExperimentRun
+	if err := r.db.WithContext(ctx).Where("sweep_id = ?", sweepID).Order("id ASC").Find(&out).Error; err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (r *gormRuns) CountBySweep(ctx context.Context, sweepID uint, status string) (int64, error) {
+	var n int64
+	err := r.db.WithContext(ctx).Model(&model.ExperimentRun{}).
+		Where("sweep_id = ? AND status = ?", sweepID, status).
+		Count(&n).Error
+	return n, err
+}
+
+func (r *gormRuns) MarkStarted(ctx context.Context, id uint, at time.Time) error {
+	return r.update(ctx, id, map[string]interface{}{
+		"status":     model.ExperimentRunStatusRunning,
+		"started_at": at,
+	})
+}
+
+func (r *gormRuns) SetCurrentRound(ctx context.Context, id uint, round int) error {
+	return r.update(ctx, id, map[string]interface{}{"current_round": round})
+}
+
+func (r *gormRuns) SetProgress(ctx context.Context, id uint, completedRounds, errorCount int) error {
+	return r.update(ctx, id, map[string]interface{}{
+		"completed_rounds": completedRounds,
+		"error_count":      errorCount,
+	})
+}
+
+func (r *gormRuns) MarkStatus(ctx context.Context, id uint, status, errMsg string, at time.Time) error {
+	fields := map[string]interface{}{
+		"status":      status,
+		"finished_at": at,
+	}
+	if errMsg != "" {
+		fields["error_message"] = errMsg
+	}
+	return r.update(ctx, id, fields)
+}
+
+func (r *gormRuns) Requeue(ctx context.Context, id uint) error {
+	return r.update(ctx, id, map[string]interface{}{
+		"status":        model.ExperimentRunStatusQueued,
+		"error_message": "",
+		"finished_at":   nil,
+	})
+}
+
+type gormSweeps struct {
+	db *gorm.DB
+}
+
+func (r *gormSweeps) update(ctx context.Context, id uint, fields map[string]interface{}) error {
+	return r.db.WithContext(ctx).Model(&model.ExperimentSweep{}).Where("id = ?", id).Updates(fields).Error
+}
+
+func (r *gormSweeps) Create(ctx context.Context, s *model.ExperimentSweep) error {
+	return r.db.WithContext(ctx).Create(s).Error
+}
+
+func (r *gormSweeps) Get(ctx context.Context, id uint) (*model.ExperimentSweep, error) {
+	var s model.ExperimentSweep
+	if err := first(r.db.WithContext(ctx).Where("id = ?", id), &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (r *gormSweeps) MarkStarted(ctx context.Context, id uint, at time.Time) error {
+	return r.update(ctx, id, map[string]interface{}{
+		"status":     model.ExperimentRunStatusRunning,
+		"started_at": at,
+	})
+}
+
+func (r *gormSweeps) SetCompletedRuns(ctx context.Context, id uint, n int) error {
+	return r.update(ctx, id, map[string]interface{}{"completed_runs": n})
+}
+
+func (r *gormSweeps) MarkStatus(ctx context.Context, id uint, status string, at time.Time) error {
+	return r.update(ctx, id, map[string]interface{}{
+		"status":      status,
+		"finished_at": at,
+	})
+}
+
+func (r *gormSweeps) SetReportPaths(ctx context.Context, id uint, jsonPath, markdownPath string) error {
+	return r.update(ctx, id, map[string]interface{}{
+		"report_path":          jsonPath,
+		"report_markdown_path": markdownPath,
+	})
+}
+
+type gormSnapshots struct {
+	db *gorm.DB
+}
+
+func (r *gormSnapshots) Create(ctx context.Context, s *model.GlobalPoolSnapshot, items []model.GlobalPoolSnapshotItem) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(s).Error; err != nil {
+			return err
+		}
+		if len(items) == 0 {
+			return nil
+		}
+		for i := range items {
+			items[i].SnapshotID = s.ID
+		}
+		return tx.Create(&items).Error
+	})
+}
+
+func (r *gormSnapshots) Get(ctx context.Context, id uint) (*model.GlobalPoolSnapshot, error) {
+	var s model.GlobalPoolSnapshot
+	if err := first(r.db.WithContext(ctx).Where("id = ?", id), &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (r *gormSnapshots) Items(ctx context.Context, snapshotID uint) ([]model.GlobalPoolSnapshotItem, error) {
+	var out []model.GlobalPoolSnapshotItem
+	if err := r.db.WithContext(ctx).Where("snapshot_id = ?", snapshotID).Order("id ASC").Find(&out).Error; err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (r *gormSnapshots) List(ctx context.Context, limit int) ([]model.GlobalPoolSnapshot, error) {
+	var out []model.GlobalPoolSnapshot
+	if err := r.db.WithContext(ctx).Order("id DESC").Limit(limit).Find(&out).Error; err != nil {
+		return nil, err
+	}
+	return out, nil
+}
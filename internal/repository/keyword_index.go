@@ -0,0 +1,295 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"mem-test/internal/model"
+)
+
+// BM25 默认参数
+const (
+	DefaultBM25K1 = 1.2
+	DefaultBM25B  = 0.75
+)
+
+// KeywordHit 关键词检索命中
+type KeywordHit struct {
+	ID    uint
+	Score float64
+}
+
+// keywordDoc 一条记忆在索引中的词频与过滤所需字段（不含向量等大字段）
+type keywordDoc struct {
+	mem    model.Memory
+	tf     map[string]int
+	length int
+}
+
+// KeywordIndex 进程内倒排索引，按 BM25 对 trigger / trigger_key / lesson 打分；
+// 只收录未删除、未废弃的记忆，由 EnableKeywordIndex 安装的仓库装饰器在写入/废弃/删除时增量维护
+type KeywordIndex struct {
+	k1 float64
+	b  float64
+
+	mu       sync.RWMutex
+	docs     map[uint]*keywordDoc
+	postings map[string]map[uint]struct{}
+	totalLen int
+}
+
+func NewKeywordIndex(k1, b float64) *KeywordIndex {
+	if k1 <= 0 {
+		k1 = DefaultBM25K1
+	}
+	if b < 0 || b > 1 {
+		b = DefaultBM25B
+	}
+	return &KeywordIndex{
+		k1:       k1,
+		b:        b,
+		docs:     map[uint]*keywordDoc{},
+		postings: map[string]map[uint]struct{}{},
+	}
+}
+
+// keywordText 参与索引的文本；trigger_key 是归一化后的 trigger，重复计入相当于给触发条件加权
+func keywordText(m *model.Memory) string {
+	return m.Trigger + "\n" + m.TriggerKey + "\n" + m.Lesson
+}
+
+// KeywordTerms 切词：连续中文按相邻二元组（单字成段时取单字），英文按小写单词（snake_case 额外拆分）；
+// 数字与符号不参与，门槛数值的差异交给版本/验证排序
+func KeywordTerms(text string) []string {
+	var out []string
+	var han []rune
+	var word []rune
+	flushHan := func() {
+		switch len(han) {
+		case 0:
+		case 1:
+			out = append(out, string(han))
+		default:
+			for i := 0; i+1 < len(han); i++ {
+				out = append(out, string(han[i:i+2]))
+			}
+		}
+		han = han[:0]
+	}
+	flushWord := func() {
+		if len(word) == 0 {
+			return
+		}
+		w := strings.ToLower(string(word))
+		for _, part := range strings.Split(w, "_") {
+			if part != "" {
+				out = append(out, part)
+			}
+		}
+		word = word[:0]
+	}
+	for _, r := range text {
+		switch {
+		case unicode.Is(unicode.Han, r):
+			flushWord()
+			han = append(han, r)
+		case r < unicode.MaxASCII && (unicode.IsLetter(r) || r == '_'):
+			flushHan()
+			word = append(word, r)
+		default:
+			flushHan()
+			flushWord()
+		}
+	}
+	flushHan()
+	flushWord()
+	return out
+}
+
+// Add 收录或覆盖一条记忆；已删除 / 已废弃的记忆等同于 Remove
+func (x *KeywordIndex) Add(m *model.Memory) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.remove(m.ID)
+	if m.DeletedAt.Valid || m.Deprecated {
+		return
+	}
+	terms := KeywordTerms(keywordText(m))
+	doc := &keywordDoc{mem: *m, tf: map[string]int{}, length: len(terms)}
+	doc.mem.Embedding = nil
+	for _, t := range terms {
+		doc.tf[t]++
+	}
+	for t := range doc.tf {
+		ids := x.postings[t]
+		if ids == nil {
+			ids = map[uint]struct{}{}
+			x.postings[t] = ids
+		}
+		ids[m.ID] = struct{}{}
+	}
+	x.docs[m.ID] = doc
+	x.totalLen += doc.length
+}
+
+func (x *KeywordIndex) Remove(id uint) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.remove(id)
+}
+
+func (x *KeywordIndex) remove(id uint) {
+	doc, ok := x.docs[id]
+	if !ok {
+		return
+	}
+	for t := range doc.tf {
+		delete(x.postings[t], id)
+		if len(x.postings[t]) == 0 {
+			delete(x.postings, t)
+		}
+	}
+	x.totalLen -= doc.length
+	delete(x.docs, id)
+}
+
+// Clear 清空索引（Store.Reset 后调用）
+func (x *KeywordIndex) Clear() {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.docs = map[uint]*keywordDoc{}
+	x.postings = map[string]map[uint]struct{}{}
+	x.totalLen = 0
+}
+
+// Len 已收录的记忆数
+func (x *KeywordIndex) Len() int {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	return len(x.docs)
+}
+
+// Search 在满足 q 过滤条件（run / 全局池 / 任务类型，同 Retrieve）的记忆中按 BM25 取前 q.Limit 条；
+// 只返回至少命中一个词的记忆，同分时新记忆（id 大）在前。IDF 与平均长度按全部已收录记忆计算
+func (x *KeywordIndex) Search(q RetrieveQuery, query string) []KeywordHit {
+	terms := KeywordTerms(query)
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	n := len(x.docs)
+	if n == 0 || len(terms) == 0 {
+		return nil
+	}
+	avgLen := float64(x.totalLen) / float64(n)
+	scores := map[uint]float64{}
+	seen := map[string]bool{}
+	for _, t := range terms {
+		if seen[t] {
+			continue
+		}
+		seen[t] = true
+		ids := x.postings[t]
+		if len(ids) == 0 {
+			continue
+		}
+		df := float64(len(ids))
+		idf := math.Log(1 + (float64(n)-df+0.5)/(df+0.5))
+		for id := range ids {
+			doc := x.docs[id]
+			if !retrieveMatch(&doc.mem, q) {
+				continue
+			}
+			tf := float64(doc.tf[t])
+			norm := x.k1 * (1 - x.b + x.b*float64(doc.length)/avgLen)
+			scores[id] += idf * tf * (x.k1 + 1) / (tf + norm)
+		}
+	}
+	hits := make([]KeywordHit, 0, len(scores))
+	for id, s := range scores {
+		hits = append(hits, KeywordHit{ID: id, Score: s})
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].ID > hits[j].ID
+	})
+	return limitRows(hits, q.Limit)
+}
+
+// indexedMemories 在底层仓库写成功后同步关键词索引；其余方法直接透传
+type indexedMemories struct {
+	MemoryRepository
+	idx *KeywordIndex
+}
+
+func (r *indexedMemories) Create(ctx context.Context, m *model.Memory) error {
+	if err := r.MemoryRepository.Create(ctx, m); err != nil {
+		return err
+	}
+	r.idx.Add(m)
+	return nil
+}
+
+func (r *indexedMemories) CreateBatch(ctx context.Context, ms []model.Memory) error {
+	if err := r.MemoryRepository.CreateBatch(ctx, ms); err != nil {
+		return err
+	}
+	for i := range ms {
+		r.idx.Add(&ms[i])
+	}
+	return nil
+}
+
+func (r *indexedMemories) Delete(ctx context.Context, id uint) error {
+	if err := r.MemoryRepository.Delete(ctx, id); err != nil {
+		return err
+	}
+	r.idx.Remove(id)
+	return nil
+}
+
+// Penalize 达到失败阈值的记忆会被废弃：回读一次，把已废弃的移出索引
+func (r *indexedMemories) Penalize(ctx context.Context, ids []uint, at time.Time, delta float64, failureThreshold int) error {
+	if err := r.MemoryRepository.Penalize(ctx, ids, at, delta, failureThreshold); err != nil {
+		return err
+	}
+	ms, err := r.MemoryRepository.FindByIDs(ctx, ids)
+	if err != nil {
+		return fmt.Errorf("同步关键词索引失败: %w", err)
+	}
+	for i := range ms {
+		if ms[i].Deprecated || ms[i].DeletedAt.Valid {
+			r.idx.Remove(ms[i].ID)
+		}
+	}
+	return nil
+}
+
+// EnableKeywordIndex 用现有记忆构建 BM25 索引，并让 s.Memories / s.Reset 在写入、废弃、删除、清空时同步维护它；
+// 应在把 Store 交给各服务之前调用一次
+func (s *Store) EnableKeywordIndex(ctx context.Context, k1, b float64) (*KeywordIndex, error) {
+	idx := NewKeywordIndex(k1, b)
+	ms, err := s.Memories.List(ctx, 0)
+	if err != nil {
+		return nil, fmt.Errorf("构建关键词索引失败: %w", err)
+	}
+	for i := range ms {
+		idx.Add(&ms[i])
+	}
+	s.Memories = &indexedMemories{MemoryRepository: s.Memories, idx: idx}
+	reset := s.reset
+	s.reset = func(ctx context.Context) error {
+		if err := reset(ctx); err != nil {
+			return err
+		}
+		idx.Clear()
+		return nil
+	}
+	return idx, nil
+}
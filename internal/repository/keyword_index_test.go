@@ -0,0 +1,80 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"mem-test/internal/model"
+)
+
+func TestKeywordTerms(t *testing.T) {
+	got := fmt.Sprint(KeywordTerms("锁定积分<100 points_locked 奖"))
+	if got != "[锁定 定积 积分 points locked 奖]" {
+		t.Fatalf("terms: %s", got)
+	}
+}
+
+// TestKeywordIndex_IncrementalBM25 索引随写入/废弃/删除/清空增量维护，打分只看命中的关键词
+func TestKeywordIndex_IncrementalBM25(t *testing.T) {
+	eachStore(t, func(t *testing.T, store *Store) {
+		ctx := context.Background()
+		existing := &model.Memory{RunID: 1, Trigger: "有效积分<100", TriggerKey: "有效积分<", Lesson: "锁定积分不计入有效积分", ApplyTo: "lottery_multi"}
+		if err := store.Memories.Create(ctx, existing); err != nil {
+			t.Fatalf("seed: %v", err)
+		}
+		idx, err := store.EnableKeywordIndex(ctx, 0, 0)
+		if err != nil {
+			t.Fatalf("enable: %v", err)
+		}
+		if idx.Len() != 1 {
+			t.Fatalf("existing memories should be indexed: %d", idx.Len())
+		}
+
+		batch := []model.Memory{
+			{RunID: 1, Trigger: "有效积分<100", TriggerKey: "有效积分<", Lesson: "惩罚积分先从可用积分中扣除", ApplyTo: "lottery_multi"},
+			{RunID: 1, Trigger: "有效积分<100", TriggerKey: "有效积分<", Lesson: "奖励积分按一半计入有效积分", ApplyTo: "lottery_multi"},
+			{RunID: 2, Trigger: "锁定积分", TriggerKey: "锁定积分", Lesson: "锁定积分不计入", ApplyTo: "lottery_multi"},
+		}
+		if err := store.Memories.CreateBatch(ctx, batch); err != nil {
+			t.Fatalf("create batch: %v", err)
+		}
+		q := RetrieveQuery{RunID: 1, TaskType: "lottery_multi", Limit: 5}
+		top := func(query string) []uint {
+			var ids []uint
+			for _, h := range idx.Search(q, query) {
+				ids = append(ids, h.ID)
+			}
+			return ids
+		}
+
+		// run 2 的记忆被过滤；只命中“积分”的记忆排在后面
+		if got := top("锁定积分"); len(got) != 3 || got[0] != existing.ID {
+			t.Fatalf("locked rule should rank first within run 1: %v", got)
+		}
+		if got := top("惩罚 扣除"); len(got) != 1 || got[0] != batch[0].ID {
+			t.Fatalf("only penalty rule should match: %v", got)
+		}
+		if got := top("123"); got != nil {
+			t.Fatalf("query without terms should not match: %v", got)
+		}
+
+		if err := store.Memories.Penalize(ctx, []uint{existing.ID}, time.Now(), 0.05, 1); err != nil {
+			t.Fatalf("penalize: %v", err)
+		}
+		if err := store.Memories.Delete(ctx, batch[1].ID); err != nil {
+			t.Fatalf("delete: %v", err)
+		}
+		if got := top("锁定积分"); len(got) != 1 || got[0] != batch[0].ID || idx.Len() != 2 {
+			t.Fatalf("deprecated and deleted memories should leave the index: %v len=%d", got, idx.Len())
+		}
+
+		if err := store.Reset(ctx); err != nil {
+			t.Fatalf("reset: %v", err)
+		}
+		if idx.Len() != 0 {
+			t.Fatalf("reset should clear the index: %d", idx.Len())
+		}
+	})
+}
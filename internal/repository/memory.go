@@ -0,0 +1,838 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"mem-test/internal/model"
+
+	"gorm.io/gorm"
+)
+
+// NewMemoryStore 进程内存储（不落盘）：单元测试与无数据库演示用。
+// 一把读写锁串行化全部表，可被并发的实验 worker 与 HTTP 请求共享；
+// 过滤、排序、软删除与列默认值均与 NewGormStore 生成的 SQL 保持一致。
+func NewMemoryStore() *Store {
+	m := &memDB{
+		memories:      newTable[model.Memory](),
+		tasks:         newTable[model.Task](),
+		feedbacks:     newTable[model.Feedback](),
+		taskLogs:      newTable[model.TaskLog](),
+		runs:          newTable[model.ExperimentRun](),
+		sweeps:        newTable[model.ExperimentSweep](),
+		snapshots:     newTable[model.GlobalPoolSnapshot](),
+		snapshotItems: newTable[model.GlobalPoolSnapshotItem](),
+	}
+	return &Store{
+		Memories:  &memMemories{m},
+		Tasks:     &memTasks{m},
+		Feedbacks: &memFeedbacks{m},
+		TaskLogs:  &memTaskLogs{m},
+		Runs:      &memRuns{m},
+		Sweeps:    &memSweeps{m},
+		Snapshots: &memSnapshots{m},
+		reset: func(ctx context.Context) error {
+			m.mu.Lock()
+			defer m.mu.Unlock()
+			// 与 SQL 的 DELETE 一致：清空行但不回收自增 ID
+			m.taskLogs.clear()
+			m.feedbacks.clear()
+			m.tasks.clear()
+			m.memories.clear()
+			m.runs.clear()
+			return nil
+		},
+	}
+}
+
+// table 一张内存表：按值保存行（读写都拷贝，调用方拿到的结构体与表内数据互不影响）
+type table[T any] struct {
+	rows   map[uint]T
+	lastID uint
+}
+
+func newTable[T any]() *table[T] {
+	return &table[T]{rows: make(map[uint]T)}
+}
+
+// nextID 自增主键
+func (t *table[T]) nextID() uint {
+	t.lastID++
+	return t.lastID
+}
+
+// put 写入行；显式指定的 ID 超过当前自增值时同步推进，避免后续冲突
+func (t *table[T]) put(id uint, row T) {
+	if id > t.lastID {
+		t.lastID = id
+	}
+	t.rows[id] = row
+}
+
+// scan 按 id 升序返回满足条件的行
+func (t *table[T]) scan(keep func(*T) bool) []T {
+	ids := make([]uint, 0, len(t.rows))
+	for id := range t.rows {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	out := make([]T, 0, len(ids))
+	for _, id := range ids {
+		row := t.rows[id]
+		if keep(&row) {
+			out = append(out, row)
+		}
+	}
+	return out
+}
+
+// update 对已存在的行原地修改
+func (t *table[T]) update(id uint, fn func(*T)) {
+	row, ok := t.rows[id]
+	if !ok {
+		return
+	}
+	fn(&row)
+	t.rows[id] = row
+}
+
+func (t *table[T]) clear() {
+	t.rows = make(map[uint]T)
+}
+
+type memDB struct {
+	mu sync.RWMutex
+
+	memories      *table[model.Memory]
+	tasks         *table[model.Task]
+	feedbacks     *table[model.Feedback]
+	taskLogs      *table[model.TaskLog]
+	runs          *table[model.ExperimentRun]
+	sweeps        *table[model.ExperimentSweep]
+	snapshots     *table[model.GlobalPoolSnapshot]
+	snapshotItems *table[model.GlobalPoolSnapshotItem]
+}
+
+// stamp 创建时补齐自增 ID 与时间戳（已显式赋值的保留；同一条语句内的行共用 now，与 gorm Create 一致）
+func stamp(id *uint, createdAt, updatedAt *time.Time, now time.Time, next func() uint) {
+	if *id == 0 {
+		*id = next()
+	}
+	if createdAt.IsZero() {
+		*createdAt = now
+	}
+	if updatedAt != nil && updatedAt.IsZero() {
+		*updatedAt = now
+	}
+}
+
+func softDelete(d *gorm.DeletedAt) {
+	*d = gorm.DeletedAt{Time: time.Now(), Valid: true}
+}
+
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
+
+func idSet(ids []uint) map[uint]bool {
+	set := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		set[id] = true
+	}
+	return set
+}
+
+func limitRows[T any](rows []T, limit int) []T {
+	if limit > 0 && len(rows) > limit {
+		return rows[:limit]
+	}
+	return rows
+}
+
+type memMemories struct {
+	m *memDB
+}
+
+// inPool 全局池记录：run_id=0 且 derived_from 带 global 前缀
+func inPool(mem *model.Memory, poolRunID uint) bool {
+	return mem.RunID == 0 && strings.HasPrefix(mem.DerivedFrom, GlobalPoolPrefix) && mem.PoolRunID == poolRunID
+}
+
+func (r *memMemories) insert(mem *model.Memory, now time.Time) {
+	// 列默认值：confidence=0.5、version=1（gorm 对零值字段不写入，由库表默认值填充）
+	if mem.Confidence == 0 {
+		mem.Confidence = 0.5
+	}
+	if mem.Version == 0 {
+		mem.Version = 1
+	}
+	stamp(&mem.ID, &mem.CreatedAt, &mem.UpdatedAt, now, r.m.memories.nextID)
+	r.m.memories.put(mem.ID, *mem)
+}
+
+func (r *memMemories) Create(ctx context.Context, mem *model.Memory) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	r.insert(mem, time.Now())
+	return nil
+}
+
+func (r *memMemories) CreateBatch(ctx context.Context, ms []model.Memory) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	now := time.Now()
+	for i := range ms {
+		r.insert(&ms[i], now)
+	}
+	return nil
+}
+
+func (r *memMemories) Get(ctx context.Context, id uint) (*model.Memory, error) {
+	r.m.mu.RLock()
+	defer r.m.mu.RUnlock()
+	mem, ok := r.m.memories.rows[id]
+	if !ok || mem.DeletedAt.Valid {
+		return nil, ErrNotFound
+	}
+	return &mem, nil
+}
+
+func (r *memMemories) List(ctx context.Context, limit int) ([]model.Memory, error) {
+	r.m.mu.RLock()
+	defer r.m.mu.RUnlock()
+	out := r.m.memories.scan(func(mem *model.Memory) bool { return !mem.DeletedAt.Valid })
+	sort.SliceStable(out, func(i, j int) bool { return out[i].CreatedAt.After(out[j].CreatedAt) })
+	return limitRows(out, limit), nil
+}
+
+func (r *memMemories) Delete(ctx context.Context, id uint) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	r.m.memories.update(id, func(mem *model.Memory) {
+		if !mem.DeletedAt.Valid {
+			softDelete(&mem.DeletedAt)
+		}
+	})
+	return nil
+}
+
+func (r *memMemories) FindByIDs(ctx context.Context, ids []uint) ([]model.Memory, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	set := idSet(ids)
+	r.m.mu.RLock()
+	defer r.m.mu.RUnlock()
+	return r.m.memories.scan(func(mem *model.Memory) bool { return set[mem.ID] }), nil
+}
+
+func (r *memMemories) Retrieve(ctx context.Context, rq RetrieveQuery) ([]model.Memory, error) {
+	r.m.mu.RLock()
+	defer r.m.mu.RUnlock()
+	out := r.m.memories.scan(func(mem *model.Memory) bool { return retrieveMatch(mem, rq) })
+	sort.SliceStable(out, func(i, j int) bool { return RetrieveLess(&out[i], &out[j]) })
+	return limitRows(out, rq.Limit), nil
+}
+
+// retrieveMatch Retrieve 的过滤条件（未删除、未废弃、任务类型命中、run / 全局池范围），关键词索引复用
+func retrieveMatch(mem *model.Memory, rq RetrieveQuery) bool {
+	if mem.DeletedAt.Valid || mem.Deprecated {
+		return false
+	}
+	if mem.ApplyTo != rq.TaskType && mem.ApplyTo != ApplyToAny {
+		return false
+	}
+	if rq.RunID == 0 {
+		return true
+	}
+	return mem.RunID == rq.RunID || (rq.IncludeGlobal && inPool(mem, rq.PoolRunID))
+}
+
+// RetrieveLess Retrieve 的排序，对应 ORDER BY last_verified_at DESC, version DESC, confidence DESC, use_count DESC, updated_at DESC；
+// 倒序时 NULL 排在最后（MySQL / SQLite 行为一致），全部相同时按 id 升序（稳定排序保留扫描顺序）
+func RetrieveLess(a, b *model.Memory) bool {
+	switch {
+	case a.LastVerifiedAt == nil && b.LastVerifiedAt != nil:
+		return false
+	case a.LastVerifiedAt != nil && b.LastVerifiedAt == nil:
+		return true
+	case a.LastVerifiedAt != nil && !a.LastVerifiedAt.Equal(*b.LastVerifiedAt):
+		return a.LastVerifiedAt.After(*b.LastVerifiedAt)
+	}
+	if a.Version != b.Version {
+		return a.Version > b.Version
+	}
+	if a.Confidence != b.Confidence {
+		return a.Confidence > b.Confidence
+	}
+	if a.UseCount != b.UseCount {
+		return a.UseCount > b.UseCount
+	}
+	return a.UpdatedAt.After(b.UpdatedAt)
+}
+
+// latest 满足条件的最高版本（同版本取 id 最小，与 ORDER BY version DESC 后 First 追加的主键排序一致）
+func (r *memMemories) latest(keep func(*model.Memory) bool) (*model.Memory, error) {
+	r.m.mu.RLock()
+	defer r.m.mu.RUnlock()
+	var best *model.Memory
+	for _, mem := range r.m.memories.scan(func(mem *model.Memory) bool { return !mem.DeletedAt.Valid && keep(mem) }) {
+		if best == nil || mem.Version > best.Version {
+			mem := mem
+			best = &mem
+		}
+	}
+	if best == nil {
+		return nil, ErrNotFound
+	}
+	return best, nil
+}
+
+func (r *memMemories) LatestByTrigger(ctx context.Context, runID uint, triggerKey, applyTo string) (*model.Memory, error) {
+	return r.latest(func(mem *model.Memory) bool {
+		return mem.TriggerKey == triggerKey && mem.ApplyTo == applyTo && (runID == 0 || mem.RunID == runID)
+	})
+}
+
+func (r *memMemories) LatestInPool(ctx context.Context, poolRunID uint, triggerKey, applyTo string) (*model.Memory, error) {
+	return r.latest(func(mem *model.Memory) bool {
+		return inPool(mem, poolRunID) && mem.ApplyTo == applyTo && mem.TriggerKey == triggerKey
+	})
+}
+
+func (r *memMemories) ListPool(ctx context.Context, poolRunID uint) ([]model.Memory, error) {
+	r.m.mu.RLock()
+	defer r.m.mu.RUnlock()
+	return r.m.memories.scan(func(mem *model.Memory) bool { return !mem.DeletedAt.Valid && inPool(mem, poolRunID) }), nil
+}
+
+func (r *memMemories) CountPool(ctx context.Context, poolRunID uint) (int64, error) {
+	pool, err := r.ListPool(ctx, poolRunID)
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(pool)), nil
+}
+
+// updateAlive 批量修改未软删除的记忆并刷新 updated_at
+func (r *memMemories) updateAlive(ids []uint, fn func(*model.Memory)) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	now := time.Now()
+	for _, id := range ids {
+		r.m.memories.update(id, func(mem *model.Memory) {
+			if mem.DeletedAt.Valid {
+				return
+			}
+			mem.UpdatedAt = now
+			fn(mem)
+		})
+	}
+}
+
+func (r *memMemories) MarkUsed(ctx context.Context, ids []uint, at time.Time) error {
+	r.updateAlive(ids, func(mem *model.Memory) {
+		mem.UseCount++
+		mem.LastUsedAt = timePtr(at)
+	})
+	return nil
+}
+
+func (r *memMemories) MarkVerified(ctx context.Context, ids []uint, at time.Time, delta float64) error {
+	r.updateAlive(ids, func(mem *model.Memory) {
+		mem.LastVerifiedAt = timePtr(at)
+		mem.Confidence = minFloat(mem.Confidence+delta, 1)
+	})
+	return nil
+}
+
+func (r *memMemories) Penalize(ctx context.Context, ids []uint, at time.Time, delta float64, failureThreshold int) error {
+	r.updateAlive(ids, func(mem *model.Memory) {
+		mem.FailureCount++
+		mem.LastFailedAt = timePtr(at)
+		mem.Confidence = maxFloat(mem.Confidence-delta, 0)
+		if mem.FailureCount >= failureThreshold {
+			// deprecated_at 只在首次废弃时写入
+			if !mem.Deprecated {
+				mem.DeprecatedAt = timePtr(at)
+			}
+			mem.Deprecated = true
+		}
+	})
+	return nil
+}
+
+func (r *memMemories) Reinforce(ctx context.Context, id uint, at time.Time, delta float64) error {
+	r.updateAlive([]uint{id}, func(mem *model.Memory) {
+		mem.Confidence = minFloat(mem.Confidence+delta, 1)
+		mem.UpdatedAt = at
+	})
+	return nil
+}
+
+func (r *memMemories) SetEmbedding(ctx context.Context, id uint, vec model.Vector, embedModel string) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	r.m.memories.update(id, func(mem *model.Memory) {
+		mem.Embedding = vec
+		mem.EmbeddingModel = embedModel
+	})
+	return nil
+}
+
+func (r *memMemories) SetParent(ctx context.Context, id, parentID uint) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	r.m.memories.update(id, func(mem *model.Memory) { mem.ParentID = parentID })
+	return nil
+}
+
+func (r *memMemories) Children(ctx context.Context, id uint) ([]model.Memory, error) {
+	if id == 0 {
+		return nil, nil
+	}
+	r.m.mu.RLock()
+	defer r.m.mu.RUnlock()
+	return r.m.memories.scan(func(mem *model.Memory) bool { return mem.ParentID == id }), nil
+}
+
+func (r *memMemories) FindBySourceTasks(ctx context.Context, taskIDs []uint) ([]model.Memory, error) {
+	if len(taskIDs) == 0 {
+		return nil, nil
+	}
+	set := idSet(taskIDs)
+	r.m.mu.RLock()
+	defer r.m.mu.RUnlock()
+	return r.m.memories.scan(func(mem *model.Memory) bool { return set[mem.SourceTaskID] }), nil
+}
+
+func minFloat(a, b float64) float64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxFloat(a, b float64) float64 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+type memTasks struct {
+	m *memDB
+}
+
+func (r *memTasks) Create(ctx context.Context, t *model.Task) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	// 列默认值：rule_version=1、phase=train
+	if t.RuleVersion == 0 {
+		t.RuleVersion = 1
+	}
+	if t.Phase == "" {
+		t.Phase = model.TaskPhaseTrain
+	}
+	stamp(&t.ID, &t.CreatedAt, &t.UpdatedAt, time.Now(), r.m.tasks.nextID)
+	r.m.tasks.put(t.ID, *t)
+	return nil
+}
+
+func (r *memTasks) Get(ctx context.Context, id uint) (*model.Task, error) {
+	r.m.mu.RLock()
+	defer r.m.mu.RUnlock()
+	t, ok := r.m.tasks.rows[id]
+	if !ok || t.DeletedAt.Valid {
+		return nil, ErrNotFound
+	}
+	return &t, nil
+}
+
+func (r *memTasks) Find(ctx context.Context, f TaskFilter) ([]model.Task, error) {
+	r.m.mu.RLock()
+	defer r.m.mu.RUnlock()
+	out := r.m.tasks.scan(func(t *model.Task) bool {
+		switch {
+		case t.DeletedAt.Valid,
+			f.RunID > 0 && t.RunID != f.RunID,
+			f.TaskType != "" && t.TaskType != f.TaskType,
+			f.GroupType != "" && t.GroupType != f.GroupType,
+			f.Phase != "" && t.Phase != f.Phase,
+			f.ExcludePhase != "" && t.Phase == f.ExcludePhase,
+			f.WithThreshold && t.RuleThreshold <= 0:
+			return false
+		case f.CorrectOnly:
+			return t.IsCorrect != nil && *t.IsCorrect
+		case f.JudgedOnly:
+			return t.IsCorrect != nil
+		case f.PendingOnly:
+			return t.IsCorrect == nil
+		}
+		return true
+	})
+	switch f.Order {
+	case TaskOrderIDDesc:
+		sort.SliceStable(out, func(i, j int) bool { return out[i].ID > out[j].ID })
+	case TaskOrderRound:
+		sort.SliceStable(out, func(i, j int) bool { return out[i].Round < out[j].Round })
+	case TaskOrderNewest:
+		sort.SliceStable(out, func(i, j int) bool {
+			if !out[i].CreatedAt.Equal(out[j].CreatedAt) {
+				return out[i].CreatedAt.After(out[j].CreatedAt)
+			}
+			return out[i].ID > out[j].ID
+		})
+	}
+	return limitRows(out, f.Limit), nil
+}
+
+func (r *memTasks) updateAlive(id uint, fn func(*model.Task)) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	r.m.tasks.update(id, func(t *model.Task) {
+		if t.DeletedAt.Valid {
+			return
+		}
+		t.UpdatedAt = time.Now()
+		fn(t)
+	})
+}
+
+func (r *memTasks) SetCorrect(ctx context.Context, id uint, correct bool) error {
+	r.updateAlive(id, func(t *model.Task) {
+		t.IsCorrect = &correct
+	})
+	return nil
+}
+
+func (r *memTasks) SetRoundInfo(ctx context.Context, src *model.Task) error {
+	r.updateAlive(src.ID, func(t *model.Task) {
+		t.Round = src.Round
+		t.RuleMode = src.RuleMode
+		t.RuleVersion = src.RuleVersion
+		t.RuleThreshold = src.RuleThreshold
+	})
+	return nil
+}
+
+func (r *memTasks) DeleteByIDs(ctx context.Context, ids []uint) error {
+	for _, id := range ids {
+		r.updateAlive(id, func(t *model.Task) {
+			softDelete(&t.DeletedAt)
+		})
+	}
+	return nil
+}
+
+type memFeedbacks struct {
+	m *memDB
+}
+
+func (r *memFeedbacks) Create(ctx context.Context, f *model.Feedback) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	stamp(&f.ID, &f.CreatedAt, &f.UpdatedAt, time.Now(), r.m.feedbacks.nextID)
+	r.m.feedbacks.put(f.ID, *f)
+	return nil
+}
+
+func (r *memFeedbacks) Get(ctx context.Context, id uint) (*model.Feedback, error) {
+	r.m.mu.RLock()
+	defer r.m.mu.RUnlock()
+	f, ok := r.m.feedbacks.rows[id]
+	if !ok || f.DeletedAt.Valid {
+		return nil, ErrNotFound
+	}
+	return &f, nil
+}
+
+func (r *memFeedbacks) Save(ctx context.Context, f *model.Feedback) error {
+	if f.ID == 0 {
+		return r.Create(ctx, f)
+	}
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	f.UpdatedAt = time.Now()
+	r.m.feedbacks.put(f.ID, *f)
+	return nil
+}
+
+func (r *memFeedbacks) LatestByTask(ctx context.Context, taskID uint) (*model.Feedback, error) {
+	r.m.mu.RLock()
+	defer r.m.mu.RUnlock()
+	out := r.m.feedbacks.scan(func(f *model.Feedback) bool { return !f.DeletedAt.Valid && f.TaskID == taskID })
+	if len(out) == 0 {
+		return nil, ErrNotFound
+	}
+	return &out[len(out)-1], nil
+}
+
+func (r *memFeedbacks) RecentIncorrect(ctx context.Context, runID uint, taskType string, limit int) ([]model.Feedback, error) {
+	r.m.mu.RLock()
+	defer r.m.mu.RUnlock()
+	out := r.m.feedbacks.scan(func(f *model.Feedback) bool {
+		if f.DeletedAt.Valid || f.RunID != runID || f.Type != "incorrect" {
+			return false
+		}
+		// JOIN tasks 不带软删除条件：已软删除的任务同样参与匹配
+		t, ok := r.m.tasks.rows[f.TaskID]
+		return ok && t.TaskType == taskType && t.Phase != model.TaskPhaseEval
+	})
+	sort.SliceStable(out, func(i, j int) bool { return out[i].ID > out[j].ID })
+	return limitRows(out, limit), nil
+}
+
+type memTaskLogs struct {
+	m *memDB
+}
+
+func (r *memTaskLogs) Create(ctx context.Context, l *model.TaskLog) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	stamp(&l.ID, &l.CreatedAt, &l.UpdatedAt, time.Now(), r.m.taskLogs.nextID)
+	r.m.taskLogs.put(l.ID, *l)
+	return nil
+}
+
+func (r *memTaskLogs) DeleteByTaskIDs(ctx context.Context, taskIDs []uint) error {
+	if len(taskIDs) == 0 {
+		return nil
+	}
+	set := idSet(taskIDs)
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	for _, l := range r.m.taskLogs.scan(func(l *model.TaskLog) bool { return !l.DeletedAt.Valid && set[l.TaskID] }) {
+		r.m.taskLogs.update(l.ID, func(l *model.TaskLog) {
+			l.UpdatedAt = time.Now()
+			softDelete(&l.DeletedAt)
+		})
+	}
+	return nil
+}
+
+type memRuns struct {
+	m *memDB
+}
+
+func (r *memRuns) update(id uint, fn func(*model.ExperimentRun)) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	r.m.runs.update(id, func(run *model.ExperimentRun) {
+		if run.DeletedAt.Valid {
+			return
+		}
+		run.UpdatedAt = time.Now()
+		fn(run)
+	})
+	return nil
+}
+
+func (r *memRuns) Create(ctx context.Context, run *model.ExperimentRun) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	stamp(&run.ID, &run.CreatedAt, &run.UpdatedAt, time.Now(), r.m.runs.nextID)
+	r.m.runs.put(run.ID, *run)
+	return nil
+}
+
+func (r *memRuns) Get(ctx context.Context, id uint) (*model.ExperimentRun, error) {
+	r.m.mu.RLock()
+	defer r.m.mu.RUnlock()
+	run, ok := r.m.runs.rows[id]
+	if !ok || run.DeletedAt.Valid {
+		return nil, ErrNotFound
+	}
+	return &run, nil
+}
+
+func (r *memRuns) Save(ctx context.Context, run *model.ExperimentRun) error {
+	if run.ID == 0 {
+		return r.Create(ctx, run)
+	}
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	run.UpdatedAt = time.Now()
+	r.m.runs.put(run.ID, *run)
+	return nil
+}
+
+func (r *memRuns) find(keep func(*model.ExperimentRun) bool) []model.ExperimentRun {
+	r.m.mu.RLock()
+	defer r.m.mu.RUnlock()
+	return r.m.runs.scan(func(run *model.ExperimentRun) bool { return !run.DeletedAt.Valid && keep(run) })
+}
+
+func (r *memRuns) Latest(ctx context.Context, taskType, ruleMode string) (*model.ExperimentRun, error) {
+	runs := r.find(func(run *model.ExperimentRun) bool {
+		return run.RuleMode == ruleMode && run.TaskType == taskType
+	})
+	if len(runs) == 0 {
+		return nil, ErrNotFound
+	}
+	return &runs[len(runs)-1], nil
+}
+
+func (r *memRuns) Find(ctx context.Context, f RunFilter) ([]model.ExperimentRun, error) {
+	return r.find(func(run *model.ExperimentRun) bool {
+		return (f.TaskType == "" || run.TaskType == f.TaskType) &&
+			(f.RuleMode == "" || run.RuleMode == f.RuleMode) &&
+			(f.Status == "" || run.Status == f.Status) &&
+			(f.From.IsZero() || !run.CreatedAt.Before(f.From)) &&
+			(f.To.IsZero() || run.CreatedAt.Before(f.To))
+	}), nil
+}
+
+func (r *memRuns) ListBySweep(ctx context.Context, sweepID uint) ([]model.ExperimentRun, error) {
+	return r.find(func(run *model.ExperimentRun) bool { return run.SweepID == sweepID }), nil
+}
+
+func (r *memRuns) CountBySweep(ctx context.Context, sweepID uint, status string) (int64, error) {
+	runs := r.find(func(run *model.ExperimentRun) bool { return run.SweepID == sweepID && run.Status == status })
+	return int64(len(runs)), nil
+}
+
+func (r *memRuns) MarkStarted(ctx context.Context, id uint, at time.Time) error {
+	return r.update(id, func(run *model.ExperimentRun) {
+		run.Status = model.ExperimentRunStatusRunning
+		run.StartedAt = timePtr(at)
+	})
+}
+
+func (r *memRuns) SetCurrentRound(ctx context.Context, id uint, round int) error {
+	return r.update(id, func(run *model.ExperimentRun) {
+		run.CurrentRound = round
+	})
+}
+
+func (r *memRuns) SetProgress(ctx context.Context, id uint, completedRounds, errorCount int) error {
+	return r.update(id, func(run *model.ExperimentRun) {
+		run.CompletedRounds = completedRounds
+		run.ErrorCount = errorCount
+	})
+}
+
+func (r *memRuns) MarkStatus(ctx context.Context, id uint, status, errMsg string, at time.Time) error {
+	return r.update(id, func(run *model.ExperimentRun) {
+		run.Status = status
+		run.FinishedAt = timePtr(at)
+		if errMsg != "" {
+			run.ErrorMessage = errMsg
+		}
+	})
+}
+
+func (r *memRuns) Requeue(ctx context.Context, id uint) error {
+	return r.update(id, func(run *model.ExperimentRun) {
+		run.Status = model.ExperimentRunStatusQueued
+		run.ErrorMessage = ""
+		run.FinishedAt = nil
+	})
+}
+
+type memSweeps struct {
+	m *memDB
+}
+
+func (r *memSweeps) update(id uint, fn func(*model.ExperimentSweep)) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	r.m.sweeps.update(id, func(s *model.ExperimentSweep) {
+		if s.DeletedAt.Valid {
+			return
+		}
+		s.UpdatedAt = time.Now()
+		fn(s)
+	})
+	return nil
+}
+
+func (r *memSweeps) Create(ctx context.Context, s *model.ExperimentSweep) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	stamp(&s.ID, &s.CreatedAt, &s.UpdatedAt, time.Now(), r.m.sweeps.nextID)
+	r.m.sweeps.put(s.ID, *s)
+	return nil
+}
+
+func (r *memSweeps) Get(ctx context.Context, id uint) (*model.ExperimentSweep, error) {
+	r.m.mu.RLock()
+	defer r.m.mu.RUnlock()
+	s, ok := r.m.sweeps.rows[id]
+	if !ok || s.DeletedAt.Valid {
+		return nil, ErrNotFound
+	}
+	return &s, nil
+}
+
+func (r *memSweeps) MarkStarted(ctx context.Context, id uint, at time.Time) error {
+	return r.update(id, func(s *model.ExperimentSweep) {
+		s.Status = model.ExperimentRunStatusRunning
+		s.StartedAt = timePtr(at)
+	})
+}
+
+func (r *memSweeps) SetCompletedRuns(ctx context.Context, id uint, n int) error {
+	return r.update(id, func(s *model.ExperimentSweep) {
+		s.CompletedRuns = n
+	})
+}
+
+func (r *memSweeps) MarkStatus(ctx context.Context, id uint, status string, at time.Time) error {
+	return r.update(id, func(s *model.ExperimentSweep) {
+		s.Status = status
+		s.FinishedAt = timePtr(at)
+	})
+}
+
+func (r *memSweeps) SetReportPaths(ctx context.Context, id uint, jsonPath, markdownPath string) error {
+	return r.update(id, func(s *model.ExperimentSweep) {
+		s.ReportPath = jsonPath
+		s.ReportMarkdownPath = markdownPath
+	})
+}
+
+type memSnapshots struct {
+	m *memDB
+}
+
+func (r *memSnapshots) Create(ctx context.Context, s *model.GlobalPoolSnapshot, items []model.GlobalPoolSnapshotItem) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	now := time.Now()
+	stamp(&s.ID, &s.CreatedAt, &s.UpdatedAt, now, r.m.snapshots.nextID)
+	r.m.snapshots.put(s.ID, *s)
+	for i := range items {
+		items[i].SnapshotID = s.ID
+		stamp(&items[i].ID, &items[i].CreatedAt, nil, now, r.m.snapshotItems.nextID)
+		r.m.snapshotItems.put(items[i].ID, items[i])
+	}
+	return nil
+}
+
+func (r *memSnapshots) Get(ctx context.Context, id uint) (*model.GlobalPoolSnapshot, error) {
+	r.m.mu.RLock()
+	defer r.m.mu.RUnlock()
+	s, ok := r.m.snapshots.rows[id]
+	if !ok || s.DeletedAt.Valid {
+		return nil, ErrNotFound
+	}
+	return &s, nil
+}
+
+func (r *memSnapshots) Items(ctx context.Context, snapshotID uint) ([]model.GlobalPoolSnapshotItem, error) {
+	r.m.mu.RLock()
+	defer r.m.mu.RUnlock()
+	return r.m.snapshotItems.scan(func(it *model.GlobalPoolSnapshotItem) bool { return it.SnapshotID == snapshotID }), nil
+}
+
+func (r *memSnapshots) List(ctx context.Context, limit int) ([]model.GlobalPoolSnapshot, error) {
+	r.m.mu.RLock()
+	defer r.m.mu.RUnlock()
+	out := r.m.snapshots.scan(func(s *model.GlobalPoolSnapshot) bool { return !s.DeletedAt.Valid })
+	sort.SliceStable(out, func(i, j int) bool { return out[i].ID > out[j].ID })
+	return limitRows(out, limit), nil
+}
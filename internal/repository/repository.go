@@ -0,0 +1,198 @@
+// Package repository 存储抽象：服务层通过这里的接口读写记忆/任务/反馈/日志/run，
+// 不直接依赖具体数据库（MySQL / SQLite 由 database.driver 选择）
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"mem-test/internal/model"
+)
+
+// ErrNotFound 按 ID 查询的记录不存在
+var ErrNotFound = errors.New("记录不存在")
+
+// ApplyToAny 通用记忆的 apply_to，任何任务类型都可检索
+const ApplyToAny = "通用"
+
+// GlobalPoolPrefix 全局池记录的 derived_from 前缀（run_id=0 且以此开头）
+const GlobalPoolPrefix = "global|"
+
+// RetrieveQuery 记忆检索条件
+type RetrieveQuery struct {
+	// 0 表示常规模式（不按 run 过滤）；>0 时只检索该 run 的记忆
+	RunID uint
+	// RunID>0 时额外检索全局池（PoolRunID=0 为共享池，>0 为该 run 的隔离池）
+	IncludeGlobal bool
+	PoolRunID     uint
+	// 任务类型；apply_to 为该类型或“通用”的记忆命中
+	TaskType string
+	Limit    int
+}
+
+// MemoryRepository 外挂记忆
+type MemoryRepository interface {
+	Create(ctx context.Context, m *model.Memory) error
+	CreateBatch(ctx context.Context, ms []model.Memory) error
+	Get(ctx context.Context, id uint) (*model.Memory, error)
+	// List 按创建时间倒序；limit<=0 不限
+	List(ctx context.Context, limit int) ([]model.Memory, error)
+	Delete(ctx context.Context, id uint) error
+	// FindByIDs 含已软删除的记录（用于归因历史任务注入过的记忆）
+	FindByIDs(ctx context.Context, ids []uint) ([]model.Memory, error)
+
+	// Retrieve 排除已废弃的记忆，按“最近验证 > 版本 > 置信度 > 使用次数 > 更新时间”倒序取前 Limit 条
+	Retrieve(ctx context.Context, q RetrieveQuery) ([]model.Memory, error)
+	// LatestByTrigger 同一归并键的最新版本；runID=0 时不按 run 过滤
+	LatestByTrigger(ctx context.Context, runID uint, triggerKey, applyTo string) (*model.Memory, error)
+	// LatestInPool 全局池内同一归并键的最新版本
+	LatestInPool(ctx context.Context, poolRunID uint, triggerKey, applyTo string) (*model.Memory, error)
+	// ListPool 全局池全部记录（按 ID 升序）
+	ListPool(ctx context.Context, poolRunID uint) ([]model.Memory, error)
+	CountPool(ctx context.Context, poolRunID uint) (int64, error)
+
+	// MarkUsed 被检索注入 prompt：use_count+1、更新 last_used_at
+	MarkUsed(ctx context.Context, ids []uint, at time.Time) error
+	// MarkVerified 判对：更新 last_verified_at，置信度 +delta（上限 1）
+	MarkVerified(ctx context.Context, ids []uint, at time.Time, delta float64) error
+	// Penalize 判错：failure_count+1、置信度 -delta（下限 0），失败次数达到 failureThreshold 时标记废弃
+	Penalize(ctx context.Context, ids []uint, at time.Time, delta float64, failureThreshold int) error
+	// Reinforce 重复证据：置信度 +delta（上限 1）
+	Reinforce(ctx context.Context, id uint, at time.Time, delta float64) error
+	// SetEmbedding 只写向量列，不刷新 updated_at（避免补齐向量改变检索排序）
+	SetEmbedding(ctx context.Context, id uint, vec model.Vector, embedModel string) error
+	// SetParent 只写 parent_id，不刷新 updated_at（快照导入后补链接）
+	SetParent(ctx context.Context, id, parentID uint) error
+	// Children parent_id 指向 id 的记录（含已软删除，按 id 升序）
+	Children(ctx context.Context, id uint) ([]model.Memory, error)
+	// FindBySourceTasks 由这些任务反思产生的记录（含已软删除，按 id 升序）
+	FindBySourceTasks(ctx context.Context, taskIDs []uint) ([]model.Memory, error)
+}
+
+// TaskOrder 任务列表排序
+type TaskOrder int
+
+const (
+	TaskOrderID     TaskOrder = iota // id 升序
+	TaskOrderIDDesc                  // id 倒序
+	TaskOrderRound                   // round 升序，同轮按 id
+	TaskOrderNewest                  // created_at 倒序
+)
+
+// TaskFilter 任务查询条件；零值字段不参与过滤
+type TaskFilter struct {
+	RunID        uint
+	TaskType     string
+	GroupType    string
+	Phase        string
+	ExcludePhase string
+	// 只取已判题 / 未判题 / 判对的任务
+	JudgedOnly  bool
+	PendingOnly bool
+	CorrectOnly bool
+	// 只取记录了规则门槛（rule_threshold>0）的任务
+	WithThreshold bool
+	Order         TaskOrder
+	Limit         int
+}
+
+// TaskRepository 任务历史
+type TaskRepository interface {
+	Create(ctx context.Context, t *model.Task) error
+	Get(ctx context.Context, id uint) (*model.Task, error)
+	Find(ctx context.Context, f TaskFilter) ([]model.Task, error)
+	// SetCorrect 只写 is_correct，不覆盖其他列
+	SetCorrect(ctx context.Context, id uint, correct bool) error
+	// SetRoundInfo 写入 round / rule_mode / rule_version / rule_threshold
+	SetRoundInfo(ctx context.Context, t *model.Task) error
+	DeleteByIDs(ctx context.Context, ids []uint) error
+}
+
+// FeedbackRepository 反馈记录
+type FeedbackRepository interface {
+	Create(ctx context.Context, f *model.Feedback) error
+	Get(ctx context.Context, id uint) (*model.Feedback, error)
+	Save(ctx context.Context, f *model.Feedback) error
+	// LatestByTask 任务最近一条反馈；没有时返回 ErrNotFound
+	LatestByTask(ctx context.Context, taskID uint) (*model.Feedback, error)
+	// RecentIncorrect run 内同任务类型、非评估阶段的最近 limit 条判错反馈（按 id 倒序）
+	RecentIncorrect(ctx context.Context, runID uint, taskType string, limit int) ([]model.Feedback, error)
+}
+
+// TaskLogRepository 任务执行日志
+type TaskLogRepository interface {
+	Create(ctx context.Context, l *model.TaskLog) error
+	DeleteByTaskIDs(ctx context.Context, taskIDs []uint) error
+}
+
+// RunFilter run 查询条件；零值字段不参与过滤，From/To 按 created_at 左闭右开
+type RunFilter struct {
+	TaskType string
+	RuleMode string
+	Status   string
+	From     time.Time
+	To       time.Time
+}
+
+// RunRepository 实验 run
+type RunRepository interface {
+	Create(ctx context.Context, r *model.ExperimentRun) error
+	Get(ctx context.Context, id uint) (*model.ExperimentRun, error)
+	Save(ctx context.Context, r *model.ExperimentRun) error
+	// Latest 指定任务类型 + 规则变更模式下最新的 run
+	Latest(ctx context.Context, taskType, ruleMode string) (*model.ExperimentRun, error)
+	// Find 按 id 升序
+	Find(ctx context.Context, f RunFilter) ([]model.ExperimentRun, error)
+	// ListBySweep 按 id 升序
+	ListBySweep(ctx context.Context, sweepID uint) ([]model.ExperimentRun, error)
+	CountBySweep(ctx context.Context, sweepID uint, status string) (int64, error)
+
+	MarkStarted(ctx context.Context, id uint, at time.Time) error
+	SetCurrentRound(ctx context.Context, id uint, round int) error
+	SetProgress(ctx context.Context, id uint, completedRounds, errorCount int) error
+	// MarkStatus 写入状态与结束时间；errMsg 为空时保留原 error_message
+	MarkStatus(ctx context.Context, id uint, status, errMsg string, at time.Time) error
+	// Requeue 续跑：状态回到 queued，清空 error_message / finished_at
+	Requeue(ctx context.Context, id uint) error
+}
+
+// SweepRepository 矩阵实验
+type SweepRepository interface {
+	Create(ctx context.Context, s *model.ExperimentSweep) error
+	Get(ctx context.Context, id uint) (*model.ExperimentSweep, error)
+	MarkStarted(ctx context.Context, id uint, at time.Time) error
+	SetCompletedRuns(ctx context.Context, id uint, n int) error
+	MarkStatus(ctx context.Context, id uint, status string, at time.Time) error
+	SetReportPaths(ctx context.Context, id uint, jsonPath, markdownPath string) error
+}
+
+// SnapshotRepository 全局池快照
+type SnapshotRepository interface {
+	// Create 在同一事务内写入快照与条目（条目的 SnapshotID 由此填充）
+	Create(ctx context.Context, s *model.GlobalPoolSnapshot, items []model.GlobalPoolSnapshotItem) error
+	Get(ctx context.Context, id uint) (*model.GlobalPoolSnapshot, error)
+	// Items 按 id 升序
+	Items(ctx context.Context, snapshotID uint) ([]model.GlobalPoolSnapshotItem, error)
+	// List 按 id 倒序
+	List(ctx context.Context, limit int) ([]model.GlobalPoolSnapshot, error)
+}
+
+// Store 一个存储后端下的全部仓库
+type Store struct {
+	Memories  MemoryRepository
+	Tasks     TaskRepository
+	Feedbacks FeedbackRepository
+	TaskLogs  TaskLogRepository
+	Runs      RunRepository
+	Sweeps    SweepRepository
+	Snapshots SnapshotRepository
+
+	// reset 清空实验数据（task_logs/feedbacks/tasks/memories/experiment_runs）
+	reset func(ctx context.Context) error
+}
+
+// Reset 清空实验数据（task_logs/feedbacks/tasks/memories/experiment_runs），保留 sweep 与快照
+func (s *Store) Reset(ctx context.Context) error {
+	return s.reset(ctx)
+}
@@ -0,0 +1,293 @@
+package repository
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"mem-test/internal/model"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func openSQLiteStore(t *testing.T) *Store {
+	t.Helper()
+	gdb, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "repo.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := gdb.AutoMigrate(&model.Memory{}, &model.Task{}, &model.Feedback{}, &model.TaskLog{}, &model.ExperimentRun{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	store, err := NewGormStore(gdb)
+	if err != nil {
+		t.Fatalf("new store: %v", err)
+	}
+	return store
+}
+
+// eachStore 同一组断言分别跑 SQLite 与内存后端，保证两者语义一致
+func eachStore(t *testing.T, fn func(t *testing.T, store *Store)) {
+	t.Run("sqlite", func(t *testing.T) { fn(t, openSQLiteStore(t)) })
+	t.Run("memory", func(t *testing.T) { fn(t, NewMemoryStore()) })
+}
+
+// TestStore_MemoryLifecycle 检索排序/废弃过滤/置信度上下限在各后端下与 MySQL 语义一致
+func TestStore_MemoryLifecycle(t *testing.T) {
+	eachStore(t, func(t *testing.T, store *Store) {
+		ctx := context.Background()
+		mems := store.Memories
+
+		verified := time.Now().Add(-time.Hour)
+		seed := []model.Memory{
+			{RunID: 1, Trigger: "积分<", TriggerKey: "积分<", Lesson: "门槛100", ApplyTo: "lottery", Confidence: 0.99, Version: 1},
+			{RunID: 1, Trigger: "积分<", TriggerKey: "积分<", Lesson: "门槛120", ApplyTo: "lottery", Confidence: 0.5, Version: 2},
+			{RunID: 1, Trigger: "通用", TriggerKey: "通用", Lesson: "先读题", ApplyTo: ApplyToAny, Confidence: 0.5, Version: 1, LastVerifiedAt: &verified},
+			{RunID: 2, Trigger: "积分<", TriggerKey: "积分<", Lesson: "其他 run", ApplyTo: "lottery", Confidence: 0.9, Version: 9},
+			{RunID: 0, PoolRunID: 1, Trigger: "积分<", TriggerKey: "积分<", Lesson: "全局池", DerivedFrom: GlobalPoolPrefix + "src_run_id=1", ApplyTo: "lottery", Confidence: 0.5, Version: 1},
+		}
+		if err := mems.CreateBatch(ctx, seed); err != nil {
+			t.Fatalf("create: %v", err)
+		}
+
+		got, err := mems.Retrieve(ctx, RetrieveQuery{RunID: 1, TaskType: "lottery", Limit: 5})
+		if err != nil || len(got) != 3 || got[0].ID != seed[2].ID || got[1].ID != seed[1].ID {
+			t.Fatalf("run-only retrieve: %v %+v", err, got)
+		}
+		withPool, _ := mems.Retrieve(ctx, RetrieveQuery{RunID: 1, IncludeGlobal: true, PoolRunID: 1, TaskType: "lottery", Limit: 5})
+		if len(withPool) != 4 {
+			t.Fatalf("retrieve with pool should include the isolated pool record, got %d", len(withPool))
+		}
+
+		if err := mems.MarkVerified(ctx, []uint{seed[0].ID}, time.Now(), 0.05); err != nil {
+			t.Fatalf("mark verified: %v", err)
+		}
+		if m, _ := mems.Get(ctx, seed[0].ID); m.Confidence != 1 || m.LastVerifiedAt == nil {
+			t.Fatalf("confidence should be capped at 1: %+v", m)
+		}
+
+		for i := 0; i < 3; i++ {
+			if err := mems.Penalize(ctx, []uint{seed[1].ID}, time.Now(), 0.3, 3); err != nil {
+				t.Fatalf("penalize: %v", err)
+			}
+		}
+		m, _ := mems.Get(ctx, seed[1].ID)
+		if m.FailureCount != 3 || m.Confidence != 0 || !m.Deprecated || m.DeprecatedAt == nil {
+			t.Fatalf("penalize should floor confidence and deprecate: %+v", m)
+		}
+		if got, _ := mems.Retrieve(ctx, RetrieveQuery{RunID: 1, TaskType: "lottery", Limit: 5}); len(got) != 2 {
+			t.Fatalf("deprecated memory should be filtered, got %d", len(got))
+		}
+
+		latest, err := mems.LatestByTrigger(ctx, 1, "积分<", "lottery")
+		if err != nil || latest.Version != 2 {
+			t.Fatalf("latest by trigger: %v %+v", err, latest)
+		}
+		if _, err := mems.LatestInPool(ctx, 0, "积分<", "lottery"); err != ErrNotFound {
+			t.Fatalf("shared pool is empty, want ErrNotFound, got %v", err)
+		}
+
+		if err := mems.Delete(ctx, seed[0].ID); err != nil {
+			t.Fatalf("delete: %v", err)
+		}
+		if _, err := mems.Get(ctx, seed[0].ID); err != ErrNotFound {
+			t.Fatalf("deleted memory should be hidden, got %v", err)
+		}
+		if found, _ := mems.FindByIDs(ctx, []uint{seed[0].ID}); len(found) != 1 {
+			t.Fatalf("FindByIDs should include soft-deleted memories")
+		}
+	})
+}
+
+// TestStore_RetrieveOrderParity 逐级打平排序键，内存后端的检索顺序与 SQL ORDER BY 完全一致
+func TestStore_RetrieveOrderParity(t *testing.T) {
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.Local)
+	at := func(minutes int) *time.Time {
+		v := base.Add(time.Duration(minutes) * time.Minute)
+		return &v
+	}
+	seed := []model.Memory{
+		{Lesson: "未验证-旧", Version: 3, Confidence: 0.9, UseCount: 5, UpdatedAt: base},
+		{Lesson: "未验证-新", Version: 3, Confidence: 0.9, UseCount: 5, UpdatedAt: *at(1)},
+		{Lesson: "验证早", Version: 1, Confidence: 0.5, LastVerifiedAt: at(1), UpdatedAt: base},
+		{Lesson: "验证晚", Version: 1, Confidence: 0.5, LastVerifiedAt: at(2), UpdatedAt: base},
+		{Lesson: "同验证-高版本", Version: 2, Confidence: 0.3, LastVerifiedAt: at(2), UpdatedAt: base},
+		{Lesson: "同版本-高置信", Version: 1, Confidence: 0.8, LastVerifiedAt: at(2), UpdatedAt: base},
+		{Lesson: "同置信-多使用", Version: 1, Confidence: 0.5, UseCount: 4, LastVerifiedAt: at(2), UpdatedAt: base},
+		{Lesson: "未验证-低版本", Version: 1, Confidence: 0.99, UseCount: 9, UpdatedAt: *at(5)},
+	}
+	want := []string{"同验证-高版本", "同版本-高置信", "同置信-多使用", "验证晚", "验证早", "未验证-新", "未验证-旧", "未验证-低版本"}
+
+	eachStore(t, func(t *testing.T, store *Store) {
+		ctx := context.Background()
+		rows := make([]model.Memory, len(seed))
+		copy(rows, seed)
+		for i := range rows {
+			rows[i].RunID, rows[i].ApplyTo, rows[i].Trigger, rows[i].TriggerKey = 1, "lottery", "积分<", "积分<"
+		}
+		if err := store.Memories.CreateBatch(ctx, rows); err != nil {
+			t.Fatalf("create: %v", err)
+		}
+		got, err := store.Memories.Retrieve(ctx, RetrieveQuery{RunID: 1, TaskType: "lottery", Limit: len(rows)})
+		if err != nil || len(got) != len(want) {
+			t.Fatalf("retrieve: %v, got %d rows", err, len(got))
+		}
+		for i, m := range got {
+			if m.Lesson != want[i] {
+				t.Fatalf("position %d: want %s, got %s", i, want[i], m.Lesson)
+			}
+		}
+	})
+}
+
+// TestStore_TasksAndFeedbacks 任务过滤/排序、判错反馈排除评估阶段、Reset 后清空
+func TestStore_TasksAndFeedbacks(t *testing.T) {
+	eachStore(t, func(t *testing.T, store *Store) {
+		ctx := context.Background()
+		tasks := []*model.Task{
+			{RunID: 1, TaskType: "lottery", Input: "{}", Round: 2},
+			{RunID: 1, TaskType: "lottery", Input: "{}", Round: 1, Phase: model.TaskPhaseEval},
+			{RunID: 1, TaskType: "lottery", Input: "{}", Round: 1},
+		}
+		for _, task := range tasks {
+			if err := store.Tasks.Create(ctx, task); err != nil {
+				t.Fatalf("create task: %v", err)
+			}
+		}
+		if err := store.Tasks.SetCorrect(ctx, tasks[0].ID, false); err != nil {
+			t.Fatalf("set correct: %v", err)
+		}
+
+		byRound, _ := store.Tasks.Find(ctx, TaskFilter{RunID: 1, Order: TaskOrderRound})
+		if len(byRound) != 3 || byRound[0].ID != tasks[1].ID || byRound[2].ID != tasks[0].ID {
+			t.Fatalf("round order: %+v", byRound)
+		}
+		train, _ := store.Tasks.Find(ctx, TaskFilter{RunID: 1, ExcludePhase: model.TaskPhaseEval})
+		if len(train) != 2 || train[0].Phase != model.TaskPhaseTrain || train[0].RuleVersion != 1 {
+			t.Fatalf("default phase/rule_version should apply: %+v", train)
+		}
+		judged, _ := store.Tasks.Find(ctx, TaskFilter{RunID: 1, JudgedOnly: true})
+		if len(judged) != 1 || judged[0].IsCorrect == nil || *judged[0].IsCorrect {
+			t.Fatalf("judged filter: %+v", judged)
+		}
+
+		for _, task := range tasks {
+			if err := store.Feedbacks.Create(ctx, &model.Feedback{RunID: 1, TaskID: task.ID, Type: "incorrect", Content: "x"}); err != nil {
+				t.Fatalf("create feedback: %v", err)
+			}
+		}
+		recent, _ := store.Feedbacks.RecentIncorrect(ctx, 1, "lottery", 5)
+		if len(recent) != 2 || recent[0].TaskID != tasks[2].ID || recent[1].TaskID != tasks[0].ID {
+			t.Fatalf("recent incorrect should skip eval tasks, newest first: %+v", recent)
+		}
+
+		if err := store.Reset(ctx); err != nil {
+			t.Fatalf("reset: %v", err)
+		}
+		if left, _ := store.Tasks.Find(ctx, TaskFilter{}); len(left) != 0 {
+			t.Fatalf("reset should clear tasks, got %d", len(left))
+		}
+	})
+}
+
+// TestStore_Lineage parent_id 链接与子版本查询（含已软删除）
+func TestStore_Lineage(t *testing.T) {
+	eachStore(t, func(t *testing.T, store *Store) {
+		ctx := context.Background()
+		ms := []model.Memory{
+			{RunID: 1, Trigger: "积分<100", TriggerKey: "积分<", Lesson: "v1", ApplyTo: "lottery"},
+			{RunID: 1, Trigger: "积分<120", TriggerKey: "积分<", Lesson: "v2", ApplyTo: "lottery", Version: 2},
+			{RunID: 1, Trigger: "积分<100", TriggerKey: "积分<", Lesson: "v3", ApplyTo: "lottery", Version: 3},
+		}
+		if err := store.Memories.CreateBatch(ctx, ms); err != nil {
+			t.Fatalf("seed: %v", err)
+		}
+		before, _ := store.Memories.Get(ctx, ms[1].ID)
+		if err := store.Memories.SetParent(ctx, ms[1].ID, ms[0].ID); err != nil {
+			t.Fatalf("set parent: %v", err)
+		}
+		_ = store.Memories.SetParent(ctx, ms[2].ID, ms[1].ID)
+		if err := store.Memories.Delete(ctx, ms[1].ID); err != nil {
+			t.Fatalf("delete: %v", err)
+		}
+
+		kids, err := store.Memories.Children(ctx, ms[0].ID)
+		if err != nil || len(kids) != 1 || kids[0].ID != ms[1].ID || !kids[0].DeletedAt.Valid {
+			t.Fatalf("children should include soft-deleted rows: %v %+v", err, kids)
+		}
+		if !kids[0].UpdatedAt.Equal(before.UpdatedAt) {
+			t.Fatalf("set parent should not touch updated_at")
+		}
+		if kids, _ := store.Memories.Children(ctx, ms[1].ID); len(kids) != 1 || kids[0].ParentID != ms[1].ID {
+			t.Fatalf("grandchild: %+v", kids)
+		}
+		if kids, _ := store.Memories.Children(ctx, 0); len(kids) != 0 {
+			t.Fatalf("roots are not children of 0: %+v", kids)
+		}
+	})
+}
+
+// TestStore_SourceLookups 按来源任务查记忆（含已软删除）与任务最近一条反馈
+func TestStore_SourceLookups(t *testing.T) {
+	eachStore(t, func(t *testing.T, store *Store) {
+		ctx := context.Background()
+		ms := []model.Memory{
+			{RunID: 1, Trigger: "积分<100", TriggerKey: "积分<", Lesson: "v1", ApplyTo: "lottery", SourceTaskID: 7},
+			{RunID: 1, Trigger: "积分<120", TriggerKey: "积分<", Lesson: "v2", ApplyTo: "lottery", SourceTaskID: 8},
+			{RunID: 1, Trigger: "积分<100", TriggerKey: "积分<", Lesson: "v3", ApplyTo: "lottery"},
+		}
+		if err := store.Memories.CreateBatch(ctx, ms); err != nil {
+			t.Fatalf("seed: %v", err)
+		}
+		_ = store.Memories.Delete(ctx, ms[1].ID)
+		got, err := store.Memories.FindBySourceTasks(ctx, []uint{7, 8, 9})
+		if err != nil || len(got) != 2 || got[0].ID != ms[0].ID || got[1].ID != ms[1].ID {
+			t.Fatalf("find by source tasks: %v %+v", err, got)
+		}
+		if got, _ := store.Memories.FindBySourceTasks(ctx, nil); len(got) != 0 {
+			t.Fatalf("empty ids: %+v", got)
+		}
+
+		for _, typ := range []string{"correct", "incorrect"} {
+			if err := store.Feedbacks.Create(ctx, &model.Feedback{TaskID: 7, RunID: 1, Type: typ}); err != nil {
+				t.Fatalf("feedback: %v", err)
+			}
+		}
+		if f, err := store.Feedbacks.LatestByTask(ctx, 7); err != nil || f.Type != "incorrect" {
+			t.Fatalf("latest feedback: %v %+v", err, f)
+		}
+		if _, err := store.Feedbacks.LatestByTask(ctx, 8); err != ErrNotFound {
+			t.Fatalf("missing feedback: %v", err)
+		}
+	})
+}
+
+// TestMemoryStore_ConcurrentUpdates 并发的原子更新不丢失（对应 SQL 的 use_count = use_count + 1）
+func TestMemoryStore_ConcurrentUpdates(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	m := &model.Memory{RunID: 1, Trigger: "积分<", TriggerKey: "积分<", Lesson: "x", ApplyTo: "lottery"}
+	if err := store.Memories.Create(ctx, m); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	const workers = 16
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = store.Memories.MarkUsed(ctx, []uint{m.ID}, time.Now())
+			_, _ = store.Memories.Retrieve(ctx, RetrieveQuery{RunID: 1, TaskType: "lottery", Limit: 5})
+		}()
+	}
+	wg.Wait()
+
+	got, _ := store.Memories.Get(ctx, m.ID)
+	if got.UseCount != workers || got.Confidence != 0.5 || got.Version != 1 {
+		t.Fatalf("want use_count=%d with column defaults applied, got %+v", workers, got)
+	}
+}
@@ -26,10 +26,10 @@ func SetupRouter(cfg *service.ServiceContext) *gin.Engine {
 	})
 
 	// 初始化handlers
-	taskHandler := handler.NewTaskHandler(cfg.AgentService, cfg.CoachService, cfg.ReflectionService)
-	memoryHandler := handler.NewMemoryHandler()
-	experimentRunner := service.NewExperimentRunner(cfg.AgentService, cfg.CoachService, cfg.ReflectionService)
-	experimentHandler := handler.NewExperimentHandler(experimentRunner)
+	taskHandler := handler.NewTaskHandler(cfg.Store, cfg.AgentService, cfg.CoachService, cfg.ReflectionService)
+	memoryHandler := handler.NewMemoryHandler(cfg.Store)
+	experimentRunner := service.NewExperimentRunner(cfg.Store, cfg.AgentService, cfg.CoachService, cfg.ReflectionService, cfg.Cassette)
+	experimentHandler := handler.NewExperimentHandler(cfg.Store, experimentRunner)
 
 	// API路由
 	api := r.Group("/api")
@@ -48,6 +48,7 @@ func SetupRouter(cfg *service.ServiceContext) *gin.Engine {
 		{
 			memories.GET("", memoryHandler.ListMemories)
 			memories.GET("/:id", memoryHandler.GetMemory)
+			memories.GET("/:id/history", memoryHandler.GetMemoryHistory)
 			memories.DELETE("/:id", memoryHandler.DeleteMemory)
 		}
 
@@ -55,11 +56,24 @@ func SetupRouter(cfg *service.ServiceContext) *gin.Engine {
 		experiments := api.Group("/experiments")
 		{
 			experiments.GET("/stats", experimentHandler.GetExperimentStats)
+			experiments.GET("/groups", experimentHandler.ListGroups)
 			experiments.GET("/compare", experimentHandler.CompareGroups)
 			experiments.GET("/compare-modes", experimentHandler.CompareGroupsByModes)
 			experiments.GET("/trend", experimentHandler.GetErrorTrend)
 			experiments.POST("/reset", experimentHandler.ResetAll)
 			experiments.POST("/run", experimentHandler.RunExperiment)
+			experiments.GET("/runs/:id/status", experimentHandler.GetRunStatus)
+			experiments.GET("/runs/:id/events", experimentHandler.StreamRunEvents)
+			experiments.POST("/runs/:id/cancel", experimentHandler.CancelRun)
+			experiments.POST("/runs/:id/resume", experimentHandler.ResumeRun)
+			experiments.POST("/sweeps", experimentHandler.RunSweep)
+			experiments.GET("/sweeps/:id", experimentHandler.GetSweep)
+			experiments.GET("/sweeps/:id/report", experimentHandler.GetSweepReport)
+			experiments.POST("/sweeps/:id/cancel", experimentHandler.CancelSweep)
+			experiments.GET("/meta-analysis", experimentHandler.GetMetaAnalysis)
+			experiments.GET("/pool-snapshots", experimentHandler.ListPoolSnapshots)
+			experiments.POST("/pool-snapshots", experimentHandler.CreatePoolSnapshot)
+			experiments.GET("/pool-snapshots/:id", experimentHandler.GetPoolSnapshot)
 		}
 	}
 
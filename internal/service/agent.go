@@ -11,19 +11,24 @@ import (
 	"sync"
 	"time"
 
-	"mem-test/internal/db"
 	"mem-test/internal/model"
-
-	"gorm.io/gorm"
+	"mem-test/internal/repository"
 )
 
 type AgentService struct {
-	difyClient    *DifyClient
+	store         *repository.Store
+	llm           LLMProvider
 	memosClient   *MemOSClient
 	memosUserPref string
 
+	groups *GroupRegistry
+	// 按任务输入语义重排检索结果（retrieval.mode=semantic）；nil 时只用仓库排序（默认 recency）
+	retriever *SemanticRetriever
+	// keywords 非 nil 时按 BM25 关键词检索（retrieval.mode=bm25），优先于 retriever
+	keywords *repository.KeywordIndex
+
 	fMu     sync.Mutex
-	fStates map[string]*fRunState // key=runID:taskType
+	fStates map[string]*fRunState // key=runID:taskType:group
 }
 
 type memoryScope int
@@ -33,15 +38,34 @@ const (
 	memoryScopeRunAndGlobal
 )
 
-func NewAgentService(difyClient *DifyClient, memosClient *MemOSClient, memosUserPref string) *AgentService {
+func NewAgentService(store *repository.Store, llm LLMProvider, memosClient *MemOSClient, memosUserPref string) *AgentService {
 	return &AgentService{
-		difyClient:    difyClient,
+		store:         store,
+		llm:           llm,
 		memosClient:   memosClient,
 		memosUserPref: memosUserPref,
+		groups:        NewGroupRegistry(),
 		fStates:       map[string]*fRunState{},
 	}
 }
 
+// RetrievalLabel 当前记忆检索方式（写入 experiment_runs.retrieval，区分不同检索方式跑出的 run）：
+// recency / bm25 / semantic:<embedder>
+func (s *AgentService) RetrievalLabel() string {
+	switch {
+	case s.keywords != nil:
+		return RetrievalModeBM25
+	case s.retriever != nil:
+		return RetrievalModeSemantic + ":" + s.retriever.Embedder.Name()
+	}
+	return RetrievalModeRecency
+}
+
+// Groups 实验组注册表（runner/统计按它决定各组行为）
+func (s *AgentService) Groups() *GroupRegistry {
+	return s.groups
+}
+
 const (
 	// memosFallbackMinLocalHits：本地命中少于该值，且置信度较低时，认为“很弱”
 	memosFallbackMinLocalHits  = 2
@@ -55,6 +79,12 @@ func (s *AgentService) ExecuteTask(ctx context.Context, taskType, input string,
 
 // ExecuteTaskInRun 论文级实验：同一次 run 内严格隔离检索范围
 func (s *AgentService) ExecuteTaskInRun(ctx context.Context, runID uint, taskType, input string, groupType string, useMemory bool) (*model.Task, error) {
+	return s.ExecuteTaskWithStrategy(ctx, runID, taskType, input, s.groups.Resolve(groupType), useMemory)
+}
+
+// ExecuteTaskWithStrategy 按给定组策略执行（实验 runner 传入叠加了消融开关的策略）
+func (s *AgentService) ExecuteTaskWithStrategy(ctx context.Context, runID uint, taskType, input string, strategy GroupStrategy, useMemory bool) (*model.Task, error) {
+	groupType := strategy.Name
 	var relevantMemories []model.Memory
 	var memoryIDs []string
 	var logCases []model.Task
@@ -63,45 +93,34 @@ func (s *AgentService) ExecuteTaskInRun(ctx context.Context, runID uint, taskTyp
 	inputFeatures := extractInputFeatures(taskType, input)
 
 	// 如果使用记忆，检索相关记忆
-	if useMemory {
-		// B 组：检索历史“案例日志”，不做规则抽象
-		if groupType == "B" {
-			cases, err := s.retrieveTaskLogs(ctx, runID, taskType)
+	if useMemory && strategy.UsesMemory() {
+		// B 组（retrieval=logs）：检索历史“案例日志”，不做规则抽象
+		if strategy.Retrieval == RetrievalLogs {
+			cases, err := s.retrieveTaskLogs(ctx, runID, taskType, groupType, strategy.MemoryLimit)
 			if err == nil {
 				logCases = cases
 			}
 		} else {
 			scope := memoryScopeRunOnly
-			if groupType == "D" || groupType == "E" || groupType == "F" {
-				// D 组：跨 run 复用“全局中期记忆池”（run_id=0 且 global 前缀）+ 当前 run 内的新记忆
+			if strategy.Scope == ScopeRunGlobal {
+				// D/E/F 组：跨 run 复用“全局中期记忆池”（run_id=0 且 global 前缀）+ 当前 run 内的新记忆
 				scope = memoryScopeRunAndGlobal
-				if runID > 0 {
-					limit := 2
-					if groupType == "E" {
-						limit = 3
-					}
-					if groupType == "F" {
-						limit = 4
-					}
-					if rec, err := s.retrieveRecentIncorrectFeedbacks(ctx, runID, taskType, limit); err == nil {
-						recentIncorrectFeedbacks = rec
-					}
-				}
 			}
-			// C/D/E/F 组：检索抽象规则记忆
-			memLimit := 5
-			if groupType == "F" {
-				// F 组：需要更多候选做“竞争/探索”，避免高频变更下被 top1 锁死
-				memLimit = 12
+			// 短期记忆：本 run 最近的判错反馈
+			if runID > 0 && strategy.STMLimit > 0 {
+				if rec, err := s.retrieveRecentIncorrectFeedbacks(ctx, runID, taskType, strategy.STMLimit); err == nil {
+					recentIncorrectFeedbacks = rec
+				}
 			}
-			memories, err := s.retrieveMemoriesWithLimit(ctx, runID, taskType, input, scope, memLimit)
+			// C/D/E/F 组：检索抽象规则记忆（F 组需要更多候选做“竞争/探索”，避免高频变更下被 top1 锁死）
+			memories, err := s.retrieveMemoriesWithLimit(ctx, runID, taskType, input, scope, strategy.PoolRunID, strategy.MemoryLimit, strategy.Frozen)
 			if err == nil {
 				// E 组：按输入相关性重排（优先阈值更接近当前 points 的规则，减少无关规则污染）
-				if groupType == "E" {
+				if strategy.Rerank {
 					memories = rerankMemoriesByInput(taskType, inputFeatures, memories)
 				}
-				if groupType == "F" {
-					memories = s.selectFMemories(runID, taskType, memories)
+				if strategy.Bandit {
+					memories = s.selectFMemories(runID, taskType, groupType, memories)
 				}
 				relevantMemories = memories
 				var ids []uint
@@ -109,23 +128,16 @@ func (s *AgentService) ExecuteTaskInRun(ctx context.Context, runID uint, taskTyp
 					memoryIDs = append(memoryIDs, fmt.Sprintf("%d", m.ID))
 					ids = append(ids, m.ID)
 				}
-				// 原子更新使用次数 + 最近使用时间（避免并发丢更新）
-				if len(ids) > 0 {
-					now := time.Now()
-					_ = db.DB.WithContext(ctx).
-						Model(&model.Memory{}).
-						Where("id IN ?", ids).
-						Updates(map[string]interface{}{
-							"use_count":    gorm.Expr("use_count + 1"),
-							"last_used_at": now,
-						}).Error
+				// 原子更新使用次数 + 最近使用时间（避免并发丢更新）；评估阶段冻结，不影响后续检索排序
+				if len(ids) > 0 && !strategy.Frozen {
+					_ = s.store.Memories.MarkUsed(ctx, ids, time.Now())
 				}
 			}
 
 			// MemOS 外部长期记忆检索：
 			// - 常规模式（run_id=0）：本地记忆为空/很弱时补充
-			// - 实验 D 组（run_id>0 且 group=D）：允许使用 MemOS（用户显式要求 D 组使用 MemOS）
-			useMemOS := (runID == 0) || (groupType == "D") || (groupType == "E") || (groupType == "F")
+			// - 实验中：仅 memos=true 的组（D/E/F）允许使用
+			useMemOS := (runID == 0) || strategy.MemOS
 			if useMemOS && s.shouldFallbackToMemOS(relevantMemories) && s.memosClient != nil && s.memosClient.Enabled() {
 				userID := s.memOSUserID(taskType)
 				// 尝试注册（多数实现会幂等；失败不影响主流程）
@@ -142,47 +154,39 @@ func (s *AgentService) ExecuteTaskInRun(ctx context.Context, runID uint, taskTyp
 		}
 	}
 
-	// 构建提示词（E 组采用两阶段：先答题、再自检纠错）
+	// 构建提示词（self_check 组采用两阶段：先答题、再自检纠错）
 	prompt := s.buildPrompt(taskType, input, relevantMemories, logCases, externalMemories, recentIncorrectFeedbacks)
 
-	// 调用Dify（智能选择chat或completion模式）
-	var inputs map[string]interface{}
-	if s.difyClient != nil && s.difyClient.AppType == "workflow" {
-		systemKey := s.difyClient.WorkflowSystemKey
-		queryKey := s.difyClient.WorkflowQueryKey
-		if systemKey == "" {
-			systemKey = "system"
-		}
-		if queryKey == "" {
-			queryKey = "query"
-		}
-		inputs = map[string]interface{}{
-			systemKey: prompt,
-			queryKey:  input,
-		}
-	} else {
-		inputs = map[string]interface{}{
-			"task_type": taskType,
-			"input":     input,
-		}
-	}
+	// 调用大模型（Dify 下智能选择 workflow/completion/chat 模式）
+	inputs := buildLLMInputs(s.llm, prompt, input, map[string]interface{}{
+		"task_type": taskType,
+		"input":     input,
+	})
 
-	resp, err := s.difyClient.ChatOrCompletion(prompt, inputs)
+	resp, err := s.llm.Complete(ctx, prompt, inputs)
 	if err != nil {
 		return nil, fmt.Errorf("调用AI失败: %w", err)
 	}
 
 	answer := resp.Answer
-	tokenCount := resp.Metadata.Usage.TotalTokens
+	usage := resp.Usage
+	ttft := resp.TimeToFirstToken
+	wfSteps := resp.WorkflowSteps
+	wfElapsed := resp.WorkflowElapsedTime
 
-	if groupType == "E" || groupType == "F" {
+	if strategy.SelfCheck {
 		// E 阶段2：自检纠错（把 stage1 的答案、严格规则、以及 MemOS 候选记忆一起给模型做一致性校验）
 		checkPrompt := s.buildECheckPrompt(taskType, input, relevantMemories, recentIncorrectFeedbacks, externalMemories, answer)
 		checkInputs := inputs
-		checkResp, err := s.difyClient.ChatOrCompletion(checkPrompt, checkInputs)
+		checkResp, err := s.llm.Complete(ctx, checkPrompt, checkInputs)
 		if err == nil && strings.TrimSpace(checkResp.Answer) != "" {
 			answer = checkResp.Answer
-			tokenCount += checkResp.Metadata.Usage.TotalTokens
+			usage.PromptTokens += checkResp.Usage.PromptTokens
+			usage.CompletionTokens += checkResp.Usage.CompletionTokens
+			usage.TotalTokens += checkResp.Usage.TotalTokens
+			usage.Estimated = usage.Estimated || checkResp.Usage.Estimated
+			wfSteps += checkResp.WorkflowSteps
+			wfElapsed += checkResp.WorkflowElapsedTime
 			prompt = checkPrompt
 		}
 	}
@@ -194,11 +198,18 @@ func (s *AgentService) ExecuteTaskInRun(ctx context.Context, runID uint, taskTyp
 		Input:      input,
 		Output:     answer,
 		MemoryIDs:  strings.Join(memoryIDs, ","),
-		TokenCount: tokenCount,
+		TokenCount: usage.TotalTokens,
 		GroupType:  groupType,
+
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+		TokenEstimated:   usage.Estimated,
+	}
+	if strategy.Frozen {
+		task.Phase = model.TaskPhaseEval
 	}
 
-	if err := db.DB.Create(task).Error; err != nil {
+	if err := s.store.Tasks.Create(ctx, task); err != nil {
 		return nil, fmt.Errorf("保存任务失败: %w", err)
 	}
 
@@ -211,48 +222,128 @@ func (s *AgentService) ExecuteTaskInRun(ctx context.Context, runID uint, taskTyp
 		SystemPrompt: prompt,
 		QueryInput:   input,
 		MemoryIDs:    strings.Join(memoryIDs, ","),
+
+		TimeToFirstTokenMs:  ttft.Milliseconds(),
+		PromptTokens:        usage.PromptTokens,
+		CompletionTokens:    usage.CompletionTokens,
+		TokenEstimated:      usage.Estimated,
+		WorkflowSteps:       wfSteps,
+		WorkflowElapsedTime: wfElapsed,
 	}
-	_ = db.DB.Create(taskLog).Error
+	_ = s.store.TaskLogs.Create(ctx, taskLog)
 
 	return task, nil
 }
 
 // retrieveMemories 检索相关记忆
 func (s *AgentService) retrieveMemories(ctx context.Context, runID uint, taskType, input string, scope memoryScope) ([]model.Memory, error) {
-	return s.retrieveMemoriesWithLimit(ctx, runID, taskType, input, scope, 5)
+	return s.retrieveMemoriesWithLimit(ctx, runID, taskType, input, scope, 0, 5, false)
 }
 
-func (s *AgentService) retrieveMemoriesWithLimit(ctx context.Context, runID uint, taskType, input string, scope memoryScope, limit int) ([]model.Memory, error) {
-	var memories []model.Memory
+// poolRunID 仅对 memoryScopeRunAndGlobal 生效：0 读共享全局池，>0 读该 run 的隔离全局池；
+// frozen（评估阶段）时检索为纯读，语义检索缺失的向量只在内存中计算，不落库
+func (s *AgentService) retrieveMemoriesWithLimit(ctx context.Context, runID uint, taskType, input string, scope memoryScope, poolRunID uint, limit int, frozen bool) ([]model.Memory, error) {
 	if limit <= 0 {
 		limit = 5
 	}
 
-	// 简单关键词匹配（MVP版本）
-	// 注意：trigger是MySQL保留关键字，需要用反引号包裹
-	q := db.DB.WithContext(ctx).Model(&model.Memory{}).Where("deprecated = 0")
-	if runID > 0 {
-		switch scope {
-		case memoryScopeRunAndGlobal:
-			// global 记忆池：run_id=0 且 derived_from 带 global 前缀，避免把普通 run_id=0 任务的零散记忆混入实验
-			q = q.Where("(run_id = ? OR (run_id = 0 AND derived_from LIKE ?))", runID, "global|%")
-		default:
-			// 论文级实验：严格 run 隔离
-			q = q.Where("run_id = ?", runID)
-		}
+	// 排序核心（见 MemoryRepository.Retrieve）：优先“最近被验证为正确”的规则，其次最新版本，再考虑置信度/使用次数
+	q := repository.RetrieveQuery{
+		RunID: runID,
+		// global 记忆池：run_id=0 且 derived_from 带 global 前缀，避免把普通 run_id=0 任务的零散记忆混入实验；
+		// 否则论文级实验严格 run 隔离
+		IncludeGlobal: scope == memoryScopeRunAndGlobal,
+		PoolRunID:     poolRunID,
+		TaskType:      taskType,
+		Limit:         limit,
+	}
+	if s.keywords != nil {
+		return s.retrieveByKeywords(ctx, q, memoryQueryText(taskType, input))
+	}
+	if s.retriever == nil {
+		return s.store.Memories.Retrieve(ctx, q)
 	}
-	query := q.
-		Where("(apply_to = ? OR apply_to = ?)", taskType, "通用").
-		// 排序核心：优先“最近被验证为正确”的规则，其次最新版本，再考虑置信度/使用次数
-		Order("last_verified_at DESC, version DESC, confidence DESC, use_count DESC, updated_at DESC").
-		Limit(limit).
-		Find(&memories)
 
-	if query.Error != nil {
-		return nil, query.Error
+	// 语义检索：多取一批候选，按与当前输入的相似度 + 仓库名次 + 置信度混合重排后取前 limit 条
+	q.Limit = s.retriever.candidateLimit(limit)
+	candidates, err := s.store.Memories.Retrieve(ctx, q)
+	if err != nil {
+		return nil, err
 	}
+	s.ensureEmbeddings(ctx, candidates, !frozen)
+	return s.retriever.Rank(memoryQueryText(taskType, input), candidates, limit), nil
+}
 
-	return memories, nil
+// ensureEmbeddings 补齐候选记忆的向量：新写入 / 快照导入 / 更换 embedder 后的记忆在首次被检索时计算；
+// persist=false 时只写入内存中的候选，不修改记忆表
+func (s *AgentService) ensureEmbeddings(ctx context.Context, memories []model.Memory, persist bool) {
+	embedder := s.retriever.Embedder
+	name := embedder.Name()
+	for i := range memories {
+		m := &memories[i]
+		if m.EmbeddingModel == name && len(m.Embedding) > 0 {
+			continue
+		}
+		m.Embedding = embedder.Embed(memoryEmbeddingText(m))
+		m.EmbeddingModel = name
+		if !persist {
+			continue
+		}
+		if err := s.store.Memories.SetEmbedding(ctx, m.ID, m.Embedding, name); err != nil {
+			log.Printf("[retrieval] save embedding failed memory_id=%d err=%v", m.ID, err)
+		}
+	}
+}
+
+// retrieveByKeywords BM25 分数高的在前，同分（如只差门槛数字的多个版本）按仓库排序；
+// 命中不足 q.Limit 条时用仓库排序补齐，输入没有可检索词时等同仓库排序
+func (s *AgentService) retrieveByKeywords(ctx context.Context, q repository.RetrieveQuery, query string) ([]model.Memory, error) {
+	ordered, err := s.store.Memories.Retrieve(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	all := q
+	all.Limit = 0
+	hits := s.keywords.Search(all, query)
+	if len(hits) == 0 {
+		return ordered, nil
+	}
+	scores := make(map[uint]float64, len(hits))
+	ids := make([]uint, 0, len(hits))
+	for _, h := range hits {
+		scores[h.ID] = h.Score
+		ids = append(ids, h.ID)
+	}
+	rows, err := s.store.Memories.FindByIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]model.Memory, 0, len(rows))
+	for _, m := range rows {
+		if !m.Deprecated && !m.DeletedAt.Valid {
+			out = append(out, m)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if si, sj := scores[out[i].ID], scores[out[j].ID]; si != sj {
+			return si > sj
+		}
+		return repository.RetrieveLess(&out[i], &out[j])
+	})
+	out = truncateMemories(out, q.Limit)
+	picked := make(map[uint]bool, len(out))
+	for _, m := range out {
+		picked[m.ID] = true
+	}
+	for _, m := range ordered {
+		if len(out) >= q.Limit {
+			break
+		}
+		if !picked[m.ID] {
+			out = append(out, m)
+		}
+	}
+	return out, nil
 }
 
 type fRunState struct {
@@ -269,12 +360,13 @@ type fCandStat struct {
 	losses int
 }
 
-func (s *AgentService) fKey(runID uint, taskType string) string {
-	return fmt.Sprintf("%d:%s", runID, strings.TrimSpace(taskType))
+// fKey 按组区分：同一 run 内多个 bandit/变更检测组（如 F 与其变体）各自维护状态
+func (s *AgentService) fKey(runID uint, taskType, group string) string {
+	return fmt.Sprintf("%d:%s:%s", runID, strings.TrimSpace(taskType), group)
 }
 
-func (s *AgentService) getOrInitFState(runID uint, taskType string) *fRunState {
-	key := s.fKey(runID, taskType)
+func (s *AgentService) getOrInitFState(runID uint, taskType, group string) *fRunState {
+	key := s.fKey(runID, taskType, group)
 	st, ok := s.fStates[key]
 	if ok && st != nil {
 		return st
@@ -291,23 +383,41 @@ func (s *AgentService) getOrInitFState(runID uint, taskType string) *fRunState {
 	return st
 }
 
-func (s *AgentService) SetFCurrentRound(runID uint, taskType string, round int) {
+// ResetFState 丢弃 F 组内存状态（resume 前重放历史判题结果以重建）
+func (s *AgentService) ResetFState(runID uint, taskType, group string) {
+	s.fMu.Lock()
+	defer s.fMu.Unlock()
+	delete(s.fStates, s.fKey(runID, taskType, group))
+}
+
+// FEpoch 返回 F 组当前 epoch（未初始化时为 1）
+func (s *AgentService) FEpoch(runID uint, taskType, group string) int {
+	if runID == 0 {
+		return 0
+	}
+	s.fMu.Lock()
+	defer s.fMu.Unlock()
+	return s.getOrInitFState(runID, taskType, group).epoch
+}
+
+func (s *AgentService) SetFCurrentRound(runID uint, taskType, group string, round int) {
 	if runID == 0 {
 		return
 	}
 	s.fMu.Lock()
 	defer s.fMu.Unlock()
-	st := s.getOrInitFState(runID, taskType)
+	st := s.getOrInitFState(runID, taskType, group)
 	st.currentRound = round
 }
 
-// UpdateFStateAfterJudge 在判题之后更新 F 组的“变更检测/epoch/bandit”状态
+// UpdateFStateAfterJudge 在判题之后更新 F 组（按 task.GroupType 区分）的“变更检测/epoch/bandit”状态
 // 说明：这里只用 correct/incorrect 信号，不读取真实阈值，不作弊。
-func (s *AgentService) UpdateFStateAfterJudge(ctx context.Context, runID uint, taskType string, task *model.Task, feedback *model.Feedback, round int) {
+// strategy 为该组本次 run 生效的策略（bandit / change_detection 可分别开关）
+func (s *AgentService) UpdateFStateAfterJudge(ctx context.Context, runID uint, taskType string, strategy GroupStrategy, task *model.Task, feedback *model.Feedback, round int) {
 	if runID == 0 || task == nil || feedback == nil {
 		return
 	}
-	// 只服务 F 组调用（runner 已经控制）
+	// 只服务 bandit/变更检测组（runner 已经控制）
 	ids := ParseMemoryIDs(task.MemoryIDs)
 	var usedID uint
 	if len(ids) > 0 {
@@ -316,11 +426,11 @@ func (s *AgentService) UpdateFStateAfterJudge(ctx context.Context, runID uint, t
 
 	s.fMu.Lock()
 	defer s.fMu.Unlock()
-	st := s.getOrInitFState(runID, taskType)
+	st := s.getOrInitFState(runID, taskType, task.GroupType)
 	st.currentRound = round
 
 	// 更新 bandit
-	if usedID > 0 {
+	if strategy.Bandit && usedID > 0 {
 		cs := st.stats[usedID]
 		if cs == nil {
 			cs = &fCandStat{}
@@ -333,7 +443,6 @@ func (s *AgentService) UpdateFStateAfterJudge(ctx context.Context, runID uint, t
 		}
 	}
 
-	// 变更检测（连续 2 次判错 => 进入探索，重置 epoch）
 	if feedback.Type == "correct" {
 		st.consecutiveIncorrect = 0
 		return
@@ -341,11 +450,16 @@ func (s *AgentService) UpdateFStateAfterJudge(ctx context.Context, runID uint, t
 	if feedback.Type != "incorrect" {
 		return
 	}
-	st.consecutiveIncorrect++
-	if usedID > 0 {
+	if strategy.Bandit && usedID > 0 {
 		// 最近用过且判错：短期封禁，避免下一轮继续被同一条旧规则带偏
 		st.banUntil[usedID] = round + 2
 	}
+
+	// 变更检测（连续 2 次判错 => 进入探索，重置 epoch）
+	if !strategy.ChangeDetection {
+		return
+	}
+	st.consecutiveIncorrect++
 	if st.consecutiveIncorrect >= 2 {
 		st.epoch++
 		st.consecutiveIncorrect = 0
@@ -355,7 +469,7 @@ func (s *AgentService) UpdateFStateAfterJudge(ctx context.Context, runID uint, t
 	}
 }
 
-func (s *AgentService) selectFMemories(runID uint, taskType string, candidates []model.Memory) []model.Memory {
+func (s *AgentService) selectFMemories(runID uint, taskType, group string, candidates []model.Memory) []model.Memory {
 	// 目标：从候选中选 1 条“主规则”（必须遵循），其余不喂（减少噪声）。
 	// 用 UCB 做探索/利用平衡；在探索期可返回 2 条（主规则+备选）。
 	if runID == 0 || len(candidates) == 0 {
@@ -363,7 +477,7 @@ func (s *AgentService) selectFMemories(runID uint, taskType string, candidates [
 	}
 
 	s.fMu.Lock()
-	st := s.getOrInitFState(runID, taskType)
+	st := s.getOrInitFState(runID, taskType, group)
 	cur := st.currentRound
 	s.fMu.Unlock()
 
@@ -445,16 +559,10 @@ func (s *AgentService) retrieveRecentIncorrectFeedbacks(ctx context.Context, run
 	if runID == 0 || limit <= 0 {
 		return nil, nil
 	}
-	var feedbacks []model.Feedback
-	q := db.DB.WithContext(ctx).
-		Model(&model.Feedback{}).
-		Joins("JOIN tasks ON tasks.id = feedbacks.task_id").
-		Where("feedbacks.run_id = ? AND tasks.task_type = ? AND feedbacks.type = ?", runID, taskType, "incorrect").
-		Order("feedbacks.id DESC").
-		Limit(limit).
-		Find(&feedbacks)
-	if q.Error != nil {
-		return nil, q.Error
+	// 评估阶段的判错不进入短期记忆（否则留出集会被“边测边学”）
+	feedbacks, err := s.store.Feedbacks.RecentIncorrect(ctx, runID, taskType, limit)
+	if err != nil {
+		return nil, err
 	}
 	// 让 prompt 里按时间正序展示
 	for i, j := 0, len(feedbacks)-1; i < j; i, j = i+1, j-1 {
@@ -463,20 +571,21 @@ func (s *AgentService) retrieveRecentIncorrectFeedbacks(ctx context.Context, run
 	return feedbacks, nil
 }
 
-func (s *AgentService) retrieveTaskLogs(ctx context.Context, runID uint, taskType string) ([]model.Task, error) {
-	var tasks []model.Task
-	// 简化：取 B 组最近的 3 条同类型、且已判定为正确的任务作为“案例”
-	// 说明：如果把 incorrect/unknown 的案例喂回上下文，会引入强噪声，导致 B 组被系统性拖累，不利于公平对照。
-	q := db.DB.Model(&model.Task{}).
-		Where("task_type = ? AND group_type = ? AND is_correct = 1", taskType, "B")
-	if runID > 0 {
-		q = q.Where("run_id = ?", runID)
-	}
-	q = q.Order("created_at DESC").Limit(3).Find(&tasks)
-	if q.Error != nil {
-		return nil, q.Error
+func (s *AgentService) retrieveTaskLogs(ctx context.Context, runID uint, taskType, groupType string, limit int) ([]model.Task, error) {
+	if limit <= 0 {
+		limit = 3
 	}
-	return tasks, nil
+	// 简化：取本组（B 组）最近 limit 条同类型、且已判定为正确的任务作为“案例”
+	// 说明：如果把 incorrect/unknown 的案例喂回上下文，会引入强噪声，导致 B 组被系统性拖累，不利于公平对照。
+	return s.store.Tasks.Find(ctx, repository.TaskFilter{
+		RunID:        runID,
+		TaskType:     taskType,
+		GroupType:    groupType,
+		ExcludePhase: model.TaskPhaseEval,
+		CorrectOnly:  true,
+		Order:        repository.TaskOrderNewest,
+		Limit:        limit,
+	})
 }
 
 func (s *AgentService) shouldFallbackToMemOS(local []model.Memory) bool {
@@ -6,15 +6,16 @@ import (
 	"fmt"
 	"strings"
 
-	"mem-test/internal/db"
 	"mem-test/internal/model"
+	"mem-test/internal/repository"
 )
 
 type CoachService struct {
+	store *repository.Store
 }
 
-func NewCoachService() *CoachService {
-	return &CoachService{}
+func NewCoachService(store *repository.Store) *CoachService {
+	return &CoachService{store: store}
 }
 
 type lotteryAnswer struct {
@@ -33,17 +34,19 @@ func parseLotteryAllow(output string) (*bool, error) {
 // SubmitFeedback 提交反馈（人工或规则引擎）
 func (s *CoachService) SubmitFeedback(ctx context.Context, taskID uint, feedbackType, content string) (*model.Feedback, error) {
 	// 取 run_id 以便论文级隔离
-	var task model.Task
-	_ = db.DB.Select("id", "run_id").First(&task, taskID).Error
+	var runID uint
+	if task, err := s.store.Tasks.Get(ctx, taskID); err == nil {
+		runID = task.RunID
+	}
 
 	feedback := &model.Feedback{
-		RunID:   task.RunID,
+		RunID:   runID,
 		TaskID:  taskID,
 		Type:    feedbackType,
 		Content: content,
 	}
 
-	if err := db.DB.Create(feedback).Error; err != nil {
+	if err := s.store.Feedbacks.Create(ctx, feedback); err != nil {
 		return nil, fmt.Errorf("保存反馈失败: %w", err)
 	}
 
@@ -57,7 +60,7 @@ func (s *CoachService) AutoJudge(ctx context.Context, task *model.Task, expected
 
 	// 更新任务正确性
 	task.IsCorrect = &isCorrect
-	db.DB.Save(task)
+	_ = s.store.Tasks.SetCorrect(ctx, task.ID, isCorrect)
 
 	var feedbackType string
 	var content string
@@ -119,7 +122,7 @@ func (s *CoachService) JudgeLotteryTaskWithThreshold(ctx context.Context, task *
 	}
 
 	task.IsCorrect = &isCorrect
-	db.DB.Save(task)
+	_ = s.store.Tasks.SetCorrect(ctx, task.ID, isCorrect)
 
 	var feedbackType string
 	var content string
@@ -164,7 +167,7 @@ func (s *CoachService) JudgeLotteryMultiPointsTaskWithThreshold(ctx context.Cont
 	}
 
 	task.IsCorrect = &isCorrect
-	db.DB.Save(task)
+	_ = s.store.Tasks.SetCorrect(ctx, task.ID, isCorrect)
 
 	feedbackType := "correct"
 	content := "判断正确"
@@ -305,7 +308,7 @@ func (s *CoachService) JudgeLotteryV2Task(ctx context.Context, task *model.Task)
 	}
 
 	task.IsCorrect = &isCorrect
-	db.DB.Save(task)
+	_ = s.store.Tasks.SetCorrect(ctx, task.ID, isCorrect)
 
 	feedbackType := "correct"
 	content := "判断正确"
@@ -1,6 +1,11 @@
 package service
 
-import "math"
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
 
 // GenerateConclusionFromStats 根据 run 内统计与检验结果生成结论（论文级更稳；仍为工程简化版）
 func GenerateConclusionFromStats(stats map[string]GroupStats, tests map[string]interface{}, trend map[string][]int) map[string]interface{} {
@@ -11,73 +16,48 @@ func GenerateConclusionFromStats(stats map[string]GroupStats, tests map[string]i
 		"caveats": []string{},
 	}
 
-	// 趋势：C 前半 vs 后半
-	cTrend, ok := trend["C"]
-	if ok && len(cTrend) >= 10 {
-		first := avgInt(cTrend[:len(cTrend)/2])
-		last := avgInt(cTrend[len(cTrend)/2:])
-		out["metrics"].(map[string]interface{})["C_first_half_error_rate"] = first
-		out["metrics"].(map[string]interface{})["C_second_half_error_rate"] = last
-		if last < first {
-			out["claims"] = append(out["claims"].([]string), "C组在同一批重复任务中错误率后半段低于前半段，存在test-time learning迹象（反馈→反思→记忆→行为变化）。")
-			out["verdict"] = "learning_observed"
-		} else {
-			out["claims"] = append(out["claims"].([]string), "C组错误率未随轮次下降，未观察到稳定的学习趋势（可能样本不足、提示词不稳定或workflow输出不可判定）。")
-			out["verdict"] = "learning_not_observed"
+	// 学习趋势：基于逻辑回归的 round 斜率（显著为负 => 错误率随轮次下降），Cochran–Armitage 作为旁证
+	// C 组决定 verdict；D/E/F 组只在 C 无法判断时补充
+	learningClaims := []struct {
+		group, learned, notLearned string
+		decides                    bool
+	}{
+		{"C", "C组错误率随轮次显著下降（逻辑回归斜率<0，p<0.05），存在test-time learning迹象（反馈→反思→记忆→行为变化）。",
+			"C组错误率未随轮次显著下降，未观察到稳定的学习趋势（可能样本不足、提示词不稳定或workflow输出不可判定）。", true},
+		{"D", "D组错误率随轮次显著下降，表明“短期纠错 + 全局中期记忆池固化”的学习链路在本次run内发挥作用。", "", false},
+		{"E", "E组错误率随轮次显著下降，表明“自检纠错 + 记忆门控 + 验证固化”在本次run内进一步提升稳定性。", "", false},
+		{"F", "F组错误率随轮次显著下降，表明“变更检测 + 候选竞争 + 自检纠错”在本次run内提升了规则切换适应能力。", "", false},
+	}
+	for _, lc := range learningClaims {
+		// 前/后半段错误率仅作描述性指标，不参与判定
+		if flags := trend[lc.group]; len(flags) >= 10 {
+			out["metrics"].(map[string]interface{})[lc.group+"_first_half_error_rate"] = avgInt(flags[:len(flags)/2])
+			out["metrics"].(map[string]interface{})[lc.group+"_second_half_error_rate"] = avgInt(flags[len(flags)/2:])
 		}
-	} else {
-		out["caveats"] = append(out["caveats"].([]string), "C组样本量不足，无法判断学习趋势（建议每组>=30）。")
-	}
-
-	// 趋势：D 前半 vs 后半（跨 run 复用全局中期记忆池，期望更稳）
-	dTrend, okDTrend := trend["D"]
-	if okDTrend && len(dTrend) >= 10 {
-		first := avgInt(dTrend[:len(dTrend)/2])
-		last := avgInt(dTrend[len(dTrend)/2:])
-		out["metrics"].(map[string]interface{})["D_first_half_error_rate"] = first
-		out["metrics"].(map[string]interface{})["D_second_half_error_rate"] = last
-		if last < first {
-			out["claims"] = append(out["claims"].([]string), "D组错误率后半段低于前半段，表明“短期纠错 + 全局中期记忆池固化”的学习链路在本次run内发挥作用。")
-			if out["verdict"] == "insufficient_data" {
-				out["verdict"] = "learning_observed"
+		curve, ok := tests[lc.group+"_learning_curve"].(LearningCurveResult)
+		if !ok {
+			if _, present := stats[lc.group]; present || lc.decides {
+				out["caveats"] = append(out["caveats"].([]string), fmt.Sprintf("%s组已判题样本不足或结果单一，无法拟合学习曲线（建议每组>=30）。", lc.group))
 			}
+			continue
 		}
-	} else {
-		out["caveats"] = append(out["caveats"].([]string), "D组样本量不足，无法判断学习趋势（建议每组>=30）。")
-	}
-
-	// 趋势：E 前半 vs 后半（两阶段推理 + 记忆门控 + 验证固化）
-	eTrend, okETrend := trend["E"]
-	if okETrend && len(eTrend) >= 10 {
-		first := avgInt(eTrend[:len(eTrend)/2])
-		last := avgInt(eTrend[len(eTrend)/2:])
-		out["metrics"].(map[string]interface{})["E_first_half_error_rate"] = first
-		out["metrics"].(map[string]interface{})["E_second_half_error_rate"] = last
-		if last < first {
-			out["claims"] = append(out["claims"].([]string), "E组错误率后半段低于前半段，表明“自检纠错 + 记忆门控 + 验证固化”在本次run内进一步提升稳定性。")
-			if out["verdict"] == "insufficient_data" {
+		m := out["metrics"].(map[string]interface{})
+		m[lc.group+"_learning_slope"] = curve.Slope.Estimate
+		m[lc.group+"_learning_slope_ci95"] = []float64{curve.Slope.CI95Low, curve.Slope.CI95High}
+		m[lc.group+"_learning_slope_p"] = curve.Slope.P
+		m[lc.group+"_cochran_armitage_p"] = curve.CochranArmitageP
+		if curve.Learning() {
+			out["claims"] = append(out["claims"].([]string), lc.learned)
+			if lc.decides || out["verdict"] == "insufficient_data" {
 				out["verdict"] = "learning_observed"
 			}
+		} else if lc.decides {
+			out["claims"] = append(out["claims"].([]string), lc.notLearned)
+			out["verdict"] = "learning_not_observed"
 		}
-	} else {
-		out["caveats"] = append(out["caveats"].([]string), "E组样本量不足，无法判断学习趋势（建议每组>=30）。")
-	}
-
-	// 趋势：F 前半 vs 后半（变更检测 + 候选竞争 + 自检纠错）
-	fTrend, okFTrend := trend["F"]
-	if okFTrend && len(fTrend) >= 10 {
-		first := avgInt(fTrend[:len(fTrend)/2])
-		last := avgInt(fTrend[len(fTrend)/2:])
-		out["metrics"].(map[string]interface{})["F_first_half_error_rate"] = first
-		out["metrics"].(map[string]interface{})["F_second_half_error_rate"] = last
-		if last < first {
-			out["claims"] = append(out["claims"].([]string), "F组错误率后半段低于前半段，表明“变更检测 + 候选竞争 + 自检纠错”在本次run内提升了规则切换适应能力。")
-			if out["verdict"] == "insufficient_data" {
-				out["verdict"] = "learning_observed"
-			}
+		if !curve.Converged {
+			out["caveats"] = append(out["caveats"].([]string), fmt.Sprintf("%s组逻辑回归未收敛（可能存在完全分离），斜率仅供参考。", lc.group))
 		}
-	} else {
-		out["caveats"] = append(out["caveats"].([]string), "F组样本量不足，无法判断学习趋势（建议每组>=30）。")
 	}
 
 	// 组间：C vs A, C vs B（需要显著性）
@@ -92,13 +72,13 @@ func GenerateConclusionFromStats(stats map[string]GroupStats, tests map[string]i
 		out["metrics"].(map[string]interface{})["B_ci95"] = []float64{b.CI95Low, b.CI95High}
 		out["metrics"].(map[string]interface{})["C_ci95"] = []float64{c.CI95Low, c.CI95High}
 
-		pCA := getPValue(tests, "C_vs_A")
-		pCB := getPValue(tests, "C_vs_B")
+		pCA := getAdjustedPValue(tests, "C_vs_A")
+		pCB := getAdjustedPValue(tests, "C_vs_B")
 		out["metrics"].(map[string]interface{})["p_C_vs_A"] = pCA
 		out["metrics"].(map[string]interface{})["p_C_vs_B"] = pCB
 
 		if c.ErrorRate < a.ErrorRate && c.ErrorRate < b.ErrorRate && pCA < 0.05 && pCB < 0.05 {
-			out["claims"] = append(out["claims"].([]string), "在本次run内，C组错误率显著低于A组与B组（p<0.05），支持“反思→抽象规则记忆”优于“无记忆/仅日志记忆”。")
+			out["claims"] = append(out["claims"].([]string), "在本次run内，C组错误率显著低于A组与B组（Holm 校正后 p<0.05），支持“反思→抽象规则记忆”优于“无记忆/仅日志记忆”。")
 			rel := (a.ErrorRate - c.ErrorRate) / math.Max(a.ErrorRate, 1e-9)
 			out["metrics"].(map[string]interface{})["C_vs_A_relative_reduction"] = rel
 			if out["verdict"] == "insufficient_data" {
@@ -116,15 +96,15 @@ func GenerateConclusionFromStats(stats map[string]GroupStats, tests map[string]i
 	if okA && okB && okC && okD {
 		out["metrics"].(map[string]interface{})["D_error_rate"] = d.ErrorRate
 		out["metrics"].(map[string]interface{})["D_ci95"] = []float64{d.CI95Low, d.CI95High}
-		out["metrics"].(map[string]interface{})["p_D_vs_A"] = getPValue(tests, "D_vs_A")
-		out["metrics"].(map[string]interface{})["p_D_vs_B"] = getPValue(tests, "D_vs_B")
-		out["metrics"].(map[string]interface{})["p_D_vs_C"] = getPValue(tests, "D_vs_C")
+		out["metrics"].(map[string]interface{})["p_D_vs_A"] = getAdjustedPValue(tests, "D_vs_A")
+		out["metrics"].(map[string]interface{})["p_D_vs_B"] = getAdjustedPValue(tests, "D_vs_B")
+		out["metrics"].(map[string]interface{})["p_D_vs_C"] = getAdjustedPValue(tests, "D_vs_C")
 
-		pDA := getPValue(tests, "D_vs_A")
-		pDB := getPValue(tests, "D_vs_B")
-		pDC := getPValue(tests, "D_vs_C")
+		pDA := getAdjustedPValue(tests, "D_vs_A")
+		pDB := getAdjustedPValue(tests, "D_vs_B")
+		pDC := getAdjustedPValue(tests, "D_vs_C")
 		if d.ErrorRate < a.ErrorRate && d.ErrorRate < b.ErrorRate && d.ErrorRate < c.ErrorRate && pDA < 0.05 && pDB < 0.05 && pDC < 0.05 {
-			out["claims"] = append(out["claims"].([]string), "在本次run内，D组错误率显著低于A/B/C组（p<0.05），支持“跨run可复用的中期记忆池 + 短期纠错信号”进一步提升稳定性。")
+			out["claims"] = append(out["claims"].([]string), "在本次run内，D组错误率显著低于A/B/C组（Holm 校正后 p<0.05），支持“跨run可复用的中期记忆池 + 短期纠错信号”进一步提升稳定性。")
 			if out["verdict"] == "insufficient_data" {
 				out["verdict"] = "memory_effect_supported"
 			}
@@ -136,18 +116,18 @@ func GenerateConclusionFromStats(stats map[string]GroupStats, tests map[string]i
 	if okA && okB && okC && okD && okE {
 		out["metrics"].(map[string]interface{})["E_error_rate"] = e.ErrorRate
 		out["metrics"].(map[string]interface{})["E_ci95"] = []float64{e.CI95Low, e.CI95High}
-		out["metrics"].(map[string]interface{})["p_E_vs_A"] = getPValue(tests, "E_vs_A")
-		out["metrics"].(map[string]interface{})["p_E_vs_B"] = getPValue(tests, "E_vs_B")
-		out["metrics"].(map[string]interface{})["p_E_vs_C"] = getPValue(tests, "E_vs_C")
-		out["metrics"].(map[string]interface{})["p_E_vs_D"] = getPValue(tests, "E_vs_D")
-
-		pEA := getPValue(tests, "E_vs_A")
-		pEB := getPValue(tests, "E_vs_B")
-		pEC := getPValue(tests, "E_vs_C")
-		pED := getPValue(tests, "E_vs_D")
+		out["metrics"].(map[string]interface{})["p_E_vs_A"] = getAdjustedPValue(tests, "E_vs_A")
+		out["metrics"].(map[string]interface{})["p_E_vs_B"] = getAdjustedPValue(tests, "E_vs_B")
+		out["metrics"].(map[string]interface{})["p_E_vs_C"] = getAdjustedPValue(tests, "E_vs_C")
+		out["metrics"].(map[string]interface{})["p_E_vs_D"] = getAdjustedPValue(tests, "E_vs_D")
+
+		pEA := getAdjustedPValue(tests, "E_vs_A")
+		pEB := getAdjustedPValue(tests, "E_vs_B")
+		pEC := getAdjustedPValue(tests, "E_vs_C")
+		pED := getAdjustedPValue(tests, "E_vs_D")
 		if e.ErrorRate < a.ErrorRate && e.ErrorRate < b.ErrorRate && e.ErrorRate < c.ErrorRate && e.ErrorRate < d.ErrorRate &&
 			pEA < 0.05 && pEB < 0.05 && pEC < 0.05 && pED < 0.05 {
-			out["claims"] = append(out["claims"].([]string), "在本次run内，E组错误率显著低于A/B/C/D组（p<0.05），支持“验证固化 + 自检纠错 + MemOS门控召回”优于 D 组策略。")
+			out["claims"] = append(out["claims"].([]string), "在本次run内，E组错误率显著低于A/B/C/D组（Holm 校正后 p<0.05），支持“验证固化 + 自检纠错 + MemOS门控召回”优于 D 组策略。")
 			if out["verdict"] == "insufficient_data" {
 				out["verdict"] = "memory_effect_supported"
 			}
@@ -159,30 +139,87 @@ func GenerateConclusionFromStats(stats map[string]GroupStats, tests map[string]i
 	if okA && okB && okC && okD && okE && okF {
 		out["metrics"].(map[string]interface{})["F_error_rate"] = f.ErrorRate
 		out["metrics"].(map[string]interface{})["F_ci95"] = []float64{f.CI95Low, f.CI95High}
-		out["metrics"].(map[string]interface{})["p_F_vs_A"] = getPValue(tests, "F_vs_A")
-		out["metrics"].(map[string]interface{})["p_F_vs_B"] = getPValue(tests, "F_vs_B")
-		out["metrics"].(map[string]interface{})["p_F_vs_C"] = getPValue(tests, "F_vs_C")
-		out["metrics"].(map[string]interface{})["p_F_vs_D"] = getPValue(tests, "F_vs_D")
-		out["metrics"].(map[string]interface{})["p_F_vs_E"] = getPValue(tests, "F_vs_E")
-
-		pFA := getPValue(tests, "F_vs_A")
-		pFB := getPValue(tests, "F_vs_B")
-		pFC := getPValue(tests, "F_vs_C")
-		pFD := getPValue(tests, "F_vs_D")
-		pFE := getPValue(tests, "F_vs_E")
+		out["metrics"].(map[string]interface{})["p_F_vs_A"] = getAdjustedPValue(tests, "F_vs_A")
+		out["metrics"].(map[string]interface{})["p_F_vs_B"] = getAdjustedPValue(tests, "F_vs_B")
+		out["metrics"].(map[string]interface{})["p_F_vs_C"] = getAdjustedPValue(tests, "F_vs_C")
+		out["metrics"].(map[string]interface{})["p_F_vs_D"] = getAdjustedPValue(tests, "F_vs_D")
+		out["metrics"].(map[string]interface{})["p_F_vs_E"] = getAdjustedPValue(tests, "F_vs_E")
+
+		pFA := getAdjustedPValue(tests, "F_vs_A")
+		pFB := getAdjustedPValue(tests, "F_vs_B")
+		pFC := getAdjustedPValue(tests, "F_vs_C")
+		pFD := getAdjustedPValue(tests, "F_vs_D")
+		pFE := getAdjustedPValue(tests, "F_vs_E")
 		// 只要显著优于 E，同时也显著优于 D 与其他组，就给出强结论
 		if f.ErrorRate < e.ErrorRate && f.ErrorRate < d.ErrorRate && f.ErrorRate < c.ErrorRate && f.ErrorRate < b.ErrorRate && f.ErrorRate < a.ErrorRate &&
 			pFA < 0.05 && pFB < 0.05 && pFC < 0.05 && pFD < 0.05 && pFE < 0.05 {
-			out["claims"] = append(out["claims"].([]string), "在本次run内，F组错误率显著低于A/B/C/D/E组（p<0.05），支持“变更检测 + 候选竞争”在高频规则切换下进一步优于 E 组策略。")
+			out["claims"] = append(out["claims"].([]string), "在本次run内，F组错误率显著低于A/B/C/D/E组（Holm 校正后 p<0.05），支持“变更检测 + 候选竞争”在高频规则切换下进一步优于 E 组策略。")
 			if out["verdict"] == "insufficient_data" {
 				out["verdict"] = "memory_effect_supported"
 			}
 		}
 	}
 
+	// 全部组对：以 Holm 校正后的 p 判定显著（适用于任意注册组，含自定义组）
+	if mx, ok := tests["pairwise_matrix"].(PairwiseMatrix); ok {
+		out["metrics"].(map[string]interface{})["p_adjustment"] = "holm"
+		significant := []string{}
+		for i := range mx.Groups {
+			for j := range mx.Groups {
+				if mx.PHolm[i][j] == nil || mx.DiffErrorRate[i][j] == nil || *mx.DiffErrorRate[i][j] >= 0 {
+					continue
+				}
+				pair := fmt.Sprintf("%s<%s", mx.Groups[i], mx.Groups[j])
+				if *mx.PHolm[i][j] < significanceLevel {
+					significant = append(significant, fmt.Sprintf("%s (p_holm=%.4f)", pair, *mx.PHolm[i][j]))
+				} else if *mx.P[i][j] < significanceLevel {
+					out["caveats"] = append(out["caveats"].([]string), fmt.Sprintf("%s 原始 p=%.4f<0.05，但经 Holm 多重比较校正后不显著（p_holm=%.4f），不作为结论。", pair, *mx.P[i][j], *mx.PHolm[i][j]))
+				}
+			}
+		}
+		out["metrics"].(map[string]interface{})["significant_pairs"] = significant
+		if len(significant) > 0 {
+			out["claims"] = append(out["claims"].([]string), fmt.Sprintf("经 Holm 多重比较校正后错误率显著更低的组对（共 %d 组对比较）：%s。", pairCount(len(mx.Groups)), strings.Join(significant, "，")))
+		}
+	}
+
+	// 负迁移：判错中由过时记忆（门槛与当前规则不一致且答案跟随该记忆）导致的比例
+	attribution := map[string]ErrorAttribution{}
+	var stale []string
+	for _, g := range sortedGroupKeys(stats) {
+		attr := stats[g].ErrorAttribution
+		if attr == nil || attr.Incorrect == 0 {
+			continue
+		}
+		attribution[g] = *attr
+		if attr.StaleMemory > 0 {
+			stale = append(stale, fmt.Sprintf("%s组 %d/%d", g, attr.StaleMemory, attr.Incorrect))
+		}
+	}
+	if len(attribution) > 0 {
+		out["metrics"].(map[string]interface{})["error_attribution"] = attribution
+	}
+	if len(stale) > 0 {
+		out["claims"] = append(out["claims"].([]string), fmt.Sprintf("负迁移：%s 次判错由与当前规则门槛不一致的记忆导致（答案跟随了过时记忆）。", strings.Join(stale, "，")))
+	}
+
 	return out
 }
 
+// sortedGroupKeys 按组名排序的 stats 键，保证结论输出顺序稳定
+func sortedGroupKeys(stats map[string]GroupStats) []string {
+	keys := make([]string, 0, len(stats))
+	for g := range stats {
+		keys = append(keys, g)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func pairCount(n int) int {
+	return n * (n - 1) / 2
+}
+
 func avgInt(flags []int) float64 {
 	if len(flags) == 0 {
 		return 0
@@ -194,7 +231,8 @@ func avgInt(flags []int) float64 {
 	return float64(sum) / float64(len(flags))
 }
 
-func getPValue(tests map[string]interface{}, key string) float64 {
+// getAdjustedPValue 组对的 Holm 校正 p（结论一律基于校正后的 p）；旧结果没有校正值时退回原始 p_value
+func getAdjustedPValue(tests map[string]interface{}, key string) float64 {
 	v, ok := tests[key]
 	if !ok {
 		return 1
@@ -203,7 +241,10 @@ func getPValue(tests map[string]interface{}, key string) float64 {
 	if !ok {
 		return 1
 	}
-	p, ok := m["p_value"]
+	p, ok := m["p_holm"]
+	if !ok {
+		p, ok = m["p_value"]
+	}
 	if !ok {
 		return 1
 	}
@@ -38,6 +38,11 @@ func NewDifyClient(baseURL, apiKey string, appType string, responseMode string,
 	if workflowQueryKey == "" {
 		workflowQueryKey = "query"
 	}
+	// blocking 模式 30s 足够；streaming 模式长 workflow 需要持续接收事件，放宽整体超时
+	timeout := 30 * time.Second
+	if responseMode == "streaming" {
+		timeout = 5 * time.Minute
+	}
 	return &DifyClient{
 		BaseURL:           baseURL,
 		APIKey:            apiKey,
@@ -47,11 +52,15 @@ func NewDifyClient(baseURL, apiKey string, appType string, responseMode string,
 		WorkflowQueryKey:  workflowQueryKey,
 		WorkflowOutputKey: workflowOutputKey,
 		Client: &http.Client{
-			Timeout: 30 * time.Second,
+			Timeout: timeout,
 		},
 	}
 }
 
+func (c *DifyClient) isStreaming() bool {
+	return c.ResponseMode == "streaming"
+}
+
 func difyMaxRetries() int {
 	// 只针对超时/临时网络错误做“少量重试”，避免实验被偶发 timeout 直接污染
 	// 默认 1 次重试（总共最多 2 次请求）
@@ -108,6 +117,18 @@ func isRetryableDifyErr(err error) bool {
 	return false
 }
 
+// sleepWithContext 重试退避等待；ctx 取消时立即返回
+func sleepWithContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
 func isRetryableStatus(code int) bool {
 	// 429/5xx 典型可重试
 	if code == http.StatusTooManyRequests {
@@ -138,6 +159,8 @@ type ChatResponse struct {
 			TotalTokens      int `json:"total_tokens"`
 		} `json:"usage"`
 	} `json:"metadata"`
+	// 仅 streaming 模式：首 token 延迟
+	TimeToFirstToken time.Duration `json:"-"`
 }
 
 type CompletionRequest struct {
@@ -157,6 +180,8 @@ type CompletionResponse struct {
 			TotalTokens      int `json:"total_tokens"`
 		} `json:"usage"`
 	} `json:"metadata"`
+	// 仅 streaming 模式：首 token 延迟
+	TimeToFirstToken time.Duration `json:"-"`
 }
 
 type WorkflowRunRequest struct {
@@ -172,11 +197,24 @@ type WorkflowRunResponse struct {
 		Outputs map[string]interface{} `json:"outputs"`
 		Status  string                 `json:"status"`
 		Error   string                 `json:"error"`
+		// 服务端统计（部分版本/部署不返回，此时为 0）
+		TotalTokens int     `json:"total_tokens"`
+		TotalSteps  int     `json:"total_steps"`
+		ElapsedTime float64 `json:"elapsed_time"`
 	} `json:"data"`
 }
 
+// WorkflowRunResult workflow 执行结果（blocking/streaming 统一）
+type WorkflowRunResult struct {
+	Answer           string
+	Usage            LLMUsage
+	TotalSteps       int
+	ElapsedTime      float64
+	TimeToFirstToken time.Duration
+}
+
 // Chat 使用chat-messages端点（适用于chat模式应用）
-func (c *DifyClient) Chat(prompt string, inputs map[string]interface{}) (*ChatResponse, error) {
+func (c *DifyClient) Chat(ctx context.Context, prompt string, inputs map[string]interface{}) (*ChatResponse, error) {
 	url := fmt.Sprintf("%s/chat-messages", c.BaseURL)
 
 	reqBody := ChatRequest{
@@ -194,43 +232,76 @@ func (c *DifyClient) Chat(prompt string, inputs map[string]interface{}) (*ChatRe
 	var lastErr error
 	maxR := difyMaxRetries()
 	for attempt := 0; attempt <= maxR; attempt++ {
-		req, err := http.NewRequestWithContext(context.Background(), "POST", url, bytes.NewBuffer(jsonData))
+		req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
 		if err != nil {
 			return nil, fmt.Errorf("创建请求失败: %w", err)
 		}
 		req.Header.Set("Content-Type", "application/json")
 		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.APIKey))
 
+		start := time.Now()
 		resp, err := c.Client.Do(req)
 		if err != nil {
 			lastErr = fmt.Errorf("请求失败: %w", err)
-			if attempt < maxR && isRetryableDifyErr(err) {
+			if attempt < maxR && ctx.Err() == nil && isRetryableDifyErr(err) {
 				sleep := difyRetryBackoff(attempt + 1)
 				log.Printf("[dify] chat retry=%d/%d sleep=%s err=%v", attempt+1, maxR, sleep, err)
-				time.Sleep(sleep)
+				if err := sleepWithContext(ctx, sleep); err != nil {
+					return nil, err
+				}
 				continue
 			}
 			return nil, lastErr
 		}
 
-		body, _ := io.ReadAll(resp.Body)
-		_ = resp.Body.Close()
-
 		if resp.StatusCode != http.StatusOK {
+			body, _ := io.ReadAll(resp.Body)
+			_ = resp.Body.Close()
 			bodyStr := string(body)
 			if len(bodyStr) > 500 {
 				bodyStr = bodyStr[:500] + "..."
 			}
 			lastErr = fmt.Errorf("API返回错误: %d, %s", resp.StatusCode, bodyStr)
-			if attempt < maxR && isRetryableStatus(resp.StatusCode) {
+			if attempt < maxR && ctx.Err() == nil && isRetryableStatus(resp.StatusCode) {
 				sleep := difyRetryBackoff(attempt + 1)
 				log.Printf("[dify] chat retry=%d/%d sleep=%s status=%d", attempt+1, maxR, sleep, resp.StatusCode)
-				time.Sleep(sleep)
+				if err := sleepWithContext(ctx, sleep); err != nil {
+					return nil, err
+				}
 				continue
 			}
 			return nil, lastErr
 		}
 
+		if c.isStreaming() {
+			sr, err := c.readStream(resp, start, "chat")
+			if err != nil {
+				lastErr = err
+				if attempt < maxR && ctx.Err() == nil && isRetryableDifyErr(err) {
+					sleep := difyRetryBackoff(attempt + 1)
+					log.Printf("[dify] chat stream retry=%d/%d sleep=%s err=%v", attempt+1, maxR, sleep, err)
+					if err := sleepWithContext(ctx, sleep); err != nil {
+						return nil, err
+					}
+					continue
+				}
+				return nil, lastErr
+			}
+			chatResp := &ChatResponse{
+				MessageID:        sr.MessageID,
+				ConversationID:   sr.ConversationID,
+				Answer:           sr.Answer,
+				TimeToFirstToken: sr.TimeToFirstToken,
+			}
+			chatResp.Metadata.Usage.PromptTokens = sr.Usage.PromptTokens
+			chatResp.Metadata.Usage.CompletionTokens = sr.Usage.CompletionTokens
+			chatResp.Metadata.Usage.TotalTokens = sr.Usage.TotalTokens
+			return chatResp, nil
+		}
+
+		body, _ := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+
 		var chatResp ChatResponse
 		if err := json.Unmarshal(body, &chatResp); err != nil {
 			return nil, fmt.Errorf("解析响应失败: %w", err)
@@ -241,7 +312,7 @@ func (c *DifyClient) Chat(prompt string, inputs map[string]interface{}) (*ChatRe
 }
 
 // Completion 使用completions端点（适用于completion模式应用）
-func (c *DifyClient) Completion(prompt string, inputs map[string]interface{}) (*CompletionResponse, error) {
+func (c *DifyClient) Completion(ctx context.Context, prompt string, inputs map[string]interface{}) (*CompletionResponse, error) {
 	url := fmt.Sprintf("%s/completions", c.BaseURL)
 
 	reqBody := CompletionRequest{
@@ -259,43 +330,75 @@ func (c *DifyClient) Completion(prompt string, inputs map[string]interface{}) (*
 	var lastErr error
 	maxR := difyMaxRetries()
 	for attempt := 0; attempt <= maxR; attempt++ {
-		req, err := http.NewRequestWithContext(context.Background(), "POST", url, bytes.NewBuffer(jsonData))
+		req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
 		if err != nil {
 			return nil, fmt.Errorf("创建请求失败: %w", err)
 		}
 		req.Header.Set("Content-Type", "application/json")
 		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.APIKey))
 
+		start := time.Now()
 		resp, err := c.Client.Do(req)
 		if err != nil {
 			lastErr = fmt.Errorf("请求失败: %w", err)
-			if attempt < maxR && isRetryableDifyErr(err) {
+			if attempt < maxR && ctx.Err() == nil && isRetryableDifyErr(err) {
 				sleep := difyRetryBackoff(attempt + 1)
 				log.Printf("[dify] completion retry=%d/%d sleep=%s err=%v", attempt+1, maxR, sleep, err)
-				time.Sleep(sleep)
+				if err := sleepWithContext(ctx, sleep); err != nil {
+					return nil, err
+				}
 				continue
 			}
 			return nil, lastErr
 		}
 
-		body, _ := io.ReadAll(resp.Body)
-		_ = resp.Body.Close()
-
 		if resp.StatusCode != http.StatusOK {
+			body, _ := io.ReadAll(resp.Body)
+			_ = resp.Body.Close()
 			bodyStr := string(body)
 			if len(bodyStr) > 500 {
 				bodyStr = bodyStr[:500] + "..."
 			}
 			lastErr = fmt.Errorf("API返回错误: %d, %s", resp.StatusCode, bodyStr)
-			if attempt < maxR && isRetryableStatus(resp.StatusCode) {
+			if attempt < maxR && ctx.Err() == nil && isRetryableStatus(resp.StatusCode) {
 				sleep := difyRetryBackoff(attempt + 1)
 				log.Printf("[dify] completion retry=%d/%d sleep=%s status=%d", attempt+1, maxR, sleep, resp.StatusCode)
-				time.Sleep(sleep)
+				if err := sleepWithContext(ctx, sleep); err != nil {
+					return nil, err
+				}
 				continue
 			}
 			return nil, lastErr
 		}
 
+		if c.isStreaming() {
+			sr, err := c.readStream(resp, start, "completion")
+			if err != nil {
+				lastErr = err
+				if attempt < maxR && ctx.Err() == nil && isRetryableDifyErr(err) {
+					sleep := difyRetryBackoff(attempt + 1)
+					log.Printf("[dify] completion stream retry=%d/%d sleep=%s err=%v", attempt+1, maxR, sleep, err)
+					if err := sleepWithContext(ctx, sleep); err != nil {
+						return nil, err
+					}
+					continue
+				}
+				return nil, lastErr
+			}
+			completionResp := &CompletionResponse{
+				MessageID:        sr.MessageID,
+				Answer:           sr.Answer,
+				TimeToFirstToken: sr.TimeToFirstToken,
+			}
+			completionResp.Metadata.Usage.PromptTokens = sr.Usage.PromptTokens
+			completionResp.Metadata.Usage.CompletionTokens = sr.Usage.CompletionTokens
+			completionResp.Metadata.Usage.TotalTokens = sr.Usage.TotalTokens
+			return completionResp, nil
+		}
+
+		body, _ := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+
 		var completionResp CompletionResponse
 		if err := json.Unmarshal(body, &completionResp); err != nil {
 			return nil, fmt.Errorf("解析响应失败: %w", err)
@@ -305,7 +408,7 @@ func (c *DifyClient) Completion(prompt string, inputs map[string]interface{}) (*
 	return nil, lastErr
 }
 
-func (c *DifyClient) WorkflowRun(inputs map[string]interface{}) (string, int, error) {
+func (c *DifyClient) WorkflowRun(ctx context.Context, inputs map[string]interface{}) (*WorkflowRunResult, error) {
 	url := fmt.Sprintf("%s/workflows/run", c.BaseURL)
 
 	reqBody := WorkflowRunRequest{
@@ -316,59 +419,112 @@ func (c *DifyClient) WorkflowRun(inputs map[string]interface{}) (string, int, er
 
 	jsonData, err := json.Marshal(reqBody)
 	if err != nil {
-		return "", 0, fmt.Errorf("序列化请求失败: %w", err)
+		return nil, fmt.Errorf("序列化请求失败: %w", err)
 	}
 
 	var lastErr error
 	maxR := difyMaxRetries()
 	for attempt := 0; attempt <= maxR; attempt++ {
-		req, err := http.NewRequestWithContext(context.Background(), "POST", url, bytes.NewBuffer(jsonData))
+		req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
 		if err != nil {
-			return "", 0, fmt.Errorf("创建请求失败: %w", err)
+			return nil, fmt.Errorf("创建请求失败: %w", err)
 		}
 		req.Header.Set("Content-Type", "application/json")
 		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.APIKey))
 
+		start := time.Now()
 		resp, err := c.Client.Do(req)
 		if err != nil {
 			lastErr = fmt.Errorf("请求失败: %w", err)
-			if attempt < maxR && isRetryableDifyErr(err) {
+			if attempt < maxR && ctx.Err() == nil && isRetryableDifyErr(err) {
 				sleep := difyRetryBackoff(attempt + 1)
 				log.Printf("[dify] workflow retry=%d/%d sleep=%s err=%v", attempt+1, maxR, sleep, err)
-				time.Sleep(sleep)
+				if err := sleepWithContext(ctx, sleep); err != nil {
+					return nil, err
+				}
 				continue
 			}
-			return "", 0, lastErr
+			return nil, lastErr
 		}
 
-		body, _ := io.ReadAll(resp.Body)
-		_ = resp.Body.Close()
-
 		if resp.StatusCode != http.StatusOK {
+			body, _ := io.ReadAll(resp.Body)
+			_ = resp.Body.Close()
 			bodyStr := string(body)
 			if len(bodyStr) > 500 {
 				bodyStr = bodyStr[:500] + "..."
 			}
 			lastErr = fmt.Errorf("API返回错误: %d, %s", resp.StatusCode, bodyStr)
-			if attempt < maxR && isRetryableStatus(resp.StatusCode) {
+			if attempt < maxR && ctx.Err() == nil && isRetryableStatus(resp.StatusCode) {
 				sleep := difyRetryBackoff(attempt + 1)
 				log.Printf("[dify] workflow retry=%d/%d sleep=%s status=%d", attempt+1, maxR, sleep, resp.StatusCode)
-				time.Sleep(sleep)
+				if err := sleepWithContext(ctx, sleep); err != nil {
+					return nil, err
+				}
 				continue
 			}
-			return "", 0, lastErr
+			return nil, lastErr
+		}
+
+		if c.isStreaming() {
+			sr, err := c.readStream(resp, start, "workflow")
+			if err != nil {
+				lastErr = err
+				if attempt < maxR && ctx.Err() == nil && isRetryableDifyErr(err) {
+					sleep := difyRetryBackoff(attempt + 1)
+					log.Printf("[dify] workflow stream retry=%d/%d sleep=%s err=%v", attempt+1, maxR, sleep, err)
+					if err := sleepWithContext(ctx, sleep); err != nil {
+						return nil, err
+					}
+					continue
+				}
+				return nil, lastErr
+			}
+			answer := extractWorkflowAnswer(sr.WorkflowOutputs, c.WorkflowOutputKey)
+			if answer == "" {
+				answer = sr.Text
+			}
+			return &WorkflowRunResult{
+				Answer:           answer,
+				Usage:            sr.Usage,
+				TotalSteps:       sr.TotalSteps,
+				ElapsedTime:      sr.ElapsedTime,
+				TimeToFirstToken: sr.TimeToFirstToken,
+			}, nil
 		}
 
-		// streaming 模式会返回 SSE；本项目不解析 SSE，建议用 blocking
+		body, _ := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+
 		var runResp WorkflowRunResponse
 		if err := json.Unmarshal(body, &runResp); err != nil {
-			return "", 0, fmt.Errorf("解析响应失败: %w", err)
+			return nil, fmt.Errorf("解析响应失败: %w", err)
+		}
+
+		if runResp.Data.Status != "" && runResp.Data.Status != "succeeded" {
+			return nil, fmt.Errorf("workflow执行失败: status=%s, error=%s", runResp.Data.Status, runResp.Data.Error)
 		}
 
 		answer := extractWorkflowAnswer(runResp.Data.Outputs, c.WorkflowOutputKey)
-		return answer, 0, nil
+		return &WorkflowRunResult{
+			Answer:      answer,
+			Usage:       LLMUsage{TotalTokens: runResp.Data.TotalTokens},
+			TotalSteps:  runResp.Data.TotalSteps,
+			ElapsedTime: runResp.Data.ElapsedTime,
+		}, nil
 	}
-	return "", 0, lastErr
+	return nil, lastErr
+}
+
+// readStream 解析 SSE 响应体并记录首 token 延迟
+func (c *DifyClient) readStream(resp *http.Response, start time.Time, endpoint string) (*difyStreamResult, error) {
+	defer resp.Body.Close()
+	sr, err := parseDifySSE(resp.Body, start)
+	if err != nil {
+		return nil, fmt.Errorf("解析流式响应失败: %w", err)
+	}
+	log.Printf("[dify] %s stream done ttft=%s total=%s tokens=%d", endpoint, sr.TimeToFirstToken, time.Since(start), sr.Usage.TotalTokens)
+	return sr, nil
 }
 
 func extractWorkflowAnswer(outputs map[string]interface{}, outputKey string) string {
@@ -407,19 +563,22 @@ func extractWorkflowAnswer(outputs map[string]interface{}, outputKey string) str
 }
 
 // ChatOrCompletion 智能选择API端点：workflow -> completion -> chat
-func (c *DifyClient) ChatOrCompletion(prompt string, inputs map[string]interface{}) (*ChatResponse, error) {
+func (c *DifyClient) ChatOrCompletion(ctx context.Context, prompt string, inputs map[string]interface{}) (*ChatResponse, error) {
 	if c.AppType == "workflow" {
-		ans, tokens, err := c.WorkflowRun(inputs)
+		wf, err := c.WorkflowRun(ctx, inputs)
 		if err != nil {
 			return nil, err
 		}
 		var resp ChatResponse
-		resp.Answer = ans
-		resp.Metadata.Usage.TotalTokens = tokens
+		resp.Answer = wf.Answer
+		resp.Metadata.Usage.PromptTokens = wf.Usage.PromptTokens
+		resp.Metadata.Usage.CompletionTokens = wf.Usage.CompletionTokens
+		resp.Metadata.Usage.TotalTokens = wf.Usage.TotalTokens
+		resp.TimeToFirstToken = wf.TimeToFirstToken
 		return &resp, nil
 	}
 
-	completionResp, err := c.Completion(prompt, inputs)
+	completionResp, err := c.Completion(ctx, prompt, inputs)
 	if err == nil {
 		// 转换为ChatResponse格式
 		return &ChatResponse{
@@ -433,11 +592,16 @@ func (c *DifyClient) ChatOrCompletion(prompt string, inputs map[string]interface
 			}{
 				Usage: completionResp.Metadata.Usage,
 			},
+			TimeToFirstToken: completionResp.TimeToFirstToken,
 		}, nil
 	}
 	completionErr := err
+	if ctx.Err() != nil {
+		// 调用方已取消：不再降级到 chat
+		return nil, ctx.Err()
+	}
 
-	chatResp, chatErr := c.Chat(prompt, inputs)
+	chatResp, chatErr := c.Chat(ctx, prompt, inputs)
 	if chatErr == nil {
 		return chatResp, nil
 	}
@@ -446,3 +610,55 @@ func (c *DifyClient) ChatOrCompletion(prompt string, inputs map[string]interface
 	return nil, fmt.Errorf("所有API端点都失败: appType=%s, completion(%v), chat(%v)",
 		c.AppType, completionErr, chatErr)
 }
+
+// BuildInputs 实现 LLMProvider：workflow 模式下 system/query 两个字段必填
+func (c *DifyClient) BuildInputs(prompt, query string, fallback map[string]interface{}) map[string]interface{} {
+	if c == nil || c.AppType != "workflow" {
+		return fallback
+	}
+	systemKey := c.WorkflowSystemKey
+	queryKey := c.WorkflowQueryKey
+	if systemKey == "" {
+		systemKey = "system"
+	}
+	if queryKey == "" {
+		queryKey = "query"
+	}
+	return map[string]interface{}{
+		systemKey: prompt,
+		queryKey:  query,
+	}
+}
+
+// Complete 实现 LLMProvider：沿用 ChatOrCompletion 的端点选择与降级链
+// usage 缺失或只有 total 时用本地估算补全 prompt/completion 拆分
+func (c *DifyClient) Complete(ctx context.Context, prompt string, inputs map[string]interface{}) (*LLMResponse, error) {
+	if c.AppType == "workflow" {
+		wf, err := c.WorkflowRun(ctx, inputs)
+		if err != nil {
+			return nil, err
+		}
+		return &LLMResponse{
+			Answer:              wf.Answer,
+			Usage:               completeUsage(wf.Usage, prompt, wf.Answer),
+			TimeToFirstToken:    wf.TimeToFirstToken,
+			WorkflowSteps:       wf.TotalSteps,
+			WorkflowElapsedTime: wf.ElapsedTime,
+		}, nil
+	}
+
+	resp, err := c.ChatOrCompletion(ctx, prompt, inputs)
+	if err != nil {
+		return nil, err
+	}
+	usage := LLMUsage{
+		PromptTokens:     resp.Metadata.Usage.PromptTokens,
+		CompletionTokens: resp.Metadata.Usage.CompletionTokens,
+		TotalTokens:      resp.Metadata.Usage.TotalTokens,
+	}
+	return &LLMResponse{
+		Answer:           resp.Answer,
+		Usage:            completeUsage(usage, prompt, resp.Answer),
+		TimeToFirstToken: resp.TimeToFirstToken,
+	}, nil
+}
@@ -0,0 +1,75 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestDifyClient_WorkflowBlockingUsage blocking workflow：从 data 取 total_tokens/total_steps/elapsed_time；
+// 服务端未返回 total_tokens 时本地估算兜底
+func TestDifyClient_WorkflowBlockingUsage(t *testing.T) {
+	totalTokens := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"task_id":"t1","data":{"id":"w1","status":"succeeded","outputs":{"text":"{\"allow\": true}"},"total_tokens":%d,"total_steps":4,"elapsed_time":2.5}}`, totalTokens)
+	}))
+	defer srv.Close()
+
+	c := NewDifyClient(srv.URL, "k", "workflow", "blocking", "", "", "text")
+
+	totalTokens = 120
+	resp, err := c.Complete(context.Background(), "系统提示词 prompt", c.BuildInputs("系统提示词 prompt", "q", nil))
+	if err != nil {
+		t.Fatalf("complete failed: %v", err)
+	}
+	if resp.Usage.TotalTokens != 120 || resp.Usage.PromptTokens+resp.Usage.CompletionTokens != 120 {
+		t.Fatalf("unexpected usage: %+v", resp.Usage)
+	}
+	if resp.WorkflowSteps != 4 || resp.WorkflowElapsedTime != 2.5 {
+		t.Fatalf("unexpected workflow stats: steps=%d elapsed=%v", resp.WorkflowSteps, resp.WorkflowElapsedTime)
+	}
+
+	totalTokens = 0
+	resp, err = c.Complete(context.Background(), "系统提示词 prompt", c.BuildInputs("系统提示词 prompt", "q", nil))
+	if err != nil {
+		t.Fatalf("complete failed: %v", err)
+	}
+	if !resp.Usage.Estimated || resp.Usage.TotalTokens <= 0 || resp.Usage.PromptTokens <= 0 {
+		t.Fatalf("expected estimated usage, got %+v", resp.Usage)
+	}
+}
+
+// TestDifyClient_ContextCancel 调用方取消后应立即返回，且不再重试
+func TestDifyClient_ContextCancel(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	c := NewDifyClient(srv.URL, "k", "workflow", "blocking", "", "", "text")
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if _, err := c.Complete(ctx, "prompt", c.BuildInputs("prompt", "q", nil)); err == nil {
+		t.Fatalf("expected error after cancel")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("cancel not propagated, elapsed=%s", elapsed)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("expected no retry after cancel, calls=%d", n)
+	}
+}
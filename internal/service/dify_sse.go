@@ -0,0 +1,169 @@
+package service
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// difySSEEvent Dify 流式响应（response_mode=streaming）中的单个事件：每个事件是一行 `data: {...}`
+//
+// 只关心以下事件，其余（ping/workflow_started/node_started/tts_message 等）直接忽略：
+// - message / agent_message：chat/completion 的增量答案
+// - message_end：chat/completion 结束，携带 metadata.usage
+// - text_chunk：workflow 的增量文本（仅用于首 token 计时/兜底答案）
+// - node_finished：workflow 节点结束，累加节点 token
+// - workflow_finished：workflow 结束，携带 outputs/status/total_tokens
+// - error：流内错误
+type difySSEEvent struct {
+	Event          string `json:"event"`
+	MessageID      string `json:"message_id"`
+	ConversationID string `json:"conversation_id"`
+	Answer         string `json:"answer"`
+	Metadata       struct {
+		Usage LLMUsage `json:"usage"`
+	} `json:"metadata"`
+	Data struct {
+		NodeType          string                 `json:"node_type"`
+		Outputs           map[string]interface{} `json:"outputs"`
+		Status            string                 `json:"status"`
+		Error             string                 `json:"error"`
+		Text              string                 `json:"text"`
+		TotalTokens       int                    `json:"total_tokens"`
+		TotalSteps        int                    `json:"total_steps"`
+		ElapsedTime       float64                `json:"elapsed_time"`
+		ExecutionMetadata struct {
+			TotalTokens int `json:"total_tokens"`
+		} `json:"execution_metadata"`
+	} `json:"data"`
+	// error 事件
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// difyStreamResult 从 SSE 流中拼装出的完整结果
+type difyStreamResult struct {
+	MessageID      string
+	ConversationID string
+	Answer         string
+	Usage          LLMUsage
+
+	// workflow
+	WorkflowOutputs  map[string]interface{}
+	WorkflowStatus   string
+	WorkflowFinished bool
+	TotalSteps       int
+	ElapsedTime      float64
+	// node_finished 中各节点 token 之和（workflow_finished 未给 total_tokens 时兜底）
+	NodeTokens int
+	// text_chunk 拼接结果（outputs 为空时兜底）
+	Text string
+
+	MessageEnded bool
+	// 从发起请求到收到第一个非空增量的耗时
+	TimeToFirstToken time.Duration
+}
+
+// parseDifySSE 解析 Dify SSE 流；start 为发起请求的时间（用于计算首 token 延迟）
+func parseDifySSE(r io.Reader, start time.Time) (*difyStreamResult, error) {
+	res := &difyStreamResult{}
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), 8*1024*1024)
+
+	var data strings.Builder
+	flush := func() error {
+		payload := strings.TrimSpace(data.String())
+		data.Reset()
+		if payload == "" {
+			return nil
+		}
+		var ev difySSEEvent
+		if err := json.Unmarshal([]byte(payload), &ev); err != nil {
+			return fmt.Errorf("解析SSE事件失败: %w", err)
+		}
+		return res.apply(ev, start)
+	}
+
+	for sc.Scan() {
+		line := sc.Text()
+		switch {
+		case line == "":
+			// 空行：事件结束
+			if err := flush(); err != nil {
+				return nil, err
+			}
+		case strings.HasPrefix(line, ":"):
+			// 注释/心跳
+		case strings.HasPrefix(line, "data:"):
+			if data.Len() > 0 {
+				data.WriteByte('\n')
+			}
+			data.WriteString(strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		default:
+			// event:/id:/retry: 等字段：Dify 的事件类型在 JSON 内，忽略
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("读取SSE流失败: %w", err)
+	}
+	// 流末尾可能没有空行
+	if err := flush(); err != nil {
+		return nil, err
+	}
+
+	if !res.MessageEnded && !res.WorkflowFinished && res.Answer == "" && res.Text == "" {
+		return nil, fmt.Errorf("SSE流提前结束: 未收到 message_end/workflow_finished")
+	}
+	return res, nil
+}
+
+func (res *difyStreamResult) apply(ev difySSEEvent, start time.Time) error {
+	if ev.MessageID != "" {
+		res.MessageID = ev.MessageID
+	}
+	if ev.ConversationID != "" {
+		res.ConversationID = ev.ConversationID
+	}
+
+	switch ev.Event {
+	case "message", "agent_message":
+		res.markFirstToken(ev.Answer, start)
+		res.Answer += ev.Answer
+	case "message_replace":
+		// 内容审查替换：以替换后的答案为准
+		res.Answer = ev.Answer
+	case "message_end":
+		res.MessageEnded = true
+		res.Usage = ev.Metadata.Usage
+	case "text_chunk":
+		res.markFirstToken(ev.Data.Text, start)
+		res.Text += ev.Data.Text
+	case "node_finished":
+		res.NodeTokens += ev.Data.ExecutionMetadata.TotalTokens
+	case "workflow_finished":
+		res.WorkflowFinished = true
+		res.WorkflowStatus = ev.Data.Status
+		res.WorkflowOutputs = ev.Data.Outputs
+		res.TotalSteps = ev.Data.TotalSteps
+		res.ElapsedTime = ev.Data.ElapsedTime
+		res.Usage.TotalTokens = ev.Data.TotalTokens
+		if res.Usage.TotalTokens == 0 {
+			res.Usage.TotalTokens = res.NodeTokens
+		}
+		if ev.Data.Status != "" && ev.Data.Status != "succeeded" {
+			return fmt.Errorf("workflow执行失败: status=%s, error=%s", ev.Data.Status, ev.Data.Error)
+		}
+	case "error":
+		return fmt.Errorf("SSE流返回错误: code=%s, message=%s", ev.Code, ev.Message)
+	}
+	return nil
+}
+
+func (res *difyStreamResult) markFirstToken(chunk string, start time.Time) {
+	if res.TimeToFirstToken == 0 && chunk != "" {
+		res.TimeToFirstToken = time.Since(start)
+	}
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestParseDifySSE_Message chat/completion：拼接 message 增量，从 message_end 取 usage
+func TestParseDifySSE_Message(t *testing.T) {
+	stream := strings.Join([]string{
+		`data: {"event": "ping"}`,
+		``,
+		`data: {"event": "message", "message_id": "m1", "conversation_id": "c1", "answer": "{\"allow\":"}`,
+		``,
+		`data: {"event": "message", "message_id": "m1", "answer": " true}"}`,
+		``,
+		`data: {"event": "message_end", "message_id": "m1", "metadata": {"usage": {"prompt_tokens": 30, "completion_tokens": 5, "total_tokens": 35}}}`,
+		``,
+	}, "\n")
+	res, err := parseDifySSE(strings.NewReader(stream), time.Now())
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	if res.Answer != `{"allow": true}` {
+		t.Fatalf("unexpected answer: %q", res.Answer)
+	}
+	if res.Usage.TotalTokens != 35 || res.Usage.PromptTokens != 30 {
+		t.Fatalf("unexpected usage: %+v", res.Usage)
+	}
+	if res.MessageID != "m1" || res.ConversationID != "c1" {
+		t.Fatalf("unexpected ids: %s %s", res.MessageID, res.ConversationID)
+	}
+	if res.TimeToFirstToken <= 0 {
+		t.Fatalf("expected ttft > 0")
+	}
+}
+
+// TestParseDifySSE_ErrorEvent 流内 error 事件应返回错误
+func TestParseDifySSE_ErrorEvent(t *testing.T) {
+	stream := "data: {\"event\": \"error\", \"code\": \"invalid_param\", \"message\": \"bad\"}\n\n"
+	if _, err := parseDifySSE(strings.NewReader(stream), time.Now()); err == nil {
+		t.Fatalf("expected error event to fail")
+	}
+	if _, err := parseDifySSE(strings.NewReader("data: {\"event\": \"ping\"}\n\n"), time.Now()); err == nil {
+		t.Fatalf("expected truncated stream to fail")
+	}
+}
+
+// TestDifyClient_WorkflowStreaming workflow streaming：从 workflow_finished 取 outputs/total_tokens
+func TestDifyClient_WorkflowStreaming(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		events := []string{
+			`{"event": "workflow_started", "data": {"id": "w1"}}`,
+			`{"event": "text_chunk", "data": {"text": "{\"allow\": false"}}`,
+			`{"event": "node_finished", "data": {"node_type": "llm", "execution_metadata": {"total_tokens": 40}}}`,
+			`{"event": "workflow_finished", "data": {"status": "succeeded", "outputs": {"text": "{\"allow\": false}"}, "total_tokens": 42, "total_steps": 3, "elapsed_time": 1.5}}`,
+		}
+		for _, e := range events {
+			fmt.Fprintf(w, "data: %s\n\n", e)
+			w.(http.Flusher).Flush()
+		}
+	}))
+	defer srv.Close()
+
+	c := NewDifyClient(srv.URL, "k", "workflow", "streaming", "", "", "text")
+	resp, err := c.Complete(context.Background(), "prompt", c.BuildInputs("prompt", "q", nil))
+	if err != nil {
+		t.Fatalf("complete failed: %v", err)
+	}
+	if resp.Answer != `{"allow": false}` {
+		t.Fatalf("unexpected answer: %q", resp.Answer)
+	}
+	if resp.Usage.TotalTokens != 42 {
+		t.Fatalf("unexpected total tokens: %d", resp.Usage.TotalTokens)
+	}
+	if resp.TimeToFirstToken <= 0 {
+		t.Fatalf("expected ttft > 0")
+	}
+}
@@ -0,0 +1,144 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+
+	"mem-test/internal/model"
+	"mem-test/internal/repository"
+)
+
+// ErrInvalidEvalConfig 评估阶段参数不合法（如留出集与训练集 seed/分布完全相同）
+var ErrInvalidEvalConfig = errors.New("无效的评估阶段配置")
+
+// 留出集分布
+const (
+	EvalDistributionSame     = "same"     // 与训练同分布、不同 seed
+	EvalDistributionBoundary = "boundary" // 积分集中在规则门槛 ±20 附近（更难的分布偏移）
+)
+
+// evalFixedCasePrefix 大于各输入构造器开头固定边界用例的条数；留出集跳过这部分，避免与训练集输入重复
+const evalFixedCasePrefix = 16
+
+// boundaryHalfWidth boundary 分布下积分相对门槛的最大偏移
+const boundaryHalfWidth = 20
+
+// validateEvalConfig 评估阶段参数校验（在 normalizeRunRequest 之后调用）
+func validateEvalConfig(req ExperimentRunRequest) error {
+	if req.EvalRounds < 0 {
+		return fmt.Errorf("%w: eval_rounds 不能为负数", ErrInvalidEvalConfig)
+	}
+	if req.EvalRounds == 0 {
+		return nil
+	}
+	switch req.EvalDistribution {
+	case EvalDistributionSame, EvalDistributionBoundary:
+	default:
+		return fmt.Errorf("%w: eval_distribution 不合法: %q", ErrInvalidEvalConfig, req.EvalDistribution)
+	}
+	if req.EvalSeed == req.Seed && req.EvalDistribution == EvalDistributionSame {
+		return fmt.Errorf("%w: 同分布评估时 eval_seed 必须与 seed 不同", ErrInvalidEvalConfig)
+	}
+	return nil
+}
+
+// buildTaskInputs 按任务类型生成 n 条输入（训练集与留出集共用）
+func buildTaskInputs(taskType string, n int, seed int64, action string) []map[string]interface{} {
+	switch taskType {
+	case "lottery_v2":
+		return buildLotteryV2Inputs(n, seed, action)
+	case "lottery_multi":
+		return buildLotteryMultiPointsInputs(n, seed, action)
+	}
+	pointsSeq := buildLotteryPoints(n, seed)
+	out := make([]map[string]interface{}, 0, len(pointsSeq))
+	for i := range pointsSeq {
+		out = append(out, map[string]interface{}{
+			"points": pointsSeq[i],
+			"action": action,
+		})
+	}
+	return out
+}
+
+// buildEvalInputs 留出集：只取随机样本（跳过固定边界用例）；boundary 分布把积分重采样到 threshold 附近
+func buildEvalInputs(taskType string, n int, seed int64, action, distribution string, threshold int) []map[string]interface{} {
+	if n <= 0 {
+		return nil
+	}
+	out := buildTaskInputs(taskType, n+evalFixedCasePrefix, seed, action)[evalFixedCasePrefix:]
+	if distribution != EvalDistributionBoundary {
+		return out
+	}
+	if threshold <= 0 {
+		threshold = 100
+	}
+	key := "points"
+	if taskType == "lottery_multi" {
+		key = "points_available"
+	}
+	rng := rand.New(rand.NewSource(seed))
+	for _, in := range out {
+		p := threshold - boundaryHalfWidth + rng.Intn(2*boundaryHalfWidth+1)
+		if p < 0 {
+			p = 0
+		}
+		in[key] = p
+	}
+	return out
+}
+
+// extendSchedule 评估阶段沿用训练最后一轮的规则（门槛/版本不再变化）
+func extendSchedule(seq []int, n int) []int {
+	if len(seq) == 0 || n <= 0 {
+		return seq
+	}
+	last := seq[len(seq)-1]
+	for i := 0; i < n; i++ {
+		seq = append(seq, last)
+	}
+	return seq
+}
+
+// ComputeRunEvalStats 评估阶段统计：各组留出集错误率/CI、组间两两比较，以及每组训练 vs 测试的泛化差距检验
+// train 为训练阶段统计（ComputeRunStatsAndTests 的结果）
+func ComputeRunEvalStats(ctx context.Context, store *repository.Store, runID uint, groups []string, train map[string]GroupStats) (map[string]GroupStats, map[string]interface{}, error) {
+	stats := map[string]GroupStats{}
+	tests := map[string]interface{}{}
+	outcomes := map[string]map[int]bool{}
+	for _, g := range groups {
+		tasks, err := store.Tasks.Find(ctx, repository.TaskFilter{RunID: runID, GroupType: g, Phase: model.TaskPhaseEval})
+		if err != nil {
+			return nil, nil, fmt.Errorf("查询评估任务失败: %w", err)
+		}
+		gs := calcGroupStats(tasks)
+		attr, err := groupErrorAttribution(ctx, store, tasks)
+		if err != nil {
+			return nil, nil, err
+		}
+		gs.ErrorAttribution = attr
+		stats[g] = gs
+		outcomes[g] = roundOutcomes(tasks)
+	}
+
+	pairwiseTests(tests, groups, stats, outcomes)
+
+	for _, g := range groups {
+		tr, ok := train[g]
+		if !ok {
+			continue
+		}
+		ev := stats[g]
+		p, z := twoPropZTest(tr.Incorrect, tr.N, ev.Incorrect, ev.N)
+		tests[g+"_eval_vs_train"] = map[string]interface{}{
+			"p_value":            p,
+			"z":                  z,
+			"train_error_rate":   tr.ErrorRate,
+			"eval_error_rate":    ev.ErrorRate,
+			"generalization_gap": ev.ErrorRate - tr.ErrorRate,
+		}
+	}
+	return stats, tests, nil
+}
@@ -0,0 +1,58 @@
+package service
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// TestBuildEvalInputs 留出集跳过固定边界用例、可复现；boundary 分布的积分落在门槛 ±20 内
+func TestBuildEvalInputs(t *testing.T) {
+	same := buildEvalInputs("lottery", 20, 7, "lottery", EvalDistributionSame, 0)
+	if len(same) != 20 {
+		t.Fatalf("expected 20 eval inputs, got %d", len(same))
+	}
+	if !reflect.DeepEqual(same, buildEvalInputs("lottery", 20, 7, "lottery", EvalDistributionSame, 0)) {
+		t.Fatalf("eval inputs should be deterministic for the same seed")
+	}
+	train := buildTaskInputs("lottery", 9, 7, "lottery")
+	if reflect.DeepEqual(same[:9], train) {
+		t.Fatalf("eval inputs should not start with the fixed training cases")
+	}
+
+	boundary := buildEvalInputs("lottery_multi", 30, 7, "lottery", EvalDistributionBoundary, 120)
+	for i, in := range boundary {
+		p := in["points_available"].(int)
+		if p < 100 || p > 140 {
+			t.Fatalf("input %d: points_available=%d outside threshold±20", i, p)
+		}
+	}
+
+	if got := extendSchedule([]int{100, 120}, 3); !reflect.DeepEqual(got, []int{100, 120, 120, 120, 120}) {
+		t.Fatalf("unexpected extended schedule: %v", got)
+	}
+}
+
+// TestValidateEvalConfig 同分布且同 seed 不构成留出集
+func TestValidateEvalConfig(t *testing.T) {
+	req := normalizeRunRequest(ExperimentRunRequest{Seed: 42, EvalRounds: 10})
+	if req.EvalSeed != 43 || req.EvalDistribution != EvalDistributionSame {
+		t.Fatalf("unexpected eval defaults: seed=%d dist=%s", req.EvalSeed, req.EvalDistribution)
+	}
+	if err := validateEvalConfig(req); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	req.EvalSeed = 42
+	if err := validateEvalConfig(req); !errors.Is(err, ErrInvalidEvalConfig) {
+		t.Fatalf("expected ErrInvalidEvalConfig for identical seed, got %v", err)
+	}
+	req.EvalDistribution = EvalDistributionBoundary
+	if err := validateEvalConfig(req); err != nil {
+		t.Fatalf("boundary distribution with same seed should be allowed: %v", err)
+	}
+	req.EvalDistribution = "uniform"
+	if err := validateEvalConfig(req); !errors.Is(err, ErrInvalidEvalConfig) {
+		t.Fatalf("expected ErrInvalidEvalConfig for unknown distribution, got %v", err)
+	}
+}
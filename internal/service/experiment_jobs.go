@@ -0,0 +1,176 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"mem-test/internal/model"
+	"mem-test/internal/repository"
+)
+
+// ErrRunNotCancellable run 已处于终态（done/failed/cancelled），无法取消
+var ErrRunNotCancellable = errors.New("run 已结束，无法取消")
+
+// experimentJobs 后台实验任务：按提交顺序串行执行（避免多个 run 交错读写共享全局池、同时占用模型配额），
+// 排队中的 run 状态为 queued，拿到执行槽后变为 running。
+type experimentJobs struct {
+	mu      sync.Mutex
+	cancels map[uint]context.CancelFunc
+	slots   chan struct{}
+}
+
+func newExperimentJobs() *experimentJobs {
+	return &experimentJobs{
+		cancels: map[uint]context.CancelFunc{},
+		slots:   make(chan struct{}, 1),
+	}
+}
+
+func (j *experimentJobs) add(runID uint, cancel context.CancelFunc) {
+	j.mu.Lock()
+	j.cancels[runID] = cancel
+	j.mu.Unlock()
+}
+
+func (j *experimentJobs) remove(runID uint) {
+	j.mu.Lock()
+	if cancel, ok := j.cancels[runID]; ok {
+		cancel()
+		delete(j.cancels, runID)
+	}
+	j.mu.Unlock()
+}
+
+func (j *experimentJobs) active(runID uint) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	_, ok := j.cancels[runID]
+	return ok
+}
+
+func (j *experimentJobs) cancel(runID uint) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	cancel, ok := j.cancels[runID]
+	if ok {
+		cancel()
+	}
+	return ok
+}
+
+// Submit 创建 run（状态 queued）并在后台执行，立即返回 run 元数据
+// 后台任务的生命周期独立于提交它的 HTTP 请求，只能通过 Cancel 中止。
+func (r *ExperimentRunner) Submit(ctx context.Context, req ExperimentRunRequest) (*model.ExperimentRun, error) {
+	req = normalizeRunRequest(req)
+	if err := r.validateRequest(ctx, req); err != nil {
+		return nil, err
+	}
+	run, err := r.createRun(ctx, req, model.ExperimentRunStatusQueued)
+	if err != nil {
+		return nil, err
+	}
+
+	r.startJob(run, req, nil)
+	return run, nil
+}
+
+// Run 与 Submit 一样创建 run 并交给后台任务队列（占用同一执行槽，Resume/Cancel 可见），然后阻塞到执行结束；
+// ctx 结束（如同步模式下 HTTP 请求断开）时取消该 run，并等待部分结果写出后返回
+func (r *ExperimentRunner) Run(ctx context.Context, req ExperimentRunRequest) (*ExperimentRunResult, error) {
+	req = normalizeRunRequest(req)
+	if err := r.validateRequest(ctx, req); err != nil {
+		return nil, err
+	}
+	run, err := r.createRun(ctx, req, model.ExperimentRunStatusQueued)
+	if err != nil {
+		return nil, err
+	}
+
+	done := r.startJob(run, req, nil)
+	select {
+	case out := <-done:
+		return out.result, out.err
+	case <-ctx.Done():
+		r.jobs.cancel(run.ID)
+		out := <-done
+		return out.result, out.err
+	}
+}
+
+// jobOutcome 后台任务结束时的结果（供 Run 同步等待）
+type jobOutcome struct {
+	result *ExperimentRunResult
+	err    error
+}
+
+func (r *ExperimentRunner) startJob(run *model.ExperimentRun, req ExperimentRunRequest, resume *runResumeState) <-chan jobOutcome {
+	jobCtx, cancel := context.WithCancel(context.Background())
+	r.jobs.add(run.ID, cancel)
+	done := make(chan jobOutcome, 1)
+	go func() {
+		result, err := r.runJob(jobCtx, run, req, resume)
+		done <- jobOutcome{result: result, err: err}
+	}()
+	return done
+}
+
+func (r *ExperimentRunner) runJob(ctx context.Context, run *model.ExperimentRun, req ExperimentRunRequest, resume *runResumeState) (result *ExperimentRunResult, err error) {
+	defer r.jobs.remove(run.ID)
+
+	select {
+	case r.jobs.slots <- struct{}{}:
+	case <-ctx.Done():
+		// 排队期间被取消：没有任何结果，直接记为 cancelled
+		markRunStatus(context.WithoutCancel(ctx), r.store, run.ID, model.ExperimentRunStatusCancelled, "")
+		r.progress.publish(ExperimentEvent{Type: ExperimentEventStatus, RunID: run.ID, Status: model.ExperimentRunStatusCancelled})
+		r.progress.finish(run.ID)
+		return &ExperimentRunResult{RunID: run.ID, Seed: req.Seed, TaskType: req.TaskType, RunsPerGroup: req.RunsPerGroup, Groups: req.Groups, Status: model.ExperimentRunStatusCancelled}, nil
+	}
+	defer func() { <-r.jobs.slots }()
+
+	defer func() {
+		if p := recover(); p != nil {
+			log.Printf("[experiment] run=%d panic: %v", run.ID, p)
+			err = fmt.Errorf("panic: %v", p)
+			markRunFailed(context.WithoutCancel(ctx), r.store, run.ID, err)
+		}
+	}()
+
+	result, err = r.execute(ctx, run, req, resume)
+	if err != nil {
+		log.Printf("[experiment] run=%d failed: %v", run.ID, err)
+	}
+	return result, err
+}
+
+// Cancel 取消排队中/执行中的 run；执行中的 run 跑完当前轮次（所有组）后停止，并写出部分结果
+func (r *ExperimentRunner) Cancel(ctx context.Context, runID uint) error {
+	if r.jobs.cancel(runID) {
+		return nil
+	}
+
+	run, err := r.store.Runs.Get(ctx, runID)
+	if err != nil {
+		return fmt.Errorf("查询实验run失败: %w", err)
+	}
+	if run.IsTerminal() {
+		return ErrRunNotCancellable
+	}
+	// 非终态但没有对应的后台任务（例如服务重启前遗留）：直接标记为 cancelled
+	markRunStatus(ctx, r.store, runID, model.ExperimentRunStatusCancelled, "")
+	return nil
+}
+
+func markRunFailed(ctx context.Context, store *repository.Store, runID uint, err error) {
+	markRunStatus(ctx, store, runID, model.ExperimentRunStatusFailed, err.Error())
+}
+
+func markRunStatus(ctx context.Context, store *repository.Store, runID uint, status, errMsg string) {
+	if err := store.Runs.MarkStatus(ctx, runID, status, errMsg, time.Now()); err != nil {
+		log.Printf("[experiment] update run=%d status=%s failed: %v", runID, status, err)
+	}
+}
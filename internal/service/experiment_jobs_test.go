@@ -0,0 +1,120 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"mem-test/internal/model"
+	"mem-test/internal/repository"
+)
+
+// newTestRunner 内存仓库 + 模拟模型（llm 为 nil 时）的完整 ExperimentRunner
+func newTestRunner(t *testing.T, llm LLMProvider) *ExperimentRunner {
+	t.Helper()
+	store := repository.NewMemoryStore()
+	if llm == nil {
+		llm = NewMockLLMClient(42, 0, 1)
+	}
+	return NewExperimentRunner(store, NewAgentService(store, llm, nil, ""), NewCoachService(store), NewReflectionService(store, llm, nil, ""), nil)
+}
+
+// waitRunStatus 轮询直到 run 进入指定状态
+func waitRunStatus(t *testing.T, r *ExperimentRunner, runID uint, status string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if run, err := r.store.Runs.Get(context.Background(), runID); err == nil && run.Status == status {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("run %d did not reach status %s", runID, status)
+}
+
+// TestRun_GoesThroughJobQueue 同步 Run 与 Submit 共用执行槽：排队期间 Resume 视其为执行中，拿到槽后跑完并返回结果
+func TestRun_GoesThroughJobQueue(t *testing.T) {
+	r := newTestRunner(t, nil)
+	ctx := context.Background()
+
+	// 占住执行槽，模拟另一个 run 正在执行
+	r.jobs.slots <- struct{}{}
+	done := make(chan jobOutcome, 1)
+	go func() {
+		result, err := r.Run(ctx, ExperimentRunRequest{TaskType: "lottery", RunsPerGroup: 2, Seed: 1, Groups: []string{"A", "C"}, GlobalPool: GlobalPoolEmpty})
+		done <- jobOutcome{result: result, err: err}
+	}()
+
+	var runID uint
+	deadline := time.Now().Add(5 * time.Second)
+	for runID == 0 && time.Now().Before(deadline) {
+		if runs, err := r.store.Runs.Find(ctx, repository.RunFilter{}); err == nil && len(runs) == 1 {
+			runID = runs[0].ID
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if runID == 0 || !r.jobs.active(runID) {
+		t.Fatalf("Run should register a job: run=%d", runID)
+	}
+	waitRunStatus(t, r, runID, model.ExperimentRunStatusQueued)
+	if _, err := r.Resume(ctx, runID); !errors.Is(err, ErrRunActive) {
+		t.Fatalf("resume of a waiting run should be rejected: %v", err)
+	}
+
+	<-r.jobs.slots
+	out := <-done
+	if out.err != nil || out.result.RunID != runID || out.result.Status != model.ExperimentRunStatusDone || out.result.CompletedRounds != 2 {
+		t.Fatalf("run result: %v %+v", out.err, out.result)
+	}
+	if r.jobs.active(runID) {
+		t.Fatalf("job should be removed after Run returns")
+	}
+}
+
+// hookLLM 每次调用前先执行 hook（参数为从 1 开始的调用序号与 prompt），再透传给内嵌的 provider
+type hookLLM struct {
+	LLMProvider
+	mu    sync.Mutex
+	calls int
+	hook  func(call int, prompt string)
+}
+
+func (h *hookLLM) Complete(ctx context.Context, prompt string, inputs map[string]interface{}) (*LLMResponse, error) {
+	h.mu.Lock()
+	h.calls++
+	call := h.calls
+	h.mu.Unlock()
+	h.hook(call, prompt)
+	return h.LLMProvider.Complete(ctx, prompt, inputs)
+}
+
+// TestRun_CancelAtRoundBoundary 轮内（B 组执行时）取消：本轮其余组照常跑完，之后的轮次不再开始，各组任务数相同
+func TestRun_CancelAtRoundBoundary(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	llm := &hookLLM{LLMProvider: NewMockLLMClient(42, 0, 1), hook: func(call int, _ string) {
+		if call != 2 {
+			return
+		}
+		cancel()
+		// 等 Run 把取消传给后台任务，确保取消发生在轮内
+		time.Sleep(20 * time.Millisecond)
+	}}
+	r := newTestRunner(t, llm)
+	groups := []string{"A", "B", "C"}
+	result, err := r.Run(ctx, ExperimentRunRequest{TaskType: "lottery", RunsPerGroup: 5, Seed: 1, Groups: groups, GlobalPool: GlobalPoolEmpty})
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if result.Status != model.ExperimentRunStatusCancelled || result.CompletedRounds != 1 {
+		t.Fatalf("run should stop after the first round: status=%s rounds=%d", result.Status, result.CompletedRounds)
+	}
+	for _, g := range groups {
+		tasks, err := r.store.Tasks.Find(context.Background(), repository.TaskFilter{RunID: result.RunID, GroupType: g})
+		if err != nil || len(tasks) != 1 || tasks[0].IsCorrect == nil || len(result.Trend[g]) != 1 {
+			t.Fatalf("group %s should have exactly one judged task: %v tasks=%d trend=%v", g, err, len(tasks), result.Trend[g])
+		}
+	}
+}
@@ -0,0 +1,339 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"mem-test/internal/model"
+	"mem-test/internal/repository"
+)
+
+// ErrInvalidMetaQuery 跨 run 汇总的查询参数无效（日期格式、对比组写法）
+var ErrInvalidMetaQuery = errors.New("无效的汇总查询参数")
+
+// DefaultMetaContrasts 默认汇总的组间对比（后者_vs_前者，差值为后者 − 前者）
+var DefaultMetaContrasts = []string{"F_vs_E", "E_vs_D"}
+
+// MetaAnalysisRequest 按 task_type / rule_mode / 创建时间筛选已完成的 run
+type MetaAnalysisRequest struct {
+	TaskType string `json:"task_type"`
+	RuleMode string `json:"rule_mode,omitempty"`
+	// 创建时间区间 [From, To)，零值表示不限
+	From time.Time `json:"from,omitempty"`
+	To   time.Time `json:"to,omitempty"`
+	// 形如 F_vs_E；为空时用 DefaultMetaContrasts
+	Contrasts []string `json:"contrasts,omitempty"`
+}
+
+// MetaStudy 单个 run 对某个指标的估计（错误率或错误率差）
+type MetaStudy struct {
+	RunID    uint    `json:"run_id"`
+	Seed     int64   `json:"seed"`
+	RuleMode string  `json:"rule_mode"`
+	N        int     `json:"n"`
+	Estimate float64 `json:"estimate"`
+	Variance float64 `json:"variance"`
+	CI95Low  float64 `json:"ci95_low"`
+	CI95High float64 `json:"ci95_high"`
+	// 在固定/随机效应合并中的权重占比
+	WeightFixed  float64 `json:"weight_fixed"`
+	WeightRandom float64 `json:"weight_random"`
+}
+
+// MetaPooled 合并估计
+type MetaPooled struct {
+	Estimate float64 `json:"estimate"`
+	SE       float64 `json:"se"`
+	CI95Low  float64 `json:"ci95_low"`
+	CI95High float64 `json:"ci95_high"`
+	Z        float64 `json:"z"`
+	P        float64 `json:"p_value"`
+}
+
+// MetaEstimate 一个指标的跨 run 汇总：逆方差固定效应 + DerSimonian–Laird 随机效应 + 异质性
+type MetaEstimate struct {
+	Name    string      `json:"name"`
+	Studies []MetaStudy `json:"studies"`
+	Fixed   MetaPooled  `json:"fixed"`
+	Random  MetaPooled  `json:"random"`
+	// Cochran Q、自由度与 p；I² = max(0, (Q−df)/Q)；Tau2 为 run 间方差
+	Q    float64 `json:"q"`
+	DF   int     `json:"df"`
+	QP   float64 `json:"q_p_value"`
+	I2   float64 `json:"i2"`
+	Tau2 float64 `json:"tau2"`
+}
+
+// MetaAnalysisReport 跨 run 汇总结果
+type MetaAnalysisReport struct {
+	TaskType    string         `json:"task_type"`
+	RuleMode    string         `json:"rule_mode,omitempty"`
+	From        *time.Time     `json:"from,omitempty"`
+	To          *time.Time     `json:"to,omitempty"`
+	RunIDs      []uint         `json:"run_ids"`
+	Groups      []string       `json:"groups"`
+	ErrorRates  []MetaEstimate `json:"error_rates"`
+	Contrasts   []MetaEstimate `json:"contrasts"`
+	GeneratedAt time.Time      `json:"generated_at"`
+}
+
+// metaRunData 单个 run 各组（训练阶段）的判题统计与按 round 的结果
+type metaRunData struct {
+	run      model.ExperimentRun
+	stats    map[string]GroupStats
+	outcomes map[string]map[int]bool
+}
+
+// ParseMetaContrast 解析 "F_vs_E" => (later=F, earlier=E)
+func ParseMetaContrast(s string) (later, earlier string, err error) {
+	parts := strings.Split(strings.TrimSpace(s), "_vs_")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" || parts[0] == parts[1] {
+		return "", "", fmt.Errorf("%w: 对比 %q 应形如 F_vs_E", ErrInvalidMetaQuery, s)
+	}
+	return parts[0], parts[1], nil
+}
+
+// BuildMetaAnalysis 选取符合条件的已完成 run，对各组错误率与指定组间对比做 meta 分析
+func (r *ExperimentRunner) BuildMetaAnalysis(ctx context.Context, req MetaAnalysisRequest) (*MetaAnalysisReport, error) {
+	contrasts := req.Contrasts
+	if len(contrasts) == 0 {
+		contrasts = DefaultMetaContrasts
+	}
+	for _, c := range contrasts {
+		if _, _, err := ParseMetaContrast(c); err != nil {
+			return nil, err
+		}
+	}
+	if !req.From.IsZero() && !req.To.IsZero() && !req.From.Before(req.To) {
+		return nil, fmt.Errorf("%w: from 必须早于 to", ErrInvalidMetaQuery)
+	}
+
+	runs, err := r.store.Runs.Find(ctx, repository.RunFilter{
+		TaskType: req.TaskType,
+		RuleMode: req.RuleMode,
+		Status:   model.ExperimentRunStatusDone,
+		From:     req.From,
+		To:       req.To,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("查询run失败: %w", err)
+	}
+
+	report := &MetaAnalysisReport{
+		TaskType:    req.TaskType,
+		RuleMode:    req.RuleMode,
+		RunIDs:      []uint{},
+		ErrorRates:  []MetaEstimate{},
+		Contrasts:   []MetaEstimate{},
+		GeneratedAt: time.Now(),
+	}
+	if !req.From.IsZero() {
+		report.From = &req.From
+	}
+	if !req.To.IsZero() {
+		report.To = &req.To
+	}
+
+	seen := map[string]bool{}
+	var all []string
+	data := make([]metaRunData, 0, len(runs))
+	for _, run := range runs {
+		groups := r.Groups().Ordered(runGroupsOrDefault(run, r.Groups().Names()))
+		d := metaRunData{run: run, stats: map[string]GroupStats{}, outcomes: map[string]map[int]bool{}}
+		for _, g := range groups {
+			tasks, err := r.store.Tasks.Find(ctx, repository.TaskFilter{RunID: run.ID, GroupType: g, ExcludePhase: model.TaskPhaseEval})
+			if err != nil {
+				return nil, fmt.Errorf("查询任务失败: %w", err)
+			}
+			d.stats[g] = calcGroupStats(tasks)
+			d.outcomes[g] = roundOutcomes(tasks)
+			if !seen[g] {
+				seen[g] = true
+				all = append(all, g)
+			}
+		}
+		data = append(data, d)
+		report.RunIDs = append(report.RunIDs, run.ID)
+	}
+	report.Groups = r.Groups().Ordered(all)
+
+	for _, g := range report.Groups {
+		report.ErrorRates = append(report.ErrorRates, metaAnalyze("error_rate_"+g, errorRateStudies(data, g)))
+	}
+	for _, c := range contrasts {
+		later, earlier, _ := ParseMetaContrast(c)
+		report.Contrasts = append(report.Contrasts, metaAnalyze(c, contrastStudies(data, later, earlier)))
+	}
+	return report, nil
+}
+
+// runGroupsOrDefault run 的参与组（旧数据没有 groups_json 时退回全部已注册组）
+func runGroupsOrDefault(run model.ExperimentRun, fallback []string) []string {
+	var groups []string
+	if err := json.Unmarshal([]byte(run.GroupsJSON), &groups); err != nil || len(groups) == 0 {
+		return fallback
+	}
+	return groups
+}
+
+// errorRateStudies 每个 run 一项：错误率 k/n，方差用 (k+0.5)/(n+1) 估计，避免 0/1 错误率时方差为 0
+func errorRateStudies(data []metaRunData, g string) []MetaStudy {
+	var out []MetaStudy
+	for _, d := range data {
+		gs, ok := d.stats[g]
+		n := gs.Correct + gs.Incorrect
+		if !ok || n == 0 {
+			continue
+		}
+		pAdj := (float64(gs.Incorrect) + 0.5) / (float64(n) + 1)
+		out = append(out, newMetaStudy(d.run, n, float64(gs.Incorrect)/float64(n), pAdj*(1-pAdj)/float64(n)))
+	}
+	return out
+}
+
+// contrastStudies 每个 run 一项：按 round 配对的错误率差（later − earlier），
+// 方差 ((b+c) − (b−c)²/n)/n²；不一致对为 0 时 b、c 各加 0.5
+func contrastStudies(data []metaRunData, later, earlier string) []MetaStudy {
+	var out []MetaStudy
+	for _, d := range data {
+		e, okE := d.outcomes[earlier]
+		l, okL := d.outcomes[later]
+		if !okE || !okL {
+			continue
+		}
+		pt := pairedTest(e, l)
+		if pt.NPairs == 0 {
+			continue
+		}
+		n := float64(pt.NPairs)
+		b, c := float64(pt.OnlyEarlierIncorrect), float64(pt.OnlyLaterIncorrect)
+		if b+c == 0 {
+			b, c = 0.5, 0.5
+		}
+		v := ((b + c) - (b-c)*(b-c)/n) / (n * n)
+		out = append(out, newMetaStudy(d.run, pt.NPairs, pt.DiffErrorRate, v))
+	}
+	return out
+}
+
+func newMetaStudy(run model.ExperimentRun, n int, est, variance float64) MetaStudy {
+	se := math.Sqrt(variance)
+	return MetaStudy{
+		RunID: run.ID, Seed: run.Seed, RuleMode: run.RuleMode, N: n,
+		Estimate: est, Variance: variance,
+		CI95Low: est - 1.96*se, CI95High: est + 1.96*se,
+	}
+}
+
+// metaAnalyze 逆方差固定效应与 DerSimonian–Laird 随机效应合并；方差非正的研究被忽略
+func metaAnalyze(name string, studies []MetaStudy) MetaEstimate {
+	out := MetaEstimate{Name: name, Studies: []MetaStudy{}}
+	for _, s := range studies {
+		if s.Variance > 0 {
+			out.Studies = append(out.Studies, s)
+		}
+	}
+	k := len(out.Studies)
+	if k == 0 {
+		return out
+	}
+
+	sumW, sumW2, sumWY := 0.0, 0.0, 0.0
+	for _, s := range out.Studies {
+		w := 1 / s.Variance
+		sumW += w
+		sumW2 += w * w
+		sumWY += w * s.Estimate
+	}
+	out.Fixed = pooledEstimate(sumWY/sumW, 1/sumW)
+
+	for _, s := range out.Studies {
+		d := s.Estimate - out.Fixed.Estimate
+		out.Q += d * d / s.Variance
+	}
+	out.DF = k - 1
+	out.QP = 1
+	if out.DF > 0 {
+		out.QP = chiSquareSF(out.Q, float64(out.DF))
+		if out.Q > 0 {
+			out.I2 = math.Max(0, (out.Q-float64(out.DF))/out.Q)
+		}
+		if c := sumW - sumW2/sumW; c > 0 {
+			out.Tau2 = math.Max(0, (out.Q-float64(out.DF))/c)
+		}
+	}
+
+	sumWR, sumWRY := 0.0, 0.0
+	for _, s := range out.Studies {
+		w := 1 / (s.Variance + out.Tau2)
+		sumWR += w
+		sumWRY += w * s.Estimate
+	}
+	out.Random = pooledEstimate(sumWRY/sumWR, 1/sumWR)
+	for i := range out.Studies {
+		out.Studies[i].WeightFixed = (1 / out.Studies[i].Variance) / sumW
+		out.Studies[i].WeightRandom = (1 / (out.Studies[i].Variance + out.Tau2)) / sumWR
+	}
+	return out
+}
+
+func pooledEstimate(est, variance float64) MetaPooled {
+	se := math.Sqrt(variance)
+	p := MetaPooled{Estimate: est, SE: se, CI95Low: est - 1.96*se, CI95High: est + 1.96*se, P: 1}
+	if se > 0 {
+		p.Z = est / se
+		p.P = 2 * (1 - normCDF(math.Abs(p.Z)))
+	}
+	return p
+}
+
+// chiSquareSF 卡方分布上尾概率 P(X > x)，即正则化上不完全 Gamma 函数 Q(df/2, x/2)
+func chiSquareSF(x, df float64) float64 {
+	if x <= 0 {
+		return 1
+	}
+	a, z := df/2, x/2
+	lg, _ := math.Lgamma(a)
+	if z < a+1 {
+		// 级数展开求 P(a, z)
+		sum, term := 1/a, 1/a
+		for n := 1; n < 500; n++ {
+			term *= z / (a + float64(n))
+			sum += term
+			if math.Abs(term) < math.Abs(sum)*1e-14 {
+				break
+			}
+		}
+		return math.Max(0, 1-sum*math.Exp(-z+a*math.Log(z)-lg))
+	}
+	// 连分式（Lentz）求 Q(a, z)
+	const tiny = 1e-300
+	b := z + 1 - a
+	c := 1 / tiny
+	d := 1 / b
+	h := d
+	for i := 1; i < 500; i++ {
+		an := -float64(i) * (float64(i) - a)
+		b += 2
+		d = an*d + b
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = b + an/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		del := d * c
+		h *= del
+		if math.Abs(del-1) < 1e-14 {
+			break
+		}
+	}
+	return math.Min(1, math.Exp(-z+a*math.Log(z)-lg)*h)
+}
@@ -0,0 +1,69 @@
+package service
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestChiSquareSF(t *testing.T) {
+	cases := []struct{ x, df, want float64 }{
+		{3.841458820694124, 1, 0.05},
+		{5.991464547107979, 2, 0.05},
+		{1, 4, 0.9097959895689501},
+		{30, 3, 1.3800570312932549e-06},
+	}
+	for _, c := range cases {
+		if got := chiSquareSF(c.x, c.df); math.Abs(got-c.want) > 1e-9*c.want {
+			t.Fatalf("chiSquareSF(%v, %v) = %v, want %v", c.x, c.df, got, c.want)
+		}
+	}
+}
+
+// TestMetaAnalyze 同质数据 I²=0 且随机效应退化为固定效应；异质数据 τ²>0 且随机效应 CI 更宽
+func TestMetaAnalyze(t *testing.T) {
+	homo := metaAnalyze("x", []MetaStudy{
+		{RunID: 1, Estimate: 0.2, Variance: 0.01},
+		{RunID: 2, Estimate: 0.2, Variance: 0.04},
+	})
+	if math.Abs(homo.Fixed.Estimate-0.2) > 1e-12 || homo.I2 != 0 || homo.Tau2 != 0 || homo.Random != homo.Fixed {
+		t.Fatalf("homogeneous studies: %+v", homo)
+	}
+	if math.Abs(homo.Studies[0].WeightFixed-0.8) > 1e-12 {
+		t.Fatalf("inverse-variance weight should be 0.8, got %v", homo.Studies[0].WeightFixed)
+	}
+
+	hetero := metaAnalyze("y", []MetaStudy{
+		{RunID: 1, Estimate: -0.3, Variance: 0.001},
+		{RunID: 2, Estimate: 0.0, Variance: 0.001},
+		{RunID: 3, Estimate: -0.1, Variance: 0.001},
+		{RunID: 4, Estimate: -0.2, Variance: 0},
+	})
+	// 合并估计 −2/15，Q = (0.0278+0.0178+0.0011)/0.001 = 140/3，df=2
+	if len(hetero.Studies) != 3 || math.Abs(hetero.Q-140.0/3) > 1e-9 || hetero.DF != 2 {
+		t.Fatalf("unexpected heterogeneity: Q=%v df=%d studies=%d", hetero.Q, hetero.DF, len(hetero.Studies))
+	}
+	if math.Abs(hetero.I2-134.0/140) > 1e-9 || hetero.Tau2 <= 0 || hetero.QP >= 0.001 {
+		t.Fatalf("unexpected I2/tau2/p: %+v", hetero)
+	}
+	if hetero.Random.SE <= hetero.Fixed.SE {
+		t.Fatalf("random-effects SE should exceed fixed-effects SE")
+	}
+
+	report := &MetaAnalysisReport{TaskType: "lottery", RunIDs: []uint{1, 2, 3}, Contrasts: []MetaEstimate{hetero}}
+	md := RenderMetaAnalysisMarkdown(report)
+	if !strings.Contains(md, "### y") || !strings.Contains(md, "随机效应") || !strings.Contains(md, "I²=95.7%") {
+		t.Fatalf("unexpected markdown:\n%s", md)
+	}
+}
+
+func TestParseMetaContrast(t *testing.T) {
+	if l, e, err := ParseMetaContrast("F_vs_E"); err != nil || l != "F" || e != "E" {
+		t.Fatalf("unexpected parse: %q %q %v", l, e, err)
+	}
+	for _, bad := range []string{"F", "F_vs_F", "_vs_E"} {
+		if _, _, err := ParseMetaContrast(bad); err == nil {
+			t.Fatalf("%q should be rejected", bad)
+		}
+	}
+}
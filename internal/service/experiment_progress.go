@@ -0,0 +1,151 @@
+package service
+
+import (
+	"sync"
+	"time"
+
+	"mem-test/internal/model"
+)
+
+const (
+	// ExperimentEventRound 某组某轮执行+判题（+反思）完成
+	ExperimentEventRound = "round"
+	// ExperimentEventEpoch F 组变更检测触发，进入新 epoch
+	ExperimentEventEpoch = "epoch"
+	// ExperimentEventStatus run 状态变化（running/done/failed/cancelled）
+	ExperimentEventStatus = "status"
+	// ExperimentEventDropped 订阅者消费过慢已被断开；客户端应重新连接，从历史回放补齐事件
+	ExperimentEventDropped = "dropped"
+)
+
+// ExperimentEvent 实验进度事件（通过 SSE 推送给前端/脚本）
+type ExperimentEvent struct {
+	Type  string `json:"type"`
+	RunID uint   `json:"run_id"`
+	Group string `json:"group,omitempty"`
+	Round int    `json:"round"`
+	// eval 表示评估阶段（冻结记忆的留出集）；训练阶段为空
+	Phase string `json:"phase,omitempty"`
+	// correct/incorrect/error
+	Outcome string `json:"outcome,omitempty"`
+	// 本次注入 prompt 的记忆
+	MemoryIDs []uint `json:"memory_ids,omitempty"`
+	// 反思结果：saved/failed（判对或不反思的组为空）
+	Reflection         string `json:"reflection,omitempty"`
+	ReflectionMemoryID uint   `json:"reflection_memory_id,omitempty"`
+	ReflectionTrigger  string `json:"reflection_trigger,omitempty"`
+	// F 组 epoch（round 事件为判题后的 epoch；epoch 事件附带切换前的值）
+	Epoch     int    `json:"epoch,omitempty"`
+	PrevEpoch int    `json:"prev_epoch,omitempty"`
+	Status    string `json:"status,omitempty"`
+	Error     string `json:"error,omitempty"`
+
+	CompletedRounds int       `json:"completed_rounds,omitempty"`
+	Time            time.Time `json:"time"`
+}
+
+func (ev *ExperimentEvent) setReflection(attempted bool, mem *model.Memory, err error) {
+	if !attempted {
+		return
+	}
+	if err != nil {
+		ev.Reflection = "failed"
+		ev.Error = err.Error()
+		return
+	}
+	ev.Reflection = "saved"
+	if mem != nil {
+		ev.ReflectionMemoryID = mem.ID
+		ev.ReflectionTrigger = mem.Trigger
+	}
+}
+
+// progressHub 进度事件广播：每个执行中的 run 保留完整事件历史，
+// 后订阅的客户端先回放历史再接收实时事件；run 结束后关闭所有订阅并释放历史。
+type progressHub struct {
+	mu      sync.Mutex
+	history map[uint][]ExperimentEvent
+	subs    map[uint]map[chan ExperimentEvent]struct{}
+}
+
+// 订阅者缓冲：不能阻塞实验执行，缓冲满时发送 dropped 标记（占最后一个槽位）并断开该订阅者
+const progressSubBuffer = 256
+
+func newProgressHub() *progressHub {
+	return &progressHub{
+		history: map[uint][]ExperimentEvent{},
+		subs:    map[uint]map[chan ExperimentEvent]struct{}{},
+	}
+}
+
+func (h *progressHub) begin(runID uint) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.history[runID]; !ok {
+		h.history[runID] = []ExperimentEvent{}
+	}
+}
+
+func (h *progressHub) publish(ev ExperimentEvent) {
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.history[ev.RunID]; !ok {
+		return
+	}
+	h.history[ev.RunID] = append(h.history[ev.RunID], ev)
+	for ch := range h.subs[ev.RunID] {
+		// 只有 publish 在持锁时写入，检查长度后发送不会阻塞
+		if len(ch) < cap(ch)-1 {
+			ch <- ev
+			continue
+		}
+		// 静默丢事件会让客户端看到不完整的进度；断开后重连即可从历史完整回放
+		ch <- ExperimentEvent{Type: ExperimentEventDropped, RunID: ev.RunID, Time: ev.Time}
+		close(ch)
+		delete(h.subs[ev.RunID], ch)
+	}
+}
+
+// finish 结束 run：关闭订阅通道并释放历史（可重复调用）
+func (h *progressHub) finish(runID uint) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subs[runID] {
+		close(ch)
+	}
+	delete(h.subs, runID)
+	delete(h.history, runID)
+}
+
+// subscribe 返回已发生的事件与实时通道；run 不在执行中时 live=false
+func (h *progressHub) subscribe(runID uint) (history []ExperimentEvent, ch <-chan ExperimentEvent, unsubscribe func(), live bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	hist, ok := h.history[runID]
+	if !ok {
+		return nil, nil, func() {}, false
+	}
+	c := make(chan ExperimentEvent, progressSubBuffer)
+	if h.subs[runID] == nil {
+		h.subs[runID] = map[chan ExperimentEvent]struct{}{}
+	}
+	h.subs[runID][c] = struct{}{}
+	history = append([]ExperimentEvent(nil), hist...)
+	unsubscribe = func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if _, ok := h.subs[runID][c]; ok {
+			delete(h.subs[runID], c)
+			close(c)
+		}
+	}
+	return history, c, unsubscribe, true
+}
+
+// SubscribeProgress 订阅执行中 run 的进度事件；run 未在本进程执行时 live=false
+func (r *ExperimentRunner) SubscribeProgress(runID uint) (history []ExperimentEvent, ch <-chan ExperimentEvent, unsubscribe func(), live bool) {
+	return r.progress.subscribe(runID)
+}
@@ -0,0 +1,72 @@
+package service
+
+import "testing"
+
+// TestProgressHub_ReplayAndLive 后订阅者先拿到历史事件，再收到实时事件；run 结束后通道关闭
+func TestProgressHub_ReplayAndLive(t *testing.T) {
+	h := newProgressHub()
+	if _, _, _, live := h.subscribe(1); live {
+		t.Fatalf("run not begun should not be live")
+	}
+
+	h.begin(1)
+	h.publish(ExperimentEvent{Type: ExperimentEventStatus, RunID: 1, Status: "running"})
+	h.publish(ExperimentEvent{Type: ExperimentEventRound, RunID: 1, Group: "F", Round: 0, Outcome: "incorrect"})
+
+	history, ch, unsubscribe, live := h.subscribe(1)
+	defer unsubscribe()
+	if !live || len(history) != 2 {
+		t.Fatalf("expected live subscription with 2 history events, got live=%v n=%d", live, len(history))
+	}
+
+	h.publish(ExperimentEvent{Type: ExperimentEventEpoch, RunID: 1, Group: "F", Round: 1, Epoch: 2, PrevEpoch: 1})
+	ev := <-ch
+	if ev.Type != ExperimentEventEpoch || ev.Epoch != 2 || ev.Time.IsZero() {
+		t.Fatalf("unexpected live event: %+v", ev)
+	}
+
+	// 其他 run 的事件不应串台
+	h.publish(ExperimentEvent{Type: ExperimentEventRound, RunID: 2})
+
+	h.finish(1)
+	if _, ok := <-ch; ok {
+		t.Fatalf("expected channel closed after finish")
+	}
+}
+
+// TestProgressHub_SlowSubscriberDropped 缓冲满的订阅者收到 dropped 标记后被断开，不影响历史与后续订阅
+func TestProgressHub_SlowSubscriberDropped(t *testing.T) {
+	h := newProgressHub()
+	h.begin(1)
+	_, ch, unsubscribe, _ := h.subscribe(1)
+	defer unsubscribe()
+
+	total := progressSubBuffer + 10
+	for i := 0; i < total; i++ {
+		h.publish(ExperimentEvent{Type: ExperimentEventRound, RunID: 1, Round: i})
+	}
+
+	var got []ExperimentEvent
+	for ev := range ch {
+		got = append(got, ev)
+	}
+	if len(got) != progressSubBuffer {
+		t.Fatalf("expected %d buffered events, got %d", progressSubBuffer, len(got))
+	}
+	for i, ev := range got[:len(got)-1] {
+		if ev.Type != ExperimentEventRound || ev.Round != i {
+			t.Fatalf("event %d out of order: %+v", i, ev)
+		}
+	}
+	if last := got[len(got)-1]; last.Type != ExperimentEventDropped || last.RunID != 1 {
+		t.Fatalf("expected dropped marker last, got %+v", last)
+	}
+
+	// 重连后历史完整
+	history, _, unsub2, live := h.subscribe(1)
+	defer unsub2()
+	if !live || len(history) != total {
+		t.Fatalf("expected full history of %d events on reconnect, got live=%v n=%d", total, live, len(history))
+	}
+	h.finish(1)
+}
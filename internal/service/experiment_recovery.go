@@ -0,0 +1,164 @@
+package service
+
+import "fmt"
+
+// DefaultRecoveryK 判定“已适应新规则”所需的连续判对次数
+const DefaultRecoveryK = 3
+
+// ChangePointRecovery 单次规则变更后的恢复情况；观察窗口为该变更点到下一次变更（或 run 结束）
+type ChangePointRecovery struct {
+	ChangePoint int `json:"change_point"`
+	// 窗口轮数
+	WindowRounds int `json:"window_rounds"`
+	// 首次判对前的错误次数；窗口内从未判对时为窗口内全部错误数
+	ErrorsUntilRecovery int  `json:"errors_until_recovery"`
+	Recovered           bool `json:"recovered"`
+	// 从变更点起到首次出现 k 连对（含这 k 轮）所用的轮数；窗口内未达到时为 -1
+	RoundsToStable int `json:"rounds_to_stable"`
+	// 变更后错误曲线下面积：窗口内逐轮 0/1 错误之和
+	AreaUnderError float64 `json:"area_under_error"`
+}
+
+// RecoveryMetrics 一个组在全部规则变更点上的恢复指标
+type RecoveryMetrics struct {
+	K            int                   `json:"k"`
+	ChangePoints []ChangePointRecovery `json:"change_points"`
+	// 各变更点的平均值；RoundsToStable 只对达到 k 连对的变更点取平均
+	AvgErrorsUntilRecovery float64 `json:"avg_errors_until_recovery"`
+	AvgRoundsToStable      float64 `json:"avg_rounds_to_stable"`
+	AvgAreaUnderError      float64 `json:"avg_area_under_error"`
+	// 窗口内未达到 k 连对的变更点数
+	Unstable int `json:"unstable"`
+}
+
+// RecoveryDiff 两组逐变更点的恢复对比（Later − Earlier，负值表示 Later 适应更快）
+type RecoveryDiff struct {
+	ChangePoints                int     `json:"change_points"`
+	MeanDiffErrorsUntilRecovery float64 `json:"mean_diff_errors_until_recovery"`
+	MeanDiffAreaUnderError      float64 `json:"mean_diff_area_under_error"`
+	// 按 errors_until_recovery 比较的胜/负/平变更点数
+	LaterFaster   int `json:"later_faster"`
+	EarlierFaster int `json:"earlier_faster"`
+	Ties          int `json:"ties"`
+}
+
+// ComputeRecovery 按规则版本序列计算某组（flags: 1=错 0=对）在每个变更点后的恢复指标
+func ComputeRecovery(ruleVersions []int, flags []int, k int) RecoveryMetrics {
+	if k <= 0 {
+		k = DefaultRecoveryK
+	}
+	out := RecoveryMetrics{K: k, ChangePoints: []ChangePointRecovery{}}
+	changePoints := RuleChangePoints(ruleVersions)
+	n := len(ruleVersions)
+	if len(flags) < n {
+		n = len(flags)
+	}
+
+	sumErr, sumArea, sumStable, stable := 0, 0.0, 0, 0
+	for idx, cp := range changePoints {
+		if cp >= n {
+			break
+		}
+		end := n
+		if idx+1 < len(changePoints) && changePoints[idx+1] < end {
+			end = changePoints[idx+1]
+		}
+		rec := ChangePointRecovery{ChangePoint: cp, WindowRounds: end - cp, RoundsToStable: -1}
+		streak := 0
+		for i := cp; i < end; i++ {
+			if flags[i] == 1 {
+				rec.AreaUnderError++
+				if !rec.Recovered {
+					rec.ErrorsUntilRecovery++
+				}
+				streak = 0
+				continue
+			}
+			rec.Recovered = true
+			streak++
+			if streak == k && rec.RoundsToStable < 0 {
+				rec.RoundsToStable = i - cp + 1
+			}
+		}
+		out.ChangePoints = append(out.ChangePoints, rec)
+		sumErr += rec.ErrorsUntilRecovery
+		sumArea += rec.AreaUnderError
+		if rec.RoundsToStable >= 0 {
+			sumStable += rec.RoundsToStable
+			stable++
+		} else {
+			out.Unstable++
+		}
+	}
+	if m := len(out.ChangePoints); m > 0 {
+		out.AvgErrorsUntilRecovery = float64(sumErr) / float64(m)
+		out.AvgAreaUnderError = sumArea / float64(m)
+	}
+	if stable > 0 {
+		out.AvgRoundsToStable = float64(sumStable) / float64(stable)
+	}
+	return out
+}
+
+// CompareRecovery 在共同的变更点上逐点比较两组的恢复速度
+func CompareRecovery(earlier, later RecoveryMetrics) RecoveryDiff {
+	byCP := make(map[int]ChangePointRecovery, len(earlier.ChangePoints))
+	for _, r := range earlier.ChangePoints {
+		byCP[r.ChangePoint] = r
+	}
+	var d RecoveryDiff
+	sumErr, sumArea := 0.0, 0.0
+	for _, l := range later.ChangePoints {
+		e, ok := byCP[l.ChangePoint]
+		if !ok {
+			continue
+		}
+		d.ChangePoints++
+		sumErr += float64(l.ErrorsUntilRecovery - e.ErrorsUntilRecovery)
+		sumArea += l.AreaUnderError - e.AreaUnderError
+		switch {
+		case l.ErrorsUntilRecovery < e.ErrorsUntilRecovery:
+			d.LaterFaster++
+		case l.ErrorsUntilRecovery > e.ErrorsUntilRecovery:
+			d.EarlierFaster++
+		default:
+			d.Ties++
+		}
+	}
+	if d.ChangePoints > 0 {
+		d.MeanDiffErrorsUntilRecovery = sumErr / float64(d.ChangePoints)
+		d.MeanDiffAreaUnderError = sumArea / float64(d.ChangePoints)
+	}
+	return d
+}
+
+// MemoryChangeFlags 某组每轮记忆变更次数：做反思的组每次判错写一次记忆，其余组为 0
+func MemoryChangeFlags(strategy GroupStrategy, flags []int) []int {
+	out := make([]int, len(flags))
+	if strategy.Reflects() {
+		copy(out, flags)
+	}
+	return out
+}
+
+// BuildRecovery 计算各组恢复指标与相邻组（groups 顺序）对比，对比键形如 F_vs_E
+func BuildRecovery(groups []string, ruleVersions []int, flagsByGroup map[string][]int, k int) (map[string]RecoveryMetrics, map[string]RecoveryDiff) {
+	recovery := make(map[string]RecoveryMetrics, len(groups))
+	for _, g := range groups {
+		flags, ok := flagsByGroup[g]
+		if !ok {
+			continue
+		}
+		recovery[g] = ComputeRecovery(ruleVersions, flags, k)
+	}
+	comparison := map[string]RecoveryDiff{}
+	for i := 1; i < len(groups); i++ {
+		e, ok1 := recovery[groups[i-1]]
+		l, ok2 := recovery[groups[i]]
+		if !ok1 || !ok2 {
+			continue
+		}
+		comparison[fmt.Sprintf("%s_vs_%s", groups[i], groups[i-1])] = CompareRecovery(e, l)
+	}
+	return recovery, comparison
+}
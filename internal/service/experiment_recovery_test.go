@@ -0,0 +1,30 @@
+package service
+
+import "testing"
+
+// TestComputeRecovery 窗口以下一次变更为界；未达到 k 连对记为 -1
+func TestComputeRecovery(t *testing.T) {
+	vers := []int{1, 1, 2, 2, 2, 2, 2, 2, 3, 3, 3, 3}
+	flags := []int{0, 0, 1, 1, 0, 1, 0, 0, 1, 0, 1, 0}
+
+	r := ComputeRecovery(vers, flags, 2)
+	if len(r.ChangePoints) != 2 {
+		t.Fatalf("expected 2 change points, got %+v", r.ChangePoints)
+	}
+	first, second := r.ChangePoints[0], r.ChangePoints[1]
+	if first.ChangePoint != 2 || first.WindowRounds != 6 || first.ErrorsUntilRecovery != 2 || first.RoundsToStable != 6 || first.AreaUnderError != 3 {
+		t.Fatalf("unexpected first change point: %+v", first)
+	}
+	if second.ChangePoint != 8 || second.ErrorsUntilRecovery != 1 || second.RoundsToStable != -1 || second.AreaUnderError != 2 {
+		t.Fatalf("unexpected second change point: %+v", second)
+	}
+	if r.Unstable != 1 || r.AvgRoundsToStable != 6 || r.AvgErrorsUntilRecovery != 1.5 {
+		t.Fatalf("unexpected averages: %+v", r)
+	}
+
+	fast := ComputeRecovery(vers, []int{0, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0}, 2)
+	d := CompareRecovery(r, fast)
+	if d.ChangePoints != 2 || d.LaterFaster != 1 || d.Ties != 1 || d.MeanDiffErrorsUntilRecovery != -1 {
+		t.Fatalf("unexpected comparison: %+v", d)
+	}
+}
@@ -0,0 +1,226 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+
+	"mem-test/internal/model"
+	"mem-test/internal/repository"
+)
+
+var (
+	// ErrRunActive run 正在本进程中排队/执行
+	ErrRunActive = errors.New("run 正在执行中")
+	// ErrRunAlreadyDone run 已正常完成，无需续跑
+	ErrRunAlreadyDone = errors.New("run 已完成，无需续跑")
+)
+
+// runResumeState 续跑所需的历史状态：已判题的 (group, round) 及其结果，F 组判题序列，待补的反思
+type runResumeState struct {
+	// group -> round -> 1(incorrect)/0(correct)
+	outcomes map[string]map[int]int
+	// bandit/变更检测组（F 组）训练阶段已判题任务（按 round 升序），用于重建 fRunState
+	fTasks []model.Task
+	// 判错但没有反思产物的任务（中断在判题之后、写入记忆之前），按 round 升序
+	reflections []pendingReflection
+}
+
+// pendingReflection 续跑前需要重新执行的一次反思
+type pendingReflection struct {
+	task     model.Task
+	feedback *model.Feedback
+}
+
+func (s *runResumeState) outcome(group string, round int) (int, bool) {
+	if s == nil {
+		return 0, false
+	}
+	v, ok := s.outcomes[group][round]
+	return v, ok
+}
+
+// Resume 从中断处续跑：
+//   - 用存储的 seed/rule_mode/action 重建完全相同的输入与门槛序列
+//   - 已判题的 (group, round) 直接跳过并回填 trend；执行了但未判题的任务会被删除后重跑
+//   - 按 round 顺序重放 F 组判题结果，恢复 epoch/bandit/封禁状态
+//   - 反思组训练阶段判错、但没有 source_task_id 指向它的记忆的任务（中断在判题之后、反思写入之前）：
+//     续跑前按 round 顺序重新反思
+//
+// 在 LLM 确定（mock 模式或 cassette replay）时，续跑后的统计与一次跑完的结果一致；
+// 例外是中断恰好发生在反思内部（已对注入的记忆降权、新记忆尚未写入），此时重跑反思会再降权一次。
+func (r *ExperimentRunner) Resume(ctx context.Context, runID uint) (*model.ExperimentRun, error) {
+	if r.jobs.active(runID) {
+		return nil, ErrRunActive
+	}
+	run, err := r.store.Runs.Get(ctx, runID)
+	if err != nil {
+		return nil, fmt.Errorf("查询实验run失败: %w", err)
+	}
+	if run.Status == model.ExperimentRunStatusDone {
+		return nil, ErrRunAlreadyDone
+	}
+
+	if current := r.agent.RetrievalLabel(); run.Retrieval != "" && run.Retrieval != current {
+		// 续跑部分与已完成部分的检索方式不同，结果不再可比：保留 run 记录的方式，只提示
+		log.Printf("[experiment] resume run=%d retrieval mismatch: run=%s current=%s", run.ID, run.Retrieval, current)
+	}
+
+	req := requestFromRun(run)
+	strategies, err := r.Groups().ResolveRunStrategies(req.Groups, req.Ablations)
+	if err != nil {
+		return nil, err
+	}
+	state, err := loadResumeState(ctx, r.store, run, strategies)
+	if err != nil {
+		return nil, err
+	}
+
+	run.Status = model.ExperimentRunStatusQueued
+	run.ErrorMessage = ""
+	run.FinishedAt = nil
+	if err := r.store.Runs.Requeue(ctx, run.ID); err != nil {
+		return nil, fmt.Errorf("更新实验run状态失败: %w", err)
+	}
+
+	log.Printf("[experiment] resume run=%d judged_groups=%d pending_reflections=%d", run.ID, len(state.outcomes), len(state.reflections))
+	r.progress.begin(run.ID)
+	r.startJob(run, req, state)
+	return run, nil
+}
+
+func requestFromRun(run *model.ExperimentRun) ExperimentRunRequest {
+	var groups []string
+	_ = json.Unmarshal([]byte(run.GroupsJSON), &groups)
+	var ablations map[string]GroupFeatureFlags
+	if run.AblationsJSON != "" {
+		_ = json.Unmarshal([]byte(run.AblationsJSON), &ablations)
+	}
+	return normalizeRunRequest(ExperimentRunRequest{
+		TaskType:     run.TaskType,
+		RunsPerGroup: run.RunsPerGroup,
+		Seed:         run.Seed,
+		Groups:       groups,
+		Action:       run.Action,
+		RuleMode:     run.RuleMode,
+		SweepID:      run.SweepID,
+		Ablations:    ablations,
+
+		EvalRounds:       run.EvalRounds,
+		EvalSeed:         run.EvalSeed,
+		EvalDistribution: run.EvalDistribution,
+
+		GlobalPool:           run.GlobalPool,
+		GlobalPoolSnapshotID: run.BaseSnapshotID,
+	})
+}
+
+func loadResumeState(ctx context.Context, store *repository.Store, run *model.ExperimentRun, strategies map[string]GroupStrategy) (*runResumeState, error) {
+	// 执行了但没判题（中断在判题前）：删除后重跑，避免污染统计
+	pending, err := store.Tasks.Find(ctx, repository.TaskFilter{RunID: run.ID, PendingOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("查询未判题任务失败: %w", err)
+	}
+	if len(pending) > 0 {
+		pendingIDs := make([]uint, 0, len(pending))
+		for _, t := range pending {
+			pendingIDs = append(pendingIDs, t.ID)
+		}
+		if err := store.TaskLogs.DeleteByTaskIDs(ctx, pendingIDs); err != nil {
+			return nil, fmt.Errorf("删除未判题任务日志失败: %w", err)
+		}
+		if err := store.Tasks.DeleteByIDs(ctx, pendingIDs); err != nil {
+			return nil, fmt.Errorf("删除未判题任务失败: %w", err)
+		}
+	}
+
+	tasks, err := store.Tasks.Find(ctx, repository.TaskFilter{RunID: run.ID, JudgedOnly: true, Order: repository.TaskOrderRound})
+	if err != nil {
+		return nil, fmt.Errorf("查询已完成任务失败: %w", err)
+	}
+
+	state := &runResumeState{outcomes: map[string]map[int]int{}}
+	for _, t := range tasks {
+		if state.outcomes[t.GroupType] == nil {
+			state.outcomes[t.GroupType] = map[int]int{}
+		}
+		if _, dup := state.outcomes[t.GroupType][t.Round]; dup {
+			continue
+		}
+		v := 0
+		if !*t.IsCorrect {
+			v = 1
+		}
+		state.outcomes[t.GroupType][t.Round] = v
+		// 评估阶段不更新 bandit/变更检测状态，重放时同样跳过
+		if strategies[t.GroupType].Adaptive() && t.Phase != model.TaskPhaseEval {
+			state.fTasks = append(state.fTasks, t)
+		}
+		if v == 1 && strategies[t.GroupType].Reflects() && t.Phase != model.TaskPhaseEval {
+			state.reflections = append(state.reflections, pendingReflection{task: t})
+		}
+	}
+
+	// 已有反思产物的判错任务无需重跑
+	if len(state.reflections) > 0 {
+		ids := make([]uint, 0, len(state.reflections))
+		for _, p := range state.reflections {
+			ids = append(ids, p.task.ID)
+		}
+		derived, err := store.Memories.FindBySourceTasks(ctx, ids)
+		if err != nil {
+			return nil, fmt.Errorf("查询反思记忆失败: %w", err)
+		}
+		reflected := map[uint]bool{}
+		for _, m := range derived {
+			reflected[m.SourceTaskID] = true
+		}
+		pending := state.reflections[:0]
+		for _, p := range state.reflections {
+			if reflected[p.task.ID] {
+				continue
+			}
+			fb, err := store.Feedbacks.LatestByTask(ctx, p.task.ID)
+			if err != nil {
+				log.Printf("[experiment] resume run=%d task=%d has no feedback, skip reflection: %v", run.ID, p.task.ID, err)
+				continue
+			}
+			p.feedback = fb
+			pending = append(pending, p)
+		}
+		state.reflections = pending
+	}
+	return state, nil
+}
+
+// replayReflections 重新执行中断丢失的反思（按 round 顺序），使续跑起点的记忆与一次跑完时一致
+func (r *ExperimentRunner) replayReflections(ctx context.Context, runID uint, strategies map[string]GroupStrategy, resume *runResumeState, result *ExperimentRunResult) {
+	for _, p := range resume.reflections {
+		t := p.task
+		strategy := strategies[t.GroupType]
+		callCtx := r.cassette.WithScope(ctx, runID, t.GroupType, t.Round)
+		if _, err := r.reflection.ReflectWithStrategy(callCtx, strategy, t.ID, p.feedback); err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("run=%d group=%s round=%d resume %s failed: %v", runID, t.GroupType, t.Round, reflectionLabel(strategy.Reflection), err))
+			continue
+		}
+		log.Printf("[experiment] resume run=%d replayed reflection group=%s round=%d task=%d", runID, t.GroupType, t.Round, t.ID)
+	}
+}
+
+// restoreFState 按 round 顺序重放 F 组判题结果，重建 epoch/bandit/封禁状态
+func (r *ExperimentRunner) restoreFState(ctx context.Context, runID uint, req ExperimentRunRequest, strategies map[string]GroupStrategy, resume *runResumeState) {
+	for _, g := range req.Groups {
+		r.agent.ResetFState(runID, req.TaskType, g)
+	}
+	for i := range resume.fTasks {
+		t := &resume.fTasks[i]
+		fb := &model.Feedback{TaskID: t.ID, Type: "incorrect"}
+		if *t.IsCorrect {
+			fb.Type = "correct"
+		}
+		r.agent.SetFCurrentRound(runID, req.TaskType, t.GroupType, t.Round)
+		r.agent.UpdateFStateAfterJudge(ctx, runID, req.TaskType, strategies[t.GroupType], t, fb, t.Round)
+	}
+}
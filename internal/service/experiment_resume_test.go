@@ -0,0 +1,123 @@
+package service
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"mem-test/internal/model"
+	"mem-test/internal/repository"
+)
+
+// TestRestoreFState_MatchesLiveRun 重放 F 组判题序列后，fRunState 与不中断执行时一致
+func TestRestoreFState_MatchesLiveRun(t *testing.T) {
+	ctx := context.Background()
+	const runID, taskType = uint(7), "lottery"
+	// 连续判错触发 epoch 切换 + 封禁；中间穿插判对
+	seq := []bool{true, false, false, true, false, false, false, true}
+
+	live := NewAgentService(repository.NewMemoryStore(), nil, nil, "")
+	var tasks []model.Task
+	for i, ok := range seq {
+		correct := ok
+		task := model.Task{ID: uint(i + 1), RunID: runID, GroupType: "F", Round: i, MemoryIDs: "11,12", IsCorrect: &correct}
+		fb := &model.Feedback{Type: "incorrect"}
+		if ok {
+			fb.Type = "correct"
+		}
+		live.SetFCurrentRound(runID, taskType, "F", i)
+		live.UpdateFStateAfterJudge(ctx, runID, taskType, live.Groups().Resolve("F"), &task, fb, i)
+		tasks = append(tasks, task)
+	}
+
+	restored := NewAgentService(repository.NewMemoryStore(), nil, nil, "")
+	// 残留的旧状态应被丢弃
+	restored.SetFCurrentRound(runID, taskType, "F", 99)
+	r := &ExperimentRunner{agent: restored}
+	req := ExperimentRunRequest{TaskType: taskType, Groups: []string{"A", "F"}}
+	strategies, _ := restored.Groups().ResolveRunStrategies(req.Groups, nil)
+	r.restoreFState(ctx, runID, req, strategies, &runResumeState{fTasks: tasks})
+
+	want := live.fStates[live.fKey(runID, taskType, "F")]
+	got := restored.fStates[restored.fKey(runID, taskType, "F")]
+	if !reflect.DeepEqual(want, got) {
+		t.Fatalf("restored F state mismatch:\nwant=%+v\ngot=%+v", want, got)
+	}
+	if got.epoch < 2 {
+		t.Fatalf("expected epoch switch in sequence, got epoch=%d", got.epoch)
+	}
+}
+
+// TestRunResumeState_Outcome nil 状态表示全新执行
+func TestRunResumeState_Outcome(t *testing.T) {
+	var none *runResumeState
+	if _, ok := none.outcome("A", 0); ok {
+		t.Fatalf("nil state should have no outcomes")
+	}
+	s := &runResumeState{outcomes: map[string]map[int]int{"A": {0: 1}}}
+	if v, ok := s.outcome("A", 0); !ok || v != 1 {
+		t.Fatalf("unexpected outcome: %v %v", v, ok)
+	}
+	if _, ok := s.outcome("B", 0); ok {
+		t.Fatalf("group B should not be marked done")
+	}
+}
+
+// TestResume_ReplaysReflectionLostAfterJudge 判题后、反思写入记忆前崩溃：续跑补做这次反思，逐轮结果与一次跑完一致
+func TestResume_ReplaysReflectionLostAfterJudge(t *testing.T) {
+	ctx := context.Background()
+	req := ExperimentRunRequest{TaskType: "lottery", RunsPerGroup: 8, Seed: 5, Groups: []string{"A", "C"}, RuleMode: "low", GlobalPool: GlobalPoolEmpty}
+
+	baseline := newTestRunner(t, nil)
+	want, err := baseline.Run(ctx, req)
+	if err != nil || want.Status != model.ExperimentRunStatusDone {
+		t.Fatalf("baseline run: %v %+v", err, want)
+	}
+
+	// 第一次反思调用时崩溃（判题已落库，记忆尚未写入）
+	crashed := false
+	llm := &hookLLM{LLMProvider: NewMockLLMClient(42, 0, 1), hook: func(_ int, prompt string) {
+		if !crashed && isReflectionPrompt(prompt) {
+			crashed = true
+			panic("crash before reflection is saved")
+		}
+	}}
+	r := newTestRunner(t, llm)
+	if _, err := r.Run(ctx, req); err == nil {
+		t.Fatalf("run should fail on the simulated crash")
+	}
+	runs, err := r.store.Runs.Find(ctx, repository.RunFilter{})
+	if err != nil || len(runs) != 1 || runs[0].Status != model.ExperimentRunStatusFailed {
+		t.Fatalf("crashed run: %v %+v", err, runs)
+	}
+	runID := runs[0].ID
+	judged, _ := r.store.Tasks.Find(ctx, repository.TaskFilter{RunID: runID, GroupType: "C", JudgedOnly: true})
+	if len(judged) == 0 || *judged[len(judged)-1].IsCorrect {
+		t.Fatalf("crash should happen right after an incorrect C task is judged: %+v", judged)
+	}
+	lost := judged[len(judged)-1]
+
+	if _, err := r.Resume(ctx, runID); err != nil {
+		t.Fatalf("resume: %v", err)
+	}
+	waitRunStatus(t, r, runID, model.ExperimentRunStatusDone)
+
+	if derived, _ := r.store.Memories.FindBySourceTasks(ctx, []uint{lost.ID}); len(derived) != 1 {
+		t.Fatalf("lost reflection should be replayed once: %+v", derived)
+	}
+	outcomes := func(store *repository.Store, runID uint) map[string][]bool {
+		t.Helper()
+		tasks, err := store.Tasks.Find(ctx, repository.TaskFilter{RunID: runID, JudgedOnly: true, Order: repository.TaskOrderRound})
+		if err != nil {
+			t.Fatalf("tasks: %v", err)
+		}
+		out := map[string][]bool{}
+		for _, task := range tasks {
+			out[task.GroupType] = append(out[task.GroupType], *task.IsCorrect)
+		}
+		return out
+	}
+	if got, exp := outcomes(r.store, runID), outcomes(baseline.store, want.RunID); !reflect.DeepEqual(got, exp) {
+		t.Fatalf("resumed outcomes differ from an uninterrupted run:\nwant=%v\ngot=%v", exp, got)
+	}
+}
@@ -4,15 +4,14 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"log"
 	"math/rand"
 	"os"
 	"path/filepath"
 	"time"
 
-	"mem-test/internal/db"
 	"mem-test/internal/model"
-
-	"gorm.io/gorm"
+	"mem-test/internal/repository"
 )
 
 type ExperimentRunRequest struct {
@@ -23,6 +22,19 @@ type ExperimentRunRequest struct {
 	Action       string   `json:"action"`
 	// 规则变更模式：none/low/high
 	RuleMode string `json:"rule_mode"`
+	// 消融开关：group -> 组件开关（self_check/rerank/stm_limit/memos/bandit/validate_before_consolidate/change_detection）
+	Ablations map[string]GroupFeatureFlags `json:"ablations,omitempty"`
+	// 评估阶段：训练 runs_per_group 轮后冻结记忆写入/置信度更新/bandit 更新，再在留出集上跑 eval_rounds 轮（0 关闭）
+	EvalRounds int `json:"eval_rounds,omitempty"`
+	// 留出集 seed（默认 seed+1）
+	EvalSeed int64 `json:"eval_seed,omitempty"`
+	// 留出集分布：same（默认）/boundary
+	EvalDistribution string `json:"eval_distribution,omitempty"`
+	// 全局池来源：live（默认，共享全局池）/snapshot（从 global_pool_snapshot_id 导入隔离池）/empty（隔离池冷启动）
+	GlobalPool           string `json:"global_pool,omitempty"`
+	GlobalPoolSnapshotID uint   `json:"global_pool_snapshot_id,omitempty"`
+	// 所属矩阵实验（仅 sweep 内部设置）
+	SweepID uint `json:"-"`
 }
 
 type ExperimentRunResult struct {
@@ -39,23 +51,54 @@ type ExperimentRunResult struct {
 	ConclusionPath     string                 `json:"conclusion_path"`
 	ConclusionMarkdown string                 `json:"conclusion_markdown"`
 	Errors             []string               `json:"errors"`
+	// running/done/cancelled；cancelled 时 stats/trend 只包含取消前已完整跑完的轮次
+	Status          string `json:"status"`
+	CompletedRounds int    `json:"completed_rounds"`
+	// cassette 开启时：record 为本次录制文件，replay 为回放来源文件
+	CassettePath string `json:"cassette_path,omitempty"`
+	// replay 中按位置宽松回放的调用次数（同 experiment_runs.cassette_loose_hits）
+	CassetteLooseHits int `json:"cassette_loose_hits,omitempty"`
+	// 消融开关（请求原样）与各组实际生效的组件
+	Ablations map[string]GroupFeatureFlags `json:"ablations,omitempty"`
+	Features  map[string]GroupFeatures     `json:"features"`
+	// 评估阶段（eval_rounds > 0 时）：Stats/Tests/Trend 只含训练阶段，留出集结果单独统计
+	EvalRounds       int                    `json:"eval_rounds,omitempty"`
+	EvalSeed         int64                  `json:"eval_seed,omitempty"`
+	EvalDistribution string                 `json:"eval_distribution,omitempty"`
+	EvalStats        map[string]GroupStats  `json:"eval_stats,omitempty"`
+	EvalTests        map[string]interface{} `json:"eval_tests,omitempty"`
+	EvalTrend        map[string][]int       `json:"eval_trend,omitempty"`
+	// 全局池来源与快照：base 为起始快照（snapshot 模式），end 为 run 正常结束时对所用全局池生成的快照
+	GlobalPool     string `json:"global_pool"`
+	BaseSnapshotID uint   `json:"base_snapshot_id,omitempty"`
+	EndSnapshotID  uint   `json:"end_snapshot_id,omitempty"`
+	// 记忆检索方式（同 experiment_runs.retrieval）
+	Retrieval string `json:"retrieval"`
 }
 
 type ExperimentRunner struct {
+	store      *repository.Store
 	agent      *AgentService
 	coach      *CoachService
 	reflection *ReflectionService
+	cassette   *LLMCassette
+	jobs       *experimentJobs
+	progress   *progressHub
 }
 
-func NewExperimentRunner(agent *AgentService, coach *CoachService, reflection *ReflectionService) *ExperimentRunner {
+func NewExperimentRunner(store *repository.Store, agent *AgentService, coach *CoachService, reflection *ReflectionService, cassette *LLMCassette) *ExperimentRunner {
 	return &ExperimentRunner{
+		store:      store,
 		agent:      agent,
 		coach:      coach,
 		reflection: reflection,
+		cassette:   cassette,
+		jobs:       newExperimentJobs(),
+		progress:   newProgressHub(),
 	}
 }
 
-func (r *ExperimentRunner) Run(ctx context.Context, req ExperimentRunRequest) (*ExperimentRunResult, error) {
+func normalizeRunRequest(req ExperimentRunRequest) ExperimentRunRequest {
 	if req.TaskType == "" {
 		req.TaskType = "lottery"
 	}
@@ -74,39 +117,137 @@ func (r *ExperimentRunner) Run(ctx context.Context, req ExperimentRunRequest) (*
 	if req.RuleMode == "" {
 		req.RuleMode = "none"
 	}
+	if req.GlobalPool == "" {
+		req.GlobalPool = GlobalPoolLive
+		if req.GlobalPoolSnapshotID > 0 {
+			req.GlobalPool = GlobalPoolSnapshot
+		}
+	}
+	if req.EvalRounds > 0 {
+		if req.EvalSeed == 0 {
+			req.EvalSeed = req.Seed + 1
+		}
+		if req.EvalDistribution == "" {
+			req.EvalDistribution = EvalDistributionSame
+		}
+	}
+	return req
+}
 
+func (r *ExperimentRunner) createRun(ctx context.Context, req ExperimentRunRequest, status string) (*model.ExperimentRun, error) {
 	groupsJSON, _ := json.Marshal(req.Groups)
+	ablationsJSON := ""
+	if len(req.Ablations) > 0 {
+		b, _ := json.Marshal(req.Ablations)
+		ablationsJSON = string(b)
+	}
 	run := &model.ExperimentRun{
 		TaskType:     req.TaskType,
 		RunsPerGroup: req.RunsPerGroup,
 		Seed:         req.Seed,
 		GroupsJSON:   string(groupsJSON),
 		RuleMode:     req.RuleMode,
+		Action:       req.Action,
+		SweepID:      req.SweepID,
+		Status:       status,
+
+		EvalRounds:       req.EvalRounds,
+		EvalSeed:         req.EvalSeed,
+		EvalDistribution: req.EvalDistribution,
+
+		GlobalPool:     req.GlobalPool,
+		BaseSnapshotID: req.GlobalPoolSnapshotID,
+		Retrieval:      r.agent.RetrievalLabel(),
+
+		AblationsJSON: ablationsJSON,
 	}
-	if err := db.DB.Create(run).Error; err != nil {
+	if err := r.store.Runs.Create(ctx, run); err != nil {
 		return nil, fmt.Errorf("创建实验run失败: %w", err)
 	}
+	r.progress.begin(run.ID)
+	return run, nil
+}
+
+// Groups 实验组注册表
+func (r *ExperimentRunner) Groups() *GroupRegistry {
+	return r.agent.Groups()
+}
+
+// validateRequest 组必须已注册，消融开关必须与组策略兼容，评估阶段参数必须构成留出集，起始快照必须存在
+func (r *ExperimentRunner) validateRequest(ctx context.Context, req ExperimentRunRequest) error {
+	if err := r.Groups().Validate(req.Groups); err != nil {
+		return err
+	}
+	if err := validateEvalConfig(req); err != nil {
+		return err
+	}
+	if err := validateGlobalPool(req); err != nil {
+		return err
+	}
+	if req.GlobalPool == GlobalPoolSnapshot {
+		if _, err := r.store.Snapshots.Get(ctx, req.GlobalPoolSnapshotID); err != nil {
+			return fmt.Errorf("%w: 全局池快照 %d 不存在", ErrInvalidGlobalPool, req.GlobalPoolSnapshotID)
+		}
+	}
+	_, err := r.Groups().ResolveRunStrategies(req.Groups, req.Ablations)
+	return err
+}
+
+// execute 执行已创建的 run；结束时把状态（done/cancelled/failed）与进度写回 ExperimentRun
+// resume 非空时跳过已完成的 (group, round)，并用其结果回填 trend
+func (r *ExperimentRunner) execute(ctx context.Context, run *model.ExperimentRun, req ExperimentRunRequest, resume *runResumeState) (*ExperimentRunResult, error) {
+	startedAt := time.Now()
+	run.Status = model.ExperimentRunStatusRunning
+	run.StartedAt = &startedAt
+	_ = r.store.Runs.MarkStarted(ctx, run.ID, startedAt)
+	r.progress.publish(ExperimentEvent{Type: ExperimentEventStatus, RunID: run.ID, Status: run.Status})
+	defer r.progress.finish(run.ID)
+
+	// cassette：record 模式按 run_id 落盘；replay 模式加载历史录制（需使用同一 seed）
+	cassettePath, err := r.cassette.BeginRun(run.ID)
+	if err != nil {
+		err = fmt.Errorf("初始化 cassette 失败: %w", err)
+		markRunFailed(context.WithoutCancel(ctx), r.store, run.ID, err)
+		r.progress.publish(ExperimentEvent{Type: ExperimentEventStatus, RunID: run.ID, Status: model.ExperimentRunStatusFailed, Error: err.Error()})
+		return nil, err
+	}
+	defer r.cassette.EndRun(run.ID)
 
-	var lotteryInputs []map[string]interface{}
+	strategies, err := r.Groups().ResolveRunStrategies(req.Groups, req.Ablations)
+	if err == nil {
+		// 隔离全局池：snapshot 模式先导入快照（resume 时已导入则跳过）
+		err = prepareRunPool(ctx, r.store, run.ID, req.GlobalPool, req.GlobalPoolSnapshotID)
+	}
+	if err != nil {
+		markRunFailed(context.WithoutCancel(ctx), r.store, run.ID, err)
+		r.progress.publish(ExperimentEvent{Type: ExperimentEventStatus, RunID: run.ID, Status: model.ExperimentRunStatusFailed, Error: err.Error()})
+		return nil, err
+	}
+	poolRunID := runPoolID(run.ID, req.GlobalPool)
+	consolidates := false
+	for g, st := range strategies {
+		st.PoolRunID = poolRunID
+		strategies[g] = st
+		consolidates = consolidates || st.consolidates()
+	}
+
+	lotteryInputs := buildTaskInputs(req.TaskType, req.RunsPerGroup, req.Seed, req.Action)
 	var thresholds []int
 	var ruleVersions []int
-	switch req.TaskType {
-	case "lottery_v2":
-		lotteryInputs = buildLotteryV2Inputs(req.RunsPerGroup, req.Seed, req.Action)
-	case "lottery_multi":
-		lotteryInputs = buildLotteryMultiPointsInputs(req.RunsPerGroup, req.Seed, req.Action)
+	if req.TaskType != "lottery_v2" {
 		thresholds, ruleVersions = buildLotteryThresholdSchedule(req.RunsPerGroup, req.RuleMode)
-	default:
-		pointsSeq := buildLotteryPoints(req.RunsPerGroup, req.Seed)
-		lotteryInputs = make([]map[string]interface{}, 0, len(pointsSeq))
-		for i := range pointsSeq {
-			lotteryInputs = append(lotteryInputs, map[string]interface{}{
-				"points": pointsSeq[i],
-				"action": req.Action,
-			})
+	}
+	// 评估阶段：留出集输入接在训练输入之后，规则沿用训练最后一轮
+	if req.EvalRounds > 0 {
+		evalThreshold := 0
+		if len(thresholds) > 0 {
+			evalThreshold = thresholds[len(thresholds)-1]
 		}
-		thresholds, ruleVersions = buildLotteryThresholdSchedule(req.RunsPerGroup, req.RuleMode)
+		lotteryInputs = append(lotteryInputs, buildEvalInputs(req.TaskType, req.EvalRounds, req.EvalSeed, req.Action, req.EvalDistribution, evalThreshold)...)
+		thresholds = extendSchedule(thresholds, req.EvalRounds)
+		ruleVersions = extendSchedule(ruleVersions, req.EvalRounds)
 	}
+	totalRounds := req.RunsPerGroup + req.EvalRounds
 
 	result := &ExperimentRunResult{
 		RunID:        run.ID,
@@ -118,14 +259,46 @@ func (r *ExperimentRunner) Run(ctx context.Context, req ExperimentRunRequest) (*
 		Tests:        map[string]interface{}{},
 		Trend:        map[string][]int{},
 		Conclusion:   map[string]interface{}{},
+		CassettePath: cassettePath,
+		Status:       model.ExperimentRunStatusRunning,
+		Ablations:    req.Ablations,
+		Features:     map[string]GroupFeatures{},
+
+		EvalRounds:       req.EvalRounds,
+		EvalSeed:         req.EvalSeed,
+		EvalDistribution: req.EvalDistribution,
+
+		GlobalPool:     req.GlobalPool,
+		BaseSnapshotID: req.GlobalPoolSnapshotID,
+		Retrieval:      run.Retrieval,
+	}
+	if req.EvalRounds > 0 {
+		result.EvalTrend = map[string][]int{}
 	}
 
 	for _, g := range req.Groups {
 		result.Trend[g] = make([]int, 0, req.RunsPerGroup)
+		result.Features[g] = strategies[g].Features()
+		if req.EvalRounds > 0 {
+			result.EvalTrend[g] = make([]int, 0, req.EvalRounds)
+		}
+	}
+	if resume != nil {
+		r.restoreFState(ctx, run.ID, req, strategies, resume)
+		r.replayReflections(ctx, run.ID, strategies, resume, result)
 	}
 
 	// 论文级：按轮次交错运行，尽量消除模型/环境随时间漂移的干扰
-	for i := 0; i < req.RunsPerGroup; i++ {
+	cancelled := false
+	for i := 0; i < totalRounds; i++ {
+		// 只在轮次边界检查取消（Cancel 接口 / 同步模式下 HTTP 请求断开）：已开始的轮次让所有组跑完，
+		// 保证各组任务数相同，配对统计仍然成立
+		if ctx.Err() != nil {
+			cancelled = true
+			break
+		}
+		run.CurrentRound = i
+		_ = r.store.Runs.SetCurrentRound(ctx, run.ID, i)
 		in := lotteryInputs[i]
 		inputJSON, _ := json.Marshal(in)
 		inputStr := string(inputJSON)
@@ -137,111 +310,162 @@ func (r *ExperimentRunner) Run(ctx context.Context, req ExperimentRunRequest) (*
 		if len(ruleVersions) > 0 {
 			ruleVersion = ruleVersions[i]
 		}
+		// 评估阶段：冻结记忆写入（反思/固化）、置信度更新与 bandit 更新，结果计入 EvalTrend
+		evalPhase := i >= req.RunsPerGroup
+		trend := result.Trend
+		phase := ""
+		if evalPhase {
+			trend = result.EvalTrend
+			phase = model.TaskPhaseEval
+		}
 
+		// 轮内调用不随取消中断：取消只在下一轮开始前生效
+		roundCtx := context.WithoutCancel(ctx)
 		for _, group := range req.Groups {
-			useMemory := group != "A"
-			if group == "F" {
+			if outcome, ok := resume.outcome(group, i); ok {
+				trend[group] = append(trend[group], outcome)
+				continue
+			}
+			strategy := strategies[group]
+			strategy.Frozen = evalPhase
+			// 本组本轮的大模型调用（执行/反思）按 (run, group, round) 录制/回放
+			callCtx := r.cassette.WithScope(roundCtx, run.ID, group, i)
+			if strategy.Adaptive() {
 				// F 组：执行前设置当前 round，便于短期封禁/探索期生效
-				r.agent.SetFCurrentRound(run.ID, req.TaskType, i)
+				r.agent.SetFCurrentRound(run.ID, req.TaskType, group, i)
 			}
-			task, err := r.agent.ExecuteTaskInRun(ctx, run.ID, req.TaskType, inputStr, group, useMemory)
+			task, err := r.agent.ExecuteTaskWithStrategy(callCtx, run.ID, req.TaskType, inputStr, strategy, strategy.UsesMemory())
 			if err != nil {
 				result.Errors = append(result.Errors, fmt.Sprintf("run=%d group=%s round=%d execute failed: %v", run.ID, group, i, err))
-				result.Trend[group] = append(result.Trend[group], 1)
+				trend[group] = append(trend[group], 1)
+				r.progress.publish(ExperimentEvent{Type: ExperimentEventRound, RunID: run.ID, Group: group, Round: i, Outcome: "error", Error: err.Error(), Phase: phase})
 				continue
 			}
 
+			// 记录实验元数据（round / rule_mode / rule_version / threshold）
+			// 判题前写入：resume 依赖 round 识别已完成的轮次
+			task.Round = i
+			task.RuleMode = req.RuleMode
+			task.RuleVersion = ruleVersion
+			task.RuleThreshold = threshold
+			_ = r.store.Tasks.SetRoundInfo(roundCtx, task)
+
+			ev := ExperimentEvent{
+				Type:      ExperimentEventRound,
+				RunID:     run.ID,
+				Group:     group,
+				Round:     i,
+				MemoryIDs: ParseMemoryIDs(task.MemoryIDs),
+				Phase:     phase,
+			}
+
 			var feedback *model.Feedback
 			switch req.TaskType {
 			case "lottery_v2":
-				feedback, err = r.coach.JudgeLotteryV2Task(ctx, task)
+				feedback, err = r.coach.JudgeLotteryV2Task(roundCtx, task)
 			case "lottery_multi":
 				if threshold > 0 {
-					feedback, err = r.coach.JudgeLotteryMultiPointsTaskWithThreshold(ctx, task, threshold)
+					feedback, err = r.coach.JudgeLotteryMultiPointsTaskWithThreshold(roundCtx, task, threshold)
 				} else {
-					feedback, err = r.coach.JudgeLotteryMultiPointsTask(ctx, task)
+					feedback, err = r.coach.JudgeLotteryMultiPointsTask(roundCtx, task)
 				}
 			default:
 				// 规则变更模式下：按当前轮次门槛判题，并把门槛写进反馈，便于记忆演化
 				if threshold > 0 {
-					feedback, err = r.coach.JudgeLotteryTaskWithThreshold(ctx, task, threshold)
+					feedback, err = r.coach.JudgeLotteryTaskWithThreshold(roundCtx, task, threshold)
 				} else {
-					feedback, err = r.coach.JudgeLotteryTask(ctx, task)
+					feedback, err = r.coach.JudgeLotteryTask(roundCtx, task)
 				}
 			}
 			if err != nil {
 				result.Errors = append(result.Errors, fmt.Sprintf("run=%d group=%s round=%d judge failed: %v", run.ID, group, i, err))
-				result.Trend[group] = append(result.Trend[group], 1)
+				trend[group] = append(trend[group], 1)
+				ev.Outcome, ev.Error = "error", err.Error()
+				r.progress.publish(ev)
 				continue
 			}
-
-			// 记录实验元数据（round / rule_mode / rule_version / threshold）
-			_ = db.DB.WithContext(ctx).Model(&model.Task{}).
-				Where("id = ?", task.ID).
-				Updates(map[string]interface{}{
-					"round":          i,
-					"rule_mode":      req.RuleMode,
-					"rule_version":   ruleVersion,
-					"rule_threshold": threshold,
-				}).Error
+			ev.Outcome = feedback.Type
 
 			// F 组：判题后更新“变更检测/epoch/bandit”状态（不依赖反思）
-			if group == "F" {
-				r.agent.UpdateFStateAfterJudge(ctx, run.ID, req.TaskType, task, feedback, i)
+			if strategy.Adaptive() && !evalPhase {
+				prevEpoch := r.agent.FEpoch(run.ID, req.TaskType, group)
+				r.agent.UpdateFStateAfterJudge(roundCtx, run.ID, req.TaskType, strategy, task, feedback, i)
+				ev.Epoch = r.agent.FEpoch(run.ID, req.TaskType, group)
+				if ev.Epoch != prevEpoch {
+					r.progress.publish(ExperimentEvent{Type: ExperimentEventEpoch, RunID: run.ID, Group: group, Round: i, Epoch: ev.Epoch, PrevEpoch: prevEpoch})
+				}
 			}
 
 			if feedback.Type == "incorrect" {
-				result.Trend[group] = append(result.Trend[group], 1)
-				if group == "C" {
-					if _, err := r.reflection.ReflectAndSaveMemory(ctx, task.ID, feedback); err != nil {
-						result.Errors = append(result.Errors, fmt.Sprintf("run=%d group=%s round=%d reflect failed: %v", run.ID, group, i, err))
-					}
+				trend[group] = append(trend[group], 1)
+				if evalPhase {
+					r.progress.publish(ev)
+					continue
 				}
-				if group == "D" {
-					if _, err := r.reflection.ReflectAndSaveMemoryAndConsolidateGlobal(ctx, task.ID, feedback); err != nil {
-						result.Errors = append(result.Errors, fmt.Sprintf("run=%d group=%s round=%d reflect+consolidate failed: %v", run.ID, group, i, err))
-					}
-				}
-				if group == "E" {
-					if _, err := r.reflection.ReflectAndSaveMemoryAndConsolidateGlobalValidated(ctx, task.ID, feedback); err != nil {
-						result.Errors = append(result.Errors, fmt.Sprintf("run=%d group=%s round=%d reflect+validate+consolidate failed: %v", run.ID, group, i, err))
-					}
-				}
-				if group == "F" {
-					// F 组：仍然用“验证固化”产出高质量记忆，但策略上更强调变更检测+候选竞争
-					if _, err := r.reflection.ReflectAndSaveMemoryAndConsolidateGlobalValidated(ctx, task.ID, feedback); err != nil {
-						result.Errors = append(result.Errors, fmt.Sprintf("run=%d group=%s round=%d reflect+validate+consolidate failed: %v", run.ID, group, i, err))
-					}
+				reflected, reflectErr := r.reflection.ReflectWithStrategy(callCtx, strategy, task.ID, feedback)
+				if reflectErr != nil {
+					result.Errors = append(result.Errors, fmt.Sprintf("run=%d group=%s round=%d %s failed: %v", run.ID, group, i, reflectionLabel(strategy.Reflection), reflectErr))
 				}
+				ev.setReflection(strategy.Reflects(), reflected, reflectErr)
 			} else {
 				// 判对：对本次使用到的记忆做“验证时间”更新，帮助规则变更场景下优先检索当前有效规则
-				if (group == "C" || group == "D" || group == "E" || group == "F") && task.MemoryIDs != "" {
+				if strategy.Retrieval == RetrievalMemory && task.MemoryIDs != "" && !evalPhase {
 					ids := ParseMemoryIDs(task.MemoryIDs)
 					if len(ids) > 0 {
-						now := time.Now()
-						_ = db.DB.WithContext(ctx).
-							Model(&model.Memory{}).
-							Where("id IN ?", ids).
-							Updates(map[string]interface{}{
-								"last_verified_at": now,
-								"confidence":       gorm.Expr("LEAST(confidence + ?, 1)", 0.01),
-							}).Error
+						_ = r.store.Memories.MarkVerified(roundCtx, ids, time.Now(), 0.01)
 					}
 				}
-				result.Trend[group] = append(result.Trend[group], 0)
+				trend[group] = append(trend[group], 0)
 			}
+			r.progress.publish(ev)
 		}
+		result.CompletedRounds = i + 1
+		_ = r.store.Runs.SetProgress(roundCtx, run.ID, result.CompletedRounds, len(result.Errors))
+	}
+
+	// 取消后 ctx 已失效：收尾（统计/落盘/状态）改用不可取消的 ctx，保证部分结果仍被写出
+	if cancelled {
+		log.Printf("[experiment] run=%d cancelled after %d/%d rounds", run.ID, result.CompletedRounds, totalRounds)
+		result.Status = model.ExperimentRunStatusCancelled
+		ctx = context.WithoutCancel(ctx)
+	} else {
+		result.Status = model.ExperimentRunStatusDone
+	}
+
+	result.CassetteLooseHits = r.cassette.LooseHits(run.ID)
+	if result.CassetteLooseHits > 0 {
+		log.Printf("[experiment] run=%d cassette replayed %d calls by position (prompt mismatch)", run.ID, result.CassetteLooseHits)
 	}
 
 	// 严谨统计：只统计本 run_id
-	stats, tests, err := ComputeRunStatsAndTests(run.ID, req.Groups, result.Trend)
+	stats, tests, err := ComputeRunStatsAndTests(ctx, r.store, run.ID, r.Groups().Ordered(req.Groups), result.Trend)
 	if err != nil {
 		result.Errors = append(result.Errors, fmt.Sprintf("run=%d stats failed: %v", run.ID, err))
 	}
 	result.Stats = stats
 	result.Tests = tests
+	if req.EvalRounds > 0 {
+		evalStats, evalTests, err := ComputeRunEvalStats(ctx, r.store, run.ID, r.Groups().Ordered(req.Groups), stats)
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("run=%d eval stats failed: %v", run.ID, err))
+		}
+		result.EvalStats = evalStats
+		result.EvalTests = evalTests
+	}
 	result.Conclusion = GenerateConclusionFromStats(stats, tests, result.Trend)
 
+	// 正常结束且有组做全局固化：为本 run 所用的全局池生成快照，供后续 run 作为“先验经验”起点
+	if result.Status == model.ExperimentRunStatusDone && consolidates {
+		note := fmt.Sprintf("run=%d end (global_pool=%s)", run.ID, req.GlobalPool)
+		snap, err := CreateGlobalPoolSnapshot(ctx, r.store, poolRunID, run.ID, req.GlobalPoolSnapshotID, note)
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("run=%d global pool snapshot failed: %v", run.ID, err))
+		} else {
+			result.EndSnapshotID = snap.ID
+			run.EndSnapshotID = snap.ID
+		}
+	}
+
 	// 输出文件
 	outDir := filepath.Join("outputs")
 	_ = os.MkdirAll(outDir, 0o755)
@@ -258,11 +482,28 @@ func (r *ExperimentRunner) Run(ctx context.Context, req ExperimentRunRequest) (*
 
 	run.ResultPath = resultPath
 	run.ConclusionPath = conclusionPath
-	_ = db.DB.Save(run).Error
+	finishedAt := time.Now()
+	run.Status = result.Status
+	run.CompletedRounds = result.CompletedRounds
+	run.ErrorCount = len(result.Errors)
+	run.CassetteLooseHits = result.CassetteLooseHits
+	run.FinishedAt = &finishedAt
+	_ = r.store.Runs.Save(ctx, run)
+	r.progress.publish(ExperimentEvent{Type: ExperimentEventStatus, RunID: run.ID, Status: run.Status, CompletedRounds: run.CompletedRounds})
 
 	return result, nil
 }
 
+func reflectionLabel(policy string) string {
+	switch policy {
+	case ReflectionGlobal:
+		return "reflect+consolidate"
+	case ReflectionValidated:
+		return "reflect+validate+consolidate"
+	}
+	return "reflect"
+}
+
 func buildLotteryThresholdSchedule(n int, mode string) (thresholds []int, versions []int) {
 	thresholds = make([]int, n)
 	versions = make([]int, n)
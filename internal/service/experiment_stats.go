@@ -21,6 +21,16 @@ type ModeCurve struct {
 
 	// C 组每轮记忆变更次数（当前定义：该轮 C 组判错次数；通常为 0/1）
 	MemoryChangesPerRound []int `json:"memory_changes_per_round"`
+
+	// 各组每轮记忆变更次数（做反思的组 = 该轮判错次数；不反思的组恒为 0）
+	MemoryChangesByGroup map[string][]int `json:"memory_changes_by_group"`
+	// 各组记忆开始变更轮次（-1 表示未触发）
+	MemoryChangeStartByGroup map[string]int `json:"memory_change_start_by_group"`
+
+	// 各组在每次规则变更后的恢复情况
+	Recovery map[string]RecoveryMetrics `json:"recovery"`
+	// 相邻组（按组顺序，如 F_vs_E）逐变更点对比恢复速度
+	RecoveryComparison map[string]RecoveryDiff `json:"recovery_comparison"`
 }
 
 type Curves struct {
@@ -55,20 +65,24 @@ func BuildCumulativeCurves(flags []int, rounds int) Curves {
 	return Curves{CumulativeAccuracy: acc, CumulativeError: err}
 }
 
-func ComputeTrialAndErrorC(ruleVersions []int, cFlags []int) TrialAndError {
+// RuleChangePoints 规则版本发生变化的轮次（不含第 0 轮）
+func RuleChangePoints(ruleVersions []int) []int {
 	var changePoints []int
+	for i := 1; i < len(ruleVersions); i++ {
+		if ruleVersions[i] != ruleVersions[i-1] {
+			changePoints = append(changePoints, i)
+		}
+	}
+	return changePoints
+}
+
+func ComputeTrialAndErrorC(ruleVersions []int, cFlags []int) TrialAndError {
 	var attempts []int
 
 	if len(ruleVersions) == 0 {
 		return TrialAndError{}
 	}
-	prev := ruleVersions[0]
-	for i := 1; i < len(ruleVersions); i++ {
-		if ruleVersions[i] != prev {
-			changePoints = append(changePoints, i)
-			prev = ruleVersions[i]
-		}
-	}
+	changePoints := RuleChangePoints(ruleVersions)
 
 	// 对每个 change point：数从该轮开始到首次正确的错误次数（C组）
 	maxA := 0
@@ -0,0 +1,544 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"mem-test/internal/model"
+	"mem-test/internal/repository"
+)
+
+// ErrSweepNotCancellable sweep 已处于终态，无法取消
+var ErrSweepNotCancellable = errors.New("sweep 已结束，无法取消")
+
+// ErrInvalidSweepRequest sweep 参数不合法（如 seeds 为空）
+var ErrInvalidSweepRequest = errors.New("无效的sweep请求")
+
+// 组间一致性判定（相对基线组，逐 seed 配对比较错误率）
+const (
+	SweepConsistencyBaseline          = "baseline"
+	SweepConsistencyInsufficientSeeds = "insufficient_seeds"
+	SweepConsistencyBetter            = "consistently_better"
+	SweepConsistencyWorse             = "consistently_worse"
+	SweepConsistencyNoDifference      = "no_difference"
+	SweepConsistencyMixed             = "mixed"
+)
+
+// ExperimentSweepRequest 矩阵实验：task_types × rule_modes × seeds 全组合，每个组合一个 run
+type ExperimentSweepRequest struct {
+	TaskTypes    []string `json:"task_types"`
+	RuleModes    []string `json:"rule_modes"`
+	Seeds        []int64  `json:"seeds"`
+	RunsPerGroup int      `json:"runs_per_group"`
+	Groups       []string `json:"groups"`
+	Action       string   `json:"action"`
+	// 消融开关：对矩阵中每个 run 生效
+	Ablations map[string]GroupFeatureFlags `json:"ablations,omitempty"`
+	// 全局池来源：对矩阵中每个 run 生效，各 run 使用各自的隔离池、起点一致。
+	// 为空时在提交时为共享全局池生成快照作为起点（等同 snapshot）；不接受 live（各 seed 会经共享池互相影响）
+	GlobalPool           string `json:"global_pool,omitempty"`
+	GlobalPoolSnapshotID uint   `json:"global_pool_snapshot_id,omitempty"`
+}
+
+// SweepGroupSummary 某个 (task_type, rule_mode) 下单组跨 seed 的汇总
+type SweepGroupSummary struct {
+	Group string `json:"group"`
+	// 有判题数据的 seed 数；error_rates 与 cell.seeds 一一对应（无数据的 seed 为 null）
+	Seeds      int        `json:"seeds"`
+	ErrorRates []*float64 `json:"error_rates"`
+	Mean       float64    `json:"mean_error_rate"`
+	Std        float64    `json:"std_error_rate"`
+	// 合并所有 seed 的判题样本后的错误率与 Wilson CI95
+	PooledN         int     `json:"pooled_n"`
+	PooledIncorrect int     `json:"pooled_incorrect"`
+	PooledErrorRate float64 `json:"pooled_error_rate"`
+	PooledCI95Low   float64 `json:"pooled_ci95_low"`
+	PooledCI95High  float64 `json:"pooled_ci95_high"`
+	// 相对基线组：错误率更低/更高的 seed 数
+	Baseline         string `json:"baseline"`
+	WinsVsBaseline   int    `json:"wins_vs_baseline"`
+	LossesVsBaseline int    `json:"losses_vs_baseline"`
+	Consistency      string `json:"consistency"`
+}
+
+// SweepCellReport 矩阵中一个 (task_type, rule_mode) 格子的跨 seed 汇总
+type SweepCellReport struct {
+	TaskType string              `json:"task_type"`
+	RuleMode string              `json:"rule_mode"`
+	Seeds    []int64             `json:"seeds"`
+	RunIDs   []uint              `json:"run_ids"`
+	Groups   []SweepGroupSummary `json:"groups"`
+	// 合并错误率最低的组，以及它是否在每个 seed 上都最低
+	BestGroup       string `json:"best_group"`
+	BestGroupStable bool   `json:"best_group_stable"`
+}
+
+type SweepReport struct {
+	SweepID      uint              `json:"sweep_id"`
+	Status       string            `json:"status"`
+	TaskTypes    []string          `json:"task_types"`
+	RuleModes    []string          `json:"rule_modes"`
+	Seeds        []int64           `json:"seeds"`
+	Groups       []string          `json:"groups"`
+	RunsPerGroup int               `json:"runs_per_group"`
+	Cells        []SweepCellReport `json:"cells"`
+	// 未完成（非 done）的 run 不参与汇总
+	SkippedRunIDs      []uint    `json:"skipped_run_ids"`
+	ReportPath         string    `json:"report_path"`
+	ReportMarkdownPath string    `json:"report_markdown_path"`
+	GeneratedAt        time.Time `json:"generated_at"`
+}
+
+// sweepSeedStats 单个 run（即一个 seed）的分组统计
+type sweepSeedStats struct {
+	RunID uint
+	Seed  int64
+	Stats map[string]GroupStats
+}
+
+type sweepJob struct {
+	ctx context.Context
+	run *model.ExperimentRun
+	req ExperimentRunRequest
+}
+
+func normalizeSweepRequest(req ExperimentSweepRequest) (ExperimentSweepRequest, error) {
+	req.TaskTypes = uniqueStrings(req.TaskTypes)
+	req.RuleModes = uniqueStrings(req.RuleModes)
+	req.Groups = uniqueStrings(req.Groups)
+	if len(req.TaskTypes) == 0 {
+		req.TaskTypes = []string{"lottery"}
+	}
+	if len(req.RuleModes) == 0 {
+		req.RuleModes = []string{"none"}
+	}
+	if len(req.Seeds) == 0 {
+		return req, fmt.Errorf("%w: seeds 不能为空（矩阵实验需要固定 seed 以便复现）", ErrInvalidSweepRequest)
+	}
+	seen := map[int64]bool{}
+	seeds := make([]int64, 0, len(req.Seeds))
+	for _, s := range req.Seeds {
+		if s == 0 {
+			return req, fmt.Errorf("%w: seed 不能为 0（0 表示按当前时间随机）", ErrInvalidSweepRequest)
+		}
+		if !seen[s] {
+			seen[s] = true
+			seeds = append(seeds, s)
+		}
+	}
+	req.Seeds = seeds
+	if req.RunsPerGroup <= 0 {
+		req.RunsPerGroup = 30
+	}
+	if len(req.Groups) == 0 {
+		req.Groups = []string{"A", "B", "C", "D", "E", "F"}
+	}
+	if req.Action == "" {
+		req.Action = "lottery"
+	}
+	if req.GlobalPool == "" && req.GlobalPoolSnapshotID != 0 {
+		req.GlobalPool = GlobalPoolSnapshot
+	}
+	if req.GlobalPool == GlobalPoolLive {
+		return req, fmt.Errorf("%w: global_pool 不能为 live（各 seed 共用并改写共享全局池，结果不独立），请使用 snapshot/empty 或留空", ErrInvalidSweepRequest)
+	}
+	return req, nil
+}
+
+func uniqueStrings(in []string) []string {
+	seen := map[string]bool{}
+	out := make([]string, 0, len(in))
+	for _, s := range in {
+		if s == "" || seen[s] {
+			continue
+		}
+		seen[s] = true
+		out = append(out, s)
+	}
+	return out
+}
+
+// SubmitSweep 创建 sweep 以及全部格子的 run（状态 queued），后台按 task_type → rule_mode → seed 顺序逐个执行；
+// 每个 run 仍可单独查询状态/订阅进度/取消，全部结束后自动生成汇总报告
+func (r *ExperimentRunner) SubmitSweep(ctx context.Context, req ExperimentSweepRequest) (*model.ExperimentSweep, []uint, error) {
+	req, err := normalizeSweepRequest(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	// 未指定全局池：校验通过后再为共享全局池生成起点快照，校验时先按空隔离池检查其余参数
+	snapshotAtStart := req.GlobalPool == ""
+	check := ExperimentRunRequest{
+		Groups:               req.Groups,
+		Ablations:            req.Ablations,
+		GlobalPool:           req.GlobalPool,
+		GlobalPoolSnapshotID: req.GlobalPoolSnapshotID,
+	}
+	if snapshotAtStart {
+		check.GlobalPool = GlobalPoolEmpty
+	}
+	if err := r.validateRequest(ctx, normalizeRunRequest(check)); err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidSweepRequest, err)
+	}
+
+	if snapshotAtStart {
+		snap, err := CreateGlobalPoolSnapshot(ctx, r.store, 0, 0, 0, "sweep start (live pool)")
+		if err != nil {
+			return nil, nil, err
+		}
+		req.GlobalPool, req.GlobalPoolSnapshotID = GlobalPoolSnapshot, snap.ID
+	}
+
+	taskTypesJSON, _ := json.Marshal(req.TaskTypes)
+	ruleModesJSON, _ := json.Marshal(req.RuleModes)
+	seedsJSON, _ := json.Marshal(req.Seeds)
+	groupsJSON, _ := json.Marshal(req.Groups)
+	sweep := &model.ExperimentSweep{
+		TaskTypesJSON: string(taskTypesJSON),
+		RuleModesJSON: string(ruleModesJSON),
+		SeedsJSON:     string(seedsJSON),
+		GroupsJSON:    string(groupsJSON),
+		RunsPerGroup:  req.RunsPerGroup,
+		Action:        req.Action,
+		Status:        model.ExperimentRunStatusQueued,
+		TotalRuns:     len(req.TaskTypes) * len(req.RuleModes) * len(req.Seeds),
+
+		GlobalPool:           req.GlobalPool,
+		GlobalPoolSnapshotID: req.GlobalPoolSnapshotID,
+	}
+	if err := r.store.Sweeps.Create(ctx, sweep); err != nil {
+		return nil, nil, fmt.Errorf("创建sweep失败: %w", err)
+	}
+
+	jobs := make([]sweepJob, 0, sweep.TotalRuns)
+	runIDs := make([]uint, 0, sweep.TotalRuns)
+	for _, taskType := range req.TaskTypes {
+		for _, ruleMode := range req.RuleModes {
+			for _, seed := range req.Seeds {
+				runReq := normalizeRunRequest(ExperimentRunRequest{
+					TaskType:     taskType,
+					RunsPerGroup: req.RunsPerGroup,
+					Seed:         seed,
+					Groups:       req.Groups,
+					Action:       req.Action,
+					RuleMode:     ruleMode,
+					Ablations:    req.Ablations,
+					SweepID:      sweep.ID,
+
+					GlobalPool:           req.GlobalPool,
+					GlobalPoolSnapshotID: req.GlobalPoolSnapshotID,
+				})
+				run, err := r.createRun(ctx, runReq, model.ExperimentRunStatusQueued)
+				if err != nil {
+					// 部分格子已创建：全部标记失败，避免留下永远 queued 的 run
+					for _, j := range jobs {
+						r.jobs.remove(j.run.ID)
+						markRunFailed(context.WithoutCancel(ctx), r.store, j.run.ID, err)
+						r.progress.finish(j.run.ID)
+					}
+					markSweepStatus(context.WithoutCancel(ctx), r.store, sweep.ID, model.ExperimentRunStatusFailed)
+					return nil, nil, err
+				}
+				jobCtx, cancel := context.WithCancel(context.Background())
+				r.jobs.add(run.ID, cancel)
+				jobs = append(jobs, sweepJob{ctx: jobCtx, run: run, req: runReq})
+				runIDs = append(runIDs, run.ID)
+			}
+		}
+	}
+
+	go r.runSweep(sweep.ID, jobs)
+	return sweep, runIDs, nil
+}
+
+// runSweep 只持有 sweepID：提交方返回的 sweep 结构体不与后台 goroutine 共享
+func (r *ExperimentRunner) runSweep(sweepID uint, jobs []sweepJob) {
+	ctx := context.Background()
+	startedAt := time.Now()
+	_ = r.store.Sweeps.MarkStarted(ctx, sweepID, startedAt)
+
+	cancelled := false
+	for i, job := range jobs {
+		if job.ctx.Err() != nil {
+			// 排队期间被取消（CancelSweep / 单独取消某个 run）
+			r.jobs.remove(job.run.ID)
+			markRunStatus(ctx, r.store, job.run.ID, model.ExperimentRunStatusCancelled, "")
+			r.progress.publish(ExperimentEvent{Type: ExperimentEventStatus, RunID: job.run.ID, Status: model.ExperimentRunStatusCancelled})
+			r.progress.finish(job.run.ID)
+			cancelled = true
+		} else {
+			r.runJob(job.ctx, job.run, job.req, nil)
+		}
+		_ = r.store.Sweeps.SetCompletedRuns(ctx, sweepID, i+1)
+	}
+
+	status := model.ExperimentRunStatusDone
+	cancelledRuns, _ := r.store.Runs.CountBySweep(ctx, sweepID, model.ExperimentRunStatusCancelled)
+	if cancelled || cancelledRuns > 0 {
+		status = model.ExperimentRunStatusCancelled
+	}
+	markSweepStatus(ctx, r.store, sweepID, status)
+
+	if _, err := r.BuildSweepReport(ctx, sweepID); err != nil {
+		log.Printf("[sweep] sweep=%d build report failed: %v", sweepID, err)
+	}
+	log.Printf("[sweep] sweep=%d finished status=%s runs=%d", sweepID, status, len(jobs))
+}
+
+// CancelSweep 取消 sweep 下所有未结束的 run；已完成的 run 仍参与汇总报告
+func (r *ExperimentRunner) CancelSweep(ctx context.Context, sweepID uint) error {
+	sweep, err := r.store.Sweeps.Get(ctx, sweepID)
+	if err != nil {
+		return fmt.Errorf("查询sweep失败: %w", err)
+	}
+	if sweep.IsTerminal() {
+		return ErrSweepNotCancellable
+	}
+
+	runs, err := r.store.Runs.ListBySweep(ctx, sweepID)
+	if err != nil {
+		return fmt.Errorf("查询sweep的run失败: %w", err)
+	}
+	active := false
+	for i := range runs {
+		if runs[i].IsTerminal() {
+			continue
+		}
+		if r.jobs.cancel(runs[i].ID) {
+			active = true
+			continue
+		}
+		markRunStatus(ctx, r.store, runs[i].ID, model.ExperimentRunStatusCancelled, "")
+	}
+	// 没有后台任务在跑（例如服务重启前遗留）：直接把 sweep 记为 cancelled
+	if !active {
+		markSweepStatus(ctx, r.store, sweepID, model.ExperimentRunStatusCancelled)
+	}
+	return nil
+}
+
+func markSweepStatus(ctx context.Context, store *repository.Store, sweepID uint, status string) {
+	if err := store.Sweeps.MarkStatus(ctx, sweepID, status, time.Now()); err != nil {
+		log.Printf("[sweep] update sweep=%d status=%s failed: %v", sweepID, status, err)
+	}
+}
+
+// BuildSweepReport 汇总 sweep 下已完成（done）的 run：按 (task_type, rule_mode) 分格，
+// 每组给出跨 seed 的错误率均值/标准差、合并 CI95 与一致性判定，并写出 JSON/Markdown 报告
+func (r *ExperimentRunner) BuildSweepReport(ctx context.Context, sweepID uint) (*SweepReport, error) {
+	sweep, err := r.store.Sweeps.Get(ctx, sweepID)
+	if err != nil {
+		return nil, fmt.Errorf("查询sweep失败: %w", err)
+	}
+	runs, err := r.store.Runs.ListBySweep(ctx, sweepID)
+	if err != nil {
+		return nil, fmt.Errorf("查询sweep的run失败: %w", err)
+	}
+
+	report := &SweepReport{
+		SweepID:       sweep.ID,
+		Status:        sweep.Status,
+		RunsPerGroup:  sweep.RunsPerGroup,
+		Cells:         []SweepCellReport{},
+		SkippedRunIDs: []uint{},
+		GeneratedAt:   time.Now(),
+	}
+	_ = json.Unmarshal([]byte(sweep.TaskTypesJSON), &report.TaskTypes)
+	_ = json.Unmarshal([]byte(sweep.RuleModesJSON), &report.RuleModes)
+	_ = json.Unmarshal([]byte(sweep.SeedsJSON), &report.Seeds)
+	_ = json.Unmarshal([]byte(sweep.GroupsJSON), &report.Groups)
+
+	cellSeeds := map[string][]sweepSeedStats{}
+	for i := range runs {
+		run := &runs[i]
+		if run.Status != model.ExperimentRunStatusDone {
+			report.SkippedRunIDs = append(report.SkippedRunIDs, run.ID)
+			continue
+		}
+		stats, _, err := ComputeRunStatsAndTests(ctx, r.store, run.ID, r.Groups().Ordered(report.Groups), nil)
+		if err != nil {
+			return nil, err
+		}
+		key := run.TaskType + "|" + run.RuleMode
+		cellSeeds[key] = append(cellSeeds[key], sweepSeedStats{RunID: run.ID, Seed: run.Seed, Stats: stats})
+	}
+	for _, taskType := range report.TaskTypes {
+		for _, ruleMode := range report.RuleModes {
+			seeds, ok := cellSeeds[taskType+"|"+ruleMode]
+			if !ok {
+				continue
+			}
+			report.Cells = append(report.Cells, aggregateSweepCell(taskType, ruleMode, report.Groups, seeds))
+		}
+	}
+
+	outDir := filepath.Join("outputs")
+	_ = os.MkdirAll(outDir, 0o755)
+	report.ReportPath = filepath.Join(outDir, fmt.Sprintf("experiment_sweep_%d.json", sweep.ID))
+	report.ReportMarkdownPath = filepath.Join(outDir, fmt.Sprintf("experiment_sweep_%d_report.md", sweep.ID))
+	if b, err := json.MarshalIndent(report, "", "  "); err == nil {
+		_ = os.WriteFile(report.ReportPath, b, 0o644)
+	}
+	_ = os.WriteFile(report.ReportMarkdownPath, []byte(RenderSweepMarkdown(report)), 0o644)
+
+	_ = r.store.Sweeps.SetReportPaths(ctx, sweep.ID, report.ReportPath, report.ReportMarkdownPath)
+	return report, nil
+}
+
+// aggregateSweepCell 同一 (task_type, rule_mode) 下跨 seed 汇总；基线组优先取 A，否则取第一个组
+func aggregateSweepCell(taskType, ruleMode string, groups []string, seeds []sweepSeedStats) SweepCellReport {
+	sort.Slice(seeds, func(i, j int) bool { return seeds[i].Seed < seeds[j].Seed })
+	cell := SweepCellReport{
+		TaskType: taskType,
+		RuleMode: ruleMode,
+		Seeds:    make([]int64, 0, len(seeds)),
+		RunIDs:   make([]uint, 0, len(seeds)),
+		Groups:   make([]SweepGroupSummary, 0, len(groups)),
+	}
+	for _, s := range seeds {
+		cell.Seeds = append(cell.Seeds, s.Seed)
+		cell.RunIDs = append(cell.RunIDs, s.RunID)
+	}
+	if len(groups) == 0 {
+		return cell
+	}
+
+	baseline := groups[0]
+	for _, g := range groups {
+		if g == "A" {
+			baseline = g
+			break
+		}
+	}
+	// 某 seed 下该组的错误率（无判题数据返回 false）
+	rateAt := func(s sweepSeedStats, g string) (float64, bool) {
+		gs, ok := s.Stats[g]
+		if !ok || gs.Correct+gs.Incorrect == 0 {
+			return 0, false
+		}
+		return gs.ErrorRate, true
+	}
+
+	for _, g := range groups {
+		sum := SweepGroupSummary{Group: g, Baseline: baseline, ErrorRates: make([]*float64, 0, len(seeds))}
+		rates := make([]float64, 0, len(seeds))
+		for _, s := range seeds {
+			rate, ok := rateAt(s, g)
+			if !ok {
+				sum.ErrorRates = append(sum.ErrorRates, nil)
+				continue
+			}
+			v := rate
+			sum.ErrorRates = append(sum.ErrorRates, &v)
+			rates = append(rates, rate)
+			gs := s.Stats[g]
+			sum.PooledN += gs.Correct + gs.Incorrect
+			sum.PooledIncorrect += gs.Incorrect
+
+			if g == baseline {
+				continue
+			}
+			if base, ok := rateAt(s, baseline); ok {
+				switch {
+				case rate < base:
+					sum.WinsVsBaseline++
+				case rate > base:
+					sum.LossesVsBaseline++
+				}
+			}
+		}
+		sum.Seeds = len(rates)
+		sum.Mean, sum.Std = meanStd(rates)
+		if sum.PooledN > 0 {
+			sum.PooledErrorRate = float64(sum.PooledIncorrect) / float64(sum.PooledN)
+			sum.PooledCI95Low, sum.PooledCI95High = wilsonCI(sum.PooledIncorrect, sum.PooledN, 1.96)
+		}
+		sum.Consistency = sweepConsistency(g == baseline, sum.WinsVsBaseline, sum.LossesVsBaseline, pairedSeeds(seeds, g, baseline, rateAt))
+		cell.Groups = append(cell.Groups, sum)
+	}
+
+	// 合并错误率最低的组；stable 表示它在每个有数据的 seed 上都不高于其他组
+	best := -1
+	for i, s := range cell.Groups {
+		if s.PooledN == 0 {
+			continue
+		}
+		if best < 0 || s.PooledErrorRate < cell.Groups[best].PooledErrorRate {
+			best = i
+		}
+	}
+	if best >= 0 {
+		cell.BestGroup = cell.Groups[best].Group
+		cell.BestGroupStable = len(seeds) >= 2
+		for _, s := range seeds {
+			bestRate, ok := rateAt(s, cell.BestGroup)
+			if !ok {
+				cell.BestGroupStable = false
+				break
+			}
+			for _, g := range groups {
+				if rate, ok := rateAt(s, g); ok && rate < bestRate {
+					cell.BestGroupStable = false
+				}
+			}
+		}
+	}
+	return cell
+}
+
+func pairedSeeds(seeds []sweepSeedStats, g, baseline string, rateAt func(sweepSeedStats, string) (float64, bool)) int {
+	n := 0
+	for _, s := range seeds {
+		_, okG := rateAt(s, g)
+		_, okB := rateAt(s, baseline)
+		if okG && okB {
+			n++
+		}
+	}
+	return n
+}
+
+// sweepConsistency 逐 seed 与基线配对：全部更低/全部更高/全部持平才算一致，否则 mixed；配对 seed 少于 2 个不下结论
+func sweepConsistency(isBaseline bool, wins, losses, paired int) string {
+	switch {
+	case isBaseline:
+		return SweepConsistencyBaseline
+	case paired < 2:
+		return SweepConsistencyInsufficientSeeds
+	case wins == paired:
+		return SweepConsistencyBetter
+	case losses == paired:
+		return SweepConsistencyWorse
+	case wins == 0 && losses == 0:
+		return SweepConsistencyNoDifference
+	default:
+		return SweepConsistencyMixed
+	}
+}
+
+// meanStd 均值与样本标准差（n-1）；少于 2 个样本时标准差为 0
+func meanStd(xs []float64) (float64, float64) {
+	if len(xs) == 0 {
+		return 0, 0
+	}
+	mean := 0.0
+	for _, x := range xs {
+		mean += x
+	}
+	mean /= float64(len(xs))
+	if len(xs) < 2 {
+		return mean, 0
+	}
+	ss := 0.0
+	for _, x := range xs {
+		ss += (x - mean) * (x - mean)
+	}
+	return mean, math.Sqrt(ss / float64(len(xs)-1))
+}
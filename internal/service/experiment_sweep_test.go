@@ -0,0 +1,97 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+
+	"mem-test/internal/model"
+)
+
+func sweepGroupStats(incorrect, n int) GroupStats {
+	gs := GroupStats{N: n, Incorrect: incorrect, Correct: n - incorrect}
+	gs.ErrorRate = float64(incorrect) / float64(n)
+	gs.CI95Low, gs.CI95High = wilsonCI(incorrect, n, 1.96)
+	return gs
+}
+
+// TestAggregateSweepCell 跨 seed：均值/样本标准差/合并 CI 与相对 A 组的一致性判定
+func TestAggregateSweepCell(t *testing.T) {
+	seeds := []sweepSeedStats{
+		{RunID: 12, Seed: 3, Stats: map[string]GroupStats{"A": sweepGroupStats(12, 20), "C": sweepGroupStats(4, 20), "F": sweepGroupStats(9, 20)}},
+		{RunID: 10, Seed: 1, Stats: map[string]GroupStats{"A": sweepGroupStats(10, 20), "C": sweepGroupStats(2, 20), "F": sweepGroupStats(12, 20)}},
+		{RunID: 11, Seed: 2, Stats: map[string]GroupStats{"A": sweepGroupStats(8, 20), "C": sweepGroupStats(6, 20), "F": sweepGroupStats(8, 20)}},
+	}
+	cell := aggregateSweepCell("lottery", "high", []string{"A", "C", "F"}, seeds)
+
+	if len(cell.Seeds) != 3 || cell.Seeds[0] != 1 || cell.RunIDs[0] != 10 {
+		t.Fatalf("seeds should be sorted: %v %v", cell.Seeds, cell.RunIDs)
+	}
+	c := cell.Groups[1]
+	if math.Abs(c.Mean-0.2) > 1e-9 || math.Abs(c.Std-0.1) > 1e-9 {
+		t.Fatalf("unexpected C mean/std: %v %v", c.Mean, c.Std)
+	}
+	if c.PooledN != 60 || c.PooledIncorrect != 12 || math.Abs(c.PooledErrorRate-0.2) > 1e-9 {
+		t.Fatalf("unexpected C pooled: %+v", c)
+	}
+	if low, high := wilsonCI(12, 60, 1.96); c.PooledCI95Low != low || c.PooledCI95High != high {
+		t.Fatalf("unexpected C pooled ci: [%v, %v]", c.PooledCI95Low, c.PooledCI95High)
+	}
+	if cell.Groups[0].Consistency != SweepConsistencyBaseline {
+		t.Fatalf("A should be baseline, got %s", cell.Groups[0].Consistency)
+	}
+	if c.Consistency != SweepConsistencyBetter || c.WinsVsBaseline != 3 {
+		t.Fatalf("C should be consistently better: %+v", c)
+	}
+	// F：seed1 更差、seed2 持平、seed3 更好
+	if f := cell.Groups[2]; f.Consistency != SweepConsistencyMixed || f.WinsVsBaseline != 1 || f.LossesVsBaseline != 1 {
+		t.Fatalf("F should be mixed: %+v", f)
+	}
+	if cell.BestGroup != "C" || !cell.BestGroupStable {
+		t.Fatalf("unexpected best group: %s stable=%v", cell.BestGroup, cell.BestGroupStable)
+	}
+
+	single := aggregateSweepCell("lottery", "none", []string{"A", "C"}, seeds[:1])
+	if single.Groups[1].Consistency != SweepConsistencyInsufficientSeeds || single.Groups[1].Std != 0 {
+		t.Fatalf("single seed should be insufficient: %+v", single.Groups[1])
+	}
+}
+
+// TestSubmitSweep_IsolatedPool sweep 默认从提交时的共享池快照起步、每个 seed 用各自的隔离池；live 被拒绝
+func TestSubmitSweep_IsolatedPool(t *testing.T) {
+	r := newTestRunner(t, nil)
+	ctx := context.Background()
+	shared := &model.Memory{Trigger: "积分<100", TriggerKey: normalizeTriggerKey("积分<100"), Lesson: "积分低于100时拒绝抽奖", ApplyTo: "lottery", DerivedFrom: "global|seed", Version: 1}
+	if err := r.store.Memories.Create(ctx, shared); err != nil {
+		t.Fatalf("seed shared pool: %v", err)
+	}
+
+	if _, _, err := r.SubmitSweep(ctx, ExperimentSweepRequest{Seeds: []int64{1, 2}, GlobalPool: GlobalPoolLive}); !errors.Is(err, ErrInvalidSweepRequest) {
+		t.Fatalf("live pool should be rejected: %v", err)
+	}
+
+	// 占住执行槽，只检查提交结果
+	r.jobs.slots <- struct{}{}
+	defer func() { <-r.jobs.slots }()
+	sweep, runIDs, err := r.SubmitSweep(ctx, ExperimentSweepRequest{Seeds: []int64{1, 2}, RunsPerGroup: 2, Groups: []string{"A", "D"}})
+	if err != nil {
+		t.Fatalf("submit: %v", err)
+	}
+	if sweep.GlobalPool != GlobalPoolSnapshot || sweep.GlobalPoolSnapshotID == 0 {
+		t.Fatalf("sweep should default to a start snapshot: %+v", sweep)
+	}
+	snap, err := r.store.Snapshots.Get(ctx, sweep.GlobalPoolSnapshotID)
+	if err != nil || snap.MemoryCount != 1 {
+		t.Fatalf("start snapshot should copy the shared pool: %v %+v", err, snap)
+	}
+	for _, id := range runIDs {
+		run, err := r.store.Runs.Get(ctx, id)
+		if err != nil || run.GlobalPool != GlobalPoolSnapshot || run.BaseSnapshotID != snap.ID {
+			t.Fatalf("run %d should import the start snapshot: %v %+v", id, err, run)
+		}
+	}
+	if err := r.CancelSweep(ctx, sweep.ID); err != nil {
+		t.Fatalf("cancel: %v", err)
+	}
+}
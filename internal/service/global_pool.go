@@ -0,0 +1,174 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"mem-test/internal/model"
+	"mem-test/internal/repository"
+)
+
+// ErrInvalidGlobalPool global_pool 取值或快照参数不合法
+var ErrInvalidGlobalPool = errors.New("无效的全局池配置")
+
+// run 的全局池来源
+const (
+	GlobalPoolLive     = "live"     // 共享全局池（默认；内容随历史 run 变化）
+	GlobalPoolSnapshot = "snapshot" // 从指定快照导入到本 run 的隔离全局池（“有先验经验”）
+	GlobalPoolEmpty    = "empty"    // 本 run 的隔离全局池从空开始（冷启动）
+)
+
+// validateGlobalPool 全局池参数校验（在 normalizeRunRequest 之后调用）
+func validateGlobalPool(req ExperimentRunRequest) error {
+	switch req.GlobalPool {
+	case GlobalPoolLive, GlobalPoolEmpty:
+		if req.GlobalPoolSnapshotID != 0 {
+			return fmt.Errorf("%w: global_pool=%s 时不能指定 global_pool_snapshot_id", ErrInvalidGlobalPool, req.GlobalPool)
+		}
+	case GlobalPoolSnapshot:
+		if req.GlobalPoolSnapshotID == 0 {
+			return fmt.Errorf("%w: global_pool=snapshot 需要 global_pool_snapshot_id", ErrInvalidGlobalPool)
+		}
+	default:
+		return fmt.Errorf("%w: global_pool 不合法: %q", ErrInvalidGlobalPool, req.GlobalPool)
+	}
+	return nil
+}
+
+// runPoolID run 使用的全局池：共享池为 0，隔离池为 run_id
+func runPoolID(runID uint, globalPool string) uint {
+	if globalPool == GlobalPoolSnapshot || globalPool == GlobalPoolEmpty {
+		return runID
+	}
+	return 0
+}
+
+// CreateGlobalPoolSnapshot 拷贝指定全局池（0 为共享池）的当前内容为一个新快照
+func CreateGlobalPoolSnapshot(ctx context.Context, store *repository.Store, poolRunID, sourceRunID, parentSnapshotID uint, note string) (*model.GlobalPoolSnapshot, error) {
+	memories, err := store.Memories.ListPool(ctx, poolRunID)
+	if err != nil {
+		return nil, fmt.Errorf("查询全局池失败: %w", err)
+	}
+
+	snap := &model.GlobalPoolSnapshot{
+		SourceRunID:      sourceRunID,
+		PoolRunID:        poolRunID,
+		ParentSnapshotID: parentSnapshotID,
+		MemoryCount:      len(memories),
+		Note:             note,
+	}
+	items := make([]model.GlobalPoolSnapshotItem, 0, len(memories))
+	for _, m := range memories {
+		items = append(items, model.GlobalPoolSnapshotItem{
+			SourceMemoryID: m.ID,
+			Trigger:        m.Trigger,
+			TriggerKey:     m.TriggerKey,
+			Lesson:         m.Lesson,
+			DerivedFrom:    m.DerivedFrom,
+			ApplyTo:        m.ApplyTo,
+			Confidence:     m.Confidence,
+			Version:        m.Version,
+			UseCount:       m.UseCount,
+			FailureCount:   m.FailureCount,
+			LastVerifiedAt: m.LastVerifiedAt,
+			Deprecated:     m.Deprecated,
+		})
+	}
+	if err := store.Snapshots.Create(ctx, snap, items); err != nil {
+		return nil, fmt.Errorf("创建全局池快照失败: %w", err)
+	}
+	log.Printf("[global_pool] snapshot=%d pool_run_id=%d source_run_id=%d memories=%d", snap.ID, poolRunID, sourceRunID, snap.MemoryCount)
+	return snap, nil
+}
+
+// GetGlobalPoolSnapshot 快照元数据 + 全部条目
+func GetGlobalPoolSnapshot(ctx context.Context, store *repository.Store, id uint) (*model.GlobalPoolSnapshot, []model.GlobalPoolSnapshotItem, error) {
+	snap, err := store.Snapshots.Get(ctx, id)
+	if err != nil {
+		return nil, nil, fmt.Errorf("查询全局池快照失败: %w", err)
+	}
+	items, err := store.Snapshots.Items(ctx, id)
+	if err != nil {
+		return nil, nil, fmt.Errorf("查询快照条目失败: %w", err)
+	}
+	return snap, items, nil
+}
+
+// ListGlobalPoolSnapshots 按创建时间倒序列出快照
+func ListGlobalPoolSnapshots(ctx context.Context, store *repository.Store, limit int) ([]model.GlobalPoolSnapshot, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	snaps, err := store.Snapshots.List(ctx, limit)
+	if err != nil {
+		return nil, fmt.Errorf("查询全局池快照失败: %w", err)
+	}
+	return snaps, nil
+}
+
+// prepareRunPool 初始化 run 的隔离全局池：snapshot 模式把快照条目导入为 pool_run_id=run_id 的全局记录。
+// 幂等：隔离池已有记录（resume）时不重复导入，保留 run 内已固化的新规则。
+func prepareRunPool(ctx context.Context, store *repository.Store, runID uint, globalPool string, snapshotID uint) error {
+	if globalPool != GlobalPoolSnapshot {
+		return nil
+	}
+	existing, err := store.Memories.CountPool(ctx, runID)
+	if err != nil {
+		return fmt.Errorf("查询隔离全局池失败: %w", err)
+	}
+	if existing > 0 {
+		return nil
+	}
+	_, items, err := GetGlobalPoolSnapshot(ctx, store, snapshotID)
+	if err != nil {
+		return err
+	}
+	if len(items) == 0 {
+		return nil
+	}
+	memories := make([]model.Memory, 0, len(items))
+	for _, it := range items {
+		memories = append(memories, model.Memory{
+			RunID:          0,
+			PoolRunID:      runID,
+			Trigger:        it.Trigger,
+			TriggerKey:     it.TriggerKey,
+			Lesson:         it.Lesson,
+			DerivedFrom:    it.DerivedFrom,
+			ApplyTo:        it.ApplyTo,
+			Confidence:     it.Confidence,
+			Version:        it.Version,
+			UseCount:       it.UseCount,
+			FailureCount:   it.FailureCount,
+			LastVerifiedAt: it.LastVerifiedAt,
+			Deprecated:     it.Deprecated,
+			SourceMemoryID: it.SourceMemoryID,
+		})
+	}
+	if err := store.Memories.CreateBatch(ctx, memories); err != nil {
+		return fmt.Errorf("导入全局池快照失败: %w", err)
+	}
+	linkImportedVersions(ctx, store, memories)
+	log.Printf("[global_pool] run=%d imported snapshot=%d memories=%d", runID, snapshotID, len(memories))
+	return nil
+}
+
+// linkImportedVersions 快照条目按 id 升序导入，同一归并键的版本依次递增：把每条链接到池内上一版本。
+// 谱系只用于追溯，链接失败不影响实验
+func linkImportedVersions(ctx context.Context, store *repository.Store, memories []model.Memory) {
+	prev := map[string]*model.Memory{}
+	for i := range memories {
+		m := &memories[i]
+		key := m.ApplyTo + "|" + m.TriggerKey
+		if p, ok := prev[key]; ok && p.Version < m.Version {
+			if err := store.Memories.SetParent(ctx, m.ID, p.ID); err != nil {
+				log.Printf("[global_pool] link imported memory failed memory_id=%d parent_id=%d err=%v", m.ID, p.ID, err)
+			} else {
+				m.ParentID = p.ID
+			}
+		}
+		prev[key] = m
+	}
+}
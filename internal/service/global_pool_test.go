@@ -0,0 +1,36 @@
+package service
+
+import (
+	"errors"
+	"testing"
+)
+
+// TestGlobalPoolConfig 指定快照 ID 默认进入 snapshot 模式；隔离池以 run_id 作为 pool_run_id
+func TestGlobalPoolConfig(t *testing.T) {
+	req := normalizeRunRequest(ExperimentRunRequest{Seed: 1})
+	if req.GlobalPool != GlobalPoolLive {
+		t.Fatalf("expected live pool by default, got %q", req.GlobalPool)
+	}
+	req = normalizeRunRequest(ExperimentRunRequest{Seed: 1, GlobalPoolSnapshotID: 3})
+	if req.GlobalPool != GlobalPoolSnapshot {
+		t.Fatalf("expected snapshot pool when snapshot id is set, got %q", req.GlobalPool)
+	}
+	if err := validateGlobalPool(req); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	bad := []ExperimentRunRequest{
+		{GlobalPool: GlobalPoolSnapshot},
+		{GlobalPool: GlobalPoolEmpty, GlobalPoolSnapshotID: 3},
+		{GlobalPool: "shared"},
+	}
+	for _, r := range bad {
+		if err := validateGlobalPool(r); !errors.Is(err, ErrInvalidGlobalPool) {
+			t.Fatalf("expected ErrInvalidGlobalPool for %+v, got %v", r, err)
+		}
+	}
+
+	if runPoolID(7, GlobalPoolLive) != 0 || runPoolID(7, GlobalPoolEmpty) != 7 || runPoolID(7, GlobalPoolSnapshot) != 7 {
+		t.Fatalf("unexpected pool ids")
+	}
+}
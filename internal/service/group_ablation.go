@@ -0,0 +1,94 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidAblation 消融开关与组策略不兼容（如对不做全局固化的组设置 validate_before_consolidate）
+var ErrInvalidAblation = errors.New("无效的消融开关")
+
+// GroupFeatureFlags 单组组件开关（用于消融实验）；nil 表示沿用组策略默认值
+type GroupFeatureFlags struct {
+	SelfCheck                 *bool `json:"self_check,omitempty"`
+	Rerank                    *bool `json:"rerank,omitempty"`
+	STMLimit                  *int  `json:"stm_limit,omitempty"`
+	MemOS                     *bool `json:"memos,omitempty"`
+	Bandit                    *bool `json:"bandit,omitempty"`
+	ValidateBeforeConsolidate *bool `json:"validate_before_consolidate,omitempty"`
+	ChangeDetection           *bool `json:"change_detection,omitempty"`
+}
+
+// GroupFeatures 某组在本次 run 中实际生效的组件（组策略默认值 + 消融覆盖）
+type GroupFeatures struct {
+	SelfCheck                 bool `json:"self_check"`
+	Rerank                    bool `json:"rerank"`
+	STMLimit                  int  `json:"stm_limit"`
+	MemOS                     bool `json:"memos"`
+	Bandit                    bool `json:"bandit"`
+	ValidateBeforeConsolidate bool `json:"validate_before_consolidate"`
+	ChangeDetection           bool `json:"change_detection"`
+}
+
+// Features 组策略中可消融的组件
+func (g GroupStrategy) Features() GroupFeatures {
+	return GroupFeatures{
+		SelfCheck:                 g.SelfCheck,
+		Rerank:                    g.Rerank,
+		STMLimit:                  g.STMLimit,
+		MemOS:                     g.MemOS,
+		Bandit:                    g.Bandit,
+		ValidateBeforeConsolidate: g.Reflection == ReflectionValidated,
+		ChangeDetection:           g.ChangeDetection,
+	}
+}
+
+// consolidates 是否把反思产物固化到全局池（只有这类组的 validate_before_consolidate 有意义）
+func (g GroupStrategy) consolidates() bool {
+	return g.Reflection == ReflectionGlobal || g.Reflection == ReflectionValidated
+}
+
+// Apply 在组策略上叠加消融开关；validate_before_consolidate 在 global/validated 两种反思策略之间切换
+func (f GroupFeatureFlags) Apply(g GroupStrategy) (GroupStrategy, error) {
+	setBoolIfPresent(&g.SelfCheck, f.SelfCheck)
+	setBoolIfPresent(&g.Rerank, f.Rerank)
+	setBoolIfPresent(&g.MemOS, f.MemOS)
+	setBoolIfPresent(&g.Bandit, f.Bandit)
+	setBoolIfPresent(&g.ChangeDetection, f.ChangeDetection)
+	if f.STMLimit != nil {
+		if *f.STMLimit < 0 {
+			return g, fmt.Errorf("%w: 组 %s 的 stm_limit 不能为负数", ErrInvalidAblation, g.Name)
+		}
+		g.STMLimit = *f.STMLimit
+	}
+	if f.ValidateBeforeConsolidate != nil {
+		if !g.consolidates() {
+			return g, fmt.Errorf("%w: 组 %s 不做全局固化，validate_before_consolidate 无效", ErrInvalidAblation, g.Name)
+		}
+		g.Reflection = ReflectionGlobal
+		if *f.ValidateBeforeConsolidate {
+			g.Reflection = ReflectionValidated
+		}
+	}
+	return g, nil
+}
+
+// ResolveRunStrategies 计算本次 run 各组实际生效的策略；消融开关只能作用于参与本次 run 的组
+func (r *GroupRegistry) ResolveRunStrategies(groups []string, ablations map[string]GroupFeatureFlags) (map[string]GroupStrategy, error) {
+	out := make(map[string]GroupStrategy, len(groups))
+	for _, g := range groups {
+		out[g] = r.Resolve(g)
+	}
+	for g, flags := range ablations {
+		base, ok := out[g]
+		if !ok {
+			return nil, fmt.Errorf("%w: 消融开关指定的组 %s 不在本次 run 的 groups 中", ErrUnknownGroup, g)
+		}
+		st, err := flags.Apply(base)
+		if err != nil {
+			return nil, err
+		}
+		out[g] = st
+	}
+	return out, nil
+}
@@ -0,0 +1,297 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"mem-test/internal/config"
+)
+
+// ErrUnknownGroup 实验组未注册（既不是内置 A–F，也没有在配置 groups 段定义）
+var ErrUnknownGroup = errors.New("未知的实验组")
+
+// 检索方式
+const (
+	RetrievalNone   = "none"   // 不使用任何记忆
+	RetrievalLogs   = "logs"   // 检索本组历史已判对案例（不做规则抽象）
+	RetrievalMemory = "memory" // 检索抽象规则记忆
+)
+
+// 检索范围
+const (
+	ScopeRun       = "run"        // 严格 run 隔离
+	ScopeRunGlobal = "run_global" // 本 run + 全局中期记忆池（run_id=0 且 global 前缀）
+)
+
+// 判错后的反思/固化策略
+const (
+	ReflectionNone      = "none"      // 不反思
+	ReflectionRun       = "run"       // 反思写入本 run 记忆
+	ReflectionGlobal    = "global"    // 反思 + 固化到全局记忆池
+	ReflectionValidated = "validated" // 反思 + 用近期任务验证通过后再固化到全局
+)
+
+// groupNameMaxLen tasks.group_type 为 varchar(10)
+const groupNameMaxLen = 10
+
+// GroupStrategy 一个实验组的完整行为定义：检索什么、检索多少、是否重排/自检、短期记忆、
+// bandit 选择与变更检测，以及判错后的反思策略。A–F 为内置组，新组可在配置 groups 段声明。
+type GroupStrategy struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Retrieval   string `json:"retrieval"`
+	Scope       string `json:"scope"`
+	// 候选记忆条数（bandit 组需要更多候选做竞争）
+	MemoryLimit int `json:"memory_limit"`
+	// 按输入相关性重排（优先阈值更接近当前 points 的规则）
+	Rerank bool `json:"rerank"`
+	// 两阶段：先答题，再结合已验证规则自检纠错
+	SelfCheck bool `json:"self_check"`
+	// 短期记忆：注入本 run 最近 N 条判错反馈（0 关闭）
+	STMLimit int `json:"stm_limit"`
+	// 本地记忆为空/很弱时回退 MemOS 外部长期记忆
+	MemOS bool `json:"memos"`
+	// UCB 从候选中选 1 条主规则，判错后短期封禁
+	Bandit bool `json:"bandit"`
+	// 连续判错进入新 epoch 并开启探索期
+	ChangeDetection bool   `json:"change_detection"`
+	Reflection      string `json:"reflection"`
+	// 是否为内置组（A–F）
+	Builtin bool `json:"builtin"`
+	// 评估阶段：只读检索，不更新记忆使用计数，任务标记为 eval（runner 运行时设置，不可配置）
+	Frozen bool `json:"-"`
+	// 全局池：0 为共享全局池，>0 为该 run 的隔离全局池（runner 按 global_pool 设置，不可配置）
+	PoolRunID uint `json:"-"`
+}
+
+// UsesMemory 是否需要检索（A 组为 false）
+func (g GroupStrategy) UsesMemory() bool {
+	return g.Retrieval != RetrievalNone
+}
+
+// Reflects 判错后是否触发反思
+func (g GroupStrategy) Reflects() bool {
+	return g.Reflection != ReflectionNone
+}
+
+// Adaptive 是否维护 bandit/变更检测的 run 内状态（F 组）
+func (g GroupStrategy) Adaptive() bool {
+	return g.Bandit || g.ChangeDetection
+}
+
+func (g GroupStrategy) validate() error {
+	if g.Name == "" {
+		return errors.New("组名不能为空")
+	}
+	if len(g.Name) > groupNameMaxLen {
+		return fmt.Errorf("组名过长（最多 %d 个字符）: %s", groupNameMaxLen, g.Name)
+	}
+	switch g.Retrieval {
+	case RetrievalNone, RetrievalLogs, RetrievalMemory:
+	default:
+		return fmt.Errorf("组 %s 的 retrieval 不合法: %q", g.Name, g.Retrieval)
+	}
+	switch g.Scope {
+	case ScopeRun, ScopeRunGlobal:
+	default:
+		return fmt.Errorf("组 %s 的 scope 不合法: %q", g.Name, g.Scope)
+	}
+	switch g.Reflection {
+	case ReflectionNone, ReflectionRun, ReflectionGlobal, ReflectionValidated:
+	default:
+		return fmt.Errorf("组 %s 的 reflection 不合法: %q", g.Name, g.Reflection)
+	}
+	if g.MemoryLimit < 0 || g.STMLimit < 0 {
+		return fmt.Errorf("组 %s 的 memory_limit/stm_limit 不能为负数", g.Name)
+	}
+	return nil
+}
+
+// builtinGroupStrategies 内置 A–F（与论文实验设计一致，不允许被配置覆盖）
+func builtinGroupStrategies() []GroupStrategy {
+	return []GroupStrategy{
+		{
+			Name: "A", Description: "无记忆基线",
+			Retrieval: RetrievalNone, Scope: ScopeRun, MemoryLimit: 0, Reflection: ReflectionNone,
+		},
+		{
+			Name: "B", Description: "检索历史正确案例（日志记忆）",
+			Retrieval: RetrievalLogs, Scope: ScopeRun, MemoryLimit: 3, Reflection: ReflectionNone,
+		},
+		{
+			Name: "C", Description: "反思 → 抽象规则记忆（run 内）",
+			Retrieval: RetrievalMemory, Scope: ScopeRun, MemoryLimit: 5, Reflection: ReflectionRun,
+		},
+		{
+			Name: "D", Description: "跨 run 中期记忆池 + 短期纠错信号 + MemOS",
+			Retrieval: RetrievalMemory, Scope: ScopeRunGlobal, MemoryLimit: 5, STMLimit: 2, MemOS: true,
+			Reflection: ReflectionGlobal,
+		},
+		{
+			Name: "E", Description: "D + 输入相关重排 + 两阶段自检 + 验证后固化",
+			Retrieval: RetrievalMemory, Scope: ScopeRunGlobal, MemoryLimit: 5, Rerank: true, SelfCheck: true,
+			STMLimit: 3, MemOS: true, Reflection: ReflectionValidated,
+		},
+		{
+			Name: "F", Description: "E + 变更检测 + bandit 候选竞争",
+			Retrieval: RetrievalMemory, Scope: ScopeRunGlobal, MemoryLimit: 12, SelfCheck: true,
+			STMLimit: 4, MemOS: true, Bandit: true, ChangeDetection: true, Reflection: ReflectionValidated,
+		},
+	}
+}
+
+// GroupRegistry 实验组注册表；按注册顺序保存（内置 A–F 在前，配置中的组按声明顺序在后）
+type GroupRegistry struct {
+	mu     sync.RWMutex
+	groups map[string]GroupStrategy
+	order  []string
+}
+
+// NewGroupRegistry 只包含内置 A–F
+func NewGroupRegistry() *GroupRegistry {
+	r := &GroupRegistry{groups: map[string]GroupStrategy{}}
+	for _, g := range builtinGroupStrategies() {
+		g.Builtin = true
+		r.groups[g.Name] = g
+		r.order = append(r.order, g.Name)
+	}
+	return r
+}
+
+// NewGroupRegistryFromConfig 内置 A–F + 配置 groups 段声明的新组（可用 base 继承已有组再覆盖部分字段）
+func NewGroupRegistryFromConfig(cfgs []config.GroupConfig) (*GroupRegistry, error) {
+	r := NewGroupRegistry()
+	for _, c := range cfgs {
+		g := GroupStrategy{Retrieval: RetrievalMemory, Scope: ScopeRun, MemoryLimit: 5, Reflection: ReflectionRun}
+		if c.Base != "" {
+			base, ok := r.Get(c.Base)
+			if !ok {
+				return nil, fmt.Errorf("组 %s 的 base 未定义: %w: %s", c.Name, ErrUnknownGroup, c.Base)
+			}
+			g = base
+		}
+		g.Name = c.Name
+		g.Builtin = false
+		if c.Description != "" {
+			g.Description = c.Description
+		}
+		if c.Retrieval != "" {
+			g.Retrieval = c.Retrieval
+		}
+		if c.Scope != "" {
+			g.Scope = c.Scope
+		}
+		if c.Reflection != "" {
+			g.Reflection = c.Reflection
+		}
+		setIntIfPresent(&g.MemoryLimit, c.MemoryLimit)
+		setIntIfPresent(&g.STMLimit, c.STMLimit)
+		setBoolIfPresent(&g.Rerank, c.Rerank)
+		setBoolIfPresent(&g.SelfCheck, c.SelfCheck)
+		setBoolIfPresent(&g.MemOS, c.MemOS)
+		setBoolIfPresent(&g.Bandit, c.Bandit)
+		setBoolIfPresent(&g.ChangeDetection, c.ChangeDetection)
+		if err := r.Register(g); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+func setIntIfPresent(dst *int, v *int) {
+	if v != nil {
+		*dst = *v
+	}
+}
+
+func setBoolIfPresent(dst *bool, v *bool) {
+	if v != nil {
+		*dst = *v
+	}
+}
+
+// Register 注册新组；组名已存在时报错（内置组不可覆盖，需要变体请用新组名 + base）
+func (r *GroupRegistry) Register(g GroupStrategy) error {
+	if err := g.validate(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.groups[g.Name]; ok {
+		return fmt.Errorf("组 %s 已存在", g.Name)
+	}
+	r.groups[g.Name] = g
+	r.order = append(r.order, g.Name)
+	return nil
+}
+
+func (r *GroupRegistry) Get(name string) (GroupStrategy, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	g, ok := r.groups[name]
+	return g, ok
+}
+
+// Resolve 未注册的组按 C 组行为处理（兼容 /api/tasks/execute 传入任意 group_type 的旧用法）
+func (r *GroupRegistry) Resolve(name string) GroupStrategy {
+	if g, ok := r.Get(name); ok {
+		return g
+	}
+	g, _ := r.Get("C")
+	g.Name = name
+	g.Reflection = ReflectionNone
+	g.Builtin = false
+	return g
+}
+
+// Names 按注册顺序返回全部组名
+func (r *GroupRegistry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]string(nil), r.order...)
+}
+
+// List 按注册顺序返回全部组定义
+func (r *GroupRegistry) List() []GroupStrategy {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make([]GroupStrategy, 0, len(r.order))
+	for _, name := range r.order {
+		out = append(out, r.groups[name])
+	}
+	return out
+}
+
+// Validate 检查实验请求中的组是否都已注册
+func (r *GroupRegistry) Validate(groups []string) error {
+	for _, g := range groups {
+		if _, ok := r.Get(g); !ok {
+			return fmt.Errorf("%w: %s", ErrUnknownGroup, g)
+		}
+	}
+	return nil
+}
+
+// Ordered 按注册顺序排列给定的组（用于生成稳定的两两比较键，如 C_vs_A）
+func (r *GroupRegistry) Ordered(groups []string) []string {
+	want := map[string]bool{}
+	for _, g := range groups {
+		want[g] = true
+	}
+	out := make([]string, 0, len(groups))
+	for _, name := range r.Names() {
+		if want[name] {
+			out = append(out, name)
+			delete(want, name)
+		}
+	}
+	// 未注册的组保持原顺序追加在后
+	for _, g := range groups {
+		if want[g] {
+			out = append(out, g)
+			delete(want, g)
+		}
+	}
+	return out
+}
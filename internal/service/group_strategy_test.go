@@ -0,0 +1,122 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"mem-test/internal/config"
+	"mem-test/internal/model"
+	"mem-test/internal/repository"
+)
+
+// TestGroupRegistry_FromConfig 配置新组：base 继承 + 显式字段覆盖；内置组不可覆盖
+func TestGroupRegistry_FromConfig(t *testing.T) {
+	off := false
+	limit := 8
+	reg, err := NewGroupRegistryFromConfig([]config.GroupConfig{
+		{Name: "G", Base: "E", SelfCheck: &off},
+		{Name: "H", Base: "F", ChangeDetection: &off, MemoryLimit: &limit},
+	})
+	if err != nil {
+		t.Fatalf("build registry failed: %v", err)
+	}
+	g, ok := reg.Get("G")
+	if !ok || g.SelfCheck || !g.Rerank || g.Reflection != ReflectionValidated || g.Scope != ScopeRunGlobal || g.Builtin {
+		t.Fatalf("unexpected G: %+v", g)
+	}
+	h, _ := reg.Get("H")
+	if !h.Bandit || h.ChangeDetection || h.MemoryLimit != 8 || !h.Adaptive() {
+		t.Fatalf("unexpected H: %+v", h)
+	}
+	if got := reg.Ordered([]string{"H", "C", "A", "G"}); len(got) != 4 || got[0] != "A" || got[1] != "C" || got[2] != "G" || got[3] != "H" {
+		t.Fatalf("unexpected order: %v", got)
+	}
+	if err := reg.Validate([]string{"A", "X"}); !errors.Is(err, ErrUnknownGroup) {
+		t.Fatalf("expected unknown group error, got %v", err)
+	}
+
+	if _, err := NewGroupRegistryFromConfig([]config.GroupConfig{{Name: "E", Base: "C"}}); err == nil {
+		t.Fatalf("builtin group should not be overridable")
+	}
+	if _, err := NewGroupRegistryFromConfig([]config.GroupConfig{{Name: "G", Base: "Z"}}); !errors.Is(err, ErrUnknownGroup) {
+		t.Fatalf("expected unknown base error, got %v", err)
+	}
+	if _, err := NewGroupRegistryFromConfig([]config.GroupConfig{{Name: "G", Retrieval: "vector"}}); err == nil {
+		t.Fatalf("invalid retrieval should be rejected")
+	}
+}
+
+// TestUpdateFState_ChangeDetectionToggle 关闭变更检测后连续判错不切换 epoch，但 bandit 封禁仍生效
+func TestUpdateFState_ChangeDetectionToggle(t *testing.T) {
+	off := false
+	reg, err := NewGroupRegistryFromConfig([]config.GroupConfig{{Name: "H", Base: "F", ChangeDetection: &off}})
+	if err != nil {
+		t.Fatalf("build registry failed: %v", err)
+	}
+	agent := NewAgentService(repository.NewMemoryStore(), nil, nil, "")
+	agent.groups = reg
+
+	ctx := context.Background()
+	const runID, taskType = uint(3), "lottery"
+	for i := 0; i < 4; i++ {
+		for _, g := range []string{"F", "H"} {
+			task := &model.Task{ID: uint(i + 1), RunID: runID, GroupType: g, MemoryIDs: "21"}
+			agent.SetFCurrentRound(runID, taskType, g, i)
+			agent.UpdateFStateAfterJudge(ctx, runID, taskType, reg.Resolve(g), task, &model.Feedback{Type: "incorrect"}, i)
+		}
+	}
+	if e := agent.FEpoch(runID, taskType, "F"); e < 2 {
+		t.Fatalf("F should switch epoch, got %d", e)
+	}
+	if e := agent.FEpoch(runID, taskType, "H"); e != 1 {
+		t.Fatalf("H without change detection should stay in epoch 1, got %d", e)
+	}
+	if st := agent.fStates[agent.fKey(runID, taskType, "H")]; st.banUntil[21] != 5 || st.stats[21].losses != 4 {
+		t.Fatalf("H bandit state not updated: ban=%v stats=%+v", st.banUntil, st.stats[21])
+	}
+}
+
+// TestResolveRunStrategies_Ablations 消融开关叠加到组策略上，并在报告中标出被覆盖的组件
+func TestResolveRunStrategies_Ablations(t *testing.T) {
+	off, on, stm := false, true, 0
+	reg := NewGroupRegistry()
+	ablations := map[string]GroupFeatureFlags{
+		"E": {SelfCheck: &off, ValidateBeforeConsolidate: &off, STMLimit: &stm},
+		"D": {ValidateBeforeConsolidate: &on},
+	}
+	strategies, err := reg.ResolveRunStrategies([]string{"A", "D", "E", "F"}, ablations)
+	if err != nil {
+		t.Fatalf("resolve failed: %v", err)
+	}
+	e := strategies["E"]
+	if e.SelfCheck || e.Reflection != ReflectionGlobal || e.STMLimit != 0 || !e.Rerank {
+		t.Fatalf("unexpected E: %+v", e)
+	}
+	if strategies["D"].Reflection != ReflectionValidated {
+		t.Fatalf("D should validate before consolidate: %+v", strategies["D"])
+	}
+	if f := strategies["F"]; !f.SelfCheck || !f.Bandit {
+		t.Fatalf("F should keep defaults: %+v", f)
+	}
+
+	if _, err := reg.ResolveRunStrategies([]string{"A", "C"}, map[string]GroupFeatureFlags{"E": {Rerank: &on}}); !errors.Is(err, ErrUnknownGroup) {
+		t.Fatalf("ablation on absent group should fail, got %v", err)
+	}
+	if _, err := reg.ResolveRunStrategies([]string{"C"}, map[string]GroupFeatureFlags{"C": {ValidateBeforeConsolidate: &on}}); !errors.Is(err, ErrInvalidAblation) {
+		t.Fatalf("validate on non-consolidating group should fail, got %v", err)
+	}
+
+	result := &ExperimentRunResult{
+		Groups:    []string{"D", "E"},
+		Stats:     map[string]GroupStats{"D": {ErrorRate: 0.2}, "E": {ErrorRate: 0.1}},
+		Ablations: ablations,
+		Features:  map[string]GroupFeatures{"D": strategies["D"].Features(), "E": e.Features()},
+	}
+	var b strings.Builder
+	renderAblationTable(&b, result)
+	if !strings.Contains(b.String(), "| E | off* | on | 0* | on | off | off* | off | 0.100 |") {
+		t.Fatalf("unexpected ablation table:\n%s", b.String())
+	}
+}
@@ -0,0 +1,374 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	CassetteModeOff    = "off"
+	CassetteModeRecord = "record"
+	CassetteModeReplay = "replay"
+)
+
+// LLMCassette 大模型调用录制/回放（类似 VCR cassette）
+//
+//   - record：每次调用的 prompt/inputs/answer/usage 追加写入 outputs/llm_cassette_run_<run_id>.jsonl
+//   - replay：从指定 cassette 文件按 (group, round, prompt_hash, seq) 取回答案，不访问网络；
+//     prompt 不一致时默认返回未命中错误；allowLoose 开启时才退化为按 (group, round, pos) 位置回放，并计入 LooseHits
+//
+// 录制文件、调用序号与回放表按 run 各自保存（BeginRun/EndRun）；调用归属的 run/group/round 由
+// ExperimentRunner 通过 WithScope 放进 ctx，多个 run 并发执行时互不干扰。
+// 用途：修复 stats.go / conclusion.go 后，用同一 seed 重放历史 run，逐位复现并重算统计，无需再次付费调用。
+type LLMCassette struct {
+	mode       string
+	dir        string
+	replayPath string
+	allowLoose bool
+
+	mu       sync.Mutex
+	sessions map[uint]*cassetteSession
+}
+
+// cassetteSession 一个 run 的录制/回放状态；ctx 未带作用域的调用（非实验，run_id=0）归入 run 0
+type cassetteSession struct {
+	runID   uint
+	file    *os.File
+	path    string
+	seq     map[string]int
+	entries map[string]cassetteEntry
+	// 宽松匹配：prompt 不一致时按 (group, round, pos) 回放（仅 allowLoose）
+	loose map[string]cassetteEntry
+	// 本 run 中按位置回放的次数
+	looseHits int
+}
+
+// cassetteScope 一次调用归属的 run/group/round（用于 cassette key）
+type cassetteScope struct {
+	runID uint
+	group string
+	round int
+}
+
+type cassetteScopeKey struct{}
+
+type cassetteEntry struct {
+	RunID      uint                   `json:"run_id"`
+	Group      string                 `json:"group"`
+	Round      int                    `json:"round"`
+	PromptHash string                 `json:"prompt_hash"`
+	Seq        int                    `json:"seq"`
+	Pos        int                    `json:"pos"`
+	Provider   string                 `json:"provider"`
+	Prompt     string                 `json:"prompt"`
+	Inputs     map[string]interface{} `json:"inputs,omitempty"`
+	Answer     string                 `json:"answer"`
+	Usage      LLMUsage               `json:"usage"`
+	Error      string                 `json:"error,omitempty"`
+	RecordedAt time.Time              `json:"recorded_at"`
+}
+
+// NewLLMCassette mode 为空/off 时返回 nil（调用方无需判空，方法均兼容 nil 接收者）；
+// allowLoose 仅对 replay 生效：prompt 不一致时按位置回放，回放出的 run 不再保证逐位复现
+func NewLLMCassette(mode, dir, replayPath string, allowLoose bool) (*LLMCassette, error) {
+	mode = strings.ToLower(strings.TrimSpace(mode))
+	switch mode {
+	case "", CassetteModeOff:
+		return nil, nil
+	case CassetteModeRecord:
+	case CassetteModeReplay:
+		if strings.TrimSpace(replayPath) == "" {
+			return nil, fmt.Errorf("cassette replay 模式必须配置 replay_path")
+		}
+	default:
+		return nil, fmt.Errorf("未知的 cassette mode: %s", mode)
+	}
+	if strings.TrimSpace(dir) == "" {
+		dir = "outputs"
+	}
+	return &LLMCassette{
+		mode:       mode,
+		dir:        dir,
+		replayPath: replayPath,
+		allowLoose: allowLoose,
+		sessions:   map[uint]*cassetteSession{},
+	}, nil
+}
+
+func (c *LLMCassette) Mode() string {
+	if c == nil {
+		return CassetteModeOff
+	}
+	return c.mode
+}
+
+// Wrap 给 provider 套上录制/回放层；cassette 关闭时原样返回
+func (c *LLMCassette) Wrap(inner LLMProvider, name string) LLMProvider {
+	if c == nil {
+		return inner
+	}
+	return &cassetteProvider{cassette: c, inner: inner, name: name}
+}
+
+// BeginRun 开始一次实验 run：record 模式打开该 run 的 cassette 文件；replay 模式加载回放表并重置序号
+// 返回本次 run 对应的 cassette 文件路径（off 模式返回空串）
+func (c *LLMCassette) BeginRun(runID uint) (string, error) {
+	if c == nil {
+		return "", nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if old, ok := c.sessions[runID]; ok {
+		old.close()
+	}
+	sess := &cassetteSession{runID: runID, seq: map[string]int{}}
+	switch c.mode {
+	case CassetteModeRecord:
+		if err := sess.openRecordFile(c.dir); err != nil {
+			return "", err
+		}
+		c.sessions[runID] = sess
+		return sess.path, nil
+	case CassetteModeReplay:
+		if err := sess.load(c.replayPath); err != nil {
+			return "", err
+		}
+		c.sessions[runID] = sess
+		return c.replayPath, nil
+	}
+	return "", nil
+}
+
+// EndRun 结束 run（关闭录制文件并释放回放表）
+func (c *LLMCassette) EndRun(runID uint) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if sess, ok := c.sessions[runID]; ok {
+		sess.close()
+		delete(c.sessions, runID)
+	}
+}
+
+// LooseHits run 中 prompt 不一致、按位置回放的调用次数（未开启 allowLoose 时恒为 0）；需在 EndRun 之前读取
+func (c *LLMCassette) LooseHits(runID uint) int {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if sess, ok := c.sessions[runID]; ok {
+		return sess.looseHits
+	}
+	return 0
+}
+
+// WithScope 返回带 run/group/round 作用域的 ctx，经由该 ctx 的大模型调用按此作用域录制/回放
+func (c *LLMCassette) WithScope(ctx context.Context, runID uint, group string, round int) context.Context {
+	if c == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, cassetteScopeKey{}, cassetteScope{runID: runID, group: group, round: round})
+}
+
+func scopeFromContext(ctx context.Context) cassetteScope {
+	if sc, ok := ctx.Value(cassetteScopeKey{}).(cassetteScope); ok {
+		return sc
+	}
+	return cassetteScope{round: -1}
+}
+
+// sessionLocked 取 run 的会话；未经 BeginRun 的调用（非实验调用）按需创建，replay 时同样加载回放表
+func (c *LLMCassette) sessionLocked(runID uint) (*cassetteSession, error) {
+	if sess, ok := c.sessions[runID]; ok {
+		return sess, nil
+	}
+	sess := &cassetteSession{runID: runID, seq: map[string]int{}}
+	if c.mode == CassetteModeReplay {
+		if err := sess.load(c.replayPath); err != nil {
+			return nil, err
+		}
+	}
+	c.sessions[runID] = sess
+	return sess, nil
+}
+
+func (s *cassetteSession) close() {
+	if s.file != nil {
+		_ = s.file.Close()
+		s.file = nil
+	}
+}
+
+func (s *cassetteSession) openRecordFile(dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("创建 cassette 目录失败: %w", err)
+	}
+	s.path = filepath.Join(dir, fmt.Sprintf("llm_cassette_run_%d.jsonl", s.runID))
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("打开 cassette 文件失败: %w", err)
+	}
+	s.file = f
+	return nil
+}
+
+func (s *cassetteSession) load(replayPath string) error {
+	f, err := os.Open(replayPath)
+	if err != nil {
+		return fmt.Errorf("打开 cassette 文件失败: %w", err)
+	}
+	defer f.Close()
+
+	s.entries = map[string]cassetteEntry{}
+	s.loose = map[string]cassetteEntry{}
+	sc := bufio.NewScanner(f)
+	// prompt 可能很长，放大单行上限
+	sc.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
+		}
+		var e cassetteEntry
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			return fmt.Errorf("解析 cassette 失败: %w", err)
+		}
+		s.entries[cassetteKey(e.Provider, e.Group, e.Round, e.PromptHash, e.Seq)] = e
+		s.loose[cassetteKey(e.Provider, e.Group, e.Round, "", e.Pos)] = e
+	}
+	if err := sc.Err(); err != nil {
+		return fmt.Errorf("读取 cassette 失败: %w", err)
+	}
+	log.Printf("[cassette] run=%d loaded %d entries from %s", s.runID, len(s.entries), replayPath)
+	return nil
+}
+
+func cassetteKey(provider, group string, round int, promptHash string, seq int) string {
+	return fmt.Sprintf("%s|%s|%d|%s|%d", provider, group, round, promptHash, seq)
+}
+
+func hashPrompt(prompt string) string {
+	sum := sha256.Sum256([]byte(prompt))
+	return hex.EncodeToString(sum[:])
+}
+
+type cassetteProvider struct {
+	cassette *LLMCassette
+	inner    LLMProvider
+	name     string
+}
+
+func (p *cassetteProvider) BuildInputs(prompt, query string, fallback map[string]interface{}) map[string]interface{} {
+	return buildLLMInputs(p.inner, prompt, query, fallback)
+}
+
+func (p *cassetteProvider) Complete(ctx context.Context, prompt string, inputs map[string]interface{}) (*LLMResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	c := p.cassette
+	h := hashPrompt(prompt)
+	scope := scopeFromContext(ctx)
+	group, round := scope.group, scope.round
+
+	c.mu.Lock()
+	sess, err := c.sessionLocked(scope.runID)
+	if err != nil {
+		c.mu.Unlock()
+		return nil, err
+	}
+	// 同一 (group, round, prompt) 可能被调用多次（如 E 组两阶段），用 seq 区分
+	seqKey := cassetteKey(p.name, group, round, h, 0)
+	seq := sess.seq[seqKey]
+	sess.seq[seqKey] = seq + 1
+	// pos：同一 (group, round) 内的调用序号（宽松回放用）
+	posKey := cassetteKey(p.name, group, round, "", -1)
+	pos := sess.seq[posKey]
+	sess.seq[posKey] = pos + 1
+
+	if c.mode == CassetteModeReplay {
+		e, ok := sess.entries[cassetteKey(p.name, group, round, h, seq)]
+		if !ok && c.allowLoose {
+			e, ok = sess.loose[cassetteKey(p.name, group, round, "", pos)]
+			if ok {
+				sess.looseHits++
+				log.Printf("[cassette] prompt mismatch, replay by position run=%d provider=%s group=%s round=%d pos=%d", scope.runID, p.name, group, round, pos)
+			}
+		}
+		c.mu.Unlock()
+		if !ok {
+			return nil, fmt.Errorf("cassette 未命中: provider=%s group=%s round=%d prompt_hash=%s", p.name, group, round, h[:12])
+		}
+		if e.Error != "" {
+			return nil, fmt.Errorf("%s", e.Error)
+		}
+		return &LLMResponse{Answer: e.Answer, Usage: e.Usage}, nil
+	}
+	c.mu.Unlock()
+
+	resp, err := p.inner.Complete(ctx, prompt, inputs)
+	if err != nil && ctx.Err() != nil {
+		// 调用方取消：不录制，避免回放时把取消当成模型错误
+		return nil, err
+	}
+
+	e := cassetteEntry{
+		Group:      group,
+		Round:      round,
+		PromptHash: h,
+		Seq:        seq,
+		Pos:        pos,
+		Provider:   p.name,
+		Prompt:     prompt,
+		Inputs:     inputs,
+		RecordedAt: time.Now(),
+	}
+	if err != nil {
+		e.Error = err.Error()
+	} else {
+		e.Answer = resp.Answer
+		e.Usage = resp.Usage
+	}
+	c.record(scope.runID, e)
+	return resp, err
+}
+
+func (c *LLMCassette) record(runID uint, e cassetteEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e.RunID = runID
+	sess, err := c.sessionLocked(runID)
+	if err != nil {
+		log.Printf("[cassette] open session failed: %v", err)
+		return
+	}
+	if sess.file == nil {
+		// 非实验调用（run_id=0）也录制，落到 llm_cassette_run_0.jsonl
+		if err := sess.openRecordFile(c.dir); err != nil {
+			log.Printf("[cassette] open record file failed: %v", err)
+			return
+		}
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		log.Printf("[cassette] marshal entry failed: %v", err)
+		return
+	}
+	if _, err := sess.file.Write(append(b, '\n')); err != nil {
+		log.Printf("[cassette] write entry failed: %v", err)
+	}
+}
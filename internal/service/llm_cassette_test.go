@@ -0,0 +1,129 @@
+package service
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestLLMCassette_RecordReplay 录制后回放应逐位复现答案，且不再调用底层 provider
+func TestLLMCassette_RecordReplay(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	mock := NewMockLLMClient(7, 0.3, 0.9)
+	prompts := []string{"任务类型: lottery\n输入: {\"points\":99}", "任务类型: lottery\n输入: {\"points\":120}"}
+
+	rec, err := NewLLMCassette(CassetteModeRecord, dir, "", false)
+	if err != nil {
+		t.Fatalf("new record cassette failed: %v", err)
+	}
+	path, err := rec.BeginRun(1)
+	if err != nil {
+		t.Fatalf("begin run failed: %v", err)
+	}
+	recorded := make([]string, 0, len(prompts))
+	p := rec.Wrap(mock, "agent")
+	for i, prompt := range prompts {
+		resp, err := p.Complete(rec.WithScope(ctx, 1, "C", i), prompt, nil)
+		if err != nil {
+			t.Fatalf("record complete failed: %v", err)
+		}
+		recorded = append(recorded, resp.Answer)
+	}
+	rec.EndRun(1)
+	if path != filepath.Join(dir, "llm_cassette_run_1.jsonl") {
+		t.Fatalf("unexpected cassette path: %s", path)
+	}
+
+	rep, err := NewLLMCassette(CassetteModeReplay, dir, path, false)
+	if err != nil {
+		t.Fatalf("new replay cassette failed: %v", err)
+	}
+	if _, err := rep.BeginRun(2); err != nil {
+		t.Fatalf("begin replay failed: %v", err)
+	}
+	// inner 为 nil：回放命中时不应访问底层 provider
+	rp := rep.Wrap(nil, "agent")
+	for i, prompt := range prompts {
+		resp, err := rp.Complete(rep.WithScope(ctx, 2, "C", i), prompt, nil)
+		if err != nil {
+			t.Fatalf("replay complete failed: %v", err)
+		}
+		if resp.Answer != recorded[i] {
+			t.Fatalf("round %d: replay=%s recorded=%s", i, resp.Answer, recorded[i])
+		}
+	}
+
+	if _, err := rp.Complete(rep.WithScope(ctx, 2, "D", 0), prompts[0], nil); err == nil {
+		t.Fatalf("expected cassette miss for unrecorded group")
+	}
+
+	// prompt 不一致：默认不按位置回放
+	if _, err := rp.Complete(rep.WithScope(ctx, 2, "C", 0), prompts[0]+"\n改动", nil); err == nil {
+		t.Fatalf("prompt mismatch should miss without allow_loose")
+	}
+	if rep.LooseHits(2) != 0 {
+		t.Fatalf("loose hits without allow_loose: %d", rep.LooseHits(2))
+	}
+
+	loose, err := NewLLMCassette(CassetteModeReplay, dir, path, true)
+	if err != nil {
+		t.Fatalf("new loose cassette failed: %v", err)
+	}
+	if _, err := loose.BeginRun(3); err != nil {
+		t.Fatalf("begin loose replay failed: %v", err)
+	}
+	lp := loose.Wrap(nil, "agent")
+	resp, err := lp.Complete(loose.WithScope(ctx, 3, "C", 1), "改动后的 prompt", nil)
+	if err != nil || resp.Answer != recorded[1] {
+		t.Fatalf("allow_loose should replay by position: %v %+v", err, resp)
+	}
+	if loose.LooseHits(3) != 1 {
+		t.Fatalf("loose hits: %d", loose.LooseHits(3))
+	}
+}
+
+// TestLLMCassette_PerRunScope 两个 run 交错调用时各自写入自己的文件、各自计序号，结束一个 run 不影响另一个
+func TestLLMCassette_PerRunScope(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	rec, err := NewLLMCassette(CassetteModeRecord, dir, "", false)
+	if err != nil {
+		t.Fatalf("new record cassette failed: %v", err)
+	}
+	p := rec.Wrap(NewMockLLMClient(7, 0.3, 0.9), "agent")
+	for _, runID := range []uint{1, 2} {
+		if _, err := rec.BeginRun(runID); err != nil {
+			t.Fatalf("begin run %d: %v", runID, err)
+		}
+	}
+	if _, err := p.Complete(rec.WithScope(ctx, 1, "C", 0), "run1 round0", nil); err != nil {
+		t.Fatalf("run 1: %v", err)
+	}
+	if _, err := p.Complete(rec.WithScope(ctx, 2, "D", 5), "run2 round5", nil); err != nil {
+		t.Fatalf("run 2: %v", err)
+	}
+	rec.EndRun(2)
+	if _, err := p.Complete(rec.WithScope(ctx, 1, "C", 1), "run1 round1", nil); err != nil {
+		t.Fatalf("run 1 after run 2 ended: %v", err)
+	}
+	rec.EndRun(1)
+
+	read := func(runID string) string {
+		t.Helper()
+		b, err := os.ReadFile(filepath.Join(dir, "llm_cassette_run_"+runID+".jsonl"))
+		if err != nil {
+			t.Fatalf("read cassette %s: %v", runID, err)
+		}
+		return string(b)
+	}
+	run1, run2 := read("1"), read("2")
+	if strings.Count(run1, "\n") != 2 || !strings.Contains(run1, `"group":"C","round":1`) || strings.Contains(run1, "run2") {
+		t.Fatalf("run 1 cassette: %s", run1)
+	}
+	if strings.Count(run2, "\n") != 1 || !strings.Contains(run2, `"run_id":2,"group":"D","round":5`) {
+		t.Fatalf("run 2 cassette: %s", run2)
+	}
+}
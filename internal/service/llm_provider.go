@@ -0,0 +1,90 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"mem-test/internal/config"
+)
+
+// LLMUsage 一次调用的 token 消耗（各后端统一口径）
+type LLMUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+	// 服务端未返回（或只返回 total）时由本地估算补全
+	Estimated bool `json:"estimated,omitempty"`
+}
+
+// LLMResponse 一次调用的结果
+type LLMResponse struct {
+	Answer string   `json:"answer"`
+	Usage  LLMUsage `json:"usage"`
+	// 首 token 延迟（仅流式后端可得，其余为 0）
+	TimeToFirstToken time.Duration `json:"time_to_first_token"`
+	// 仅 Dify workflow：执行步数与服务端耗时（秒）
+	WorkflowSteps       int     `json:"workflow_steps,omitempty"`
+	WorkflowElapsedTime float64 `json:"workflow_elapsed_time,omitempty"`
+}
+
+// LLMProvider 大模型后端抽象：AgentService / ReflectionService 只依赖该接口，
+// 具体实现可以是 Dify（workflow/completion/chat），也可以是 OpenAI 兼容的本地推理服务。
+type LLMProvider interface {
+	// BuildInputs 按后端协议组装 inputs：
+	// - prompt: 完整提示词
+	// - query: 用户侧输入（Dify workflow 的 query 字段必填）
+	// - fallback: 非 workflow 模式下透传的 inputs
+	BuildInputs(prompt, query string, fallback map[string]interface{}) map[string]interface{}
+	// Complete 执行一次补全，返回答案与 token 消耗；ctx 取消时应尽快返回
+	Complete(ctx context.Context, prompt string, inputs map[string]interface{}) (*LLMResponse, error)
+}
+
+const (
+	LLMProviderDify   = "dify"
+	LLMProviderOpenAI = "openai"
+	LLMProviderMock   = "mock"
+)
+
+// buildLLMInputs 兼容 provider 为空的情况（直接返回 fallback）
+func buildLLMInputs(p LLMProvider, prompt, query string, fallback map[string]interface{}) map[string]interface{} {
+	if p == nil {
+		return fallback
+	}
+	return p.BuildInputs(prompt, query, fallback)
+}
+
+// NewLLMProvider 根据 provider 名称构造后端；difyClient 由调用方共享，避免重复创建 http.Client
+func NewLLMProvider(name string, cfg *config.Config, difyClient *DifyClient) (LLMProvider, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", LLMProviderDify:
+		if cfg.Dify.MockMode {
+			return newMockLLMFromConfig(cfg), nil
+		}
+		return difyClient, nil
+	case LLMProviderMock:
+		return newMockLLMFromConfig(cfg), nil
+	case LLMProviderOpenAI:
+		return NewOpenAIClient(
+			cfg.OpenAI.BaseURL,
+			cfg.OpenAI.APIKey,
+			cfg.OpenAI.Model,
+			cfg.OpenAI.SystemPrompt,
+			cfg.OpenAI.Temperature,
+			cfg.OpenAI.MaxTokens,
+			cfg.OpenAI.TimeoutSeconds,
+		), nil
+	default:
+		return nil, fmt.Errorf("未知的 llm provider %q（可选值: %s, %s, %s；留空等同 %s）",
+			name, LLMProviderDify, LLMProviderOpenAI, LLMProviderMock, LLMProviderDify)
+	}
+}
+
+func newMockLLMFromConfig(cfg *config.Config) *MockLLMClient {
+	obey := -1.0
+	if cfg.Dify.MockObeyMemoryRate != nil {
+		obey = *cfg.Dify.MockObeyMemoryRate
+	}
+	return NewMockLLMClient(cfg.Dify.MockSeed, cfg.Dify.MockErrorRate, obey)
+}
@@ -0,0 +1,246 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"mem-test/internal/model"
+	"mem-test/internal/repository"
+)
+
+// maxHistoryDepth 谱系最多回溯/展开的版本数（防御异常数据形成的环）
+const maxHistoryDepth = 200
+
+// maxDiffCells 逐字 LCS 的规模上限（旧文本字数 × 新文本字数），超过时整体视为替换
+const maxDiffCells = 1 << 20
+
+// MemoryVersionEntry 谱系中的一个版本
+type MemoryVersionEntry struct {
+	Memory  model.Memory `json:"memory"`
+	Deleted bool         `json:"deleted"`
+	// Children 以该版本为父版本的全部记录；多于 1 条表示出现分叉，versions 只沿版本号最高的一支展开
+	Children []uint `json:"children,omitempty"`
+	// 相对上一版本的差异（首个版本为空）
+	TriggerDiff *TextDiff `json:"trigger_diff,omitempty"`
+	LessonDiff  *TextDiff `json:"lesson_diff,omitempty"`
+}
+
+// MemoryHistory 一条记忆所在的完整演化链（按版本从旧到新）
+type MemoryHistory struct {
+	MemoryID   uint                 `json:"memory_id"`
+	TriggerKey string               `json:"trigger_key"`
+	Versions   []MemoryVersionEntry `json:"versions"`
+}
+
+// DiffOp 一段差异：equal / delete / insert
+type DiffOp struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
+
+// TextDiff 逐字差异；Inline 为 “[-删除-]{+新增+}” 形式的行内展示
+type TextDiff struct {
+	Changed bool     `json:"changed"`
+	Ops     []DiffOp `json:"ops"`
+	Inline  string   `json:"inline"`
+}
+
+// GetMemoryHistory 沿 parent_id 回溯到首个版本，再沿子版本展开到最新版本，并给出相邻版本的 trigger / lesson 差异；
+// 已软删除的版本保留在链上（deleted=true）
+func GetMemoryHistory(ctx context.Context, store *repository.Store, id uint) (*MemoryHistory, error) {
+	target, err := findMemoryUnscoped(ctx, store, id)
+	if err != nil {
+		return nil, err
+	}
+
+	chain := []model.Memory{*target}
+	seen := map[uint]bool{target.ID: true}
+	for cur := target; cur.ParentID != 0 && len(chain) < maxHistoryDepth; {
+		if seen[cur.ParentID] {
+			break
+		}
+		parent, err := findMemoryUnscoped(ctx, store, cur.ParentID)
+		if err != nil {
+			// 上一版本已被物理删除（reset）：链从现存最早的版本开始
+			break
+		}
+		seen[parent.ID] = true
+		chain = append([]model.Memory{*parent}, chain...)
+		cur = parent
+	}
+
+	children := map[uint][]uint{}
+	for cur := chain[len(chain)-1]; len(chain) < maxHistoryDepth; {
+		kids, err := store.Memories.Children(ctx, cur.ID)
+		if err != nil {
+			return nil, fmt.Errorf("查询子版本失败: %w", err)
+		}
+		children[cur.ID] = memoryIDs(kids)
+		next := latestUnseen(kids, seen)
+		if next == nil {
+			break
+		}
+		seen[next.ID] = true
+		chain = append(chain, *next)
+		cur = *next
+	}
+	// 回溯得到的版本也要标出分叉
+	for _, m := range chain {
+		if _, ok := children[m.ID]; ok {
+			continue
+		}
+		kids, err := store.Memories.Children(ctx, m.ID)
+		if err != nil {
+			return nil, fmt.Errorf("查询子版本失败: %w", err)
+		}
+		children[m.ID] = memoryIDs(kids)
+	}
+
+	out := &MemoryHistory{MemoryID: target.ID, TriggerKey: target.TriggerKey}
+	for i, m := range chain {
+		entry := MemoryVersionEntry{Memory: m, Deleted: m.DeletedAt.Valid, Children: children[m.ID]}
+		if i > 0 {
+			prev := chain[i-1]
+			entry.TriggerDiff = DiffText(prev.Trigger, m.Trigger)
+			entry.LessonDiff = DiffText(prev.Lesson, m.Lesson)
+		}
+		out.Versions = append(out.Versions, entry)
+	}
+	return out, nil
+}
+
+// findMemoryUnscoped 按 ID 取记忆（含已软删除）
+func findMemoryUnscoped(ctx context.Context, store *repository.Store, id uint) (*model.Memory, error) {
+	ms, err := store.Memories.FindByIDs(ctx, []uint{id})
+	if err != nil {
+		return nil, fmt.Errorf("查询记忆失败: %w", err)
+	}
+	if len(ms) == 0 {
+		return nil, repository.ErrNotFound
+	}
+	return &ms[0], nil
+}
+
+func memoryIDs(ms []model.Memory) []uint {
+	var ids []uint
+	for _, m := range ms {
+		ids = append(ids, m.ID)
+	}
+	return ids
+}
+
+// latestUnseen 子版本中版本号最高的一条（同版本取 id 最小）
+func latestUnseen(kids []model.Memory, seen map[uint]bool) *model.Memory {
+	var best *model.Memory
+	for i := range kids {
+		k := &kids[i]
+		if seen[k.ID] {
+			continue
+		}
+		if best == nil || k.Version > best.Version || (k.Version == best.Version && k.ID < best.ID) {
+			best = k
+		}
+	}
+	return best
+}
+
+// DiffText 逐字（rune）最长公共子序列差异，中文规则按字比较
+func DiffText(before, after string) *TextDiff {
+	a, b := []rune(before), []rune(after)
+	d := &TextDiff{Changed: before != after}
+	if !d.Changed {
+		if before != "" {
+			d.Ops = []DiffOp{{Op: "equal", Text: before}}
+		}
+		d.Inline = before
+		return d
+	}
+
+	var ops []DiffOp
+	push := func(op string, r rune) {
+		if n := len(ops); n > 0 && ops[n-1].Op == op {
+			ops[n-1].Text += string(r)
+			return
+		}
+		ops = append(ops, DiffOp{Op: op, Text: string(r)})
+	}
+
+	// 公共前后缀直接视为 equal，缩小 LCS 规模
+	pre := 0
+	for pre < len(a) && pre < len(b) && a[pre] == b[pre] {
+		pre++
+	}
+	suf := 0
+	for suf < len(a)-pre && suf < len(b)-pre && a[len(a)-1-suf] == b[len(b)-1-suf] {
+		suf++
+	}
+	for _, r := range a[:pre] {
+		push("equal", r)
+	}
+	ma, mb := a[pre:len(a)-suf], b[pre:len(b)-suf]
+	if len(ma)*len(mb) > maxDiffCells {
+		for _, r := range ma {
+			push("delete", r)
+		}
+		for _, r := range mb {
+			push("insert", r)
+		}
+	} else {
+		// lcs[i][j]：ma[i:] 与 mb[j:] 的最长公共子序列长度
+		lcs := make([][]int, len(ma)+1)
+		for i := range lcs {
+			lcs[i] = make([]int, len(mb)+1)
+		}
+		for i := len(ma) - 1; i >= 0; i-- {
+			for j := len(mb) - 1; j >= 0; j-- {
+				if ma[i] == mb[j] {
+					lcs[i][j] = lcs[i+1][j+1] + 1
+				} else if lcs[i+1][j] >= lcs[i][j+1] {
+					lcs[i][j] = lcs[i+1][j]
+				} else {
+					lcs[i][j] = lcs[i][j+1]
+				}
+			}
+		}
+		i, j := 0, 0
+		for i < len(ma) && j < len(mb) {
+			switch {
+			case ma[i] == mb[j]:
+				push("equal", ma[i])
+				i++
+				j++
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				push("delete", ma[i])
+				i++
+			default:
+				push("insert", mb[j])
+				j++
+			}
+		}
+		for ; i < len(ma); i++ {
+			push("delete", ma[i])
+		}
+		for ; j < len(mb); j++ {
+			push("insert", mb[j])
+		}
+	}
+	for _, r := range a[len(a)-suf:] {
+		push("equal", r)
+	}
+
+	var inline strings.Builder
+	for _, op := range ops {
+		switch op.Op {
+		case "delete":
+			inline.WriteString("[-" + op.Text + "-]")
+		case "insert":
+			inline.WriteString("{+" + op.Text + "+}")
+		default:
+			inline.WriteString(op.Text)
+		}
+	}
+	d.Ops = ops
+	d.Inline = inline.String()
+	return d
+}
@@ -0,0 +1,117 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"mem-test/internal/repository"
+)
+
+func TestDiffText(t *testing.T) {
+	d := DiffText("积分<100", "积分<120")
+	if !d.Changed || d.Inline != "积分<1[-0-]{+2+}0" {
+		t.Fatalf("diff: %+v", d)
+	}
+	if d := DiffText("不变", "不变"); d.Changed || d.Inline != "不变" || len(d.Ops) != 1 {
+		t.Fatalf("unchanged diff: %+v", d)
+	}
+	if d := DiffText("", "新规则"); d.Inline != "{+新规则+}" {
+		t.Fatalf("insert-only diff: %+v", d)
+	}
+}
+
+// TestMemoryHistory_Lineage run 内演化、全局池固化与快照导入都写入结构化谱系，history 从任一版本还原完整链
+func TestMemoryHistory_Lineage(t *testing.T) {
+	h := newEvolutionHarness(t)
+	ctx := context.Background()
+
+	var ids []uint
+	for _, s := range []struct{ points, threshold int }{{110, 120}, {115, 120}, {105, 100}, {106, 100}} {
+		if r := h.play(t, s.points, s.threshold); r.NewMemoryID != 0 {
+			ids = append(ids, r.NewMemoryID)
+		}
+	}
+	if len(ids) != 3 {
+		t.Fatalf("want 3 evolved versions, got %v", ids)
+	}
+
+	history, err := GetMemoryHistory(ctx, h.store, ids[1])
+	if err != nil {
+		t.Fatalf("history: %v", err)
+	}
+	if history.MemoryID != ids[1] || len(history.Versions) != 3 {
+		t.Fatalf("history should cover the whole chain: %+v", history)
+	}
+	for i, v := range history.Versions {
+		m := v.Memory
+		if m.ID != ids[i] || m.Version != i+1 || m.SourceTaskID == 0 || m.SourceFeedbackID == 0 {
+			t.Fatalf("version %d: %+v", i+1, m)
+		}
+		if i == 0 {
+			if m.ParentID != 0 || v.LessonDiff != nil {
+				t.Fatalf("first version should have no parent/diff: %+v", v)
+			}
+			continue
+		}
+		if m.ParentID != ids[i-1] || v.LessonDiff == nil || v.TriggerDiff == nil {
+			t.Fatalf("version %d should link to its predecessor with diffs: %+v", i+1, v)
+		}
+	}
+	if d := history.Versions[1].TriggerDiff; !d.Changed {
+		t.Fatalf("120 → 100 should change the trigger: %+v", d)
+	}
+
+	// 软删除的版本仍保留在链上
+	if err := h.store.Memories.Delete(ctx, ids[0]); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	history, err = GetMemoryHistory(ctx, h.store, ids[2])
+	if err != nil || len(history.Versions) != 3 || !history.Versions[0].Deleted {
+		t.Fatalf("deleted version should stay in history: %v %+v", err, history)
+	}
+	if _, err := GetMemoryHistory(ctx, h.store, 9999); err != repository.ErrNotFound {
+		t.Fatalf("unknown memory: %v", err)
+	}
+
+	// 固化到共享全局池：新版本链接到池内上一版本，并记录来源 run 记忆
+	tasks, err := h.store.Tasks.Find(ctx, repository.TaskFilter{RunID: h.runID})
+	if err != nil || len(tasks) == 0 {
+		t.Fatalf("tasks: %v", err)
+	}
+	for _, id := range ids[:2] {
+		runMem, err := findMemoryUnscoped(ctx, h.store, id)
+		if err != nil {
+			t.Fatalf("get: %v", err)
+		}
+		if err := h.reflection.consolidateToGlobal(ctx, &tasks[0], runMem, 0); err != nil {
+			t.Fatalf("consolidate: %v", err)
+		}
+	}
+	pool, err := h.store.Memories.ListPool(ctx, 0)
+	if err != nil || len(pool) != 2 {
+		t.Fatalf("global pool: %v %+v", err, pool)
+	}
+	if pool[0].SourceMemoryID != ids[0] || pool[1].SourceMemoryID != ids[1] || pool[1].ParentID != pool[0].ID || pool[1].Version != 2 {
+		t.Fatalf("global versions should carry lineage: %+v", pool)
+	}
+
+	// 快照导入到隔离池：来源指向快照中的原记录，版本之间重新链接
+	snap, err := CreateGlobalPoolSnapshot(ctx, h.store, 0, h.runID, 0, "")
+	if err != nil {
+		t.Fatalf("snapshot: %v", err)
+	}
+	if err := prepareRunPool(ctx, h.store, 42, GlobalPoolSnapshot, snap.ID); err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	imported, err := h.store.Memories.ListPool(ctx, 42)
+	if err != nil || len(imported) != 2 {
+		t.Fatalf("imported pool: %v %+v", err, imported)
+	}
+	if imported[0].SourceMemoryID != pool[0].ID || imported[1].ParentID != imported[0].ID {
+		t.Fatalf("imported versions should be relinked: %+v", imported)
+	}
+	history, err = GetMemoryHistory(ctx, h.store, imported[0].ID)
+	if err != nil || len(history.Versions) != 2 || history.Versions[1].Memory.ID != imported[1].ID {
+		t.Fatalf("imported history: %v %+v", err, history)
+	}
+}
@@ -15,35 +15,20 @@ import (
 )
 
 // TestMemoryEvolution_Integration 集成测试：真实测试记忆演化
-// 需要真实的数据库连接
+// 使用临时 SQLite 文件 + 离线模拟模型，无需 MySQL / Dify
 func TestMemoryEvolution_Integration(t *testing.T) {
-	// 加载测试配置
-	cfg, err := config.LoadConfig("../../config/config.yaml")
+	store, err := db.Open(config.DatabaseConfig{
+		Driver: db.DriverSQLite,
+		Path:   filepath.Join(t.TempDir(), "integration.db"),
+	})
 	if err != nil {
-		t.Skip("跳过集成测试：无法加载配置文件（请确保 config/config.yaml 存在）")
-		return
+		t.Fatalf("初始化 SQLite 失败: %v", err)
 	}
-
-	// 初始化数据库
-	if err := db.InitDB(cfg); err != nil {
-		t.Skip("跳过集成测试：无法连接数据库")
-		return
-	}
-
 	// 创建服务实例
-	difyClient := NewDifyClient(
-		cfg.Dify.BaseURL,
-		cfg.Dify.APIKey,
-		cfg.Dify.AppType,
-		cfg.Dify.ResponseMode,
-		cfg.Dify.WorkflowSystemKey,
-		cfg.Dify.WorkflowQueryKey,
-		cfg.Dify.WorkflowOutputKey,
-	)
-
-	agentService := NewAgentService(difyClient, nil, "")
-	coachService := NewCoachService()
-	reflectionService := NewReflectionService(difyClient, nil, "")
+	llm := NewMockLLMClient(42, 0, mockDefaultObeyMemoryRate)
+	agentService := NewAgentService(store, llm, nil, "")
+	coachService := NewCoachService(store)
+	reflectionService := NewReflectionService(store, llm, nil, "")
 
 	ctx := context.Background()
 
@@ -54,7 +39,7 @@ func TestMemoryEvolution_Integration(t *testing.T) {
 		Seed:         time.Now().UnixNano(),
 		GroupsJSON:   `["C"]`,
 	}
-	if err := db.DB.Create(testRun).Error; err != nil {
+	if err := store.Runs.Create(ctx, testRun); err != nil {
 		t.Fatalf("创建测试 run 失败: %v", err)
 	}
 	runID := testRun.ID
@@ -113,6 +98,18 @@ func TestMemoryEvolution_Integration(t *testing.T) {
 		}
 	}
 
+	// 门槛 120 → 100 后同一归并键演化出新版本；旧版本在第3轮被注入且导致判错，应被降权
+	if len(generatedMemories) != 2 || generatedMemories[0].TriggerKey != generatedMemories[1].TriggerKey || generatedMemories[1].Version != generatedMemories[0].Version+1 {
+		t.Fatalf("记忆未按版本演化: %+v", generatedMemories)
+	}
+	stale, err := store.Memories.Get(ctx, generatedMemories[0].ID)
+	if err != nil {
+		t.Fatalf("查询旧版本记忆失败: %v", err)
+	}
+	if stale.FailureCount != 1 || stale.Confidence >= generatedMemories[0].Confidence || stale.LastFailedAt == nil {
+		t.Fatalf("旧版本记忆未被降权: %+v", stale)
+	}
+
 	// 生成报告
 	generateIntegrationTestReport(t, runID, generatedMemories, scenarios)
 
@@ -141,7 +138,7 @@ func judgeWithCustomThreshold(coach *CoachService, ctx context.Context, task *mo
 	// 判断是否正确
 	isCorrect := modelAllow == expectedAllow
 	task.IsCorrect = &isCorrect
-	db.DB.Save(task)
+	_ = coach.store.Tasks.SetCorrect(ctx, task.ID, isCorrect)
 
 	feedbackType := "correct"
 	content := "判断正确"
@@ -0,0 +1,315 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+
+	"mem-test/internal/config"
+	"mem-test/internal/model"
+)
+
+// 记忆检索模式（retrieval.mode）
+const (
+	RetrievalModeSemantic = "semantic"
+	RetrievalModeBM25     = "bm25"
+	RetrievalModeRecency  = "recency"
+)
+
+const (
+	EmbedderHash = "hash"
+
+	defaultEmbeddingDim     = 256
+	defaultCandidatePool    = 20
+	defaultSimilarityWeight = 0.5
+	defaultRecencyWeight    = 0.4
+	defaultConfidenceWeight = 0.1
+)
+
+// Embedder 把文本映射为定长、L2 归一化的向量；Name 写入 memories.embedding_model，
+// 更换实现或维度后旧向量会在下次检索时重算
+type Embedder interface {
+	Name() string
+	Embed(text string) model.Vector
+}
+
+// HashingEmbedder 本地特征哈希：中文按字 + 相邻二元组、英文按单词（含 snake_case 拆分）切词，
+// 数字不参与（门槛数值由最近验证/版本排序与 E 组重排负责，避免 100/120 这类数字噪声左右相似度），
+// 次线性词频 + 带符号哈希投影到 dim 维
+type HashingEmbedder struct {
+	dim int
+}
+
+func NewHashingEmbedder(dim int) *HashingEmbedder {
+	if dim <= 0 {
+		dim = defaultEmbeddingDim
+	}
+	return &HashingEmbedder{dim: dim}
+}
+
+func (e *HashingEmbedder) Name() string {
+	return fmt.Sprintf("%s-%d", EmbedderHash, e.dim)
+}
+
+func (e *HashingEmbedder) Embed(text string) model.Vector {
+	tf := map[string]int{}
+	for _, tok := range embeddingTokens(text) {
+		tf[tok]++
+	}
+	if len(tf) == 0 {
+		return nil
+	}
+	vec := make(model.Vector, e.dim)
+	for tok, n := range tf {
+		h := fnv.New32a()
+		_, _ = h.Write([]byte(tok))
+		sum := h.Sum32()
+		w := float32(1 + math.Log(float64(n)))
+		if sum&1 == 1 {
+			w = -w
+		}
+		vec[(sum>>1)%uint32(e.dim)] += w
+	}
+	var norm float64
+	for _, v := range vec {
+		norm += float64(v) * float64(v)
+	}
+	if norm == 0 {
+		return nil
+	}
+	scale := float32(1 / math.Sqrt(norm))
+	for i := range vec {
+		vec[i] *= scale
+	}
+	return vec
+}
+
+// embeddingTokens 中文字（u:）/二元组（b:）与英文单词（w:）分前缀，避免不同粒度的特征互相碰撞
+func embeddingTokens(text string) []string {
+	var out []string
+	var han []rune
+	var word []rune
+	flushHan := func() {
+		for i, r := range han {
+			out = append(out, "u:"+string(r))
+			if i+1 < len(han) {
+				out = append(out, "b:"+string(han[i:i+2]))
+			}
+		}
+		han = han[:0]
+	}
+	flushWord := func() {
+		if len(word) == 0 {
+			return
+		}
+		w := strings.ToLower(string(word))
+		out = append(out, "w:"+w)
+		if strings.Contains(w, "_") {
+			for _, part := range strings.Split(w, "_") {
+				if part != "" {
+					out = append(out, "w:"+part)
+				}
+			}
+		}
+		word = word[:0]
+	}
+	for _, r := range text {
+		switch {
+		case unicode.Is(unicode.Han, r):
+			flushWord()
+			han = append(han, r)
+		case r < unicode.MaxASCII && (unicode.IsLetter(r) || r == '_'):
+			flushHan()
+			word = append(word, r)
+		default:
+			flushHan()
+			flushWord()
+		}
+	}
+	flushHan()
+	flushWord()
+	return out
+}
+
+// inputFieldGlossary 任务输入字段 / 取值的中文说法：输入是英文 JSON，记忆是中文规则，靠它对齐到同一词表
+var inputFieldGlossary = map[string]string{
+	"lottery":          "抽奖",
+	"points":           "积分",
+	"points_available": "可用积分",
+	"points_bonus":     "奖励积分",
+	"points_locked":    "锁定积分",
+	"points_expiring":  "过期积分 即将过期",
+	"expiring_days":    "过期天数",
+	"points_penalty":   "惩罚积分 扣除",
+	"is_vip":           "VIP用户",
+	"is_blacklisted":   "黑名单",
+	"daily_draws":      "每日抽奖次数 上限",
+}
+
+// memoryQueryText 把任务输入转成检索查询文本：只保留“生效”的字段（非 0 / true / 非空），
+// 这样 points_locked>0 的样本会更贴近“锁定积分”相关规则，而不是所有样本拿到同一组 top-k
+func memoryQueryText(taskType, input string) string {
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(input), &fields); err != nil {
+		return input
+	}
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, k := range keys {
+		var value string
+		switch v := fields[k].(type) {
+		case bool:
+			if !v {
+				continue
+			}
+		case float64:
+			if v == 0 {
+				continue
+			}
+		case string:
+			if v == "" {
+				continue
+			}
+			value = v
+		case nil:
+			continue
+		}
+		b.WriteString(k)
+		b.WriteString(" ")
+		b.WriteString(inputFieldGlossary[k])
+		if value != "" {
+			b.WriteString(" ")
+			b.WriteString(value)
+			b.WriteString(" ")
+			b.WriteString(inputFieldGlossary[value])
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// memoryEmbeddingText 记忆参与向量化的文本
+func memoryEmbeddingText(m *model.Memory) string {
+	return m.Trigger + "\n" + m.Lesson
+}
+
+// SemanticRetriever 在仓库返回的候选（已按最近验证 > 版本 > 置信度 > 使用次数排序）上按任务输入重排：
+// score = w_sim·max(cos, 0) + w_rec·(1 − 名次/候选池大小) + w_conf·confidence；
+// 名次按候选池大小归一，候选很少时相邻名次的差距不会压过相似度
+type SemanticRetriever struct {
+	Embedder         Embedder
+	Candidates       int
+	SimilarityWeight float64
+	RecencyWeight    float64
+	ConfidenceWeight float64
+}
+
+func NewSemanticRetriever(embedder Embedder, cfg config.RetrievalConfig) *SemanticRetriever {
+	r := &SemanticRetriever{
+		Embedder:         embedder,
+		Candidates:       cfg.Candidates,
+		SimilarityWeight: cfg.SimilarityWeight,
+		RecencyWeight:    cfg.RecencyWeight,
+		ConfidenceWeight: cfg.ConfidenceWeight,
+	}
+	if r.SimilarityWeight == 0 && r.RecencyWeight == 0 && r.ConfidenceWeight == 0 {
+		r.SimilarityWeight, r.RecencyWeight, r.ConfidenceWeight = defaultSimilarityWeight, defaultRecencyWeight, defaultConfidenceWeight
+	}
+	return r
+}
+
+// retrievalMode 规范化后的 retrieval.mode（未配置时为 recency，与基线 run 的检索排序一致；semantic/bm25 需显式开启）
+func retrievalMode(cfg config.RetrievalConfig) string {
+	mode := strings.ToLower(strings.TrimSpace(cfg.Mode))
+	if mode == "" {
+		return RetrievalModeRecency
+	}
+	return mode
+}
+
+// NewMemoryRetriever 按 retrieval 配置构建向量检索器；mode=bm25/recency 时返回 nil（不做向量重排）
+func NewMemoryRetriever(cfg config.RetrievalConfig) (*SemanticRetriever, error) {
+	switch retrievalMode(cfg) {
+	case RetrievalModeSemantic:
+	case RetrievalModeBM25, RetrievalModeRecency:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("未知的检索模式: %q（可选 semantic/bm25/recency）", cfg.Mode)
+	}
+	switch strings.ToLower(strings.TrimSpace(cfg.Embedder)) {
+	case "", EmbedderHash:
+		return NewSemanticRetriever(NewHashingEmbedder(cfg.Dim), cfg), nil
+	default:
+		return nil, fmt.Errorf("未知的 embedder: %q（可选 hash）", cfg.Embedder)
+	}
+}
+
+// candidateLimit 从仓库取多少条候选参与重排
+func (r *SemanticRetriever) candidateLimit(limit int) int {
+	if r.Candidates > 0 {
+		if r.Candidates < limit {
+			return limit
+		}
+		return r.Candidates
+	}
+	if n := 4 * limit; n > defaultCandidatePool {
+		return n
+	}
+	return defaultCandidatePool
+}
+
+// Rank 候选需已带当前 embedder 的向量；输入无法向量化时保持仓库排序
+func (r *SemanticRetriever) Rank(query string, candidates []model.Memory, limit int) []model.Memory {
+	q := r.Embedder.Embed(query)
+	if q == nil || len(candidates) <= 1 {
+		return truncateMemories(candidates, limit)
+	}
+	type scored struct {
+		m     model.Memory
+		score float64
+	}
+	n := float64(r.candidateLimit(limit))
+	if m := float64(len(candidates)); m > n {
+		n = m
+	}
+	out := make([]scored, 0, len(candidates))
+	for i, m := range candidates {
+		sim := math.Max(cosine(q, m.Embedding), 0)
+		recency := 1 - float64(i)/n
+		out = append(out, scored{m: m, score: r.SimilarityWeight*sim + r.RecencyWeight*recency + r.ConfidenceWeight*m.Confidence})
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].score > out[j].score })
+	res := make([]model.Memory, 0, len(out))
+	for _, it := range out {
+		res = append(res, it.m)
+	}
+	return truncateMemories(res, limit)
+}
+
+// cosine 两个已归一化向量的点积；维度不一致（embedder 变更但尚未重算）视为不相关
+func cosine(a, b model.Vector) float64 {
+	if len(a) == 0 || len(a) != len(b) {
+		return 0
+	}
+	var dot float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+	}
+	return dot
+}
+
+func truncateMemories(ms []model.Memory, limit int) []model.Memory {
+	if limit > 0 && len(ms) > limit {
+		return ms[:limit]
+	}
+	return ms
+}
@@ -0,0 +1,146 @@
+package service
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"mem-test/internal/config"
+	"mem-test/internal/model"
+	"mem-test/internal/repository"
+)
+
+func TestHashingEmbedder(t *testing.T) {
+	e := NewHashingEmbedder(0)
+	if e.Name() != "hash-256" {
+		t.Fatalf("name: %s", e.Name())
+	}
+	a := e.Embed("积分<100\n当积分低于100时拒绝抽奖")
+	b := e.Embed("积分<100\n当积分低于100时拒绝抽奖")
+	if len(a) != 256 || cosine(a, b) < 0.9999 {
+		t.Fatalf("embedding should be deterministic: len=%d cos=%f", len(a), cosine(a, b))
+	}
+	if n := cosine(a, a); math.Abs(n-1) > 1e-5 {
+		t.Fatalf("embedding should be L2-normalized: %f", n)
+	}
+	// 门槛数字不参与向量化：规则变更的多个版本相似度相同，排序交给最近验证/版本
+	if c := cosine(a, e.Embed("积分<120\n当积分低于120时拒绝抽奖")); c < 0.9999 {
+		t.Fatalf("digits should not affect embedding: %f", c)
+	}
+	if e.Embed("123 <= 456") != nil {
+		t.Fatalf("text without tokens should not embed")
+	}
+}
+
+// TestMemoryRetrieval_FieldRelevant lottery_multi：最新写入的是奖励积分规则，但 points_locked>0 的输入应优先拿到锁定积分规则；
+// semantic 与 bm25 都按输入选取，recency 不看输入
+func TestMemoryRetrieval_FieldRelevant(t *testing.T) {
+	ctx := context.Background()
+	store := repository.NewMemoryStore()
+	agent := NewAgentService(store, NewMockLLMClient(1, 0, 1), nil, "")
+	if agent.RetrievalLabel() != RetrievalModeRecency {
+		t.Fatalf("recency should be the default: %s", agent.RetrievalLabel())
+	}
+	if r, err := NewMemoryRetriever(config.RetrievalConfig{}); r != nil || err != nil {
+		t.Fatalf("empty retrieval.mode should mean recency: %v %v", r, err)
+	}
+	retriever, err := NewMemoryRetriever(config.RetrievalConfig{Mode: RetrievalModeSemantic})
+	if err != nil {
+		t.Fatalf("semantic retriever: %v", err)
+	}
+	agent.retriever = retriever
+	if agent.RetrievalLabel() != "semantic:hash-256" {
+		t.Fatalf("label: %s", agent.RetrievalLabel())
+	}
+	run := &model.ExperimentRun{TaskType: "lottery_multi", RunsPerGroup: 1, GroupsJSON: `["C"]`}
+	if err := store.Runs.Create(ctx, run); err != nil {
+		t.Fatalf("create run: %v", err)
+	}
+
+	seed := []model.Memory{
+		{Trigger: "有效积分<100", Lesson: "锁定积分不计入有效积分，只按可用积分判断是否达到门槛"},
+		{Trigger: "有效积分<100", Lesson: "有惩罚积分时先从可用积分中扣除惩罚再与门槛比较"},
+		{Trigger: "有效积分<100", Lesson: "奖励积分按一半计入有效积分，最多计入门槛的20%"},
+	}
+	for i := range seed {
+		seed[i].RunID, seed[i].ApplyTo, seed[i].TriggerKey, seed[i].Confidence, seed[i].Version = run.ID, "lottery_multi", normalizeTriggerKey(seed[i].Trigger), 0.8, i+1
+		if err := store.Memories.Create(ctx, &seed[i]); err != nil {
+			t.Fatalf("seed: %v", err)
+		}
+	}
+
+	frozen := false
+	top := func(input string) uint {
+		t.Helper()
+		mems, err := agent.retrieveMemoriesWithLimit(ctx, run.ID, "lottery_multi", input, memoryScopeRunOnly, 0, 1, frozen)
+		if err != nil || len(mems) != 1 {
+			t.Fatalf("retrieve: %v %+v", err, mems)
+		}
+		return mems[0].ID
+	}
+	cases := []struct {
+		input string
+		want  uint
+	}{
+		{`{"points_available":90,"points_bonus":0,"points_locked":40,"points_penalty":0}`, seed[0].ID},
+		{`{"points_available":90,"points_bonus":0,"points_locked":0,"points_penalty":20}`, seed[1].ID},
+		{`{"points_available":90,"points_bonus":30,"points_locked":0,"points_penalty":0}`, seed[2].ID},
+	}
+	embedded := func() bool {
+		t.Helper()
+		m, err := store.Memories.Get(ctx, seed[0].ID)
+		if err != nil {
+			t.Fatalf("get: %v", err)
+		}
+		return m.EmbeddingModel == "hash-256" && len(m.Embedding) == 256
+	}
+	// 评估阶段冻结：排序相同，但向量不落库
+	frozen = true
+	for _, c := range cases {
+		if got := top(c.input); got != c.want {
+			t.Fatalf("frozen input %s: want memory %d, got %d", c.input, c.want, got)
+		}
+	}
+	if embedded() {
+		t.Fatalf("frozen retrieval should not write embeddings")
+	}
+	frozen = false
+	for _, c := range cases {
+		if got := top(c.input); got != c.want {
+			t.Fatalf("input %s: want memory %d, got %d", c.input, c.want, got)
+		}
+	}
+	if !embedded() {
+		t.Fatalf("embedding should be persisted outside the frozen phase")
+	}
+
+	// recency 模式：不看输入，始终是仓库排序的第一条
+	agent.retriever = nil
+	for _, c := range cases {
+		if got := top(c.input); got != seed[2].ID {
+			t.Fatalf("recency mode should ignore input: got %d", got)
+		}
+	}
+
+	// bm25 模式：关键词命中优先，之后写入的记忆增量进入索引
+	idx, err := store.EnableKeywordIndex(ctx, 0, 0)
+	if err != nil {
+		t.Fatalf("enable keyword index: %v", err)
+	}
+	agent.keywords = idx
+	for _, c := range cases {
+		if got := top(c.input); got != c.want {
+			t.Fatalf("bm25 input %s: want memory %d, got %d", c.input, c.want, got)
+		}
+	}
+	penalty := &model.Memory{
+		RunID: run.ID, ApplyTo: "lottery_multi", Trigger: "惩罚积分", TriggerKey: normalizeTriggerKey("惩罚积分"),
+		Lesson: "惩罚积分需要从可用积分中全额扣除后再判断门槛", Version: 1,
+	}
+	if err := store.Memories.Create(ctx, penalty); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if got := top(cases[1].input); got != penalty.ID {
+		t.Fatalf("new memory should be searchable without rebuild: got %d", got)
+	}
+}
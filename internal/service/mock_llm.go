@@ -0,0 +1,295 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"regexp"
+	"strings"
+)
+
+// MockLLMClient 内置离线模拟模型（dify.mock_mode=true 时启用）
+//
+// 目标：不依赖网络即可跑通 A–F 全流程，且同一 seed 下结果完全可复现。
+// 行为：
+// - 任务 prompt：解析 buildPrompt 注入的“重要经验/已验证规则”，以 obeyMemoryRate 概率遵循记忆中的门槛
+// - 不遵循记忆时按“先验”作答（lottery 默认门槛 100；lottery_multi 简单加总；lottery_v2 不区分 VIP）
+// - 以 errorRate 概率把最终答案翻转（模拟模型偶发失误）
+// - 反思 prompt：从反馈内容中提取门槛，输出合法的 trigger/lesson JSON
+//
+// 随机性只由 seed + prompt 决定（与调用顺序无关），并发/交错执行不影响结果。
+type MockLLMClient struct {
+	Seed           int64
+	ErrorRate      float64
+	ObeyMemoryRate float64
+}
+
+const (
+	mockDefaultObeyMemoryRate = 0.9
+	mockPriorThreshold        = 100
+)
+
+func NewMockLLMClient(seed int64, errorRate, obeyMemoryRate float64) *MockLLMClient {
+	if errorRate < 0 {
+		errorRate = 0
+	}
+	if errorRate > 1 {
+		errorRate = 1
+	}
+	// 负数表示未配置，使用默认值；0 是合法取值（从不遵循记忆，用作无记忆基线）
+	if obeyMemoryRate < 0 {
+		obeyMemoryRate = mockDefaultObeyMemoryRate
+	}
+	if obeyMemoryRate > 1 {
+		obeyMemoryRate = 1
+	}
+	return &MockLLMClient{
+		Seed:           seed,
+		ErrorRate:      errorRate,
+		ObeyMemoryRate: obeyMemoryRate,
+	}
+}
+
+var (
+	mockTaskTypeRe      = regexp.MustCompile(`(?m)^任务类型: *(\S+)`)
+	mockInputRe         = regexp.MustCompile(`(?m)^输入: *(.+)$`)
+	mockFeedbackRe      = regexp.MustCompile(`(?m)^反馈内容: *(.+)$`)
+	mockFeedbackThrRe   = regexp.MustCompile(`门槛=([0-9]{1,4})`)
+	mockCurrentThrRe    = regexp.MustCompile(`当前门槛/门限\(若适用\): *([0-9]{1,4})`)
+	mockRuleLineRe      = regexp.MustCompile(`^[0-9]+\. *(.+)$`)
+	mockRuleSectionHdrs = []string{"重要经验（请遵循）:", "已验证规则（必须遵循）:"}
+)
+
+// BuildInputs 实现 LLMProvider：模拟模型只看 prompt
+func (c *MockLLMClient) BuildInputs(prompt, query string, fallback map[string]interface{}) map[string]interface{} {
+	return fallback
+}
+
+// Complete 实现 LLMProvider
+func (c *MockLLMClient) Complete(ctx context.Context, prompt string, inputs map[string]interface{}) (*LLMResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	rng := c.rngFor(prompt)
+
+	var answer string
+	if isReflectionPrompt(prompt) {
+		answer = c.answerReflection(prompt)
+	} else {
+		answer = c.answerTask(prompt, rng)
+	}
+
+	promptTokens := estimateTokens(prompt)
+	completionTokens := estimateTokens(answer)
+	return &LLMResponse{
+		Answer: answer,
+		Usage: LLMUsage{
+			PromptTokens:     promptTokens,
+			CompletionTokens: completionTokens,
+			TotalTokens:      promptTokens + completionTokens,
+		},
+	}, nil
+}
+
+func (c *MockLLMClient) rngFor(prompt string) *rand.Rand {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(fmt.Sprintf("%d|", c.Seed)))
+	_, _ = h.Write([]byte(prompt))
+	return rand.New(rand.NewSource(int64(h.Sum64())))
+}
+
+func isReflectionPrompt(prompt string) bool {
+	return strings.Contains(prompt, "请进行反思") && strings.Contains(prompt, "反馈内容:")
+}
+
+// mockRule 从注入的记忆行中解析出的门槛规则
+type mockRule struct {
+	threshold int
+	vip       bool
+}
+
+func parseInjectedRules(prompt string) []mockRule {
+	var out []mockRule
+	inSection := false
+	for _, line := range strings.Split(prompt, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			inSection = false
+			continue
+		}
+		isHdr := false
+		for _, h := range mockRuleSectionHdrs {
+			if line == h {
+				isHdr = true
+				break
+			}
+		}
+		if isHdr {
+			inSection = true
+			continue
+		}
+		if !inSection {
+			continue
+		}
+		m := mockRuleLineRe.FindStringSubmatch(line)
+		if len(m) < 2 {
+			continue
+		}
+		thr, ok := extractThresholdFromText(m[1])
+		if !ok {
+			continue
+		}
+		out = append(out, mockRule{
+			threshold: thr,
+			vip:       strings.Contains(strings.ToLower(m[1]), "vip"),
+		})
+	}
+	return out
+}
+
+func (c *MockLLMClient) answerTask(prompt string, rng *rand.Rand) string {
+	taskType := ""
+	if m := mockTaskTypeRe.FindStringSubmatch(prompt); len(m) == 2 {
+		taskType = m[1]
+	}
+	var inputData map[string]interface{}
+	if m := mockInputRe.FindStringSubmatch(prompt); len(m) == 2 {
+		_ = json.Unmarshal([]byte(strings.TrimSpace(m[1])), &inputData)
+	}
+	if inputData == nil {
+		inputData = map[string]interface{}{}
+	}
+
+	rules := parseInjectedRules(prompt)
+	// 先抽签决定是否遵循记忆，再抽签决定是否失误（抽签顺序固定，保证可复现）
+	obey := len(rules) > 0 && rng.Float64() < c.ObeyMemoryRate
+	slip := rng.Float64() < c.ErrorRate
+
+	var allow bool
+	var reason string
+	switch taskType {
+	case "lottery":
+		thr := mockPriorThreshold
+		if obey {
+			thr = firstGeneralRule(rules, thr)
+		}
+		points := int(getFloat(inputData, "points"))
+		allow = points >= thr
+		reason = fmt.Sprintf("积分=%d，门槛=%d", points, thr)
+	case "lottery_multi":
+		available := int(getFloat(inputData, "points_available"))
+		bonus := int(getFloat(inputData, "points_bonus"))
+		locked := int(getFloat(inputData, "points_locked"))
+		expiring := int(getFloat(inputData, "points_expiring"))
+		expDays := int(getFloat(inputData, "expiring_days"))
+		penalty := int(getFloat(inputData, "points_penalty"))
+		if obey {
+			// 遵循记忆：按记忆门槛 + 学到的有效积分口径计算
+			thr := firstGeneralRule(rules, mockPriorThreshold)
+			effective, _ := computeEffectivePoints(thr, available, bonus, locked, expiring, expDays, penalty)
+			allow = effective >= thr
+			reason = fmt.Sprintf("有效积分=%d，门槛=%d", effective, thr)
+		} else {
+			// 先验：简单加总可用 + 奖励积分
+			naive := available + bonus - penalty
+			allow = naive >= mockPriorThreshold
+			reason = fmt.Sprintf("积分合计=%d，门槛=%d", naive, mockPriorThreshold)
+		}
+	case "lottery_v2":
+		points := int(getFloat(inputData, "points"))
+		isVip, _ := inputData["is_vip"].(bool)
+		isBlacklisted, _ := inputData["is_blacklisted"].(bool)
+		dailyDraws := int(getFloat(inputData, "daily_draws"))
+		thr := mockPriorThreshold
+		if obey {
+			if isVip {
+				thr = firstVIPRule(rules, thr)
+			} else {
+				thr = firstGeneralRule(rules, thr)
+			}
+		}
+		switch {
+		case isBlacklisted:
+			allow, reason = false, "黑名单用户禁止抽奖"
+		case dailyDraws >= 1:
+			allow, reason = false, "已达到每日抽奖次数上限"
+		default:
+			allow = points >= thr
+			reason = fmt.Sprintf("积分=%d，门槛=%d", points, thr)
+		}
+	default:
+		return "mock answer"
+	}
+
+	if slip {
+		allow = !allow
+		reason += "（模拟失误）"
+	}
+	b, _ := json.Marshal(map[string]interface{}{"allow": allow, "reason": reason})
+	return string(b)
+}
+
+func firstGeneralRule(rules []mockRule, def int) int {
+	for _, r := range rules {
+		if !r.vip {
+			return r.threshold
+		}
+	}
+	return def
+}
+
+func firstVIPRule(rules []mockRule, def int) int {
+	for _, r := range rules {
+		if r.vip {
+			return r.threshold
+		}
+	}
+	return def
+}
+
+func (c *MockLLMClient) answerReflection(prompt string) string {
+	taskType := "通用"
+	if m := mockTaskTypeRe.FindStringSubmatch(prompt); len(m) == 2 {
+		taskType = m[1]
+	}
+	feedback := ""
+	if m := mockFeedbackRe.FindStringSubmatch(prompt); len(m) == 2 {
+		feedback = m[1]
+	}
+
+	thr := 0
+	if m := mockFeedbackThrRe.FindStringSubmatch(feedback); len(m) == 2 {
+		thr, _ = extractThresholdFromText(m[1])
+	}
+	if thr == 0 {
+		if m := mockCurrentThrRe.FindStringSubmatch(prompt); len(m) == 2 {
+			thr, _ = extractThresholdFromText(m[1])
+		}
+	}
+	if thr == 0 {
+		thr = mockPriorThreshold
+	}
+
+	trigger := fmt.Sprintf("积分<%d", thr)
+	lesson := fmt.Sprintf("当积分低于%d时拒绝抽奖；积分>=%d时允许抽奖", thr, thr)
+	switch taskType {
+	case "lottery_multi":
+		trigger = fmt.Sprintf("有效积分<%d", thr)
+		lesson = fmt.Sprintf("有效积分低于%d时拒绝抽奖；有效积分=可用+奖励折半(封顶门槛20%%)+1天内过期积分-惩罚，锁定积分不计入", thr)
+	case "lottery_v2":
+		if strings.Contains(feedback, "VIP门槛") {
+			trigger = fmt.Sprintf("VIP积分<%d", thr)
+			lesson = fmt.Sprintf("VIP用户积分低于%d时拒绝抽奖；黑名单或已达每日上限一律拒绝", thr)
+		}
+	}
+
+	b, _ := json.Marshal(map[string]interface{}{
+		"trigger":    trigger,
+		"lesson":     lesson,
+		"apply_to":   taskType,
+		"confidence": 0.8,
+	})
+	return string(b)
+}
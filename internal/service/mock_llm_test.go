@@ -0,0 +1,107 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"mem-test/internal/config"
+	"mem-test/internal/model"
+)
+
+// TestMockLLM_ObeysInjectedMemory 模拟模型应遵循 buildPrompt 注入的门槛规则
+func TestMockLLM_ObeysInjectedMemory(t *testing.T) {
+	mock := NewMockLLMClient(42, 0, 1)
+	agent := &AgentService{}
+	input := `{"action":"lottery","points":110}`
+
+	// 无记忆：按先验门槛 100 作答 => allow
+	noMem := agent.buildPrompt("lottery", input, nil, nil, nil, nil)
+	resp, err := mock.Complete(context.Background(), noMem, nil)
+	if err != nil {
+		t.Fatalf("complete failed: %v", err)
+	}
+	allow, err := parseLotteryAllow(resp.Answer)
+	if err != nil || allow == nil || !*allow {
+		t.Fatalf("expected allow=true without memory, got %s", resp.Answer)
+	}
+
+	// 注入门槛 120 的记忆 => deny
+	mems := []model.Memory{{Trigger: "积分<120", Lesson: "当积分低于120时拒绝抽奖"}}
+	withMem := agent.buildPrompt("lottery", input, mems, nil, nil, nil)
+	resp, err = mock.Complete(context.Background(), withMem, nil)
+	if err != nil {
+		t.Fatalf("complete failed: %v", err)
+	}
+	allow, err = parseLotteryAllow(resp.Answer)
+	if err != nil || allow == nil || *allow {
+		t.Fatalf("expected allow=false with memory threshold=120, got %s", resp.Answer)
+	}
+	if resp.Usage.TotalTokens <= 0 {
+		t.Fatalf("expected positive token usage, got %d", resp.Usage.TotalTokens)
+	}
+}
+
+// TestMockLLM_ZeroObeyRate 显式配置 0 时从不遵循注入的记忆，未配置时才取默认值
+func TestMockLLM_ZeroObeyRate(t *testing.T) {
+	zero := 0.0
+	cfg := &config.Config{}
+	cfg.Dify.MockObeyMemoryRate = &zero
+	mock := newMockLLMFromConfig(cfg)
+	if mock.ObeyMemoryRate != 0 {
+		t.Fatalf("explicit 0 should be kept, got %v", mock.ObeyMemoryRate)
+	}
+	if def := newMockLLMFromConfig(&config.Config{}); def.ObeyMemoryRate != mockDefaultObeyMemoryRate {
+		t.Fatalf("unset rate should default to %v, got %v", mockDefaultObeyMemoryRate, def.ObeyMemoryRate)
+	}
+
+	agent := &AgentService{}
+	mems := []model.Memory{{Trigger: "积分<120", Lesson: "当积分低于120时拒绝抽奖"}}
+	for points := 100; points < 120; points++ {
+		prompt := agent.buildPrompt("lottery", fmt.Sprintf(`{"action":"lottery","points":%d}`, points), mems, nil, nil, nil)
+		resp, err := mock.Complete(context.Background(), prompt, nil)
+		if err != nil {
+			t.Fatalf("complete failed: %v", err)
+		}
+		// 门槛 120 的记忆若被遵循会 deny；不遵循时按先验门槛 100 => allow
+		allow, err := parseLotteryAllow(resp.Answer)
+		if err != nil || allow == nil || !*allow {
+			t.Fatalf("rate 0 must not follow memory (points=%d), got %s", points, resp.Answer)
+		}
+	}
+}
+
+// TestMockLLM_Deterministic 同一 seed + 同一 prompt 必须得到相同答案
+func TestMockLLM_Deterministic(t *testing.T) {
+	agent := &AgentService{}
+	a := NewMockLLMClient(7, 0.5, 0.5)
+	b := NewMockLLMClient(7, 0.5, 0.5)
+	for points := 0; points < 50; points++ {
+		prompt := agent.buildPrompt("lottery", fmt.Sprintf(`{"points":%d}`, points*5), nil, nil, nil, nil)
+		ra, _ := a.Complete(context.Background(), prompt, nil)
+		rb, _ := b.Complete(context.Background(), prompt, nil)
+		if ra.Answer != rb.Answer {
+			t.Fatalf("non-deterministic answer for points=%d: %s vs %s", points*5, ra.Answer, rb.Answer)
+		}
+	}
+}
+
+// TestMockLLM_ReflectionJSON 反思 prompt 应返回可解析的 trigger/lesson JSON
+func TestMockLLM_ReflectionJSON(t *testing.T) {
+	mock := NewMockLLMClient(1, 0, 0)
+	refl := &ReflectionService{}
+	task := &model.Task{TaskType: "lottery", Input: `{"points":110}`, Output: `{"allow":true}`}
+	fb := &model.Feedback{Type: "incorrect", Content: "判断错误。积分=110时，门槛=120，应该: 积分不足"}
+
+	resp, err := mock.Complete(context.Background(), refl.buildReflectionPrompt(task, fb), nil)
+	if err != nil {
+		t.Fatalf("complete failed: %v", err)
+	}
+	mem := refl.parseReflectionResult(resp.Answer, fb)
+	if thr, ok := extractThresholdFromText(mem.Trigger + " " + mem.Lesson); !ok || thr != 120 {
+		t.Fatalf("expected threshold 120 in reflection, got trigger=%q lesson=%q", mem.Trigger, mem.Lesson)
+	}
+	if mem.ApplyTo != "lottery" {
+		t.Fatalf("expected apply_to=lottery, got %q", mem.ApplyTo)
+	}
+}
@@ -0,0 +1,135 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"mem-test/internal/model"
+	"mem-test/internal/repository"
+)
+
+// 判错任务的归因类别
+const (
+	ErrorClassStaleMemory   = "stale_memory"   // 注入的记忆门槛与当前规则不一致，且答案与该记忆推出的结论一致（负迁移）
+	ErrorClassMemoryIgnored = "memory_ignored" // 注入了可解析门槛的记忆，但答案没有跟随过时记忆（含记忆本身正确却仍答错）
+	ErrorClassNoMemory      = "no_memory"      // 未注入任何记忆（A/B 组或检索为空）
+	ErrorClassUnattributed  = "unattributed"   // 注入了记忆，但记忆中提取不到门槛、输出不可解析或任务类型不支持
+)
+
+// ErrorAttribution 一组判错任务的归因统计
+type ErrorAttribution struct {
+	Incorrect     int `json:"incorrect"`
+	StaleMemory   int `json:"stale_memory"`
+	MemoryIgnored int `json:"memory_ignored"`
+	NoMemory      int `json:"no_memory"`
+	Unattributed  int `json:"unattributed"`
+	// 过时记忆导致的错误占全部错误的比例
+	StaleMemoryShare float64 `json:"stale_memory_share"`
+}
+
+func (a *ErrorAttribution) add(class string) {
+	a.Incorrect++
+	switch class {
+	case ErrorClassStaleMemory:
+		a.StaleMemory++
+	case ErrorClassMemoryIgnored:
+		a.MemoryIgnored++
+	case ErrorClassNoMemory:
+		a.NoMemory++
+	default:
+		a.Unattributed++
+	}
+	a.StaleMemoryShare = float64(a.StaleMemory) / float64(a.Incorrect)
+}
+
+// classifyError 对单个判错任务归因；memories 为注入记忆（按 ID 索引）。
+// 记忆门槛从 lesson（为空时退回 trigger）中提取。记忆行不可变：演化只会插入 Version+1、ParentID 指向原行的新行，
+// 因此按任务实际注入的那一行归因，后续版本不影响本次判断
+func classifyError(task model.Task, memories map[uint]model.Memory) string {
+	ids := ParseMemoryIDs(task.MemoryIDs)
+	if len(ids) == 0 {
+		return ErrorClassNoMemory
+	}
+	allow, err := parseLotteryAllow(task.Output)
+	if err != nil || allow == nil || task.RuleThreshold <= 0 {
+		return ErrorClassUnattributed
+	}
+	parsed := false
+	for _, id := range ids {
+		mem, ok := memories[id]
+		if !ok {
+			continue
+		}
+		text := mem.Lesson
+		if text == "" {
+			text = mem.Trigger
+		}
+		th, ok := extractThresholdFromText(text)
+		if !ok {
+			continue
+		}
+		predicted, ok := predictedAllowFromRule(task.TaskType, &task, th)
+		if !ok {
+			continue
+		}
+		parsed = true
+		if th != task.RuleThreshold && predicted == *allow {
+			return ErrorClassStaleMemory
+		}
+	}
+	if !parsed {
+		return ErrorClassUnattributed
+	}
+	return ErrorClassMemoryIgnored
+}
+
+// attributeErrors 汇总 tasks 中判错任务的归因
+func attributeErrors(tasks []model.Task, memories map[uint]model.Memory) ErrorAttribution {
+	var out ErrorAttribution
+	for _, t := range tasks {
+		if t.IsCorrect == nil || *t.IsCorrect {
+			continue
+		}
+		out.add(classifyError(t, memories))
+	}
+	return out
+}
+
+// loadInjectedMemories 加载判错任务注入过的记忆（含已软删除的，保证可归因）
+func loadInjectedMemories(ctx context.Context, store *repository.Store, tasks []model.Task) (map[uint]model.Memory, error) {
+	seen := map[uint]bool{}
+	var ids []uint
+	for _, t := range tasks {
+		if t.IsCorrect == nil || *t.IsCorrect {
+			continue
+		}
+		for _, id := range ParseMemoryIDs(t.MemoryIDs) {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+	out := make(map[uint]model.Memory, len(ids))
+	if len(ids) == 0 {
+		return out, nil
+	}
+	mems, err := store.Memories.FindByIDs(ctx, ids)
+	if err != nil {
+		return nil, fmt.Errorf("查询注入记忆失败: %w", err)
+	}
+	for _, m := range mems {
+		out[m.ID] = m
+	}
+	return out, nil
+}
+
+// groupErrorAttribution 查询注入记忆并对一组任务做错误归因
+func groupErrorAttribution(ctx context.Context, store *repository.Store, tasks []model.Task) (*ErrorAttribution, error) {
+	memories, err := loadInjectedMemories(ctx, store, tasks)
+	if err != nil {
+		return nil, err
+	}
+	attr := attributeErrors(tasks, memories)
+	return &attr, nil
+}
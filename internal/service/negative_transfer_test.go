@@ -0,0 +1,35 @@
+package service
+
+import (
+	"testing"
+
+	"mem-test/internal/model"
+)
+
+func TestAttributeErrors(t *testing.T) {
+	bad, good := false, true
+	memories := map[uint]model.Memory{
+		1: {ID: 1, Lesson: "积分>=80 才允许抽奖"},  // 旧规则
+		2: {ID: 2, Lesson: "积分>=120 才允许抽奖"}, // 当前规则
+		3: {ID: 3, Lesson: "先看清输入再回答"},      // 无门槛
+	}
+	task := func(ids, output string, isCorrect *bool) model.Task {
+		return model.Task{
+			TaskType: "lottery", Input: `{"points":100}`, Output: output,
+			MemoryIDs: ids, RuleThreshold: 120, IsCorrect: isCorrect,
+		}
+	}
+	tasks := []model.Task{
+		task("1", `{"allow":true,"reason":"够80"}`, &bad), // 跟随旧门槛 => stale
+		task("2", `{"allow":true,"reason":"随便"}`, &bad),  // 记忆正确但没跟随 => ignored
+		task("1,2", `{"allow":false}`, &good),            // 判对不计
+		task("", `{"allow":true}`, &bad),                 // 无记忆
+		task("3", `{"allow":true}`, &bad),                // 提取不到门槛
+		task("1", `not json`, &bad),                      // 输出不可解析
+	}
+	got := attributeErrors(tasks, memories)
+	want := ErrorAttribution{Incorrect: 5, StaleMemory: 1, MemoryIgnored: 1, NoMemory: 1, Unattributed: 2, StaleMemoryShare: 0.2}
+	if got != want {
+		t.Fatalf("unexpected attribution: got %+v want %+v", got, want)
+	}
+}
@@ -0,0 +1,150 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// OpenAIClient OpenAI 兼容协议（/v1/chat/completions）后端
+// 适用于 vLLM / llama.cpp server / Ollama / LM Studio 等本地推理服务，无需再套一层 Dify workflow。
+type OpenAIClient struct {
+	BaseURL      string
+	APIKey       string
+	Model        string
+	SystemPrompt string
+	Temperature  float64
+	MaxTokens    int
+	Client       *http.Client
+}
+
+func NewOpenAIClient(baseURL, apiKey, model, systemPrompt string, temperature float64, maxTokens int, timeoutSeconds int) *OpenAIClient {
+	baseURL = strings.TrimRight(strings.TrimSpace(baseURL), "/")
+	if timeoutSeconds <= 0 {
+		timeoutSeconds = 60
+	}
+	return &OpenAIClient{
+		BaseURL:      baseURL,
+		APIKey:       apiKey,
+		Model:        model,
+		SystemPrompt: systemPrompt,
+		Temperature:  temperature,
+		MaxTokens:    maxTokens,
+		Client: &http.Client{
+			Timeout: time.Duration(timeoutSeconds) * time.Second,
+		},
+	}
+}
+
+type openAIChatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type openAIChatRequest struct {
+	Model       string              `json:"model"`
+	Messages    []openAIChatMessage `json:"messages"`
+	Temperature float64             `json:"temperature"`
+	MaxTokens   int                 `json:"max_tokens,omitempty"`
+	Stream      bool                `json:"stream"`
+}
+
+type openAIChatResponse struct {
+	ID      string `json:"id"`
+	Choices []struct {
+		Index   int               `json:"index"`
+		Message openAIChatMessage `json:"message"`
+	} `json:"choices"`
+	Usage LLMUsage `json:"usage"`
+}
+
+// BuildInputs 实现 LLMProvider：OpenAI 协议只使用 prompt，inputs 原样透传（不参与请求）
+func (c *OpenAIClient) BuildInputs(prompt, query string, fallback map[string]interface{}) map[string]interface{} {
+	return fallback
+}
+
+// Complete 实现 LLMProvider：prompt 作为 user 消息发送；SystemPrompt 非空时作为 system 消息
+func (c *OpenAIClient) Complete(ctx context.Context, prompt string, inputs map[string]interface{}) (*LLMResponse, error) {
+	url := fmt.Sprintf("%s/chat/completions", c.BaseURL)
+
+	messages := make([]openAIChatMessage, 0, 2)
+	if strings.TrimSpace(c.SystemPrompt) != "" {
+		messages = append(messages, openAIChatMessage{Role: "system", Content: c.SystemPrompt})
+	}
+	messages = append(messages, openAIChatMessage{Role: "user", Content: prompt})
+
+	reqBody := openAIChatRequest{
+		Model:       c.Model,
+		Messages:    messages,
+		Temperature: c.Temperature,
+		MaxTokens:   c.MaxTokens,
+	}
+
+	jsonData, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("序列化请求失败: %w", err)
+	}
+
+	var lastErr error
+	maxR := difyMaxRetries()
+	for attempt := 0; attempt <= maxR; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
+		if err != nil {
+			return nil, fmt.Errorf("创建请求失败: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if c.APIKey != "" {
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.APIKey))
+		}
+
+		resp, err := c.Client.Do(req)
+		if err != nil {
+			lastErr = fmt.Errorf("请求失败: %w", err)
+			if attempt < maxR && ctx.Err() == nil && isRetryableDifyErr(err) {
+				sleep := difyRetryBackoff(attempt + 1)
+				log.Printf("[openai] chat retry=%d/%d sleep=%s err=%v", attempt+1, maxR, sleep, err)
+				if err := sleepWithContext(ctx, sleep); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			return nil, lastErr
+		}
+
+		body, _ := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			lastErr = fmt.Errorf("API返回错误: %d, %s", resp.StatusCode, truncate(string(body), 500))
+			if attempt < maxR && ctx.Err() == nil && isRetryableStatus(resp.StatusCode) {
+				sleep := difyRetryBackoff(attempt + 1)
+				log.Printf("[openai] chat retry=%d/%d sleep=%s status=%d", attempt+1, maxR, sleep, resp.StatusCode)
+				if err := sleepWithContext(ctx, sleep); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			return nil, lastErr
+		}
+
+		var chatResp openAIChatResponse
+		if err := json.Unmarshal(body, &chatResp); err != nil {
+			return nil, fmt.Errorf("解析响应失败: %w", err)
+		}
+		if len(chatResp.Choices) == 0 {
+			return nil, fmt.Errorf("响应中没有 choices: %s", truncate(string(body), 500))
+		}
+		answer := chatResp.Choices[0].Message.Content
+		return &LLMResponse{
+			Answer: answer,
+			Usage:  completeUsage(chatResp.Usage, prompt, answer),
+		}, nil
+	}
+	return nil, lastErr
+}
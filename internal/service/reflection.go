@@ -8,21 +8,21 @@ import (
 	"strings"
 	"time"
 
-	"mem-test/internal/db"
 	"mem-test/internal/model"
-
-	"gorm.io/gorm"
+	"mem-test/internal/repository"
 )
 
 type ReflectionService struct {
-	difyClient    *DifyClient
+	store         *repository.Store
+	llm           LLMProvider
 	memosClient   *MemOSClient
 	memosUserPref string
 }
 
-func NewReflectionService(difyClient *DifyClient, memosClient *MemOSClient, memosUserPref string) *ReflectionService {
+func NewReflectionService(store *repository.Store, llm LLMProvider, memosClient *MemOSClient, memosUserPref string) *ReflectionService {
 	return &ReflectionService{
-		difyClient:    difyClient,
+		store:         store,
+		llm:           llm,
 		memosClient:   memosClient,
 		memosUserPref: memosUserPref,
 	}
@@ -31,43 +31,26 @@ func NewReflectionService(difyClient *DifyClient, memosClient *MemOSClient, memo
 // ReflectAndSaveMemory 反思并保存记忆
 func (s *ReflectionService) ReflectAndSaveMemory(ctx context.Context, taskID uint, feedback *model.Feedback) (*model.Memory, error) {
 	// 获取任务信息
-	var task model.Task
-	if err := db.DB.First(&task, taskID).Error; err != nil {
+	task, err := s.store.Tasks.Get(ctx, taskID)
+	if err != nil {
 		return nil, fmt.Errorf("获取任务失败: %w", err)
 	}
 
 	// 如果这次是判错反馈，对本次使用到的记忆进行“反向降权/可废弃”
 	if feedback != nil && feedback.Type == "incorrect" {
-		s.penalizeUsedMemories(ctx, &task)
+		s.penalizeUsedMemories(ctx, task)
 	}
 
 	// 构建反思提示词
-	reflectionPrompt := s.buildReflectionPrompt(&task, feedback)
-
-	// 调用Dify进行反思（智能选择 chat / completion / workflow）
-	var inputs map[string]interface{}
-	if s.difyClient != nil && s.difyClient.AppType == "workflow" {
-		systemKey := s.difyClient.WorkflowSystemKey
-		queryKey := s.difyClient.WorkflowQueryKey
-		if systemKey == "" {
-			systemKey = "system"
-		}
-		if queryKey == "" {
-			queryKey = "query"
-		}
-		// query 必填：用反馈内容承载（更像 user input）
-		inputs = map[string]interface{}{
-			systemKey: reflectionPrompt,
-			queryKey:  feedback.Content,
-		}
-	} else {
-		inputs = map[string]interface{}{
-			"task_id":  taskID,
-			"feedback": feedback.Content,
-		}
-	}
+	reflectionPrompt := s.buildReflectionPrompt(task, feedback)
+
+	// 调用大模型进行反思（Dify 下智能选择 chat / completion / workflow）
+	inputs := buildLLMInputs(s.llm, reflectionPrompt, feedback.Content, map[string]interface{}{
+		"task_id":  taskID,
+		"feedback": feedback.Content,
+	})
 
-	resp, err := s.difyClient.ChatOrCompletion(reflectionPrompt, inputs)
+	resp, err := s.llm.Complete(ctx, reflectionPrompt, inputs)
 	if err != nil {
 		return nil, fmt.Errorf("反思失败: %w", err)
 	}
@@ -81,27 +64,9 @@ func (s *ReflectionService) ReflectAndSaveMemory(ctx context.Context, taskID uin
 	// 补全归并键（兼容旧数据：默认空串，但新写入必须填充）
 	memory.TriggerKey = normalizeTriggerKey(memory.Trigger)
 
-	// 检查是否已有相似记忆（用于演化）
-	// 注意：trigger是MySQL保留关键字，需要用反引号包裹
-	var existingMemory model.Memory
-	q := db.DB.Model(&model.Memory{}).
-		Where("trigger_key = ? AND apply_to = ?", memory.TriggerKey, memory.ApplyTo)
-	if task.RunID > 0 {
-		q = q.Where("run_id = ?", task.RunID)
-	}
-	query := q.
-		Order("version DESC").
-		First(&existingMemory)
-
-	if query.Error == nil {
-		// 演化：更新版本
-		memory.Version = existingMemory.Version + 1
-		// 可以选择覆盖或保留旧版本
-	}
-
-	// 保存记忆
-	if err := db.DB.Create(memory).Error; err != nil {
-		return nil, fmt.Errorf("保存记忆失败: %w", err)
+	// 保存记忆（已有同一归并键的记忆时演化为新版本）
+	if err := s.saveEvolvingMemory(ctx, task, feedback, memory); err != nil {
+		return nil, err
 	}
 
 	// run_id=0 的常规模式：同步写入 MemOS（作为长期外部记忆层）
@@ -125,95 +90,42 @@ func (s *ReflectionService) ReflectAndSaveMemory(ctx context.Context, taskID uin
 	feedback.UsedForMemory = true
 	memoryID := memory.ID
 	feedback.MemoryID = &memoryID
-	db.DB.Save(feedback)
+	_ = s.store.Feedbacks.Save(ctx, feedback)
 
 	return memory, nil
 }
 
+// ReflectWithStrategy 按组策略（含消融开关）选择反思方式：
+// run → 只写 run 内记忆；global → 固化到全局池；validated → 验证通过后再固化；memos 控制是否同步写入 MemOS
+func (s *ReflectionService) ReflectWithStrategy(ctx context.Context, strategy GroupStrategy, taskID uint, feedback *model.Feedback) (*model.Memory, error) {
+	switch strategy.Reflection {
+	case ReflectionRun:
+		return s.ReflectAndSaveMemory(ctx, taskID, feedback)
+	case ReflectionGlobal, ReflectionValidated:
+		return s.reflectAndConsolidateGlobal(ctx, taskID, feedback, consolidateOptions{
+			validate:  strategy.Reflection == ReflectionValidated,
+			memos:     strategy.MemOS,
+			poolRunID: strategy.PoolRunID,
+		})
+	}
+	return nil, nil
+}
+
+// consolidateOptions 全局固化的可消融组件
+type consolidateOptions struct {
+	// 固化前用近期样本做快速一致性验证（E/F 组）
+	validate bool
+	// 同步写入 MemOS 外部长期记忆层
+	memos bool
+	// 固化目标：0 为共享全局池，>0 为该 run 的隔离全局池
+	poolRunID uint
+}
+
 // ReflectAndSaveMemoryAndConsolidateGlobal 用于实验 D 组：
 // - 仍然把“本次 run 的反思产物”写入 run_id=task.RunID（便于论文级追踪）
 // - 额外把经验“固化/整合”到全局中期记忆池（run_id=0 且 derived_from 带 global 前缀），使下一次跑实验可复用
 func (s *ReflectionService) ReflectAndSaveMemoryAndConsolidateGlobal(ctx context.Context, taskID uint, feedback *model.Feedback) (*model.Memory, error) {
-	// 获取任务信息
-	var task model.Task
-	if err := db.DB.First(&task, taskID).Error; err != nil {
-		return nil, fmt.Errorf("获取任务失败: %w", err)
-	}
-	if task.RunID == 0 {
-		// 非实验模式不走“全局固化池”，保持原行为（可避免把日常零散数据混入实验池）
-		return s.ReflectAndSaveMemory(ctx, taskID, feedback)
-	}
-
-	// 判错反馈：先对使用到的记忆做反向追责
-	if feedback != nil && feedback.Type == "incorrect" {
-		s.penalizeUsedMemories(ctx, &task)
-	}
-
-	// D 组：更强调“抽象可执行规则”，并注入实验元数据，提升总结规律质量
-	reflectionPrompt := s.buildReflectionPromptForGlobal(&task, feedback)
-
-	// 调用 Dify
-	var inputs map[string]interface{}
-	if s.difyClient != nil && s.difyClient.AppType == "workflow" {
-		systemKey := s.difyClient.WorkflowSystemKey
-		queryKey := s.difyClient.WorkflowQueryKey
-		if systemKey == "" {
-			systemKey = "system"
-		}
-		if queryKey == "" {
-			queryKey = "query"
-		}
-		inputs = map[string]interface{}{
-			systemKey: reflectionPrompt,
-			queryKey:  feedback.Content,
-		}
-	} else {
-		inputs = map[string]interface{}{
-			"task_id":  taskID,
-			"feedback": feedback.Content,
-		}
-	}
-
-	resp, err := s.difyClient.ChatOrCompletion(reflectionPrompt, inputs)
-	if err != nil {
-		return nil, fmt.Errorf("反思失败: %w", err)
-	}
-
-	// 解析 + 保存 run 内记忆（追踪用）
-	runMemory := s.parseReflectionResult(resp.Answer, feedback)
-	runMemory.RunID = task.RunID
-	runMemory.ApplyTo = task.TaskType
-	runMemory.TriggerKey = normalizeTriggerKey(runMemory.Trigger)
-	if err := s.saveEvolvingMemory(ctx, &task, runMemory); err != nil {
-		return nil, err
-	}
-
-	// 固化到全局池（run_id=0, derived_from=global|...）
-	if err := s.consolidateToGlobal(ctx, &task, runMemory); err != nil {
-		log.Printf("[global_memo] consolidate failed task_id=%d run_id=%d err=%v", task.ID, task.RunID, err)
-	}
-
-	// D 组：同步写入 MemOS（外部长期记忆层）
-	// 注意：仅 D 组使用 MemOS，避免影响 A/B/C 的可归因对照
-	if s.memosClient != nil && s.memosClient.Enabled() {
-		userID := s.memOSUserID(task.TaskType)
-		if err := s.memosClient.RegisterUser(ctx, userID); err != nil {
-			log.Printf("[memos] register user failed user=%s err=%v", userID, err)
-		}
-		content := fmt.Sprintf("apply_to=%s trigger=%s lesson=%s confidence=%.4f", runMemory.ApplyTo, runMemory.Trigger, runMemory.Lesson, runMemory.Confidence)
-		source := fmt.Sprintf("mem-test|exp|group=D|run_id=%d|task_id=%d|memory_id=%d", task.RunID, task.ID, runMemory.ID)
-		if err := s.memosClient.AddMemory(ctx, userID, content, source); err != nil {
-			log.Printf("[memos] add memory failed user=%s err=%v", userID, err)
-		}
-	}
-
-	// 更新反馈记录（仍关联 run 内产物，便于追踪）
-	feedback.UsedForMemory = true
-	memoryID := runMemory.ID
-	feedback.MemoryID = &memoryID
-	db.DB.Save(feedback)
-
-	return runMemory, nil
+	return s.reflectAndConsolidateGlobal(ctx, taskID, feedback, consolidateOptions{memos: true})
 }
 
 // ReflectAndSaveMemoryAndConsolidateGlobalValidated 用于实验 E 组：
@@ -222,56 +134,55 @@ func (s *ReflectionService) ReflectAndSaveMemoryAndConsolidateGlobal(ctx context
 // - 通过后固化到全局中期记忆池（run_id=0 & derived_from=global|...）
 // - 同步写入 MemOS（外部长期记忆层）
 func (s *ReflectionService) ReflectAndSaveMemoryAndConsolidateGlobalValidated(ctx context.Context, taskID uint, feedback *model.Feedback) (*model.Memory, error) {
-	var task model.Task
-	if err := db.DB.First(&task, taskID).Error; err != nil {
+	return s.reflectAndConsolidateGlobal(ctx, taskID, feedback, consolidateOptions{validate: true, memos: true})
+}
+
+func (s *ReflectionService) reflectAndConsolidateGlobal(ctx context.Context, taskID uint, feedback *model.Feedback, opts consolidateOptions) (*model.Memory, error) {
+	// 获取任务信息
+	task, err := s.store.Tasks.Get(ctx, taskID)
+	if err != nil {
 		return nil, fmt.Errorf("获取任务失败: %w", err)
 	}
 	if task.RunID == 0 {
+		// 非实验模式不走“全局固化池”，保持原行为（可避免把日常零散数据混入实验池）
 		return s.ReflectAndSaveMemory(ctx, taskID, feedback)
 	}
 
+	// 判错反馈：先对使用到的记忆做反向追责
 	if feedback != nil && feedback.Type == "incorrect" {
-		s.penalizeUsedMemories(ctx, &task)
+		s.penalizeUsedMemories(ctx, task)
 	}
 
-	reflectionPrompt := s.buildReflectionPromptForGlobal(&task, feedback)
-	var inputs map[string]interface{}
-	if s.difyClient != nil && s.difyClient.AppType == "workflow" {
-		systemKey := s.difyClient.WorkflowSystemKey
-		queryKey := s.difyClient.WorkflowQueryKey
-		if systemKey == "" {
-			systemKey = "system"
-		}
-		if queryKey == "" {
-			queryKey = "query"
-		}
-		inputs = map[string]interface{}{
-			systemKey: reflectionPrompt,
-			queryKey:  feedback.Content,
-		}
-	} else {
-		inputs = map[string]interface{}{
-			"task_id":  taskID,
-			"feedback": feedback.Content,
-		}
-	}
+	// D 组：更强调“抽象可执行规则”，并注入实验元数据，提升总结规律质量
+	reflectionPrompt := s.buildReflectionPromptForGlobal(task, feedback)
+
+	// 调用大模型
+	inputs := buildLLMInputs(s.llm, reflectionPrompt, feedback.Content, map[string]interface{}{
+		"task_id":  taskID,
+		"feedback": feedback.Content,
+	})
 
-	resp, err := s.difyClient.ChatOrCompletion(reflectionPrompt, inputs)
+	resp, err := s.llm.Complete(ctx, reflectionPrompt, inputs)
 	if err != nil {
 		return nil, fmt.Errorf("反思失败: %w", err)
 	}
 
+	// 解析 + 保存 run 内记忆（追踪用）
 	runMemory := s.parseReflectionResult(resp.Answer, feedback)
 	runMemory.RunID = task.RunID
 	runMemory.ApplyTo = task.TaskType
 	runMemory.TriggerKey = normalizeTriggerKey(runMemory.Trigger)
-	if err := s.saveEvolvingMemory(ctx, &task, runMemory); err != nil {
+	if err := s.saveEvolvingMemory(ctx, task, feedback, runMemory); err != nil {
 		return nil, err
 	}
 
-	pass := s.quickValidateMemoryAgainstRecentTasks(ctx, &task, runMemory, 20)
+	// 固化到全局池（run_id=0, derived_from=global|...）；validate 时先验证
+	pass := true
+	if opts.validate {
+		pass = s.quickValidateMemoryAgainstRecentTasks(ctx, task, runMemory, 20)
+	}
 	if pass {
-		if err := s.consolidateToGlobal(ctx, &task, runMemory); err != nil {
+		if err := s.consolidateToGlobal(ctx, task, runMemory, opts.poolRunID); err != nil {
 			log.Printf("[global_memo] consolidate failed task_id=%d run_id=%d err=%v", task.ID, task.RunID, err)
 		}
 	} else {
@@ -279,23 +190,28 @@ func (s *ReflectionService) ReflectAndSaveMemoryAndConsolidateGlobalValidated(ct
 		log.Printf("[global_memo] skip consolidate due to validation failed task_id=%d run_id=%d", task.ID, task.RunID)
 	}
 
-	// E 组：同步写入 MemOS（外部长期记忆层）
-	if s.memosClient != nil && s.memosClient.Enabled() {
+	// 同步写入 MemOS（外部长期记忆层）
+	// 注意：仅 memos=true 的组使用 MemOS，避免影响 A/B/C 的可归因对照
+	if opts.memos && s.memosClient != nil && s.memosClient.Enabled() {
 		userID := s.memOSUserID(task.TaskType)
 		if err := s.memosClient.RegisterUser(ctx, userID); err != nil {
 			log.Printf("[memos] register user failed user=%s err=%v", userID, err)
 		}
 		content := fmt.Sprintf("apply_to=%s trigger=%s lesson=%s confidence=%.4f", runMemory.ApplyTo, runMemory.Trigger, runMemory.Lesson, runMemory.Confidence)
-		source := fmt.Sprintf("mem-test|exp|group=E|run_id=%d|task_id=%d|memory_id=%d|validated=%v", task.RunID, task.ID, runMemory.ID, pass)
+		source := fmt.Sprintf("mem-test|exp|group=%s|run_id=%d|task_id=%d|memory_id=%d", task.GroupType, task.RunID, task.ID, runMemory.ID)
+		if opts.validate {
+			source += fmt.Sprintf("|validated=%v", pass)
+		}
 		if err := s.memosClient.AddMemory(ctx, userID, content, source); err != nil {
 			log.Printf("[memos] add memory failed user=%s err=%v", userID, err)
 		}
 	}
 
+	// 更新反馈记录（仍关联 run 内产物，便于追踪）
 	feedback.UsedForMemory = true
 	memoryID := runMemory.ID
 	feedback.MemoryID = &memoryID
-	db.DB.Save(feedback)
+	_ = s.store.Feedbacks.Save(ctx, feedback)
 
 	return runMemory, nil
 }
@@ -317,32 +233,13 @@ func (s *ReflectionService) penalizeUsedMemories(ctx context.Context, task *mode
 	if len(ids) == 0 {
 		return
 	}
-	now := time.Now()
 	const failureThreshold = 3
 
 	// 说明：
 	// - 原子更新 failure_count，避免并发丢更新
 	// - 每次判错轻微降低 confidence，避免旧规则长期“霸榜”
 	// - 失败次数达到阈值后标记 deprecated，检索时过滤
-	updates := map[string]interface{}{
-		"failure_count":  gorm.Expr("failure_count + 1"),
-		"last_failed_at": now,
-		"confidence":     gorm.Expr("GREATEST(confidence - ?, 0)", 0.05),
-		"deprecated": gorm.Expr(
-			"CASE WHEN failure_count + 1 >= ? THEN 1 ELSE deprecated END",
-			failureThreshold,
-		),
-		"deprecated_at": gorm.Expr(
-			"CASE WHEN failure_count + 1 >= ? AND (deprecated = 0 OR deprecated IS NULL) THEN ? ELSE deprecated_at END",
-			failureThreshold,
-			now,
-		),
-	}
-
-	_ = db.DB.WithContext(ctx).
-		Model(&model.Memory{}).
-		Where("id IN ?", ids).
-		Updates(updates).Error
+	_ = s.store.Memories.Penalize(ctx, ids, time.Now(), 0.05, failureThreshold)
 }
 
 func (s *ReflectionService) buildReflectionPrompt(task *model.Task, feedback *model.Feedback) string {
@@ -402,26 +299,25 @@ func (s *ReflectionService) buildReflectionPromptForGlobal(task *model.Task, fee
 	return prompt.String()
 }
 
-func (s *ReflectionService) saveEvolvingMemory(ctx context.Context, task *model.Task, memory *model.Memory) error {
-	// 检查是否已有相似记忆（用于演化）
-	var existingMemory model.Memory
-	q := db.DB.WithContext(ctx).Model(&model.Memory{}).
-		Where("trigger_key = ? AND apply_to = ?", memory.TriggerKey, memory.ApplyTo)
-	if task.RunID > 0 {
-		q = q.Where("run_id = ?", task.RunID)
+// saveEvolvingMemory 写入 run 内记忆：同一归并键已有记忆时版本 +1 并链接到上一版本，同时记录来源任务与反馈
+func (s *ReflectionService) saveEvolvingMemory(ctx context.Context, task *model.Task, feedback *model.Feedback, memory *model.Memory) error {
+	memory.SourceTaskID = task.ID
+	if feedback != nil {
+		memory.SourceFeedbackID = feedback.ID
 	}
-	query := q.Order("version DESC").First(&existingMemory)
-
-	if query.Error == nil {
+	// 检查是否已有相似记忆（用于演化）
+	if existingMemory, err := s.store.Memories.LatestByTrigger(ctx, task.RunID, memory.TriggerKey, memory.ApplyTo); err == nil {
 		memory.Version = existingMemory.Version + 1
+		memory.ParentID = existingMemory.ID
 	}
-	if err := db.DB.WithContext(ctx).Create(memory).Error; err != nil {
+	if err := s.store.Memories.Create(ctx, memory); err != nil {
 		return fmt.Errorf("保存记忆失败: %w", err)
 	}
 	return nil
 }
 
-func (s *ReflectionService) consolidateToGlobal(ctx context.Context, task *model.Task, runMemory *model.Memory) error {
+// consolidateToGlobal 固化到全局池；poolRunID=0 为共享全局池，>0 为该 run 的隔离全局池
+func (s *ReflectionService) consolidateToGlobal(ctx context.Context, task *model.Task, runMemory *model.Memory, poolRunID uint) error {
 	if task == nil || runMemory == nil {
 		return nil
 	}
@@ -440,14 +336,11 @@ func (s *ReflectionService) consolidateToGlobal(ctx context.Context, task *model
 	}
 
 	// 查找全局池的最新版本（只取 derived_from=global|... 的记录）
-	var existing model.Memory
-	q := db.DB.WithContext(ctx).Model(&model.Memory{}).
-		Where("run_id = 0 AND apply_to = ? AND trigger_key = ? AND derived_from LIKE ?", applyTo, triggerKey, "global|%").
-		Order("version DESC").
-		First(&existing)
+	existing, err := s.store.Memories.LatestInPool(ctx, poolRunID, triggerKey, applyTo)
 
 	newGlobal := &model.Memory{
 		RunID:       0,
+		PoolRunID:   poolRunID,
 		Trigger:     strings.TrimSpace(runMemory.Trigger),
 		TriggerKey:  triggerKey,
 		Lesson:      strings.TrimSpace(runMemory.Lesson),
@@ -455,6 +348,10 @@ func (s *ReflectionService) consolidateToGlobal(ctx context.Context, task *model
 		ApplyTo:     applyTo,
 		Confidence:  runMemory.Confidence,
 		Version:     1,
+
+		SourceMemoryID:   runMemory.ID,
+		SourceTaskID:     task.ID,
+		SourceFeedbackID: runMemory.SourceFeedbackID,
 	}
 	// 置信度边界（避免模型异常输出）
 	if newGlobal.Confidence < 0 {
@@ -464,22 +361,17 @@ func (s *ReflectionService) consolidateToGlobal(ctx context.Context, task *model
 		newGlobal.Confidence = 1
 	}
 
-	if q.Error == nil {
+	if err == nil {
 		// 若规则文本几乎一致：不新增版本，仅轻微提高置信度（“重复证据”）
 		if normalizeLessonText(existing.Lesson) == normalizeLessonText(newGlobal.Lesson) &&
 			normalizeLessonText(existing.Trigger) == normalizeLessonText(newGlobal.Trigger) {
-			return db.DB.WithContext(ctx).
-				Model(&model.Memory{}).
-				Where("id = ?", existing.ID).
-				Updates(map[string]interface{}{
-					"confidence": gorm.Expr("LEAST(confidence + ?, 1)", 0.02),
-					"updated_at": time.Now(),
-				}).Error
+			return s.store.Memories.Reinforce(ctx, existing.ID, time.Now(), 0.02)
 		}
 		newGlobal.Version = existing.Version + 1
+		newGlobal.ParentID = existing.ID
 	}
 
-	return db.DB.WithContext(ctx).Create(newGlobal).Error
+	return s.store.Memories.Create(ctx, newGlobal)
 }
 
 func normalizeLessonText(s string) string {
@@ -505,13 +397,14 @@ func (s *ReflectionService) quickValidateMemoryAgainstRecentTasks(ctx context.Co
 		return false
 	}
 
-	var tasks []model.Task
-	q := db.DB.WithContext(ctx).Model(&model.Task{}).
-		Where("run_id = ? AND task_type = ? AND rule_threshold > 0", task.RunID, tt).
-		Order("id DESC").
-		Limit(limit).
-		Find(&tasks)
-	if q.Error != nil || len(tasks) < 5 {
+	tasks, err := s.store.Tasks.Find(ctx, repository.TaskFilter{
+		RunID:         task.RunID,
+		TaskType:      tt,
+		WithThreshold: true,
+		Order:         repository.TaskOrderIDDesc,
+		Limit:         limit,
+	})
+	if err != nil || len(tasks) < 5 {
 		return false
 	}
 
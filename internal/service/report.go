@@ -3,6 +3,7 @@ package service
 import (
 	"encoding/json"
 	"fmt"
+	"math"
 	"strings"
 	"time"
 
@@ -16,9 +17,26 @@ func RenderConclusionMarkdown(run *model.ExperimentRun, result *ExperimentRunRes
 	b.WriteString(fmt.Sprintf("- task_type: %s\n", run.TaskType))
 	b.WriteString(fmt.Sprintf("- runs_per_group: %d\n", run.RunsPerGroup))
 	b.WriteString(fmt.Sprintf("- seed: %d\n", run.Seed))
+	if result.GlobalPool != "" && result.GlobalPool != GlobalPoolLive {
+		b.WriteString(fmt.Sprintf("- global_pool: %s", result.GlobalPool))
+		if result.BaseSnapshotID > 0 {
+			b.WriteString(fmt.Sprintf("（base_snapshot_id=%d）", result.BaseSnapshotID))
+		}
+		b.WriteString("\n")
+	}
+	if result.EndSnapshotID > 0 {
+		b.WriteString(fmt.Sprintf("- end_snapshot_id: %d\n", result.EndSnapshotID))
+	}
+	if result.EvalRounds > 0 {
+		b.WriteString(fmt.Sprintf("- eval_rounds: %d（eval_seed=%d, distribution=%s）\n", result.EvalRounds, result.EvalSeed, result.EvalDistribution))
+	}
 	b.WriteString(fmt.Sprintf("- created_at: %s\n\n", run.CreatedAt.Format(time.RFC3339)))
 
-	b.WriteString("## 组内统计（仅本次 run）\n\n")
+	if result.EvalRounds > 0 {
+		b.WriteString("## 组内统计（仅本次 run，训练阶段）\n\n")
+	} else {
+		b.WriteString("## 组内统计（仅本次 run）\n\n")
+	}
 	b.WriteString("| 组别 | N | Incorrect | ErrorRate | CI95 |\n")
 	b.WriteString("| --- | ---: | ---: | ---: | --- |\n")
 	for _, g := range result.Groups {
@@ -31,6 +49,19 @@ func RenderConclusionMarkdown(run *model.ExperimentRun, result *ExperimentRunRes
 	}
 	b.WriteString("\n")
 
+	if result.EvalRounds > 0 {
+		renderEvalTable(&b, result)
+	}
+
+	if len(result.Features) > 0 {
+		renderAblationTable(&b, result)
+	}
+
+	renderErrorAttribution(&b, result.Groups, result.Stats)
+	renderLearningCurves(&b, result.Groups, result.Tests)
+	renderPairwiseMatrix(&b, result.Tests)
+	renderPairedTable(&b, result.Groups, result.Tests)
+
 	b.WriteString("## 显著性检验\n\n")
 	if len(result.Tests) == 0 {
 		b.WriteString("- 无（可能样本不足或统计失败）\n\n")
@@ -73,3 +104,343 @@ func RenderConclusionMarkdown(run *model.ExperimentRun, result *ExperimentRunRes
 	}
 	return b.String()
 }
+
+// RenderSweepMarkdown 矩阵实验汇总：每个 (task_type, rule_mode) 一张表，列出各组跨 seed 的错误率与一致性
+func RenderSweepMarkdown(report *SweepReport) string {
+	var b strings.Builder
+	b.WriteString("# 矩阵实验汇总（task_type × rule_mode × seed）\n\n")
+	b.WriteString(fmt.Sprintf("- sweep_id: %d\n", report.SweepID))
+	b.WriteString(fmt.Sprintf("- status: %s\n", report.Status))
+	b.WriteString(fmt.Sprintf("- task_types: %s\n", strings.Join(report.TaskTypes, ", ")))
+	b.WriteString(fmt.Sprintf("- rule_modes: %s\n", strings.Join(report.RuleModes, ", ")))
+	b.WriteString(fmt.Sprintf("- seeds: %v\n", report.Seeds))
+	b.WriteString(fmt.Sprintf("- runs_per_group: %d\n", report.RunsPerGroup))
+	b.WriteString(fmt.Sprintf("- generated_at: %s\n", report.GeneratedAt.Format(time.RFC3339)))
+	if len(report.SkippedRunIDs) > 0 {
+		b.WriteString(fmt.Sprintf("- 未完成、未参与汇总的 run: %v\n", report.SkippedRunIDs))
+	}
+	b.WriteString("\n")
+
+	if len(report.Cells) == 0 {
+		b.WriteString("暂无已完成的 run。\n")
+		return b.String()
+	}
+
+	for _, cell := range report.Cells {
+		b.WriteString(fmt.Sprintf("## task_type=%s, rule_mode=%s\n\n", cell.TaskType, cell.RuleMode))
+		b.WriteString(fmt.Sprintf("- seeds: %v（run_id: %v）\n", cell.Seeds, cell.RunIDs))
+		if cell.BestGroup != "" {
+			stable := "否"
+			if cell.BestGroupStable {
+				stable = "是"
+			}
+			b.WriteString(fmt.Sprintf("- 合并错误率最低: %s（每个 seed 均最低: %s）\n", cell.BestGroup, stable))
+		}
+		b.WriteString("\n")
+		b.WriteString("| 组别 | Seeds | Mean | Std | Pooled N | Pooled ErrorRate | Pooled CI95 | 优/劣于基线 | 一致性 |\n")
+		b.WriteString("| --- | ---: | ---: | ---: | ---: | ---: | --- | --- | --- |\n")
+		for _, g := range cell.Groups {
+			b.WriteString(fmt.Sprintf("| %s | %d | %.3f | %.3f | %d | %.3f | [%.3f, %.3f] | %d/%d vs %s | %s |\n",
+				g.Group, g.Seeds, g.Mean, g.Std, g.PooledN, g.PooledErrorRate, g.PooledCI95Low, g.PooledCI95High,
+				g.WinsVsBaseline, g.LossesVsBaseline, g.Baseline, g.Consistency))
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// renderAblationTable 各组实际生效的组件 + 错误率；* 表示被本次 ablations 覆盖
+func renderAblationTable(b *strings.Builder, result *ExperimentRunResult) {
+	b.WriteString("## 组件消融\n\n")
+	b.WriteString("| 组别 | self_check | rerank | stm_limit | memos | bandit | validate_before_consolidate | change_detection | ErrorRate | CI95 |\n")
+	b.WriteString("| --- | --- | --- | ---: | --- | --- | --- | --- | ---: | --- |\n")
+	onOff := func(v bool, overridden bool) string {
+		s := "off"
+		if v {
+			s = "on"
+		}
+		if overridden {
+			s += "*"
+		}
+		return s
+	}
+	for _, g := range result.Groups {
+		f, ok := result.Features[g]
+		if !ok {
+			continue
+		}
+		flags := result.Ablations[g]
+		stm := fmt.Sprintf("%d", f.STMLimit)
+		if flags.STMLimit != nil {
+			stm += "*"
+		}
+		s := result.Stats[g]
+		b.WriteString(fmt.Sprintf("| %s | %s | %s | %s | %s | %s | %s | %s | %.3f | [%.3f, %.3f] |\n",
+			g,
+			onOff(f.SelfCheck, flags.SelfCheck != nil),
+			onOff(f.Rerank, flags.Rerank != nil),
+			stm,
+			onOff(f.MemOS, flags.MemOS != nil),
+			onOff(f.Bandit, flags.Bandit != nil),
+			onOff(f.ValidateBeforeConsolidate, flags.ValidateBeforeConsolidate != nil),
+			onOff(f.ChangeDetection, flags.ChangeDetection != nil),
+			s.ErrorRate, s.CI95Low, s.CI95High))
+	}
+	if len(result.Ablations) > 0 {
+		b.WriteString("\n`*` 表示该组件被本次 run 的 ablations 覆盖（其余为组策略默认值）。\n")
+	}
+	b.WriteString("\n")
+}
+
+// renderEvalTable 训练 vs 留出集（冻结记忆）错误率与 CI；gap>0 表示测试比训练差
+func renderEvalTable(b *strings.Builder, result *ExperimentRunResult) {
+	b.WriteString("## 训练 / 测试（冻结记忆）\n\n")
+	b.WriteString("| 组别 | Train N | Train ErrorRate | Train CI95 | Test N | Test ErrorRate | Test CI95 | Gap | p |\n")
+	b.WriteString("| --- | ---: | ---: | --- | ---: | ---: | --- | ---: | ---: |\n")
+	for _, g := range result.Groups {
+		tr := result.Stats[g]
+		ev, ok := result.EvalStats[g]
+		if !ok {
+			continue
+		}
+		p := "-"
+		if t, ok := result.EvalTests[g+"_eval_vs_train"].(map[string]interface{}); ok {
+			if v, ok := t["p_value"].(float64); ok {
+				p = fmt.Sprintf("%.4f", v)
+			}
+		}
+		b.WriteString(fmt.Sprintf("| %s | %d | %.3f | [%.3f, %.3f] | %d | %.3f | [%.3f, %.3f] | %+.3f | %s |\n",
+			g, tr.N, tr.ErrorRate, tr.CI95Low, tr.CI95High,
+			ev.N, ev.ErrorRate, ev.CI95Low, ev.CI95High, ev.ErrorRate-tr.ErrorRate, p))
+	}
+	b.WriteString("\n测试阶段不反思、不固化、不更新置信度/使用计数/bandit 状态，判错也不进入短期记忆；规则沿用训练最后一轮。\n\n")
+}
+
+// renderErrorAttribution 判错归因：过时记忆 / 忽略记忆 / 无记忆 / 无法归因
+func renderErrorAttribution(b *strings.Builder, groups []string, stats map[string]GroupStats) {
+	var rows []string
+	for _, g := range groups {
+		attr := stats[g].ErrorAttribution
+		if attr == nil || attr.Incorrect == 0 {
+			continue
+		}
+		rows = append(rows, fmt.Sprintf("| %s | %d | %d | %d | %d | %d | %.3f |\n",
+			g, attr.Incorrect, attr.StaleMemory, attr.MemoryIgnored, attr.NoMemory, attr.Unattributed, attr.StaleMemoryShare))
+	}
+	if len(rows) == 0 {
+		return
+	}
+	b.WriteString("## 判错归因（负迁移）\n\n")
+	b.WriteString("| 组别 | Incorrect | 过时记忆 | 忽略记忆 | 无记忆 | 无法归因 | 过时记忆占比 |\n")
+	b.WriteString("| --- | ---: | ---: | ---: | ---: | ---: | ---: |\n")
+	for _, r := range rows {
+		b.WriteString(r)
+	}
+	b.WriteString("\n过时记忆：注入记忆中的门槛与当前规则不一致，且答案与按该门槛推出的结论一致。\n\n")
+}
+
+// renderPairedTable 按 round 配对的组间比较（McNemar 精确检验 + 配对 bootstrap CI + 效应量）
+func renderPairedTable(b *strings.Builder, groups []string, tests map[string]interface{}) {
+	type row struct {
+		key string
+		pt  PairedTestResult
+	}
+	var rows []row
+	for j := range groups {
+		for i := 0; i < j; i++ {
+			for _, key := range []string{groups[j] + "_vs_" + groups[i], groups[i] + "_vs_" + groups[j]} {
+				t, ok := tests[key].(map[string]interface{})
+				if !ok {
+					continue
+				}
+				if pt, ok := t["paired"].(PairedTestResult); ok {
+					rows = append(rows, row{key: key, pt: pt})
+				}
+				break
+			}
+		}
+	}
+	if len(rows) == 0 {
+		return
+	}
+	b.WriteString("## 配对检验（同一输入逐轮配对）\n\n")
+	b.WriteString("| 比较 | 配对数 | 仅前者错 | 仅后者错 | McNemar p | 错误率差 | 差值 CI95（bootstrap） | Cohen's h | OR | 配对 OR |\n")
+	b.WriteString("| --- | ---: | ---: | ---: | ---: | ---: | --- | ---: | ---: | ---: |\n")
+	for _, r := range rows {
+		pt := r.pt
+		b.WriteString(fmt.Sprintf("| %s | %d | %d | %d | %.4f | %+.3f | [%+.3f, %+.3f] | %+.3f | %.3f | %.3f |\n",
+			r.key, pt.NPairs, pt.OnlyEarlierIncorrect, pt.OnlyLaterIncorrect, pt.McNemarP,
+			pt.DiffErrorRate, pt.DiffCI95Low, pt.DiffCI95High, pt.CohenH, pt.OddsRatio, pt.PairedOddsRatio))
+	}
+	b.WriteString("\n`X_vs_Y`：“前者”为 Y、“后者”为 X；错误率差 = X − Y（负值表示 X 更好）；OR 为 X 相对 Y 的出错 odds（0.5 连续性校正）。\n\n")
+}
+
+// renderPairwiseMatrix 全部组对的显著性矩阵：单元格为 “Holm / BH” 校正后的 p，* 表示 Holm 校正后 p<0.05
+func renderPairwiseMatrix(b *strings.Builder, tests map[string]interface{}) {
+	mx, ok := tests["pairwise_matrix"].(PairwiseMatrix)
+	if !ok || len(mx.Groups) < 2 {
+		return
+	}
+	b.WriteString("## 两两显著性矩阵（多重比较校正）\n\n")
+	b.WriteString("| |")
+	for _, g := range mx.Groups {
+		b.WriteString(" " + g + " |")
+	}
+	b.WriteString("\n| --- |")
+	for range mx.Groups {
+		b.WriteString(" --- |")
+	}
+	b.WriteString("\n")
+	for i, gi := range mx.Groups {
+		b.WriteString("| " + gi + " |")
+		for j := range mx.Groups {
+			if mx.PHolm[i][j] == nil {
+				b.WriteString(" - |")
+				continue
+			}
+			mark := ""
+			if *mx.PHolm[i][j] < significanceLevel {
+				mark = "*"
+			}
+			b.WriteString(fmt.Sprintf(" %.4f / %.4f%s |", *mx.PHolm[i][j], *mx.PBH[i][j], mark))
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString(fmt.Sprintf("\n单元格为 Holm / BH 校正后的 p（校正族为全部 %d 组对；主检验为配对 McNemar 精确检验，无配对样本时为两比例 z 检验）；`*` 表示 Holm 校正后 p<0.05。结论只基于 Holm 校正值。\n\n", pairCount(len(mx.Groups))))
+}
+
+// renderLearningCurves 每组错误随轮次的逻辑回归斜率（含规则变更项）与 Cochran–Armitage 趋势检验
+func renderLearningCurves(b *strings.Builder, groups []string, tests map[string]interface{}) {
+	var rows []string
+	for _, g := range groups {
+		lc, ok := tests[g+"_learning_curve"].(LearningCurveResult)
+		if !ok {
+			continue
+		}
+		cp := "-"
+		if lc.SinceChange != nil {
+			cp = fmt.Sprintf("%+.3f [%+.3f, %+.3f] p=%.4f", lc.SinceChange.Estimate, lc.SinceChange.CI95Low, lc.SinceChange.CI95High, lc.SinceChange.P)
+		}
+		conv := ""
+		if !lc.Converged {
+			conv = "（未收敛）"
+		}
+		rows = append(rows, fmt.Sprintf("| %s | %d | %d | %+.4f%s | [%+.4f, %+.4f] | %.4f | %.3f | %s | %+.2f | %.4f |\n",
+			g, lc.N, lc.Errors, lc.Slope.Estimate, conv, lc.Slope.CI95Low, lc.Slope.CI95High, lc.Slope.P,
+			lc.OddsRatioPer10Rounds, cp, lc.CochranArmitageZ, lc.CochranArmitageP))
+	}
+	if len(rows) == 0 {
+		return
+	}
+	b.WriteString("## 学习曲线（错误 ~ 轮次）\n\n")
+	b.WriteString("| 组别 | N | 错误数 | 斜率（log-odds/轮） | 斜率 CI95 | 斜率 p | 每 10 轮 OR | 距变更轮数项 | Cochran–Armitage Z | CA p |\n")
+	b.WriteString("| --- | ---: | ---: | ---: | --- | ---: | ---: | --- | ---: | ---: |\n")
+	for _, r := range rows {
+		b.WriteString(r)
+	}
+	b.WriteString("\n模型：logit P(错) = b0 + 斜率·round + 变更项·(距上次规则变更的轮数)；斜率显著为负即判定为“学习”。\n\n")
+}
+
+// forestWidth 森林图文本条的字符宽度
+const forestWidth = 31
+
+// RenderMetaAnalysisMarkdown 跨 run 汇总：每个指标一张森林图风格的表（逐 run 估计 + 固定/随机效应合并 + 异质性）
+func RenderMetaAnalysisMarkdown(report *MetaAnalysisReport) string {
+	var b strings.Builder
+	b.WriteString("# 跨 run 汇总（meta 分析）\n\n")
+	b.WriteString(fmt.Sprintf("- task_type: %s\n", report.TaskType))
+	if report.RuleMode != "" {
+		b.WriteString(fmt.Sprintf("- rule_mode: %s\n", report.RuleMode))
+	}
+	if report.From != nil || report.To != nil {
+		from, to := "-", "-"
+		if report.From != nil {
+			from = report.From.Format(time.RFC3339)
+		}
+		if report.To != nil {
+			to = report.To.Format(time.RFC3339)
+		}
+		b.WriteString(fmt.Sprintf("- created_at: [%s, %s)\n", from, to))
+	}
+	b.WriteString(fmt.Sprintf("- run_ids: %v\n", report.RunIDs))
+	b.WriteString(fmt.Sprintf("- generated_at: %s\n\n", report.GeneratedAt.Format(time.RFC3339)))
+	if len(report.RunIDs) == 0 {
+		b.WriteString("没有符合条件的已完成 run。\n")
+		return b.String()
+	}
+
+	b.WriteString("## 各组错误率\n\n")
+	for _, est := range report.ErrorRates {
+		renderForestTable(&b, est, false)
+	}
+	b.WriteString("## 组间对比（错误率差，后者 − 前者，按 round 配对）\n\n")
+	for _, est := range report.Contrasts {
+		renderForestTable(&b, est, true)
+	}
+	b.WriteString("固定效应为逆方差加权；随机效应为 DerSimonian–Laird（τ² 为 run 间方差）。I² 表示 run 间差异中超出抽样误差的比例，I²>50% 时应以随机效应为准。\n")
+	return b.String()
+}
+
+func renderForestTable(b *strings.Builder, est MetaEstimate, zeroLine bool) {
+	b.WriteString(fmt.Sprintf("### %s\n\n", est.Name))
+	if len(est.Studies) == 0 {
+		b.WriteString("- 无数据\n\n")
+		return
+	}
+	lo, hi := est.Random.CI95Low, est.Random.CI95High
+	for _, s := range est.Studies {
+		lo, hi = math.Min(lo, s.CI95Low), math.Max(hi, s.CI95High)
+	}
+	lo, hi = math.Min(lo, est.Fixed.CI95Low), math.Max(hi, est.Fixed.CI95High)
+	if zeroLine {
+		lo, hi = math.Min(lo, 0), math.Max(hi, 0)
+	}
+
+	b.WriteString("| 来源 | N | 估计 | CI95 | 权重(固定/随机) | 森林图 |\n")
+	b.WriteString("| --- | ---: | ---: | --- | --- | --- |\n")
+	for _, s := range est.Studies {
+		b.WriteString(fmt.Sprintf("| run %d (seed=%d) | %d | %.3f | [%.3f, %.3f] | %.1f%% / %.1f%% | `%s` |\n",
+			s.RunID, s.Seed, s.N, s.Estimate, s.CI95Low, s.CI95High, 100*s.WeightFixed, 100*s.WeightRandom,
+			forestBar(s.CI95Low, s.Estimate, s.CI95High, lo, hi, zeroLine, '■')))
+	}
+	for _, p := range []struct {
+		label  string
+		pooled MetaPooled
+	}{{"固定效应", est.Fixed}, {"随机效应", est.Random}} {
+		b.WriteString(fmt.Sprintf("| **%s** | | **%.3f** | [%.3f, %.3f] (p=%.4f) | | `%s` |\n",
+			p.label, p.pooled.Estimate, p.pooled.CI95Low, p.pooled.CI95High, p.pooled.P,
+			forestBar(p.pooled.CI95Low, p.pooled.Estimate, p.pooled.CI95High, lo, hi, zeroLine, '◆')))
+	}
+	b.WriteString(fmt.Sprintf("\n异质性：Q=%.3f (df=%d, p=%.4f)，I²=%.1f%%，τ²=%.5f；坐标范围 [%.3f, %.3f]\n\n",
+		est.Q, est.DF, est.QP, 100*est.I2, est.Tau2, lo, hi))
+}
+
+// forestBar 把 [low, high] 区间与点估计画到 [min, max] 刻度上；zeroLine 时在 0 处画竖线
+func forestBar(low, est, high, min, max float64, zeroLine bool, mark rune) string {
+	line := []rune(strings.Repeat(" ", forestWidth))
+	pos := func(v float64) int {
+		if max <= min {
+			return forestWidth / 2
+		}
+		i := int(math.Round((v - min) / (max - min) * float64(forestWidth-1)))
+		if i < 0 {
+			return 0
+		}
+		if i >= forestWidth {
+			return forestWidth - 1
+		}
+		return i
+	}
+	if zeroLine {
+		line[pos(0)] = '|'
+	}
+	l, h := pos(low), pos(high)
+	for i := l; i <= h; i++ {
+		if line[i] == ' ' {
+			line[i] = '-'
+		}
+	}
+	line[l], line[h] = '[', ']'
+	line[pos(est)] = mark
+	return string(line)
+}
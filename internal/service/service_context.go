@@ -1,16 +1,25 @@
 package service
 
 import (
+	"context"
+	"fmt"
+	"log"
+
 	"mem-test/internal/config"
+	"mem-test/internal/repository"
 )
 
 type ServiceContext struct {
+	Store             *repository.Store
 	AgentService      *AgentService
 	CoachService      *CoachService
 	ReflectionService *ReflectionService
+	Cassette          *LLMCassette
 }
 
-func NewServiceContext(cfg *config.Config) *ServiceContext {
+// NewServiceContext 组装各服务；store 由调用方按 database.driver 打开后注入。
+// llm provider 未知或 cassette 配置不合法时返回错误：静默退回其他模型（或要求回放却改走真实模型）会破坏可复现性
+func NewServiceContext(cfg *config.Config, store *repository.Store) (*ServiceContext, error) {
 	difyClient := NewDifyClient(
 		cfg.Dify.BaseURL,
 		cfg.Dify.APIKey,
@@ -22,9 +31,51 @@ func NewServiceContext(cfg *config.Config) *ServiceContext {
 	)
 	memosClient := NewMemOSClient(cfg.MemOS.BaseURL, cfg.MemOS.TopK)
 
-	return &ServiceContext{
-		AgentService:      NewAgentService(difyClient, memosClient, cfg.MemOS.UserPrefix),
-		CoachService:      NewCoachService(),
-		ReflectionService: NewReflectionService(difyClient, memosClient, cfg.MemOS.UserPrefix),
+	agentLLM, err := NewLLMProvider(cfg.LLM.AgentProvider, cfg, difyClient)
+	if err != nil {
+		return nil, fmt.Errorf("llm.agent_provider 配置无效: %w", err)
+	}
+	reflectionLLM, err := NewLLMProvider(cfg.LLM.ReflectionProvider, cfg, difyClient)
+	if err != nil {
+		return nil, fmt.Errorf("llm.reflection_provider 配置无效: %w", err)
 	}
+
+	cassette, err := NewLLMCassette(cfg.Cassette.Mode, cfg.Cassette.Dir, cfg.Cassette.ReplayPath, cfg.Cassette.AllowLoose)
+	if err != nil {
+		return nil, fmt.Errorf("cassette 配置无效: %w", err)
+	}
+	agentLLM = cassette.Wrap(agentLLM, "agent")
+	reflectionLLM = cassette.Wrap(reflectionLLM, "reflection")
+
+	agent := NewAgentService(store, agentLLM, memosClient, cfg.MemOS.UserPrefix)
+	groups, err := NewGroupRegistryFromConfig(cfg.Groups)
+	if err != nil {
+		log.Printf("[groups] invalid groups config, only builtin A-F enabled: %v", err)
+		groups = NewGroupRegistry()
+	}
+	agent.groups = groups
+	retriever, err := NewMemoryRetriever(cfg.Retrieval)
+	if err != nil {
+		log.Printf("[retrieval] invalid retrieval config, fallback to recency: %v", err)
+		retriever = nil
+	}
+	agent.retriever = retriever
+	if retrievalMode(cfg.Retrieval) == RetrievalModeBM25 {
+		// 索引装饰 store.Memories：此后各服务写入/废弃/删除记忆都会同步索引
+		idx, err := store.EnableKeywordIndex(context.Background(), cfg.Retrieval.BM25K1, cfg.Retrieval.BM25B)
+		if err != nil {
+			log.Printf("[retrieval] build keyword index failed, fallback to recency: %v", err)
+		} else {
+			agent.keywords = idx
+			log.Printf("[retrieval] keyword index ready memories=%d", idx.Len())
+		}
+	}
+
+	return &ServiceContext{
+		Store:             store,
+		AgentService:      agent,
+		CoachService:      NewCoachService(store),
+		ReflectionService: NewReflectionService(store, reflectionLLM, memosClient, cfg.MemOS.UserPrefix),
+		Cassette:          cassette,
+	}, nil
 }
@@ -0,0 +1,46 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"mem-test/internal/config"
+	"mem-test/internal/repository"
+)
+
+// TestNewServiceContext_InvalidCassette replay 缺少 replay_path 时启动失败，而不是退回真实模型
+func TestNewServiceContext_InvalidCassette(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.LLM.AgentProvider = LLMProviderMock
+	cfg.LLM.ReflectionProvider = LLMProviderMock
+	if _, err := NewServiceContext(cfg, repository.NewMemoryStore()); err != nil {
+		t.Fatalf("valid config: %v", err)
+	}
+
+	cfg.Cassette.Mode = CassetteModeReplay
+	if svc, err := NewServiceContext(cfg, repository.NewMemoryStore()); err == nil || svc != nil {
+		t.Fatalf("replay without replay_path should fail: %v", err)
+	}
+}
+
+// TestNewServiceContext_UnknownProvider 未知 provider 启动失败并列出可选值，而不是退回 dify
+func TestNewServiceContext_UnknownProvider(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.LLM.AgentProvider = LLMProviderMock
+	cfg.LLM.ReflectionProvider = "opena1"
+	svc, err := NewServiceContext(cfg, repository.NewMemoryStore())
+	if err == nil || svc != nil {
+		t.Fatalf("unknown reflection provider should fail")
+	}
+	for _, want := range []string{"reflection_provider", "opena1", LLMProviderDify, LLMProviderOpenAI, LLMProviderMock} {
+		if !strings.Contains(err.Error(), want) {
+			t.Fatalf("error %q should mention %q", err.Error(), want)
+		}
+	}
+
+	cfg.LLM.ReflectionProvider = ""
+	cfg.LLM.AgentProvider = "gpt"
+	if _, err := NewServiceContext(cfg, repository.NewMemoryStore()); err == nil || !strings.Contains(err.Error(), "agent_provider") {
+		t.Fatalf("unknown agent provider should fail: %v", err)
+	}
+}
@@ -1,11 +1,12 @@
 package service
 
 import (
+	"context"
 	"fmt"
 	"math"
 
-	"mem-test/internal/db"
 	"mem-test/internal/model"
+	"mem-test/internal/repository"
 )
 
 type GroupStats struct {
@@ -15,145 +16,49 @@ type GroupStats struct {
 	ErrorRate float64 `json:"error_rate"`
 	CI95Low   float64 `json:"ci95_low"`
 	CI95High  float64 `json:"ci95_high"`
+	// 判错归因（过时记忆 / 忽略记忆 / 无记忆），只在 run 统计中填写
+	ErrorAttribution *ErrorAttribution `json:"error_attribution,omitempty"`
 }
 
-// ComputeRunStatsAndTests 论文级：只统计本 run_id，并做显著性检验/趋势检验
-func ComputeRunStatsAndTests(runID uint, groups []string, trend map[string][]int) (map[string]GroupStats, map[string]interface{}, error) {
+// ComputeRunStatsAndTests 论文级：只统计本 run_id 的训练阶段，并做显著性检验/趋势检验
+// groups 应按组注册顺序排列（GroupRegistry.Ordered），保证比较键稳定；评估阶段见 ComputeRunEvalStats
+func ComputeRunStatsAndTests(ctx context.Context, store *repository.Store, runID uint, groups []string, trend map[string][]int) (map[string]GroupStats, map[string]interface{}, error) {
 	stats := map[string]GroupStats{}
 	tests := map[string]interface{}{}
+	outcomes := map[string]map[int]bool{}
 
 	for _, g := range groups {
-		var tasks []model.Task
-		if err := db.DB.Where("run_id = ? AND group_type = ?", runID, g).Find(&tasks).Error; err != nil {
+		tasks, err := store.Tasks.Find(ctx, repository.TaskFilter{RunID: runID, GroupType: g, ExcludePhase: model.TaskPhaseEval})
+		if err != nil {
 			return nil, nil, fmt.Errorf("查询任务失败: %w", err)
 		}
 		gs := calcGroupStats(tasks)
-		stats[g] = gs
-	}
-
-	// 组间显著性：C vs A, C vs B
-	if a, okA := stats["A"]; okA {
-		if c, okC := stats["C"]; okC {
-			p, z := twoPropZTest(a.Incorrect, a.N, c.Incorrect, c.N)
-			tests["C_vs_A"] = map[string]interface{}{
-				"p_value": p,
-				"z":       z,
-			}
-		}
-	}
-	if b, okB := stats["B"]; okB {
-		if c, okC := stats["C"]; okC {
-			p, z := twoPropZTest(b.Incorrect, b.N, c.Incorrect, c.N)
-			tests["C_vs_B"] = map[string]interface{}{
-				"p_value": p,
-				"z":       z,
-			}
-		}
-	}
-
-	// 组间显著性：D vs A/B/C（如果有 D 组）
-	if d, okD := stats["D"]; okD {
-		if a, okA := stats["A"]; okA {
-			p, z := twoPropZTest(a.Incorrect, a.N, d.Incorrect, d.N)
-			tests["D_vs_A"] = map[string]interface{}{
-				"p_value": p,
-				"z":       z,
-			}
-		}
-		if b, okB := stats["B"]; okB {
-			p, z := twoPropZTest(b.Incorrect, b.N, d.Incorrect, d.N)
-			tests["D_vs_B"] = map[string]interface{}{
-				"p_value": p,
-				"z":       z,
-			}
+		attr, err := groupErrorAttribution(ctx, store, tasks)
+		if err != nil {
+			return nil, nil, err
 		}
-		if c, okC := stats["C"]; okC {
-			p, z := twoPropZTest(c.Incorrect, c.N, d.Incorrect, d.N)
-			tests["D_vs_C"] = map[string]interface{}{
-				"p_value": p,
-				"z":       z,
-			}
+		gs.ErrorAttribution = attr
+		stats[g] = gs
+		outcomes[g] = roundOutcomes(tasks)
+		// 学习曲线：Cochran–Armitage 趋势检验 + 逻辑回归（round 斜率 + 规则变更项）
+		if lc, ok := learningCurve(tasks); ok {
+			tests[g+"_learning_curve"] = lc
 		}
 	}
 
-	// 组间显著性：E vs A/B/C/D（如果有 E 组）
-	if e, okE := stats["E"]; okE {
-		if a, okA := stats["A"]; okA {
-			p, z := twoPropZTest(a.Incorrect, a.N, e.Incorrect, e.N)
-			tests["E_vs_A"] = map[string]interface{}{
-				"p_value": p,
-				"z":       z,
-			}
-		}
-		if b, okB := stats["B"]; okB {
-			p, z := twoPropZTest(b.Incorrect, b.N, e.Incorrect, e.N)
-			tests["E_vs_B"] = map[string]interface{}{
-				"p_value": p,
-				"z":       z,
-			}
-		}
-		if c, okC := stats["C"]; okC {
-			p, z := twoPropZTest(c.Incorrect, c.N, e.Incorrect, e.N)
-			tests["E_vs_C"] = map[string]interface{}{
-				"p_value": p,
-				"z":       z,
-			}
-		}
-		if d, okD := stats["D"]; okD {
-			p, z := twoPropZTest(d.Incorrect, d.N, e.Incorrect, e.N)
-			tests["E_vs_D"] = map[string]interface{}{
-				"p_value": p,
-				"z":       z,
-			}
-		}
-	}
+	pairwiseTests(tests, groups, stats, outcomes)
 
-	// 组间显著性：F vs A/B/C/D/E（如果有 F 组）
-	if f, okF := stats["F"]; okF {
-		if a, okA := stats["A"]; okA {
-			p, z := twoPropZTest(a.Incorrect, a.N, f.Incorrect, f.N)
-			tests["F_vs_A"] = map[string]interface{}{
-				"p_value": p,
-				"z":       z,
-			}
-		}
-		if b, okB := stats["B"]; okB {
-			p, z := twoPropZTest(b.Incorrect, b.N, f.Incorrect, f.N)
-			tests["F_vs_B"] = map[string]interface{}{
-				"p_value": p,
-				"z":       z,
-			}
-		}
-		if c, okC := stats["C"]; okC {
-			p, z := twoPropZTest(c.Incorrect, c.N, f.Incorrect, f.N)
-			tests["F_vs_C"] = map[string]interface{}{
-				"p_value": p,
-				"z":       z,
-			}
-		}
-		if d, okD := stats["D"]; okD {
-			p, z := twoPropZTest(d.Incorrect, d.N, f.Incorrect, f.N)
-			tests["F_vs_D"] = map[string]interface{}{
-				"p_value": p,
-				"z":       z,
-			}
-		}
-		if e, okE := stats["E"]; okE {
-			p, z := twoPropZTest(e.Incorrect, e.N, f.Incorrect, f.N)
-			tests["F_vs_E"] = map[string]interface{}{
-				"p_value": p,
-				"z":       z,
-			}
+	// 粗粒度趋势：每组前半 vs 后半（两比例检验；结论以 <g>_learning_curve 为准，这里仅作参考）
+	for _, g := range groups {
+		flags, ok := trend[g]
+		if !ok || len(flags) < 10 {
+			continue
 		}
-	}
-
-	// 趋势检验：C 前半 vs 后半（两比例检验）
-	if cTrend, ok := trend["C"]; ok && len(cTrend) >= 10 {
-		mid := len(cTrend) / 2
-		firstN, firstBad := mid, sumInt(cTrend[:mid])
-		lastN, lastBad := len(cTrend)-mid, sumInt(cTrend[mid:])
+		mid := len(flags) / 2
+		firstN, firstBad := mid, sumInt(flags[:mid])
+		lastN, lastBad := len(flags)-mid, sumInt(flags[mid:])
 		p, z := twoPropZTest(firstBad, firstN, lastBad, lastN)
-		tests["C_trend_first_vs_second_half"] = map[string]interface{}{
+		tests[g+"_trend_first_vs_second_half"] = map[string]interface{}{
 			"p_value":                p,
 			"z":                      z,
 			"first_half_error_rate":  float64(firstBad) / math.Max(float64(firstN), 1),
@@ -161,49 +66,32 @@ func ComputeRunStatsAndTests(runID uint, groups []string, trend map[string][]int
 		}
 	}
 
-	// 趋势检验：D 前半 vs 后半（两比例检验）
-	if dTrend, ok := trend["D"]; ok && len(dTrend) >= 10 {
-		mid := len(dTrend) / 2
-		firstN, firstBad := mid, sumInt(dTrend[:mid])
-		lastN, lastBad := len(dTrend)-mid, sumInt(dTrend[mid:])
-		p, z := twoPropZTest(firstBad, firstN, lastBad, lastN)
-		tests["D_trend_first_vs_second_half"] = map[string]interface{}{
-			"p_value":                p,
-			"z":                      z,
-			"first_half_error_rate":  float64(firstBad) / math.Max(float64(firstN), 1),
-			"second_half_error_rate": float64(lastBad) / math.Max(float64(lastN), 1),
-		}
-	}
+	return stats, tests, nil
+}
 
-	// 趋势检验：E 前半 vs 后半（两比例检验）
-	if eTrend, ok := trend["E"]; ok && len(eTrend) >= 10 {
-		mid := len(eTrend) / 2
-		firstN, firstBad := mid, sumInt(eTrend[:mid])
-		lastN, lastBad := len(eTrend)-mid, sumInt(eTrend[mid:])
-		p, z := twoPropZTest(firstBad, firstN, lastBad, lastN)
-		tests["E_trend_first_vs_second_half"] = map[string]interface{}{
-			"p_value":                p,
-			"z":                      z,
-			"first_half_error_rate":  float64(firstBad) / math.Max(float64(firstN), 1),
-			"second_half_error_rate": float64(lastBad) / math.Max(float64(lastN), 1),
+// pairwiseTests 组间两两比较，键为“后者_vs_前者”（如 C_vs_A），groups 需按注册顺序排列：
+// p_value/z 为非配对两比例 z 检验；paired 为按 round 配对（各组输入相同）的 McNemar/bootstrap/效应量；
+// p_holm/p_bh 为全部组对上的多重比较校正（见 adjustPairwise），另写入 tests["pairwise_matrix"]
+func pairwiseTests(tests map[string]interface{}, groups []string, stats map[string]GroupStats, outcomes map[string]map[int]bool) {
+	for j := range groups {
+		later, ok := stats[groups[j]]
+		if !ok {
+			continue
 		}
-	}
-
-	// 趋势检验：F 前半 vs 后半（两比例检验）
-	if fTrend, ok := trend["F"]; ok && len(fTrend) >= 10 {
-		mid := len(fTrend) / 2
-		firstN, firstBad := mid, sumInt(fTrend[:mid])
-		lastN, lastBad := len(fTrend)-mid, sumInt(fTrend[mid:])
-		p, z := twoPropZTest(firstBad, firstN, lastBad, lastN)
-		tests["F_trend_first_vs_second_half"] = map[string]interface{}{
-			"p_value":                p,
-			"z":                      z,
-			"first_half_error_rate":  float64(firstBad) / math.Max(float64(firstN), 1),
-			"second_half_error_rate": float64(lastBad) / math.Max(float64(lastN), 1),
+		for i := 0; i < j; i++ {
+			earlier, ok := stats[groups[i]]
+			if !ok {
+				continue
+			}
+			p, z := twoPropZTest(earlier.Incorrect, earlier.N, later.Incorrect, later.N)
+			tests[fmt.Sprintf("%s_vs_%s", groups[j], groups[i])] = map[string]interface{}{
+				"p_value": p,
+				"z":       z,
+				"paired":  pairedTest(outcomes[groups[i]], outcomes[groups[j]]),
+			}
 		}
 	}
-
-	return stats, tests, nil
+	adjustPairwise(tests, groups, stats)
 }
 
 func calcGroupStats(tasks []model.Task) GroupStats {
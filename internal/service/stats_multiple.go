@@ -0,0 +1,133 @@
+package service
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// 组对比较的主检验：能按 round 配对时用 McNemar 精确检验，否则退回非配对两比例 z 检验
+const (
+	PrimaryTestMcNemar = "mcnemar_exact"
+	PrimaryTestZ       = "two_prop_z"
+)
+
+// significanceLevel 结论使用的显著性水平（作用于多重比较校正后的 p 值）
+const significanceLevel = 0.05
+
+// PairwiseMatrix 全部组对的显著性矩阵（对称，对角为 null）；校正族为本矩阵内的全部组对
+type PairwiseMatrix struct {
+	Groups []string `json:"groups"`
+	// P 为主检验原始 p；PHolm 为 Holm-Bonferroni 校正（控制 FWER）；PBH 为 Benjamini–Hochberg 校正（控制 FDR）
+	P     [][]*float64 `json:"p"`
+	PHolm [][]*float64 `json:"p_holm"`
+	PBH   [][]*float64 `json:"p_bh"`
+	// DiffErrorRate[i][j] = groups[i] 错误率 − groups[j] 错误率
+	DiffErrorRate [][]*float64 `json:"diff_error_rate"`
+}
+
+// holmAdjust Holm-Bonferroni 步降校正，返回与输入同序的校正 p
+func holmAdjust(p []float64) []float64 {
+	m := len(p)
+	idx := sortedIndex(p)
+	out := make([]float64, m)
+	running := 0.0
+	for rank, i := range idx {
+		v := math.Min(1, float64(m-rank)*p[i])
+		running = math.Max(running, v) // 保证单调
+		out[i] = running
+	}
+	return out
+}
+
+// bhAdjust Benjamini–Hochberg 步升校正，返回与输入同序的校正 p
+func bhAdjust(p []float64) []float64 {
+	m := len(p)
+	idx := sortedIndex(p)
+	out := make([]float64, m)
+	running := 1.0
+	for rank := m - 1; rank >= 0; rank-- {
+		i := idx[rank]
+		v := math.Min(1, p[i]*float64(m)/float64(rank+1))
+		running = math.Min(running, v)
+		out[i] = running
+	}
+	return out
+}
+
+// sortedIndex 按 p 升序的下标（稳定排序，结果可复现）
+func sortedIndex(p []float64) []int {
+	idx := make([]int, len(p))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(a, b int) bool { return p[idx[a]] < p[idx[b]] })
+	return idx
+}
+
+// adjustPairwise 对 pairwiseTests 写入的全部组对做多重比较校正：每个组对补充 primary_test/p_primary/p_holm/p_bh，
+// 并写入 tests["pairwise_matrix"]
+func adjustPairwise(tests map[string]interface{}, groups []string, stats map[string]GroupStats) {
+	type pair struct {
+		i, j  int // groups[j]_vs_groups[i]
+		entry map[string]interface{}
+	}
+	var pairs []pair
+	var ps []float64
+	for j := range groups {
+		for i := 0; i < j; i++ {
+			entry, ok := tests[fmt.Sprintf("%s_vs_%s", groups[j], groups[i])].(map[string]interface{})
+			if !ok {
+				continue
+			}
+			test, p := PrimaryTestZ, entry["p_value"].(float64)
+			if pt, ok := entry["paired"].(PairedTestResult); ok && pt.NPairs > 0 {
+				test, p = PrimaryTestMcNemar, pt.McNemarP
+			}
+			entry["primary_test"] = test
+			entry["p_primary"] = p
+			pairs = append(pairs, pair{i: i, j: j, entry: entry})
+			ps = append(ps, p)
+		}
+	}
+	if len(pairs) == 0 {
+		return
+	}
+	holm := holmAdjust(ps)
+	bh := bhAdjust(ps)
+
+	n := len(groups)
+	mx := PairwiseMatrix{
+		Groups:        append([]string(nil), groups...),
+		P:             newFloatMatrix(n),
+		PHolm:         newFloatMatrix(n),
+		PBH:           newFloatMatrix(n),
+		DiffErrorRate: newFloatMatrix(n),
+	}
+	for k, pr := range pairs {
+		pr.entry["p_holm"] = holm[k]
+		pr.entry["p_bh"] = bh[k]
+		setSymmetric(mx.P, pr.i, pr.j, ps[k])
+		setSymmetric(mx.PHolm, pr.i, pr.j, holm[k])
+		setSymmetric(mx.PBH, pr.i, pr.j, bh[k])
+		diff := stats[groups[pr.j]].ErrorRate - stats[groups[pr.i]].ErrorRate
+		dj, di := diff, -diff
+		mx.DiffErrorRate[pr.j][pr.i] = &dj
+		mx.DiffErrorRate[pr.i][pr.j] = &di
+	}
+	tests["pairwise_matrix"] = mx
+}
+
+func newFloatMatrix(n int) [][]*float64 {
+	m := make([][]*float64, n)
+	for i := range m {
+		m[i] = make([]*float64, n)
+	}
+	return m
+}
+
+func setSymmetric(m [][]*float64, i, j int, v float64) {
+	a, b := v, v
+	m[i][j] = &a
+	m[j][i] = &b
+}
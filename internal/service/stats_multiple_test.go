@@ -0,0 +1,63 @@
+package service
+
+import (
+	"math"
+	"testing"
+)
+
+func TestHolmAndBHAdjust(t *testing.T) {
+	p := []float64{0.01, 0.04, 0.03, 0.005}
+	wantHolm := []float64{0.03, 0.06, 0.06, 0.02}
+	wantBH := []float64{0.02, 0.04, 0.04, 0.02}
+	holm, bh := holmAdjust(p), bhAdjust(p)
+	for i := range p {
+		if math.Abs(holm[i]-wantHolm[i]) > 1e-12 || math.Abs(bh[i]-wantBH[i]) > 1e-12 {
+			t.Fatalf("index %d: holm=%v bh=%v, want holm=%v bh=%v", i, holm[i], bh[i], wantHolm[i], wantBH[i])
+		}
+	}
+}
+
+// TestAdjustPairwise_Conclusion 结论只采信 Holm 校正后显著的组对，原始显著但校正后不显著的记为注意事项
+func TestAdjustPairwise_Conclusion(t *testing.T) {
+	groups := []string{"A", "C", "G"}
+	stats := map[string]GroupStats{
+		"A": {N: 40, Incorrect: 20, ErrorRate: 0.5},
+		"C": {N: 40, Incorrect: 4, ErrorRate: 0.1},
+		"G": {N: 40, Incorrect: 15, ErrorRate: 0.375},
+	}
+	a, c, g := map[int]bool{}, map[int]bool{}, map[int]bool{}
+	for r := 0; r < 40; r++ {
+		a[r] = r%2 == 0
+		c[r] = r%10 == 0
+		g[r] = r%2 == 0 && r%16 != 0 && r != 6
+	}
+	tests := map[string]interface{}{}
+	pairwiseTests(tests, groups, stats, map[string]map[int]bool{"A": a, "C": c, "G": g})
+
+	mx, ok := tests["pairwise_matrix"].(PairwiseMatrix)
+	if !ok {
+		t.Fatalf("pairwise_matrix missing")
+	}
+	if mx.PHolm[0][0] != nil || *mx.PHolm[1][0] != *mx.PHolm[0][1] {
+		t.Fatalf("matrix should be symmetric with empty diagonal")
+	}
+	ca := tests["C_vs_A"].(map[string]interface{})
+	if ca["primary_test"] != PrimaryTestMcNemar || ca["p_holm"].(float64) < ca["p_primary"].(float64) {
+		t.Fatalf("unexpected C_vs_A entry: %+v", ca)
+	}
+	ga := tests["G_vs_A"].(map[string]interface{})
+	if ga["p_primary"].(float64) >= 0.05 && ga["p_holm"].(float64) < 0.05 {
+		t.Fatalf("adjusted p should never be smaller than raw p")
+	}
+
+	out := GenerateConclusionFromStats(stats, tests, nil)
+	sig := out["metrics"].(map[string]interface{})["significant_pairs"].([]string)
+	if len(sig) == 0 || sig[0][:3] != "C<A" {
+		t.Fatalf("expected C<A to be significant after adjustment, got %v", sig)
+	}
+	for _, s := range sig {
+		if s[:3] == "G<A" {
+			t.Fatalf("G<A should not survive adjustment: %v", sig)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package service
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+
+	"mem-test/internal/model"
+)
+
+// pairedBootstrapResamples / pairedBootstrapSeed 配对 bootstrap 的重采样次数与固定 seed（保证报告可复现）
+const (
+	pairedBootstrapResamples = 2000
+	pairedBootstrapSeed      = 20240601
+)
+
+// PairedTestResult 同一 run 内两组在相同输入（同一 round）上的配对比较；“后者”为键 X_vs_Y 中的 X
+type PairedTestResult struct {
+	// 两组都已判题的 round 数
+	NPairs        int `json:"n_pairs"`
+	BothCorrect   int `json:"both_correct"`
+	BothIncorrect int `json:"both_incorrect"`
+	// 不一致对：只有前者错 / 只有后者错
+	OnlyEarlierIncorrect int `json:"only_earlier_incorrect"`
+	OnlyLaterIncorrect   int `json:"only_later_incorrect"`
+	// McNemar 精确检验（不一致对上的双侧二项检验）
+	McNemarP float64 `json:"mcnemar_p"`
+	// 错误率差（后者 - 前者，仅配对样本）及配对 bootstrap 95% CI
+	DiffErrorRate float64 `json:"diff_error_rate"`
+	DiffCI95Low   float64 `json:"diff_ci95_low"`
+	DiffCI95High  float64 `json:"diff_ci95_high"`
+	// 效应量：Cohen's h（后者 - 前者）；边际 odds ratio（后者/前者的出错 odds）与配对（条件）odds ratio，均做 0.5 连续性校正
+	CohenH          float64 `json:"cohen_h"`
+	OddsRatio       float64 `json:"odds_ratio"`
+	PairedOddsRatio float64 `json:"paired_odds_ratio"`
+}
+
+// roundOutcomes 已判题任务按 round 取结果（true 为判错）；同一 round 重复记录只取第一条
+func roundOutcomes(tasks []model.Task) map[int]bool {
+	out := map[int]bool{}
+	for _, t := range tasks {
+		if t.IsCorrect == nil {
+			continue
+		}
+		if _, dup := out[t.Round]; dup {
+			continue
+		}
+		out[t.Round] = !*t.IsCorrect
+	}
+	return out
+}
+
+// pairedTest 以 round 为配对单位比较两组；earlier/later 为 round -> 是否判错
+func pairedTest(earlier, later map[int]bool) PairedTestResult {
+	rounds := make([]int, 0, len(earlier))
+	for r := range earlier {
+		if _, ok := later[r]; ok {
+			rounds = append(rounds, r)
+		}
+	}
+	sort.Ints(rounds)
+
+	res := PairedTestResult{NPairs: len(rounds), McNemarP: 1}
+	if len(rounds) == 0 {
+		return res
+	}
+	e := make([]bool, len(rounds))
+	l := make([]bool, len(rounds))
+	errE, errL := 0, 0
+	for i, r := range rounds {
+		e[i], l[i] = earlier[r], later[r]
+		switch {
+		case e[i] && l[i]:
+			res.BothIncorrect++
+		case e[i]:
+			res.OnlyEarlierIncorrect++
+		case l[i]:
+			res.OnlyLaterIncorrect++
+		default:
+			res.BothCorrect++
+		}
+		if e[i] {
+			errE++
+		}
+		if l[i] {
+			errL++
+		}
+	}
+	n := float64(len(rounds))
+	pE, pL := float64(errE)/n, float64(errL)/n
+
+	res.McNemarP = mcnemarExactP(res.OnlyEarlierIncorrect, res.OnlyLaterIncorrect)
+	res.DiffErrorRate = pL - pE
+	res.DiffCI95Low, res.DiffCI95High = pairedBootstrapCI(e, l, pairedBootstrapResamples, pairedBootstrapSeed)
+	res.CohenH = cohenH(pE, pL)
+	res.OddsRatio = ((float64(errL) + 0.5) / (n - float64(errL) + 0.5)) / ((float64(errE) + 0.5) / (n - float64(errE) + 0.5))
+	res.PairedOddsRatio = (float64(res.OnlyLaterIncorrect) + 0.5) / (float64(res.OnlyEarlierIncorrect) + 0.5)
+	return res
+}
+
+// mcnemarExactP McNemar 精确检验：不一致对 b+c 上 Binomial(b+c, 0.5) 的双侧 p 值
+func mcnemarExactP(b, c int) float64 {
+	n := b + c
+	if n == 0 {
+		return 1
+	}
+	k := b
+	if c < k {
+		k = c
+	}
+	// P(X <= k)，对数空间累加避免大 n 溢出
+	tail := 0.0
+	for i := 0; i <= k; i++ {
+		tail += math.Exp(logChoose(n, i) - float64(n)*math.Ln2)
+	}
+	return math.Min(1, 2*tail)
+}
+
+func logChoose(n, k int) float64 {
+	a, _ := math.Lgamma(float64(n + 1))
+	b, _ := math.Lgamma(float64(k + 1))
+	c, _ := math.Lgamma(float64(n - k + 1))
+	return a - b - c
+}
+
+// cohenH 两比例效应量：2·asin(√p2) − 2·asin(√p1)
+func cohenH(p1, p2 float64) float64 {
+	return 2*math.Asin(math.Sqrt(p2)) - 2*math.Asin(math.Sqrt(p1))
+}
+
+// pairedBootstrapCI 按 round 成对重采样，返回错误率差（later - earlier）的 percentile 95% CI
+func pairedBootstrapCI(earlier, later []bool, resamples int, seed int64) (float64, float64) {
+	n := len(earlier)
+	if n == 0 || resamples <= 0 {
+		return 0, 0
+	}
+	rng := rand.New(rand.NewSource(seed))
+	diffs := make([]float64, resamples)
+	for b := 0; b < resamples; b++ {
+		d := 0
+		for i := 0; i < n; i++ {
+			j := rng.Intn(n)
+			if later[j] {
+				d++
+			}
+			if earlier[j] {
+				d--
+			}
+		}
+		diffs[b] = float64(d) / float64(n)
+	}
+	sort.Float64s(diffs)
+	return percentileSorted(diffs, 0.025), percentileSorted(diffs, 0.975)
+}
+
+// percentileSorted 已排序样本的线性插值分位数
+func percentileSorted(sorted []float64, q float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	pos := q * float64(len(sorted)-1)
+	lo := int(math.Floor(pos))
+	hi := int(math.Ceil(pos))
+	if lo == hi {
+		return sorted[lo]
+	}
+	return sorted[lo] + (pos-float64(lo))*(sorted[hi]-sorted[lo])
+}
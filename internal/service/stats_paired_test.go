@@ -0,0 +1,50 @@
+package service
+
+import (
+	"math"
+	"testing"
+)
+
+// TestMcNemarExactP 与二项分布精确值对照
+func TestMcNemarExactP(t *testing.T) {
+	if p := mcnemarExactP(0, 5); math.Abs(p-0.0625) > 1e-9 {
+		t.Fatalf("b=0 c=5: expected 0.0625, got %v", p)
+	}
+	if p := mcnemarExactP(1, 9); math.Abs(p-22.0/1024) > 1e-9 {
+		t.Fatalf("b=1 c=9: expected %v, got %v", 22.0/1024, p)
+	}
+	if p := mcnemarExactP(4, 4); p != 1 {
+		t.Fatalf("balanced discordant pairs should give p=1, got %v", p)
+	}
+}
+
+// TestPairedTest 只在两组都判题的 round 上配对；后者更好时差值与 CI 为负
+func TestPairedTest(t *testing.T) {
+	earlier := map[int]bool{}
+	later := map[int]bool{}
+	for r := 0; r < 40; r++ {
+		earlier[r] = r%2 == 0 // 50% 错
+		later[r] = r%10 == 0  // 10% 错，且都是 earlier 也错的 round
+	}
+	earlier[99] = true // 无配对，忽略
+
+	res := pairedTest(earlier, later)
+	if res.NPairs != 40 || res.BothIncorrect != 4 || res.OnlyEarlierIncorrect != 16 || res.OnlyLaterIncorrect != 0 {
+		t.Fatalf("unexpected counts: %+v", res)
+	}
+	if math.Abs(res.DiffErrorRate-(-0.4)) > 1e-9 {
+		t.Fatalf("expected diff -0.4, got %v", res.DiffErrorRate)
+	}
+	if res.McNemarP >= 0.001 {
+		t.Fatalf("expected strong McNemar evidence, got p=%v", res.McNemarP)
+	}
+	if !(res.DiffCI95Low <= res.DiffErrorRate && res.DiffErrorRate <= res.DiffCI95High && res.DiffCI95High < 0) {
+		t.Fatalf("unexpected bootstrap CI [%v, %v]", res.DiffCI95Low, res.DiffCI95High)
+	}
+	if res.CohenH >= 0 || res.OddsRatio >= 1 || res.PairedOddsRatio >= 1 {
+		t.Fatalf("effect sizes should favour the later group: %+v", res)
+	}
+	if again := pairedTest(earlier, later); again != res {
+		t.Fatalf("paired test should be deterministic")
+	}
+}
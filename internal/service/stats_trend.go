@@ -0,0 +1,263 @@
+package service
+
+import (
+	"errors"
+	"math"
+	"sort"
+
+	"mem-test/internal/model"
+)
+
+// learningCurveMinN 拟合学习曲线所需的最少已判题轮次
+const learningCurveMinN = 10
+
+// logitRidge 非截距系数上的弱 L2 惩罚：完全分离（如后半段全对）时防止 IRLS 发散，对正常数据几乎无影响
+const logitRidge = 1e-3
+
+// LogitCoef 逻辑回归系数（Wald 95% CI 与双侧 p）
+type LogitCoef struct {
+	Estimate float64 `json:"estimate"`
+	SE       float64 `json:"se"`
+	CI95Low  float64 `json:"ci95_low"`
+	CI95High float64 `json:"ci95_high"`
+	P        float64 `json:"p_value"`
+}
+
+// LearningCurveResult 单组错误随轮次的变化：Cochran–Armitage 趋势检验 + 逻辑回归
+// logit P(错) = b0 + slope·round + since_change·(距上次规则变更的轮数)
+// 变更项用段内轮数而非累计变更次数：后者随 round 单调递增，两者近乎共线，会把斜率的 SE 撑大
+type LearningCurveResult struct {
+	N      int `json:"n"`
+	Errors int `json:"errors"`
+	// Cochran–Armitage 趋势检验（以 round 为得分）；Z<0 表示错误率随轮次下降
+	CochranArmitageZ float64 `json:"cochran_armitage_z"`
+	CochranArmitageP float64 `json:"cochran_armitage_p"`
+	// 每轮的 log-odds 变化；<0 且显著表示在学习
+	Slope LogitCoef `json:"slope"`
+	// 距上次规则变更（首段为 run 开始）每多一轮的 log-odds 变化，<0 表示变更后在恢复（规则未变更时为空）
+	SinceChange *LogitCoef `json:"since_change,omitempty"`
+	Intercept   float64    `json:"intercept"`
+	// 每 10 轮的出错 odds 倍数（exp(10·slope)）
+	OddsRatioPer10Rounds float64 `json:"odds_ratio_per_10_rounds"`
+	Converged            bool    `json:"converged"`
+}
+
+// Learning 斜率显著为负（错误率随轮次下降）
+func (r LearningCurveResult) Learning() bool {
+	return r.Converged && r.Slope.Estimate < 0 && r.Slope.P < significanceLevel
+}
+
+// learningCurve 按 round 对已判题任务拟合学习曲线；样本不足或结果单一时 ok=false
+func learningCurve(tasks []model.Task) (LearningCurveResult, bool) {
+	type obs struct {
+		round, version int
+		bad            bool
+	}
+	seen := map[int]bool{}
+	var data []obs
+	for _, t := range tasks {
+		if t.IsCorrect == nil || seen[t.Round] {
+			continue
+		}
+		seen[t.Round] = true
+		v := t.RuleVersion
+		if v < 1 {
+			v = 1
+		}
+		data = append(data, obs{round: t.Round, version: v, bad: !*t.IsCorrect})
+	}
+	sort.Slice(data, func(i, j int) bool { return data[i].round < data[j].round })
+
+	res := LearningCurveResult{N: len(data)}
+	if len(data) < learningCurveMinN {
+		return res, false
+	}
+	scores := make([]float64, len(data))
+	y := make([]float64, len(data))
+	versionVaries := false
+	for i, o := range data {
+		scores[i] = float64(o.round)
+		if o.bad {
+			y[i] = 1
+			res.Errors++
+		}
+		if o.version != data[0].version {
+			versionVaries = true
+		}
+	}
+	if res.Errors == 0 || res.Errors == len(data) {
+		// 全对/全错：没有可估计的趋势
+		return res, false
+	}
+	res.CochranArmitageZ, res.CochranArmitageP = cochranArmitage(scores, y)
+
+	x := make([][]float64, len(data))
+	segStart := data[0].round
+	for i, o := range data {
+		if i > 0 && o.version != data[i-1].version {
+			segStart = o.round
+		}
+		row := []float64{1, float64(o.round)}
+		if versionVaries {
+			row = append(row, float64(o.round-segStart))
+		}
+		x[i] = row
+	}
+	beta, cov, converged, err := fitLogistic(x, y)
+	if err != nil {
+		return res, false
+	}
+	res.Converged = converged
+	res.Intercept = beta[0]
+	res.Slope = waldCoef(beta[1], cov[1][1])
+	res.OddsRatioPer10Rounds = math.Exp(10 * beta[1])
+	if versionVaries {
+		sc := waldCoef(beta[2], cov[2][2])
+		res.SinceChange = &sc
+	}
+	return res, true
+}
+
+// cochranArmitage 二分类结果的线性趋势检验（每个观测一个得分），返回 Z 与双侧 p
+func cochranArmitage(scores, y []float64) (z, p float64) {
+	n := float64(len(y))
+	if n == 0 {
+		return 0, 1
+	}
+	pbar, sbar := 0.0, 0.0
+	for i := range y {
+		pbar += y[i]
+		sbar += scores[i]
+	}
+	pbar /= n
+	sbar /= n
+	t, ss := 0.0, 0.0
+	for i := range y {
+		t += scores[i] * (y[i] - pbar)
+		ss += (scores[i] - sbar) * (scores[i] - sbar)
+	}
+	v := pbar * (1 - pbar) * ss
+	if v <= 0 {
+		return 0, 1
+	}
+	z = t / math.Sqrt(v)
+	return z, 2 * (1 - normCDF(math.Abs(z)))
+}
+
+func waldCoef(est, variance float64) LogitCoef {
+	se := math.Sqrt(math.Max(variance, 0))
+	c := LogitCoef{Estimate: est, SE: se, P: 1}
+	c.CI95Low, c.CI95High = est-1.96*se, est+1.96*se
+	if se > 0 {
+		c.P = 2 * (1 - normCDF(math.Abs(est/se)))
+	}
+	return c
+}
+
+// fitLogistic IRLS（Newton–Raphson）拟合逻辑回归；x 的第一列为截距。返回系数、协方差（惩罚后 Fisher 信息的逆）
+func fitLogistic(x [][]float64, y []float64) (beta []float64, cov [][]float64, converged bool, err error) {
+	if len(x) == 0 {
+		return nil, nil, false, errors.New("无样本")
+	}
+	k := len(x[0])
+	beta = make([]float64, k)
+	var h [][]float64
+	for iter := 0; iter < 100; iter++ {
+		g := make([]float64, k)
+		h = make([][]float64, k)
+		for a := range h {
+			h[a] = make([]float64, k)
+		}
+		for i, row := range x {
+			eta := 0.0
+			for a := range row {
+				eta += row[a] * beta[a]
+			}
+			mu := 1 / (1 + math.Exp(-eta))
+			w := mu * (1 - mu)
+			for a := range row {
+				g[a] += row[a] * (y[i] - mu)
+				for b := range row {
+					h[a][b] += w * row[a] * row[b]
+				}
+			}
+		}
+		for a := 1; a < k; a++ {
+			g[a] -= logitRidge * beta[a]
+			h[a][a] += logitRidge
+		}
+		step, err := solveLinear(h, g)
+		if err != nil {
+			return nil, nil, false, err
+		}
+		maxStep := 0.0
+		for a := range beta {
+			beta[a] += step[a]
+			maxStep = math.Max(maxStep, math.Abs(step[a]))
+		}
+		if maxStep < 1e-8 {
+			converged = true
+			break
+		}
+	}
+	cov, err = invertMatrix(h)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	return beta, cov, converged, nil
+}
+
+// solveLinear 高斯消元（部分主元）解 a·x = b；a、b 不被修改
+func solveLinear(a [][]float64, b []float64) ([]float64, error) {
+	n := len(b)
+	m := make([][]float64, n)
+	for i := range a {
+		m[i] = append(append([]float64(nil), a[i]...), b[i])
+	}
+	for col := 0; col < n; col++ {
+		pivot := col
+		for r := col + 1; r < n; r++ {
+			if math.Abs(m[r][col]) > math.Abs(m[pivot][col]) {
+				pivot = r
+			}
+		}
+		if math.Abs(m[pivot][col]) < 1e-12 {
+			return nil, errors.New("矩阵奇异")
+		}
+		m[col], m[pivot] = m[pivot], m[col]
+		for r := 0; r < n; r++ {
+			if r == col {
+				continue
+			}
+			f := m[r][col] / m[col][col]
+			for c := col; c <= n; c++ {
+				m[r][c] -= f * m[col][c]
+			}
+		}
+	}
+	out := make([]float64, n)
+	for i := range out {
+		out[i] = m[i][n] / m[i][i]
+	}
+	return out, nil
+}
+
+func invertMatrix(a [][]float64) ([][]float64, error) {
+	n := len(a)
+	inv := make([][]float64, n)
+	for i := range inv {
+		inv[i] = make([]float64, n)
+	}
+	for c := 0; c < n; c++ {
+		e := make([]float64, n)
+		e[c] = 1
+		col, err := solveLinear(a, e)
+		if err != nil {
+			return nil, err
+		}
+		for r := 0; r < n; r++ {
+			inv[r][c] = col[r]
+		}
+	}
+	return inv, nil
+}
@@ -0,0 +1,145 @@
+package service
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"mem-test/internal/model"
+)
+
+// TestFitLogistic_RecoversCoefficients 大样本模拟数据上应能恢复真实系数
+func TestFitLogistic_RecoversCoefficients(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	var x [][]float64
+	var y []float64
+	for i := 0; i < 5000; i++ {
+		r := float64(i % 100)
+		p := 1 / (1 + math.Exp(-(1.0 - 0.04*r)))
+		v := 0.0
+		if rng.Float64() < p {
+			v = 1
+		}
+		x = append(x, []float64{1, r})
+		y = append(y, v)
+	}
+	beta, cov, converged, err := fitLogistic(x, y)
+	if err != nil || !converged {
+		t.Fatalf("fit failed: err=%v converged=%v", err, converged)
+	}
+	if math.Abs(beta[0]-1.0) > 0.15 || math.Abs(beta[1]+0.04) > 0.005 {
+		t.Fatalf("unexpected coefficients: %v", beta)
+	}
+	if cov[1][1] <= 0 {
+		t.Fatalf("slope variance should be positive: %v", cov[1][1])
+	}
+}
+
+func judgedTasks(flags []bool, versions []int) []model.Task {
+	tasks := make([]model.Task, len(flags))
+	for i, bad := range flags {
+		ok := !bad
+		tasks[i] = model.Task{Round: i, IsCorrect: &ok, RuleVersion: versions[i]}
+	}
+	return tasks
+}
+
+// TestLearningCurve 错误集中在前期 => 斜率显著为负；规则有变更时估计变更项
+func TestLearningCurve(t *testing.T) {
+	n := 60
+	flags := make([]bool, n)
+	versions := make([]int, n)
+	for i := range flags {
+		flags[i] = (i < 20 && i%4 != 3) || (i >= 20 && i%9 == 0)
+		versions[i] = 1
+		if i >= 30 {
+			versions[i] = 2
+		}
+	}
+	lc, ok := learningCurve(judgedTasks(flags, versions))
+	if !ok || !lc.Learning() {
+		t.Fatalf("expected significant learning, got ok=%v %+v", ok, lc)
+	}
+	if lc.CochranArmitageZ >= 0 || lc.CochranArmitageP >= 0.05 {
+		t.Fatalf("expected decreasing Cochran–Armitage trend, got z=%v p=%v", lc.CochranArmitageZ, lc.CochranArmitageP)
+	}
+	if lc.SinceChange == nil {
+		t.Fatalf("expected change-point term when rule_version varies")
+	}
+
+	flat := make([]bool, n)
+	ones := make([]int, n)
+	for i := range flat {
+		flat[i] = i%3 == 0
+		ones[i] = 1
+	}
+	lc, ok = learningCurve(judgedTasks(flat, ones))
+	if !ok || lc.Learning() || lc.SinceChange != nil {
+		t.Fatalf("flat error sequence should not show learning: ok=%v %+v", ok, lc)
+	}
+
+	if _, ok := learningCurve(judgedTasks(make([]bool, n), ones)); ok {
+		t.Fatalf("all-correct sequence has no estimable trend")
+	}
+}
+
+// TestLearningCurve_HighRuleMode rule_mode=high（5 次变更）下按已知系数模拟：
+// 斜率与段内恢复项应被恢复，且斜率 SE 接近只含 round 时的水平（段内轮数与 round 近乎正交），
+// 而累计变更次数与 round 近乎共线，用它作回归项时斜率 SE 会膨胀数倍
+func TestLearningCurve_HighRuleMode(t *testing.T) {
+	const (
+		n         = 3000
+		b0        = 0.5
+		slope     = -0.0005
+		perRound  = -0.006
+		tolerance = 3.0
+	)
+	_, versions := buildLotteryThresholdSchedule(n, "high")
+	rng := rand.New(rand.NewSource(7))
+	flags := make([]bool, n)
+	y := make([]float64, n)
+	roundOnly := make([][]float64, n)
+	cumulative := make([][]float64, n)
+	segStart := 0
+	for i := range flags {
+		if i > 0 && versions[i] != versions[i-1] {
+			segStart = i
+		}
+		p := 1 / (1 + math.Exp(-(b0 + slope*float64(i) + perRound*float64(i-segStart))))
+		flags[i] = rng.Float64() < p
+		if flags[i] {
+			y[i] = 1
+		}
+		roundOnly[i] = []float64{1, float64(i)}
+		cumulative[i] = []float64{1, float64(i), float64(versions[i] - 1)}
+	}
+	if versions[n-1] != 6 {
+		t.Fatalf("high schedule should have 5 changes, got final version %d", versions[n-1])
+	}
+
+	lc, ok := learningCurve(judgedTasks(flags, versions))
+	if !ok || !lc.Converged || lc.SinceChange == nil {
+		t.Fatalf("fit failed: ok=%v %+v", ok, lc)
+	}
+	if math.Abs(lc.Slope.Estimate-slope) > tolerance*lc.Slope.SE {
+		t.Fatalf("slope %v (SE %v) too far from true %v", lc.Slope.Estimate, lc.Slope.SE, slope)
+	}
+	if math.Abs(lc.SinceChange.Estimate-perRound) > tolerance*lc.SinceChange.SE {
+		t.Fatalf("since_change %v (SE %v) too far from true %v", lc.SinceChange.Estimate, lc.SinceChange.SE, perRound)
+	}
+
+	_, covRound, _, err := fitLogistic(roundOnly, y)
+	if err != nil {
+		t.Fatalf("round-only fit: %v", err)
+	}
+	if ref := math.Sqrt(covRound[1][1]); lc.Slope.SE > 1.25*ref {
+		t.Fatalf("slope SE %v inflated vs round-only SE %v", lc.Slope.SE, ref)
+	}
+	_, covCum, _, err := fitLogistic(cumulative, y)
+	if err != nil {
+		t.Fatalf("cumulative fit: %v", err)
+	}
+	if cum := math.Sqrt(covCum[1][1]); cum < 3*lc.Slope.SE {
+		t.Fatalf("expected cumulative-count design to inflate slope SE, got %v vs %v", cum, lc.Slope.SE)
+	}
+}
@@ -0,0 +1,45 @@
+package service
+
+// estimateTokens 本地粗略估算 token（中文约 1 字 1 token，英文约 4 字符 1 token）
+// 仅在服务端未返回 usage 时兜底，量级可比但不保证与具体 tokenizer 一致。
+func estimateTokens(s string) int {
+	n := 0
+	ascii := 0
+	for _, r := range s {
+		if r < 128 {
+			ascii++
+		} else {
+			n++
+		}
+	}
+	return n + (ascii+3)/4
+}
+
+// completeUsage 补全 usage 的 prompt/completion 拆分：
+// - 服务端已给出拆分：只补 total
+// - 只给出 total（如 Dify workflow）：按答案估算 completion，其余计入 prompt
+// - 完全缺失：prompt/completion 均本地估算
+// 后两种情况 Estimated=true。
+func completeUsage(u LLMUsage, prompt, answer string) LLMUsage {
+	if u.PromptTokens > 0 || u.CompletionTokens > 0 {
+		if u.TotalTokens == 0 {
+			u.TotalTokens = u.PromptTokens + u.CompletionTokens
+		}
+		return u
+	}
+	if u.TotalTokens > 0 {
+		completion := estimateTokens(answer)
+		if completion > u.TotalTokens {
+			completion = u.TotalTokens
+		}
+		u.CompletionTokens = completion
+		u.PromptTokens = u.TotalTokens - completion
+		u.Estimated = true
+		return u
+	}
+	u.PromptTokens = estimateTokens(prompt)
+	u.CompletionTokens = estimateTokens(answer)
+	u.TotalTokens = u.PromptTokens + u.CompletionTokens
+	u.Estimated = true
+	return u
+}
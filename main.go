@@ -18,12 +18,17 @@ func main() {
 	}
 
 	// 初始化数据库
-	if err := db.InitDB(cfg); err != nil {
+	store, err := db.Open(cfg.Database)
+	if err != nil {
 		log.Fatalf("初始化数据库失败: %v", err)
 	}
+	log.Printf("数据库初始化成功 driver=%s", db.DriverName(cfg.Database))
 
 	// 初始化服务
-	svcCtx := service.NewServiceContext(cfg)
+	svcCtx, err := service.NewServiceContext(cfg, store)
+	if err != nil {
+		log.Fatalf("初始化服务失败: %v", err)
+	}
 
 	// 初始化路由
 	r := router.SetupRouter(svcCtx)
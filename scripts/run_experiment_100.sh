@@ -28,6 +28,8 @@ body=$(cat <<JSON
 JSON
 )
 
+POLL_INTERVAL=${POLL_INTERVAL:-5}
+
 echo "[experiment] POST ${HOST}/api/experiments/run"
 tmp_body="$(mktemp)"
 http_code=$(curl -sS -o "${tmp_body}" -w "%{http_code}" -X POST "${HOST}/api/experiments/run" \
@@ -39,8 +41,8 @@ rm -f "${tmp_body}"
 
 resp_trim="$(printf '%s' "${resp}" | tr -d '\r\n\t ')"
 
-if [[ "${http_code}" != "200" ]] || [[ -z "${resp_trim}" ]]; then
-  echo "[experiment] 请求失败或返回非JSON"
+if [[ "${http_code}" != "202" ]] || [[ -z "${resp_trim}" ]]; then
+  echo "[experiment] 提交失败或返回非JSON"
   echo "HTTP_CODE: ${http_code}"
   echo "RAW_RESPONSE_BEGIN"
   echo "${resp}"
@@ -52,27 +54,64 @@ if [[ "${http_code}" != "200" ]] || [[ -z "${resp_trim}" ]]; then
   exit 1
 fi
 
-printf '%s' "$resp" | python3 -c '
+run_id=$(printf '%s' "${resp}" | python3 -c 'import json,sys; print(json.load(sys.stdin).get("run_id",""))')
+if [[ -z "${run_id}" ]]; then
+  echo "[experiment] 返回体缺少 run_id：${resp}"
+  exit 1
+fi
+echo "[experiment] 已提交 run_id=${run_id}，每 ${POLL_INTERVAL}s 轮询一次状态（Ctrl-C 会取消该 run）"
+
+cancel_run() {
+  echo ""
+  echo "[experiment] 取消 run_id=${run_id}"
+  curl -sS -X POST "${HOST}/api/experiments/runs/${run_id}/cancel" || true
+  echo ""
+  exit 130
+}
+trap cancel_run INT TERM
+
+status_json=""
+while true; do
+  status_json=$(curl -sS "${HOST}/api/experiments/runs/${run_id}/status" || true)
+  line=$(printf '%s' "${status_json}" | python3 -c '
 import json,sys
-s=sys.stdin.read()
-ss=s.strip()
-if not ss:
-    print("[experiment] 返回体为空/仅空白，无法解析 JSON")
-    sys.exit(1)
 try:
-    obj=json.loads(ss)
-except Exception as e:
-    print("[experiment] 返回体不是合法 JSON，解析失败：", repr(e))
-    print("RAW_RESPONSE_BEGIN")
-    print(s)
-    print("RAW_RESPONSE_END")
-    sys.exit(1)
+    o=json.load(sys.stdin)
+except Exception:
+    print("unknown|false|?")
+    sys.exit(0)
+print("%s|%s|round %s/%s errors=%s" % (o.get("status"), str(o.get("terminal")).lower(), o.get("completed_rounds"), o.get("runs_per_group"), o.get("error_count")))
+')
+  status="${line%%|*}"
+  rest="${line#*|}"
+  terminal="${rest%%|*}"
+  progress="${rest#*|}"
+  echo "[experiment] status=${status} ${progress}"
+  if [[ "${terminal}" == "true" ]]; then
+    break
+  fi
+  sleep "${POLL_INTERVAL}"
+done
+trap - INT TERM
 
-res=obj.get("result",{}) if isinstance(obj, dict) else {}
-print("run_id:", res.get("run_id") if isinstance(res, dict) else None)
-print("result_path:", (obj.get("result_path") if isinstance(obj, dict) else None) or (res.get("result_path") if isinstance(res, dict) else None))
-print("conclusion_path:", (obj.get("conclusion_path") if isinstance(obj, dict) else None) or (res.get("conclusion_path") if isinstance(res, dict) else None))
-print("verdict:", ((res.get("conclusion") or {}) if isinstance(res, dict) else {}).get("verdict"))
+printf '%s' "${status_json}" | python3 -c '
+import json,os,sys
+o=json.load(sys.stdin)
+print("run_id:", o.get("run_id"))
+print("status:", o.get("status"))
+if o.get("error_message"):
+    print("error:", o.get("error_message"))
+print("result_path:", o.get("result_path"))
+print("conclusion_path:", o.get("conclusion_path"))
+p=o.get("result_path") or ""
+if p and os.path.exists(p):
+    try:
+        res=json.load(open(p))
+        print("verdict:", (res.get("conclusion") or {}).get("verdict"))
+    except Exception:
+        pass
+if o.get("status") not in ("done", "cancelled"):
+    sys.exit(1)
 '
 
 echo "[experiment] 完成。请打开 outputs/experiment_run_<run_id>_conclusion.md 查看结论。"